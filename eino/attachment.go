@@ -0,0 +1,274 @@
+package eino
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/hildam/eino-history/model"
+	"github.com/hildam/eino-history/store/interfaces"
+)
+
+// DefaultMaxAttachmentSize 未设置上限时单个附件的最大字节数
+const DefaultMaxAttachmentSize = 32 << 20
+
+// AttachmentConfig 附件内容的存储配置
+type AttachmentConfig struct {
+	// Store 附件内容存储，为nil时使用数据库提供者的内容存储
+	Store interfaces.BlobStore
+	// MaxSize 单个附件的最大字节数，为0时使用 DefaultMaxAttachmentSize，小于0时不限制
+	MaxSize int64
+	// Previewers 上传时按附件类型生成预览，为nil时使用 DefaultPreviewers，为空时不生成预览
+	Previewers map[string]Previewer
+	// OnPreviewError 生成预览失败时的回调，预览失败不影响上传，可以为nil
+	OnPreviewError func(attachment *models.Attachment, err error)
+	// AllowedTypes 允许上传的类型，为空时不限制；元素可以是 MIME 类型、"image/*" 形式的通配或以 "." 开头的扩展名
+	AllowedTypes []string
+	// DeniedTypes 禁止上传的类型，格式同 AllowedTypes，优先于 AllowedTypes
+	DeniedTypes []string
+	// MaxSizeByType 按附件类型(image、audio、video、code、file)限制单个附件的最大字节数，与 MaxSize 同时生效
+	MaxSizeByType map[string]int64
+	// MaxConversationSize 单个会话中附件(包括回收站中消息的附件)的总字节数配额，为0时不限制
+	// 同一会话并发上传时总大小可能略微超过配额
+	MaxConversationSize int64
+	// AllowExtensionMismatch 允许文件扩展名与检测到的内容类型不符，默认拒绝
+	AllowExtensionMismatch bool
+}
+
+// SetAttachmentConfig 设置附件内容的存储和大小限制，为nil时恢复默认配置
+// 已上传的附件按内容哈希读取，切换存储后需自行迁移已有内容
+// 参数:
+//   - config: 附件配置
+func (x *History) SetAttachmentConfig(config *AttachmentConfig) {
+	cfg := AttachmentConfig{}
+	if config != nil {
+		cfg = *config
+	}
+	if cfg.Store == nil {
+		cfg.Store = x.dbProvider.GetBlobStore()
+	}
+	if cfg.MaxSize == 0 {
+		cfg.MaxSize = DefaultMaxAttachmentSize
+	}
+	if cfg.Previewers == nil {
+		cfg.Previewers = DefaultPreviewers()
+	}
+	x.attach = cfg
+}
+
+// UploadAttachment 流式上传附件内容并关联到消息，相同内容在存储中只保存一份，上传后按附件类型生成预览
+// 上传前根据内容检测 MIME 类型和附件类型，并按附件配置校验类型、扩展名、大小和会话配额
+// 开启附件摄取时上传后在后台提取文本、分块并生成摘要
+// 参数:
+//   - msgID: 附件所属消息ID
+//   - attachment: 附件信息，FileName 由调用方填写，MimeType 为调用方声明的类型，上传时替换为检测结果；
+//     AttachmentType 由检测填充，文本内容可以由调用方指定为 code；
+//     AttachID、FileSize、StorageType、StoragePath、ContentHash 由上传填充，Thumbnail、PreviewText、Metadata 由预览填充，
+//     IngestStatus 等摄取字段由摄取填充
+//   - r: 附件内容
+//
+// 返回:
+//   - error: 如果附件为空、消息不存在、校验失败(*AttachmentError，超过大小限制时 errors.Is(err, models.ErrBlobTooLarge) 成立)
+//     或上传过程中发生错误
+func (x *History) UploadAttachment(msgID string, attachment *models.Attachment, r io.Reader) (err error) {
+	var convID string
+	defer func() { x.auditCall(&err, models.AuditAttachmentUpload, convID, attachIDOf(attachment)) }()
+
+	if attachment == nil {
+		return fmt.Errorf("附件为空")
+	}
+	msg, err := x.mr.GetByID(msgID)
+	if err != nil {
+		return err
+	}
+	convID = msg.ConversationID
+	if err := x.authorize(convID); err != nil {
+		return err
+	}
+
+	if err := x.storeAttachment(attachment, msgID, convID, r); err != nil {
+		return err
+	}
+	if err := x.dbProvider.Transaction(func(tx interfaces.TxStores) error {
+		return createAttachment(tx, msgID, attachment)
+	}); err != nil {
+		return err
+	}
+	x.scheduleIngest(attachment.AttachID)
+	return nil
+}
+
+// attachmentInConversation 判断附件是否通过消息关联属于指定会话，包括回收站中的消息
+func (x *History) attachmentInConversation(attachment *models.Attachment, convID string) (bool, error) {
+	links, err := x.mar.ListByAttachment(attachment.AttachID)
+	if err != nil {
+		return false, err
+	}
+	msgIDs := make([]string, 0, len(links)+1)
+	if attachment.MessageID != "" {
+		msgIDs = append(msgIDs, attachment.MessageID)
+	}
+	for _, link := range links {
+		msgIDs = append(msgIDs, link.MessageID)
+	}
+
+	for _, msgID := range msgIDs {
+		msg, err := x.mr.GetByID(msgID)
+		if err != nil {
+			if msg, err = x.mr.GetDeleted(msgID); err != nil {
+				continue
+			}
+		}
+		if msg.ConversationID == convID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// attachIDOf 返回附件ID，附件为nil时返回空
+func attachIDOf(attachment *models.Attachment) string {
+	if attachment == nil {
+		return ""
+	}
+	return attachment.AttachID
+}
+
+// storeAttachment 校验附件并保存内容，填充存储、预览和摄取状态字段，不创建附件记录
+// 附件记录未能创建时内容仍保留在存储中，相同内容再次上传时复用
+func (x *History) storeAttachment(attachment *models.Attachment, msgID, convID string, r io.Reader) error {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	head = head[:n]
+	if err := x.inspectAttachment(attachment, head); err != nil {
+		return err
+	}
+	limit, quota, err := x.uploadLimit(attachment, convID)
+	if err != nil {
+		return err
+	}
+
+	info, err := x.attach.Store.Put(io.MultiReader(bytes.NewReader(head), r), limit)
+	if errors.Is(err, models.ErrBlobTooLarge) {
+		return x.sizeError(attachment, limit, quota)
+	}
+	if err != nil {
+		return err
+	}
+
+	attachment.MessageID = msgID
+	attachment.FileSize = info.Size
+	attachment.StorageType = info.StorageType
+	attachment.StoragePath = info.Path
+	attachment.ContentHash = info.Hash
+	if attachment.CreatedAt == 0 {
+		attachment.CreatedAt = time.Now().Unix()
+	}
+	x.previewAttachment(attachment)
+	if x.ingest != nil {
+		attachment.IngestStatus = models.IngestStatusPending
+	}
+	return nil
+}
+
+// createAttachment 在事务中创建附件记录并关联到消息
+func createAttachment(tx interfaces.TxStores, msgID string, attachment *models.Attachment) error {
+	if err := tx.GetAttachmentStore().Create(attachment); err != nil {
+		return err
+	}
+	return tx.GetMessageAttachmentStore().Create(&models.MessageAttachment{MessageID: msgID, AttachmentID: attachment.AttachID})
+}
+
+// DownloadAttachment 流式读取附件内容，调用方负责关闭返回的读取器
+// 参数:
+//   - attachID: 附件ID
+//
+// 返回:
+//   - io.ReadCloser: 附件内容
+//   - *models.Attachment: 附件信息
+//   - error: 如果附件不存在、没有保存内容或读取过程中发生错误
+func (x *History) DownloadAttachment(attachID string) (rc io.ReadCloser, attachment *models.Attachment, err error) {
+	var convID string
+	defer func() { x.auditCall(&err, models.AuditAttachmentDownload, convID, attachID) }()
+
+	attachment, err = x.ar.GetByID(attachID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if convID, err = x.attachmentConversation(attachment); err != nil {
+		return nil, nil, err
+	}
+	if err := x.authorizeAny(convID); err != nil {
+		return nil, nil, err
+	}
+	if attachment.ContentHash == "" {
+		return nil, nil, fmt.Errorf("附件 %s 没有保存内容", attachID)
+	}
+
+	rc, err = x.attach.Store.Get(attachment.ContentHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	return rc, attachment, nil
+}
+
+// PresignAttachment 生成附件内容的临时下载链接，调用方可直接从对象存储下载
+// 参数:
+//   - attachID: 附件ID
+//   - expires: 链接有效期
+//
+// 返回:
+//   - string: 下载链接
+//   - error: 如果附件不存在、没有保存内容或附件存储不支持生成下载链接
+func (x *History) PresignAttachment(attachID string, expires time.Duration) (link string, err error) {
+	var convID string
+	defer func() { x.auditCall(&err, models.AuditAttachmentDownload, convID, attachID) }()
+
+	attachment, err := x.ar.GetByID(attachID)
+	if err != nil {
+		return "", err
+	}
+	if convID, err = x.attachmentConversation(attachment); err != nil {
+		return "", err
+	}
+	if err := x.authorizeAny(convID); err != nil {
+		return "", err
+	}
+	if attachment.ContentHash == "" {
+		return "", fmt.Errorf("附件 %s 没有保存内容", attachID)
+	}
+
+	presigner, ok := x.attach.Store.(interfaces.BlobPresigner)
+	if !ok {
+		return "", fmt.Errorf("附件存储不支持生成下载链接")
+	}
+	return presigner.PresignGet(attachment.ContentHash, expires)
+}
+
+// attachmentConversation 获取附件所属会话，附件没有记录消息ID时使用第一个关联的消息
+func (x *History) attachmentConversation(attachment *models.Attachment) (string, error) {
+	msgID := attachment.MessageID
+	if msgID == "" {
+		links, err := x.mar.ListByAttachment(attachment.AttachID)
+		if err != nil {
+			return "", err
+		}
+		if len(links) == 0 {
+			return "", fmt.Errorf("附件 %s 没有关联的消息", attachment.AttachID)
+		}
+		msgID = links[0].MessageID
+	}
+
+	msg, err := x.mr.GetByID(msgID)
+	if err != nil {
+		if msg, err = x.mr.GetDeleted(msgID); err != nil {
+			return "", err
+		}
+	}
+	return msg.ConversationID, nil
+}
@@ -0,0 +1,189 @@
+package eino
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/hildam/eino-history/model"
+)
+
+// auditVerifyBatch 校验审计链时每批读取的事件数量
+const auditVerifyBatch = 500
+
+// Actor 操作者身份，通过 WithActor 传给历史实例
+type Actor struct {
+	// ID 操作者ID，如用户ID、管理员ID或服务账号
+	ID string
+	// Source 操作来源，如客户端IP或调用方服务名，可以为空
+	Source string
+}
+
+// auditState 审计日志配置，WithOwner、WithActor 返回的实例与原实例共享，SetAudit 对全部实例生效
+type auditState struct {
+	mu     sync.RWMutex
+	config *AuditConfig
+}
+
+// AuditConfig 审计日志配置
+type AuditConfig struct {
+	// ExcludeActions 不记录的操作类型，如 models.AuditConversationRead，为空时记录全部操作
+	ExcludeActions []string
+	// Strict 为 true 时审计事件写入失败会使操作返回错误，默认只回调 OnError
+	// 注意操作本身已经执行，严格模式只保证调用方能感知到审计缺失
+	Strict bool
+	// OnError 审计事件写入失败时的回调，可以为nil
+	OnError func(event *models.AuditEvent, err error)
+}
+
+// AuditVerification 审计链校验结果
+type AuditVerification struct {
+	// Valid 哈希链是否完整
+	Valid bool
+	// Checked 已校验的事件数
+	Checked int64
+	// LastSeq 最后一条有效事件的序号
+	LastSeq int64
+	// BrokenSeq 第一条校验失败的事件序号，链完整时为0
+	BrokenSeq int64
+	// Reason 校验失败的原因
+	Reason string
+}
+
+// WithActor 返回以指定操作者身份记录审计事件的历史实例
+// 未指定操作者时使用归属范围中的用户ID。返回的实例与原实例共享数据库连接和审计配置
+// 参数:
+//   - actor: 操作者身份
+//
+// 返回:
+//   - *History: 携带操作者身份的历史实例
+func (x *History) WithActor(actor Actor) *History {
+	scoped := *x
+	scoped.actor = &actor
+	return &scoped
+}
+
+// SetAudit 开启审计日志，为nil时关闭，对共享审计配置的全部实例生效
+// 开启后每个读写会话、消息、评价、标签和文件夹的方法都会追加一条审计事件，失败的操作会记录错误信息
+// 参数:
+//   - config: 审计日志配置
+func (x *History) SetAudit(config *AuditConfig) {
+	var cfg *AuditConfig
+	if config != nil {
+		copied := *config
+		cfg = &copied
+	}
+	x.audit.mu.Lock()
+	defer x.audit.mu.Unlock()
+	x.audit.config = cfg
+}
+
+// QueryAudit 按条件查询审计事件，限定归属范围时只返回该租户的事件
+// 参数:
+//   - query: 时间范围、操作者、会话和操作类型等查询条件，为nil时返回全部事件
+//
+// 返回:
+//   - []*models.AuditEvent: 按序号排序的事件列表
+//   - error: 如果查询过程中发生错误
+func (x *History) QueryAudit(query *models.AuditQuery) ([]*models.AuditEvent, error) {
+	scoped := models.AuditQuery{}
+	if query != nil {
+		scoped = *query
+	}
+	if x.owner != nil {
+		scoped.TenantID = x.owner.TenantID
+	}
+	return x.adr.Query(&scoped)
+}
+
+// VerifyAudit 从第一条事件开始校验审计链，发现序号缺口、前一条哈希不匹配或哈希被篡改时停止
+// 返回:
+//   - *AuditVerification: 校验结果
+//   - error: 如果读取过程中发生错误
+func (x *History) VerifyAudit() (*AuditVerification, error) {
+	result := &AuditVerification{Valid: true}
+	var prev *models.AuditEvent
+	for {
+		events, err := x.adr.Range(result.LastSeq, auditVerifyBatch)
+		if err != nil {
+			return result, err
+		}
+		for _, event := range events {
+			reason := ""
+			switch {
+			case event.Seq != result.LastSeq+1:
+				reason = fmt.Sprintf("序号不连续，缺少 %d", result.LastSeq+1)
+			case prev != nil && event.PrevHash != prev.Hash:
+				reason = "前一条事件的哈希不匹配"
+			case prev == nil && event.PrevHash != "":
+				reason = "第一条事件的前一条哈希不为空"
+			case event.ComputeHash() != event.Hash:
+				reason = "事件内容与哈希不匹配"
+			}
+			if reason != "" {
+				result.Valid = false
+				result.BrokenSeq = result.LastSeq + 1
+				result.Reason = reason
+				return result, nil
+			}
+			result.Checked++
+			result.LastSeq = event.Seq
+			prev = event
+		}
+		if len(events) == 0 {
+			return result, nil
+		}
+	}
+}
+
+// auditCall 在方法返回时记录审计事件，用于 defer，errp 指向方法的错误返回值
+func (x *History) auditCall(errp *error, action, convID, targetID string) {
+	*errp = x.audited(&models.AuditEvent{Action: action, ConversationID: convID, TargetID: targetID}, *errp)
+}
+
+// audited 补全操作者和租户后追加审计事件，并返回操作的最终错误
+// 未开启审计或操作类型被排除时直接返回原错误
+func (x *History) audited(event *models.AuditEvent, err error) error {
+	x.audit.mu.RLock()
+	config := x.audit.config
+	x.audit.mu.RUnlock()
+	if config == nil {
+		return err
+	}
+	for _, action := range config.ExcludeActions {
+		if action == event.Action {
+			return err
+		}
+	}
+
+	if x.actor != nil {
+		event.Actor, event.ActorSource = x.actor.ID, x.actor.Source
+	} else if x.owner != nil {
+		event.Actor = x.owner.UserID
+	}
+	if event.TenantID == "" && x.owner != nil {
+		event.TenantID = x.owner.TenantID
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+
+	if auditErr := x.adr.Append(event); auditErr != nil {
+		if config.OnError != nil {
+			config.OnError(event, auditErr)
+		}
+		if config.Strict && err == nil {
+			return fmt.Errorf("记录审计事件失败: %w", auditErr)
+		}
+	}
+	return err
+}
+
+// auditDetail 将审计详情序列化为JSON，失败时忽略详情
+func auditDetail(v interface{}) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return data
+}
@@ -1,7 +1,12 @@
 package eino
 
 import (
+	"errors"
+	"fmt"
+
+	"github.com/cloudwego/eino/components/embedding"
 	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
 	"github.com/hildam/eino-history/model"
 	"github.com/hildam/eino-history/store/interfaces"
 	"github.com/hildam/eino-history/store/provider"
@@ -11,7 +16,49 @@ import (
 type History struct {
 	mr         interfaces.MessageStore
 	cr         interfaces.ConversationStore
+	ar         interfaces.AttachmentStore
+	mar        interfaces.MessageAttachmentStore
+	sr         interfaces.SearchStore
+	er         interfaces.EmbeddingStore
+	fr         interfaces.FeedbackStore
+	tr         interfaces.TagStore
+	fdr        interfaces.FolderStore
+	adr        interfaces.AuditStore
+	acr        interfaces.AttachmentChunkStore
 	dbProvider provider.Provider // 持有数据库提供者实例
+	embedder   embedding.Embedder
+	index      *vectorIndex
+	owner      *models.Owner     // 归属范围，为nil时不限制
+	titles     *titleState       // 自动标题生成，为nil时关闭
+	retention  *retentionState   // 保留策略的累计指标
+	audit      *auditState       // 审计日志配置，各实例共享
+	actor      *Actor            // 审计事件的操作者身份，为nil时使用归属范围中的用户ID
+	attach     AttachmentConfig  // 附件内容的存储配置
+	ingest     *ingestState      // 附件摄取，为nil时关闭
+	multimodal *MultimodalConfig // 加载历史时填充多模态内容，为nil时关闭
+}
+
+// newHistory 使用数据库提供者的各个存储库创建历史实例
+func newHistory(dbProvider provider.Provider) *History {
+	x := &History{
+		mr:         dbProvider.GetMessageStore(),
+		cr:         dbProvider.GetConversationStore(),
+		ar:         dbProvider.GetAttachmentStore(),
+		mar:        dbProvider.GetMessageAttachmentStore(),
+		sr:         dbProvider.GetSearchStore(),
+		er:         dbProvider.GetEmbeddingStore(),
+		fr:         dbProvider.GetFeedbackStore(),
+		tr:         dbProvider.GetTagStore(),
+		fdr:        dbProvider.GetFolderStore(),
+		adr:        dbProvider.GetAuditStore(),
+		acr:        dbProvider.GetAttachmentChunkStore(),
+		dbProvider: dbProvider,
+		index:      newVectorIndex(),
+		retention:  &retentionState{},
+		audit:      &auditState{},
+	}
+	x.SetAttachmentConfig(nil)
+	return x
 }
 
 // NewDefaultEinoHistory 创建一个使用MySQL作为默认存储的历史实例
@@ -40,11 +87,7 @@ func NewDefaultEinoHistory(dsn, loglevel string) *History {
 		panic(err)
 	}
 
-	return &History{
-		mr:         dbProvider.GetMessageStore(),
-		cr:         dbProvider.GetConversationStore(),
-		dbProvider: dbProvider,
-	}
+	return newHistory(dbProvider)
 }
 
 // NewEinoHistoryWithProvider 创建一个使用指定数据库提供者的历史实例
@@ -69,17 +112,15 @@ func NewEinoHistoryWithProvider(dsn string, dbType provider.Type, debug bool, lo
 		panic(err)
 	}
 
-	return &History{
-		mr:         dbProvider.GetMessageStore(),
-		cr:         dbProvider.GetConversationStore(),
-		dbProvider: dbProvider,
-	}
+	return newHistory(dbProvider)
 }
 
-// Close 关闭数据库连接
+// Close 等待后台标题生成和附件摄取结束后关闭数据库连接
 // 返回:
 //   - error: 如果关闭过程中发生错误
 func (x *History) Close() error {
+	x.WaitTitles()
+	x.WaitIngestion()
 	if x.dbProvider != nil {
 		return x.dbProvider.Close()
 	}
@@ -87,18 +128,163 @@ func (x *History) Close() error {
 }
 
 // SaveMessage 存储消息
+// 消息的 MultiContent 中的图片、音频、视频和文件片段会创建附件并关联到消息，片段顺序保存在消息元数据中；
+// Content 为空时使用文本片段拼接的内容
 // 参数:
 //   - mess: 要存储的消息
 //   - convID: 会话ID
 //
 // 返回:
 //   - error: 如果存储过程中发生错误
-func (x *History) SaveMessage(mess *schema.Message, convID string) error {
-	return x.mr.Create(&models.Message{
+func (x *History) SaveMessage(mess *schema.Message, convID string) (err error) {
+	msg := &models.Message{
 		Role:           string(mess.Role),
 		Content:        mess.Content,
 		ConversationID: convID,
-	})
+	}
+	defer func() { x.auditCall(&err, models.AuditMessageCreate, convID, msg.MsgID) }()
+
+	if x.owner != nil {
+		if _, err := x.ensureConversation(convID); err != nil {
+			return err
+		}
+	}
+	layout, pending, err := x.captureParts(mess, convID)
+	if err != nil {
+		return err
+	}
+	if msg.Content == "" {
+		msg.Content = partsText(layout)
+	}
+	msg.Metadata = encodeMessageExtra(mess, layout, msg.Content)
+
+	// 消息、附件记录和关联在一个事务中创建，附件内容先于事务保存
+	msg.MsgID = uuid.NewString()
+	err = x.storePartAttachments(msg.MsgID, convID, pending)
+	if err == nil {
+		err = x.dbProvider.Transaction(func(tx interfaces.TxStores) error {
+			if err := tx.GetMessageStore().Create(msg); err != nil {
+				return err
+			}
+			return createPartAttachments(tx, msg.MsgID, pending)
+		})
+	}
+	if err := x.finishPartAttachments(convID, pending, err); err != nil {
+		return err
+	}
+	x.scheduleTitle(convID, mess.Role)
+	return nil
+}
+
+// SaveMessages 批量存储同一会话的消息，适用于导入历史或一轮对话产生多条工具调用消息的场景
+// 每条消息的多模态片段按 SaveMessage 的规则处理；片段无效或附件内容保存失败的消息不写入，其余消息、
+// 附件记录和关联在一个事务中按列表顺序写入并更新会话的活动字段，任一写入失败时整批回滚。审计事件按消息逐条记录
+// 参数:
+//   - mess: 要存储的消息列表
+//   - convID: 会话ID
+//
+// 返回:
+//   - error: 部分消息失败时为 *models.BatchError，未列出的消息均已存储
+func (x *History) SaveMessages(mess []*schema.Message, convID string) error {
+	if x.owner != nil {
+		if _, err := x.ensureConversation(convID); err != nil {
+			return x.audited(&models.AuditEvent{Action: models.AuditMessageCreate, ConversationID: convID}, err)
+		}
+	}
+
+	errs := make([]error, len(mess))
+	ids := make([]string, len(mess))
+	msgs := make([]*models.Message, 0, len(mess))
+	index := make([]int, 0, len(mess)) // msgs 中每条消息在 mess 中的位置
+	pending := make([][]*pendingAttachment, 0, len(mess))
+	for i, m := range mess {
+		if m == nil {
+			errs[i] = fmt.Errorf("消息为空")
+			continue
+		}
+		layout, attachments, err := x.captureParts(m, convID)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		msg := &models.Message{
+			MsgID:          uuid.NewString(),
+			Role:           string(m.Role),
+			Content:        m.Content,
+			ConversationID: convID,
+		}
+		if msg.Content == "" {
+			msg.Content = partsText(layout)
+		}
+		msg.Metadata = encodeMessageExtra(m, layout, msg.Content)
+		ids[i] = msg.MsgID
+		// 附件内容先于事务保存
+		if err := x.storePartAttachments(msg.MsgID, convID, attachments); err != nil {
+			errs[i] = x.finishPartAttachments(convID, attachments, err)
+			continue
+		}
+		msgs = append(msgs, msg)
+		index = append(index, i)
+		pending = append(pending, attachments)
+	}
+
+	if len(msgs) > 0 {
+		failedAt := -1 // 附件写入失败的消息在 msgs 中的位置
+		err := x.dbProvider.Transaction(func(tx interfaces.TxStores) error {
+			if err := tx.GetMessageStore().CreateBatch(msgs); err != nil {
+				return err
+			}
+			for k, msg := range msgs {
+				if err := createPartAttachments(tx, msg.MsgID, pending[k]); err != nil {
+					failedAt = k
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			var batchErr *models.BatchError
+			if errors.As(err, &batchErr) {
+				for _, item := range batchErr.Failed {
+					errs[index[item.Index]] = item.Err
+				}
+			} else if failedAt >= 0 {
+				errs[index[failedAt]] = err
+			}
+			// 同一事务中的其他消息随之回滚
+			for _, i := range index {
+				if errs[i] == nil {
+					errs[i] = fmt.Errorf("同批消息写入失败，已回滚: %w", err)
+				}
+			}
+		}
+		for k, i := range index {
+			errs[i] = x.finishPartAttachments(convID, pending[k], errs[i])
+		}
+	}
+
+	assistant := false
+	for i := range mess {
+		if ids[i] == "" {
+			continue
+		}
+		errs[i] = x.audited(&models.AuditEvent{
+			Action: models.AuditMessageCreate, ConversationID: convID, TargetID: ids[i],
+		}, errs[i])
+		if errs[i] == nil && mess[i].Role == schema.Assistant {
+			assistant = true
+		}
+	}
+	var failed []*models.BatchItemError
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, &models.BatchItemError{Index: i, ID: ids[i], Err: err})
+		}
+	}
+	if assistant {
+		x.scheduleTitle(convID, schema.Assistant)
+	}
+	return models.NewBatchError(len(mess), failed)
 }
 
 // GetHistory 根据会话ID获取聊天历史
@@ -107,14 +293,15 @@ func (x *History) SaveMessage(mess *schema.Message, convID string) error {
 //   - limit: 返回的消息数量上限，0表示使用默认值(100)
 //
 // 返回:
-//   - []*schema.Message: 消息列表
+//   - []*schema.Message: 消息列表，开启多模态内容(SetMultimodal)时消息关联的附件填充到 MultiContent
 //   - error: 如果获取过程中发生错误
 func (x *History) GetHistory(convID string, limit int) (list []*schema.Message, err error) {
+	defer x.auditCall(&err, models.AuditConversationRead, convID, "")
 	if limit == 0 {
 		limit = 100
 	}
 	// 如果convID数据不存在，则创建
-	_, err = x.cr.FirstOrCreat(convID)
+	_, err = x.ensureConversation(convID)
 	if err != nil {
 		return
 	}
@@ -124,6 +311,9 @@ func (x *History) GetHistory(convID string, limit int) (list []*schema.Message,
 		return
 	}
 	list = messageList2ChatHistory(mess)
+	if x.multimodal != nil {
+		err = x.hydrateMessages(mess, list)
+	}
 	return
 }
 
@@ -133,7 +323,14 @@ func (x *History) GetHistory(convID string, limit int) (list []*schema.Message,
 //
 // 返回:
 //   - error: 如果创建过程中发生错误
-func (x *History) CreateConversation(conv *models.Conversation) error {
+func (x *History) CreateConversation(conv *models.Conversation) (err error) {
+	defer func() { x.auditCall(&err, models.AuditConversationCreate, conv.ConvID, "") }()
+	if x.owner != nil {
+		conv.TenantID = x.owner.TenantID
+		if x.owner.UserID != "" {
+			conv.UserID = x.owner.UserID
+		}
+	}
 	return x.cr.Create(conv)
 }
 
@@ -143,17 +340,51 @@ func (x *History) CreateConversation(conv *models.Conversation) error {
 //
 // 返回:
 //   - error: 如果更新过程中发生错误
-func (x *History) UpdateConversation(conv *models.Conversation) error {
+func (x *History) UpdateConversation(conv *models.Conversation) (err error) {
+	defer x.auditCall(&err, models.AuditConversationUpdate, conv.ConvID, "")
+	if x.owner != nil {
+		existing, err := x.cr.GetByID(conv.ConvID)
+		if err != nil {
+			return err
+		}
+		if !x.owner.Owns(existing) {
+			return ErrForbidden
+		}
+		// 限定归属范围时不允许转移会话归属
+		conv.TenantID = existing.TenantID
+		conv.UserID = existing.UserID
+	}
 	return x.cr.Update(conv)
 }
 
+// PatchConversation 部分更新对话，只写入 patch 中不为nil的字段
+// patch.Version 不为nil时作为期望版本，会话已被其他写入修改时返回 models.ErrVersionConflict，调用方可重新读取后重试
+// 参数:
+//   - convID: 会话ID
+//   - patch: 要更新的字段
+//
+// 返回:
+//   - *models.Conversation: 更新后的会话，Version 为新的版本号
+//   - error: 如果会话不存在、版本冲突或更新过程中发生错误
+func (x *History) PatchConversation(convID string, patch *models.ConversationPatch) (conv *models.Conversation, err error) {
+	defer x.auditCall(&err, models.AuditConversationUpdate, convID, "")
+	if err := x.authorize(convID); err != nil {
+		return nil, err
+	}
+	return x.cr.Patch(convID, patch)
+}
+
 // ArchiveConversation 归档对话
 // 参数:
 //   - convID: 要归档的对话ID
 //
 // 返回:
 //   - error: 如果归档过程中发生错误
-func (x *History) ArchiveConversation(convID string) error {
+func (x *History) ArchiveConversation(convID string) (err error) {
+	defer x.auditCall(&err, models.AuditConversationArchive, convID, "")
+	if err := x.authorize(convID); err != nil {
+		return err
+	}
 	return x.cr.Archive(convID)
 }
 
@@ -163,7 +394,11 @@ func (x *History) ArchiveConversation(convID string) error {
 //
 // 返回:
 //   - error: 如果取消归档过程中发生错误
-func (x *History) UnarchiveConversation(convID string) error {
+func (x *History) UnarchiveConversation(convID string) (err error) {
+	defer x.auditCall(&err, models.AuditConversationUnarchive, convID, "")
+	if err := x.authorize(convID); err != nil {
+		return err
+	}
 	return x.cr.Unarchive(convID)
 }
 
@@ -173,7 +408,11 @@ func (x *History) UnarchiveConversation(convID string) error {
 //
 // 返回:
 //   - error: 如果置顶过程中发生错误
-func (x *History) PinConversation(convID string) error {
+func (x *History) PinConversation(convID string) (err error) {
+	defer x.auditCall(&err, models.AuditConversationPin, convID, "")
+	if err := x.authorize(convID); err != nil {
+		return err
+	}
 	return x.cr.Pin(convID)
 }
 
@@ -183,11 +422,15 @@ func (x *History) PinConversation(convID string) error {
 //
 // 返回:
 //   - error: 如果取消置顶过程中发生错误
-func (x *History) UnpinConversation(convID string) error {
+func (x *History) UnpinConversation(convID string) (err error) {
+	defer x.auditCall(&err, models.AuditConversationUnpin, convID, "")
+	if err := x.authorize(convID); err != nil {
+		return err
+	}
 	return x.cr.Unpin(convID)
 }
 
-// ListConversations 获取对话列表
+// ListConversations 获取对话列表，限定归属范围时只返回范围内的对话
 // 参数:
 //   - offset: 分页偏移量
 //   - limit: 返回对话数量上限
@@ -195,6 +438,33 @@ func (x *History) UnpinConversation(convID string) error {
 // 返回:
 //   - []*models.Conversation: 对话列表
 //   - error: 如果获取过程中发生错误
-func (x *History) ListConversations(offset, limit int) ([]*models.Conversation, error) {
-	return x.cr.List(offset, limit)
+func (x *History) ListConversations(offset, limit int) (list []*models.Conversation, err error) {
+	defer x.auditCall(&err, models.AuditConversationList, "", "")
+	return x.listConversations(offset, limit)
+}
+
+// QueryConversations 按条件查询对话列表，结果附带总数、消息数和最后一条消息预览
+// 限定归属范围时查询条件中的归属会被替换为当前范围
+// 参数:
+//   - query: 过滤、排序和游标分页条件，为nil时按更新时间降序返回第一页
+//
+// 返回:
+//   - *models.ConversationPage: 一页对话及下一页游标
+//   - error: 如果查询过程中发生错误
+func (x *History) QueryConversations(query *models.ConversationQuery) (page *models.ConversationPage, err error) {
+	defer x.auditCall(&err, models.AuditConversationList, "", "")
+	return x.queryConversations(query)
+}
+
+// queryConversations 按当前归属范围查询对话列表，不记录审计事件
+func (x *History) queryConversations(query *models.ConversationQuery) (*models.ConversationPage, error) {
+	if x.owner != nil {
+		scoped := models.ConversationQuery{}
+		if query != nil {
+			scoped = *query
+		}
+		scoped.Owner = x.owner
+		query = &scoped
+	}
+	return x.cr.Query(query)
 }
@@ -0,0 +1,72 @@
+package eino
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+
+	"github.com/cloudwego/eino/components/embedding"
+	"github.com/hildam/eino-history/store/common/fulltext"
+)
+
+// DefaultHashEmbedderDimension HashEmbedder 的默认向量维度
+const DefaultHashEmbedderDimension = 256
+
+// HashEmbedder 基于特征哈希的确定性向量化实现
+// 相同文本总是得到相同向量，词项重叠越多的文本余弦相似度越高。
+// 不依赖外部模型服务，适用于测试和离线环境，不适合生产环境的语义检索
+type HashEmbedder struct {
+	dimension int
+}
+
+var _ embedding.Embedder = (*HashEmbedder)(nil)
+
+// NewHashEmbedder 创建确定性的哈希向量化器
+// 参数:
+//   - dimension: 向量维度，小于等于0时使用 DefaultHashEmbedderDimension
+//
+// 返回:
+//   - *HashEmbedder: 新创建的向量化器
+func NewHashEmbedder(dimension int) *HashEmbedder {
+	if dimension <= 0 {
+		dimension = DefaultHashEmbedderDimension
+	}
+	return &HashEmbedder{dimension: dimension}
+}
+
+// EmbedStrings 将文本列表转换为归一化向量
+func (e *HashEmbedder) EmbedStrings(_ context.Context, texts []string, _ ...embedding.Option) ([][]float64, error) {
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		vec := make([]float64, e.dimension)
+		for _, token := range fulltext.Tokenize(text) {
+			h := fnv.New64a()
+			_, _ = h.Write([]byte(token))
+			sum := h.Sum64()
+			// 使用哈希的最高位决定符号，减少哈希冲突带来的偏差
+			sign := 1.0
+			if sum>>63 == 1 {
+				sign = -1.0
+			}
+			vec[sum%uint64(e.dimension)] += sign
+		}
+		vectors[i] = normalize(vec)
+	}
+	return vectors, nil
+}
+
+// normalize 将向量归一化为单位长度，零向量原样返回
+func normalize(vec []float64) []float64 {
+	var norm float64
+	for _, v := range vec {
+		norm += v * v
+	}
+	if norm == 0 {
+		return vec
+	}
+	norm = math.Sqrt(norm)
+	for i := range vec {
+		vec[i] /= norm
+	}
+	return vec
+}
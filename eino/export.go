@@ -0,0 +1,394 @@
+package eino
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/hildam/eino-history/model"
+)
+
+// exportPageSize 导出时分页读取消息的页大小
+const exportPageSize = 100
+
+// ExportOptions 微调数据集导出选项
+type ExportOptions struct {
+	// ConvIDs 指定导出的会话ID，为空时导出全部会话
+	ConvIDs []string
+	// Roles 仅导出指定角色的消息，为空时不限制
+	Roles []schema.RoleType
+	// OnlySent 仅导出状态为 sent 的消息
+	OnlySent bool
+	// OnlyRated 仅导出包含已评价消息的会话
+	OnlyRated bool
+	// IsRated 判断消息是否已被评价，为空时检查消息是否有评价记录，或消息元数据中的 rating 或 feedback 字段
+	IsRated func(msg *models.Message) bool
+	// Since 消息创建时间下限，零值表示不限制
+	Since time.Time
+	// Until 消息创建时间上限，零值表示不限制
+	Until time.Time
+	// ActiveBranchOnly 仅导出当前活跃分支上的消息，跳过变体和被替换的分支
+	ActiveBranchOnly bool
+	// Tools 写入每条样本的工具定义
+	Tools []*schema.ToolInfo
+	// RedactPII 是否对消息内容进行个人信息脱敏，工具调用参数只脱敏其中的字符串值，
+	// 数字等其他类型的值保持不变，保证参数仍是合法的 JSON
+	RedactPII bool
+	// Redactor 自定义脱敏函数，为空时使用 RedactPII，同样只作用于工具调用参数中的字符串值
+	Redactor func(string) string
+	// ValidationRatio 验证集占比，取值范围 [0, 1)，为0时不拆分
+	ValidationRatio float64
+	// ValidationWriter 验证集输出目标，ValidationRatio 大于0时必填
+	ValidationWriter io.Writer
+	// SplitSeed 拆分种子，相同种子下同一会话总是落入同一个数据集
+	SplitSeed string
+}
+
+// ExportReport 导出结果统计
+type ExportReport struct {
+	// Conversations 扫描的会话数
+	Conversations int
+	// TrainSamples 写入训练集的样本数
+	TrainSamples int
+	// ValidationSamples 写入验证集的样本数
+	ValidationSamples int
+	// Skipped 过滤后没有助手回复而被跳过的会话数
+	Skipped int
+	// Messages 导出的消息总数
+	Messages int
+}
+
+// fineTuneSample OpenAI 微调格式的一行样本
+type fineTuneSample struct {
+	Messages []*fineTuneMessage `json:"messages"`
+	Tools    []*fineTuneTool    `json:"tools,omitempty"`
+}
+
+// fineTuneMessage OpenAI 微调格式的消息
+type fineTuneMessage struct {
+	Role       string              `json:"role"`
+	Content    *string             `json:"content"`
+	Name       string              `json:"name,omitempty"`
+	ToolCalls  []*fineTuneToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string              `json:"tool_call_id,omitempty"`
+}
+
+// fineTuneToolCall OpenAI 微调格式的工具调用
+type fineTuneToolCall struct {
+	ID       string           `json:"id"`
+	Type     string           `json:"type"`
+	Function fineTuneFunction `json:"function"`
+}
+
+// fineTuneFunction 工具调用中的函数信息
+type fineTuneFunction struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// fineTuneTool OpenAI 微调格式的工具定义
+type fineTuneTool struct {
+	Type     string               `json:"type"`
+	Function fineTuneToolFunction `json:"function"`
+}
+
+// fineTuneToolFunction 工具定义中的函数描述
+type fineTuneToolFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+// ExportFineTuning 将会话导出为 OpenAI 微调格式的 JSONL
+// 每个会话输出一行样本，过滤后不包含助手回复的会话会被跳过
+// 参数:
+//   - w: 训练集输出目标
+//   - opts: 导出选项，为nil时导出全部会话的全部消息
+//
+// 返回:
+//   - *ExportReport: 导出结果统计
+//   - error: 如果导出过程中发生错误
+func (x *History) ExportFineTuning(w io.Writer, opts *ExportOptions) (*ExportReport, error) {
+	if opts == nil {
+		opts = &ExportOptions{}
+	}
+	if opts.ValidationRatio < 0 || opts.ValidationRatio >= 1 {
+		return nil, fmt.Errorf("验证集占比必须在 [0, 1) 范围内: %v", opts.ValidationRatio)
+	}
+	if opts.ValidationRatio > 0 && opts.ValidationWriter == nil {
+		return nil, fmt.Errorf("设置验证集占比时必须提供验证集输出目标")
+	}
+
+	tools, err := toFineTuneTools(opts.Tools)
+	if err != nil {
+		return nil, err
+	}
+
+	convIDs := opts.ConvIDs
+	if len(convIDs) == 0 {
+		if convIDs, err = x.ownedConvIDs(); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, convID := range convIDs {
+			if err := x.authorize(convID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	report := &ExportReport{}
+	trainEnc := json.NewEncoder(w)
+	var validEnc *json.Encoder
+	if opts.ValidationWriter != nil {
+		validEnc = json.NewEncoder(opts.ValidationWriter)
+	}
+
+	for _, convID := range convIDs {
+		report.Conversations++
+
+		mess, err := x.listAllMessages(convID)
+		if err = x.audited(&models.AuditEvent{Action: models.AuditConversationExport, ConversationID: convID}, err); err != nil {
+			return report, err
+		}
+
+		isRated := opts.IsRated
+		if opts.OnlyRated && isRated == nil {
+			if isRated, err = x.feedbackRated(convID); err != nil {
+				return report, err
+			}
+		}
+
+		sample := buildFineTuneSample(filterExportMessages(mess, opts, isRated), opts)
+		if sample == nil {
+			report.Skipped++
+			continue
+		}
+		sample.Tools = tools
+
+		if validEnc != nil && inValidationSet(opts.SplitSeed, convID, opts.ValidationRatio) {
+			if err := validEnc.Encode(sample); err != nil {
+				return report, fmt.Errorf("写入验证集失败: %v", err)
+			}
+			report.ValidationSamples++
+		} else {
+			if err := trainEnc.Encode(sample); err != nil {
+				return report, fmt.Errorf("写入训练集失败: %v", err)
+			}
+			report.TrainSamples++
+		}
+		report.Messages += len(sample.Messages)
+	}
+
+	return report, nil
+}
+
+// listAllMessages 分页读取会话的全部消息
+func (x *History) listAllMessages(convID string) ([]*models.Message, error) {
+	var all []*models.Message
+	for offset := 0; ; offset += exportPageSize {
+		mess, err := x.mr.ListByConversation(convID, offset, exportPageSize)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, mess...)
+		if len(mess) < exportPageSize {
+			return all, nil
+		}
+	}
+}
+
+// filterExportMessages 按导出选项过滤消息，不满足评价条件时返回nil
+// isRated 为nil时只检查消息元数据中的评价信息
+func filterExportMessages(mess []*models.Message, opts *ExportOptions, isRated func(msg *models.Message) bool) []*models.Message {
+	if opts.ActiveBranchOnly {
+		mess = activeBranch(mess)
+	}
+
+	if isRated == nil {
+		isRated = hasRatingMetadata
+	}
+
+	var (
+		filtered []*models.Message
+		rated    bool
+	)
+	for _, m := range mess {
+		if len(opts.Roles) > 0 && !containsRole(opts.Roles, m.Role) {
+			continue
+		}
+		// Redis 后端不会写入默认状态，空状态视为 sent
+		if opts.OnlySent && m.Status != "" && m.Status != "sent" {
+			continue
+		}
+		if !opts.Since.IsZero() && m.CreatedAt < opts.Since.Unix() {
+			continue
+		}
+		if !opts.Until.IsZero() && m.CreatedAt > opts.Until.Unix() {
+			continue
+		}
+		if opts.OnlyRated && isRated(m) {
+			rated = true
+		}
+		filtered = append(filtered, m)
+	}
+
+	if opts.OnlyRated && !rated {
+		return nil
+	}
+	return filtered
+}
+
+// buildFineTuneSample 将消息转换为微调样本，没有助手回复时返回nil
+func buildFineTuneSample(mess []*models.Message, opts *ExportOptions) *fineTuneSample {
+	redact := opts.Redactor
+	if redact == nil && opts.RedactPII {
+		redact = RedactPII
+	}
+
+	sample := &fineTuneSample{}
+	hasAssistant := false
+	for _, m := range mess {
+		msg := message2MessagesTemplate(m)
+		ftMsg := &fineTuneMessage{
+			Role:       string(msg.Role),
+			Name:       msg.Name,
+			ToolCallID: msg.ToolCallID,
+		}
+
+		content := msg.Content
+		if redact != nil {
+			content = redact(content)
+		}
+		// 只有工具调用的助手消息按 OpenAI 格式输出 null 内容
+		if content != "" || len(msg.ToolCalls) == 0 {
+			ftMsg.Content = &content
+		}
+
+		for _, tc := range msg.ToolCalls {
+			typ := tc.Type
+			if typ == "" {
+				typ = "function"
+			}
+			args := tc.Function.Arguments
+			if redact != nil {
+				args = redactArguments(args, redact)
+			}
+			ftMsg.ToolCalls = append(ftMsg.ToolCalls, &fineTuneToolCall{
+				ID:   tc.ID,
+				Type: typ,
+				Function: fineTuneFunction{
+					Name:      tc.Function.Name,
+					Arguments: args,
+				},
+			})
+		}
+
+		if msg.Role == schema.Assistant {
+			hasAssistant = true
+		}
+		sample.Messages = append(sample.Messages, ftMsg)
+	}
+
+	if !hasAssistant {
+		return nil
+	}
+	return sample
+}
+
+// toFineTuneTools 将 Eino 工具定义转换为 OpenAI 微调格式
+func toFineTuneTools(tools []*schema.ToolInfo) ([]*fineTuneTool, error) {
+	var result []*fineTuneTool
+	for _, t := range tools {
+		if t == nil {
+			continue
+		}
+		params, err := t.ToOpenAPIV3()
+		if err != nil {
+			return nil, fmt.Errorf("转换工具 %s 的参数定义失败: %v", t.Name, err)
+		}
+
+		fn := fineTuneToolFunction{
+			Name:        t.Name,
+			Description: t.Desc,
+		}
+		if params != nil {
+			if fn.Parameters, err = json.Marshal(params); err != nil {
+				return nil, fmt.Errorf("序列化工具 %s 的参数定义失败: %v", t.Name, err)
+			}
+		}
+		result = append(result, &fineTuneTool{Type: "function", Function: fn})
+	}
+	return result, nil
+}
+
+// activeBranch 从最后一条非变体消息沿 ParentID 回溯，返回当前活跃分支上的消息
+// 没有 ParentID 的消息视为线性历史，回溯到它之前最近的一条非变体消息
+func activeBranch(mess []*models.Message) []*models.Message {
+	index := make(map[string]int, len(mess))
+	for i, m := range mess {
+		index[m.MsgID] = i
+	}
+
+	prevNonVariant := func(i int) int {
+		for j := i - 1; j >= 0; j-- {
+			if !mess[j].IsVariant {
+				return j
+			}
+		}
+		return -1
+	}
+
+	keep := make(map[int]bool)
+	for i := prevNonVariant(len(mess)); i >= 0 && !keep[i]; {
+		keep[i] = true
+		if parent, ok := index[mess[i].ParentID]; ok && mess[i].ParentID != "" {
+			i = parent
+		} else {
+			i = prevNonVariant(i)
+		}
+	}
+
+	var branch []*models.Message
+	for i, m := range mess {
+		if keep[i] {
+			branch = append(branch, m)
+		}
+	}
+	return branch
+}
+
+// hasRatingMetadata 检查消息元数据中是否包含评价信息
+func hasRatingMetadata(msg *models.Message) bool {
+	if len(msg.Metadata) == 0 {
+		return false
+	}
+	var meta map[string]json.RawMessage
+	if err := json.Unmarshal(msg.Metadata, &meta); err != nil {
+		return false
+	}
+	_, hasRating := meta["rating"]
+	_, hasFeedback := meta["feedback"]
+	return hasRating || hasFeedback
+}
+
+// containsRole 判断角色是否在列表中
+func containsRole(roles []schema.RoleType, role string) bool {
+	for _, r := range roles {
+		if string(r) == role {
+			return true
+		}
+	}
+	return false
+}
+
+// inValidationSet 根据种子和会话ID的哈希值确定性地决定样本是否划入验证集
+func inValidationSet(seed, convID string, ratio float64) bool {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(seed))
+	_, _ = h.Write([]byte(convID))
+	return float64(h.Sum64()%10000)/10000 < ratio
+}
@@ -0,0 +1,220 @@
+package eino
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hildam/eino-history/model"
+)
+
+// TextExtractor 从附件内容中提取文本
+type TextExtractor interface {
+	// Extract 提取附件的文本
+	// 参数:
+	//   - attachment: 附件信息
+	//   - r: 附件内容
+	// 返回:
+	//   - string: 提取的文本，附件不包含文本时返回空
+	//   - error: 如果读取过程中发生错误
+	Extract(attachment *models.Attachment, r io.Reader) (string, error)
+}
+
+// TextExtractorFunc 函数形式的文本提取器
+type TextExtractorFunc func(attachment *models.Attachment, r io.Reader) (string, error)
+
+// Extract 实现 TextExtractor 接口
+func (f TextExtractorFunc) Extract(attachment *models.Attachment, r io.Reader) (string, error) {
+	return f(attachment, r)
+}
+
+// codeExtensions 按扩展名识别为文本的代码和配置文件
+var codeExtensions = map[string]bool{
+	".txt": true, ".log": true, ".csv": true, ".tsv": true, ".md": true, ".markdown": true, ".rst": true,
+	".go": true, ".py": true, ".js": true, ".ts": true, ".jsx": true, ".tsx": true, ".java": true, ".kt": true,
+	".c": true, ".h": true, ".cc": true, ".cpp": true, ".hpp": true, ".cs": true, ".rs": true, ".rb": true,
+	".php": true, ".swift": true, ".scala": true, ".sh": true, ".bash": true, ".sql": true, ".lua": true,
+	".yaml": true, ".yml": true, ".toml": true, ".ini": true, ".conf": true, ".xml": true, ".css": true,
+	".proto": true, ".graphql": true, ".vue": true, ".dockerfile": true,
+}
+
+// htmlBlockTags 提取 HTML 文本时换行的块级标签
+var htmlBlockTags = map[string]bool{
+	"p": true, "div": true, "br": true, "li": true, "tr": true, "td": true, "th": true, "table": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "pre": true, "blockquote": true,
+	"section": true, "article": true, "header": true, "footer": true, "title": true, "ul": true, "ol": true,
+	"hr": true, "dt": true, "dd": true,
+}
+
+// ExtractText 默认的文本提取器，支持纯文本、代码、Markdown、HTML 和 JSON
+// 纯文本、代码和 Markdown 原样返回，HTML 去除标签、脚本和样式，JSON 展开为 "路径: 值" 的行
+// 其他格式或不是 UTF-8 文本的内容返回空
+func ExtractText(attachment *models.Attachment, r io.Reader) (string, error) {
+	kind := textKind(attachment)
+	if kind == "" {
+		return "", nil
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	if !utf8.Valid(data) || bytes.IndexByte(data, 0) >= 0 {
+		return "", nil
+	}
+
+	switch kind {
+	case "html":
+		return htmlText(string(data)), nil
+	case "json":
+		if text, err := jsonText(data); err == nil {
+			return text, nil
+		}
+	}
+	return string(data), nil
+}
+
+// textKind 按 MIME 类型和扩展名判断附件的文本格式，不是文本时返回空
+func textKind(attachment *models.Attachment) string {
+	mimeType, _, _ := strings.Cut(strings.ToLower(attachment.MimeType), ";")
+	mimeType = strings.TrimSpace(mimeType)
+	ext := strings.ToLower(path.Ext(attachment.FileName))
+
+	switch {
+	case mimeType == "text/html" || mimeType == "application/xhtml+xml" || ext == ".html" || ext == ".htm":
+		return "html"
+	case mimeType == "application/json" || strings.HasSuffix(mimeType, "+json") || ext == ".json":
+		return "json"
+	case attachment.AttachmentType == "code" || isTextMIME(mimeType) || codeExtensions[ext]:
+		return "text"
+	}
+	return ""
+}
+
+// htmlText 去除 HTML 的标签、注释、脚本和样式，块级标签处换行
+func htmlText(src string) string {
+	var b strings.Builder
+	for i := 0; i < len(src); {
+		switch {
+		case strings.HasPrefix(src[i:], "<!--"):
+			end := strings.Index(src[i+4:], "-->")
+			if end < 0 {
+				i = len(src)
+			} else {
+				i += 4 + end + 3
+			}
+		case src[i] == '<':
+			end := strings.IndexByte(src[i:], '>')
+			if end < 0 {
+				b.WriteString(src[i:])
+				i = len(src)
+				continue
+			}
+			closing, name := htmlTagName(src[i+1 : i+end])
+			i += end + 1
+			if !closing && (name == "script" || name == "style") {
+				// 跳过脚本和样式的内容，结束标签在下一轮处理
+				if idx := strings.Index(strings.ToLower(src[i:]), "</"+name); idx >= 0 {
+					i += idx
+				} else {
+					i = len(src)
+				}
+			}
+			if htmlBlockTags[name] {
+				b.WriteByte('\n')
+			}
+		default:
+			next := strings.IndexByte(src[i:], '<')
+			if next < 0 {
+				next = len(src) - i
+			}
+			b.WriteString(src[i : i+next])
+			i += next
+		}
+	}
+
+	var lines []string
+	for _, line := range strings.Split(html.UnescapeString(b.String()), "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// htmlTagName 解析标签名，返回是否为结束标签和小写的标签名
+func htmlTagName(tag string) (bool, string) {
+	closing := strings.HasPrefix(tag, "/")
+	tag = strings.TrimPrefix(tag, "/")
+	if end := strings.IndexAny(tag, " \t\r\n/"); end >= 0 {
+		tag = tag[:end]
+	}
+	return closing, strings.ToLower(tag)
+}
+
+// jsonText 将 JSON 的标量值展开为 "路径: 值" 的行，支持多个顶层值(如 NDJSON)
+func jsonText(data []byte) (string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var lines []string
+	var walk func(path string) error
+	walk = func(path string) error {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch v := tok.(type) {
+		case json.Delim:
+			if v == '{' {
+				for dec.More() {
+					key, err := dec.Token()
+					if err != nil {
+						return err
+					}
+					if err := walk(joinJSONPath(path, fmt.Sprint(key))); err != nil {
+						return err
+					}
+				}
+			} else {
+				for i := 0; dec.More(); i++ {
+					if err := walk(fmt.Sprintf("%s[%d]", path, i)); err != nil {
+						return err
+					}
+				}
+			}
+			_, err = dec.Token()
+			return err
+		case nil:
+			return nil
+		default:
+			if path == "" {
+				lines = append(lines, fmt.Sprint(v))
+			} else {
+				lines = append(lines, fmt.Sprintf("%s: %v", path, v))
+			}
+			return nil
+		}
+	}
+
+	for {
+		if err := walk(""); err == io.EOF {
+			break
+		} else if err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// joinJSONPath 拼接 JSON 路径
+func joinJSONPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
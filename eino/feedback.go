@@ -0,0 +1,176 @@
+package eino
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/hildam/eino-history/model"
+)
+
+// RecordFeedback 记录用户对助手消息的评价，同一用户再次评价时覆盖之前的评价
+// 会话ID和租户由消息所属会话填充；限定到用户的归属范围时 UserID 为空则使用归属用户，不能代其他用户评价；
+// Model 为空时使用会话设置中的模型
+// 参数:
+//   - feedback: 评价对象，MessageID 必填，Rating 取值为 1、0 或 -1
+//
+// 返回:
+//   - error: 如果评价为空或无效、消息不存在或不是助手消息、用户不属于归属范围、保存过程中发生错误
+func (x *History) RecordFeedback(feedback *models.MessageFeedback) (err error) {
+	if feedback == nil {
+		return fmt.Errorf("评价为空")
+	}
+	defer func() { x.auditCall(&err, models.AuditFeedbackRecord, feedback.ConversationID, feedback.MessageID) }()
+	if feedback.Rating < models.FeedbackRatingDown || feedback.Rating > models.FeedbackRatingUp {
+		return fmt.Errorf("评价取值无效: %d", feedback.Rating)
+	}
+	if feedback.Rating == models.FeedbackRatingNone && len(feedback.Reasons) == 0 && feedback.Comment == "" {
+		return fmt.Errorf("评价内容不能为空")
+	}
+
+	msg, err := x.mr.GetByID(feedback.MessageID)
+	if err != nil {
+		return err
+	}
+	if msg.Role != string(schema.Assistant) {
+		return fmt.Errorf("只能评价助手消息，消息 %s 的角色为 %s", msg.MsgID, msg.Role)
+	}
+	conv, err := x.cr.GetByID(msg.ConversationID)
+	if err != nil {
+		return err
+	}
+	if x.owner != nil && !x.owner.Owns(conv) {
+		return ErrForbidden
+	}
+
+	feedback.ConversationID = conv.ConvID
+	feedback.TenantID = conv.TenantID
+	if feedback.UserID, err = x.feedbackUser(feedback.UserID); err != nil {
+		return err
+	}
+	if feedback.Model == "" {
+		settings, err := models.ParseConversationSettings(conv.Settings)
+		if err != nil {
+			return err
+		}
+		feedback.Model = settings.Model
+	}
+	return x.fr.Upsert(feedback)
+}
+
+// DeleteFeedback 删除用户对消息的评价
+// 参数:
+//   - msgID: 消息ID
+//   - userID: 评价用户ID，限定到用户的归属范围时为空则使用归属用户，不能删除其他用户的评价
+//
+// 返回:
+//   - error: 如果用户不属于归属范围或删除过程中发生错误
+func (x *History) DeleteFeedback(msgID, userID string) (err error) {
+	defer x.auditCall(&err, models.AuditFeedbackDelete, "", msgID)
+	if err := x.authorizeMessage(msgID); err != nil {
+		return err
+	}
+	if userID, err = x.feedbackUser(userID); err != nil {
+		return err
+	}
+	return x.fr.Delete(msgID, userID)
+}
+
+// feedbackUser 确定评价所属的用户，归属范围限定到用户时只能是归属用户，为空时使用归属用户
+func (x *History) feedbackUser(userID string) (string, error) {
+	if x.owner == nil || x.owner.UserID == "" {
+		return userID, nil
+	}
+	if userID != "" && userID != x.owner.UserID {
+		return "", ErrForbidden
+	}
+	return x.owner.UserID, nil
+}
+
+// GetFeedback 获取消息的全部评价
+// 参数:
+//   - msgID: 消息ID
+//
+// 返回:
+//   - []*models.MessageFeedback: 评价列表
+//   - error: 如果获取过程中发生错误
+func (x *History) GetFeedback(msgID string) ([]*models.MessageFeedback, error) {
+	if err := x.authorizeMessage(msgID); err != nil {
+		return nil, err
+	}
+	return x.fr.ListByMessage(msgID)
+}
+
+// ListFeedback 获取会话中全部消息的评价
+// 参数:
+//   - convID: 会话ID
+//
+// 返回:
+//   - []*models.MessageFeedback: 评价列表
+//   - error: 如果获取过程中发生错误
+func (x *History) ListFeedback(convID string) ([]*models.MessageFeedback, error) {
+	if err := x.authorize(convID); err != nil {
+		return nil, err
+	}
+	return x.fr.ListByConversation(convID)
+}
+
+// FeedbackStats 汇总会话的评价
+// 参数:
+//   - convID: 会话ID
+//
+// 返回:
+//   - *models.FeedbackStats: 评价汇总
+//   - error: 如果汇总过程中发生错误
+func (x *History) FeedbackStats(convID string) (*models.FeedbackStats, error) {
+	if err := x.authorize(convID); err != nil {
+		return nil, err
+	}
+	return x.fr.StatsByConversation(convID)
+}
+
+// FeedbackStatsByModel 按模型汇总评价，限定归属范围时只汇总归属租户的评价
+// 参数:
+//   - since: 评价更新时间下限，零值表示不限制
+//   - until: 评价更新时间上限，零值表示不限制
+//
+// 返回:
+//   - []*models.FeedbackStats: 各模型的评价汇总，按模型名称排序
+//   - error: 如果汇总过程中发生错误
+func (x *History) FeedbackStatsByModel(since, until time.Time) ([]*models.FeedbackStats, error) {
+	var from, to int64
+	if !since.IsZero() {
+		from = since.Unix()
+	}
+	if !until.IsZero() {
+		to = until.Unix()
+	}
+	return x.fr.StatsByModel(x.owner, from, to)
+}
+
+// authorizeMessage 校验消息所属会话是否属于当前归属范围
+func (x *History) authorizeMessage(msgID string) error {
+	if x.owner == nil {
+		return nil
+	}
+	msg, err := x.mr.GetByID(msgID)
+	if err != nil {
+		return err
+	}
+	return x.authorize(msg.ConversationID)
+}
+
+// feedbackRated 返回判断消息是否已被评价的函数，有评价记录或元数据中包含评价信息的消息视为已评价
+func (x *History) feedbackRated(convID string) (func(msg *models.Message) bool, error) {
+	feedback, err := x.fr.ListByConversation(convID)
+	if err != nil {
+		return nil, err
+	}
+	rated := make(map[string]bool, len(feedback))
+	for _, fb := range feedback {
+		rated[fb.MessageID] = true
+	}
+	return func(msg *models.Message) bool {
+		return rated[msg.MsgID] || hasRatingMetadata(msg)
+	}, nil
+}
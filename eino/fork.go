@@ -0,0 +1,191 @@
+package eino
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hildam/eino-history/model"
+	"github.com/hildam/eino-history/store/interfaces"
+)
+
+// SettingsForkKey 会话设置中记录分叉来源的 key
+const SettingsForkKey = "forked_from"
+
+// ForkSource 分叉来源，记录在新会话设置的 forked_from 字段中
+type ForkSource struct {
+	// ConversationID 源会话ID
+	ConversationID string `json:"conversation_id"`
+	// MessageID 复制的最后一条源消息ID，源会话没有消息时为空
+	MessageID string `json:"message_id,omitempty"`
+	// ForkedAt 分叉时间(Unix秒)
+	ForkedAt int64 `json:"forked_at"`
+}
+
+// ForkOptions 会话分叉选项
+type ForkOptions struct {
+	// NewConvID 新会话ID，为空时自动生成
+	NewConvID string
+	// UntilMsgID 复制到该消息为止(包含该消息)，为空时复制全部消息
+	UntilMsgID string
+	// Title 新会话标题，为空时沿用源会话标题
+	Title string
+}
+
+// ForkConversation 将会话或会话中截至某条消息的前缀复制为新会话
+// 消息元数据深拷贝，附件只复制关联不复制附件本身，分叉来源记录在新会话设置的 forked_from 字段中
+// 参数:
+//   - srcConvID: 源会话ID
+//   - opts: 分叉选项，为nil时复制全部消息到自动生成ID的新会话
+//
+// 返回:
+//   - *models.Conversation: 新创建的会话
+//   - error: 如果源会话或消息不存在、新会话ID已被占用或复制过程中发生错误
+func (x *History) ForkConversation(srcConvID string, opts *ForkOptions) (forked *models.Conversation, err error) {
+	defer func() {
+		targetID := ""
+		if forked != nil {
+			targetID = forked.ConvID
+		}
+		x.auditCall(&err, models.AuditConversationFork, srcConvID, targetID)
+	}()
+
+	if opts == nil {
+		opts = &ForkOptions{}
+	}
+	if err := x.authorize(srcConvID); err != nil {
+		return nil, err
+	}
+
+	src, err := x.cr.GetByID(srcConvID)
+	if err != nil {
+		return nil, err
+	}
+
+	mess, err := x.listAllMessages(srcConvID)
+	if err != nil {
+		return nil, err
+	}
+	if opts.UntilMsgID != "" {
+		end := -1
+		for i, m := range mess {
+			if m.MsgID == opts.UntilMsgID {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return nil, fmt.Errorf("消息 %s 不在会话 %s 中", opts.UntilMsgID, srcConvID)
+		}
+		mess = mess[:end+1]
+	}
+
+	newConvID := opts.NewConvID
+	if newConvID == "" {
+		newConvID = uuid.NewString()
+	}
+	if _, err := x.cr.GetByID(newConvID); err == nil {
+		return nil, fmt.Errorf("会话 %s 已存在", newConvID)
+	}
+	if _, err := x.cr.GetDeleted(newConvID); err == nil {
+		return nil, fmt.Errorf("会话 %s 已存在于回收站", newConvID)
+	}
+
+	now := time.Now().Unix()
+	source := ForkSource{ConversationID: srcConvID, ForkedAt: now}
+	if len(mess) > 0 {
+		source.MessageID = mess[len(mess)-1].MsgID
+	}
+	settings, err := withSetting(src.Settings, SettingsForkKey, source)
+	if err != nil {
+		return nil, err
+	}
+
+	title := opts.Title
+	if title == "" {
+		title = src.Title
+	}
+	conv := &models.Conversation{
+		ConvID:    newConvID,
+		Title:     title,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Settings:  settings,
+		TenantID:  src.TenantID,
+		UserID:    src.UserID,
+	}
+	if err := x.CreateConversation(conv); err != nil {
+		return nil, err
+	}
+
+	if err := x.copyMessages(mess, newConvID); err != nil {
+		// 复制失败时尽量清理已创建的内容，避免留下不完整的分叉
+		x.discardConversation(newConvID)
+		return nil, err
+	}
+
+	return x.cr.GetByID(newConvID)
+}
+
+// copyMessages 在一个事务中将消息复制到新会话，重新生成消息ID并映射父消息，同时复制附件关联
+func (x *History) copyMessages(mess []*models.Message, convID string) error {
+	idMap := make(map[string]string, len(mess))
+	srcIDs := make([]string, len(mess))
+	copies := make([]*models.Message, len(mess))
+	for i, m := range mess {
+		msg := *m
+		msg.ID = 0
+		msg.MsgID = uuid.NewString()
+		msg.ConversationID = convID
+		msg.ParentID = idMap[m.ParentID]
+		if m.Metadata != nil {
+			msg.Metadata = append(json.RawMessage(nil), m.Metadata...)
+		}
+		idMap[m.MsgID] = msg.MsgID
+		srcIDs[i], copies[i] = m.MsgID, &msg
+	}
+
+	links, err := x.mar.ListByMessages(srcIDs)
+	if err != nil {
+		return err
+	}
+	return x.dbProvider.Transaction(func(tx interfaces.TxStores) error {
+		if err := tx.GetMessageStore().CreateBatch(copies); err != nil {
+			return err
+		}
+		for _, link := range links {
+			if err := tx.GetMessageAttachmentStore().Create(&models.MessageAttachment{
+				MessageID:    idMap[link.MessageID],
+				AttachmentID: link.AttachmentID,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// discardConversation 尽量永久删除会话及其消息和附件关联，用于清理未完成的写入
+func (x *History) discardConversation(convID string) {
+	if err := x.cr.Delete(convID); err == nil {
+		_ = x.cr.Purge(convID)
+	}
+}
+
+// withSetting 在会话设置中写入一个字段，保留其他字段
+func withSetting(settings json.RawMessage, key string, value interface{}) (json.RawMessage, error) {
+	fields := make(map[string]json.RawMessage)
+	if len(settings) > 0 && string(settings) != "null" {
+		if err := json.Unmarshal(settings, &fields); err != nil {
+			return nil, fmt.Errorf("会话设置不是有效的JSON对象: %v", err)
+		}
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	fields[key] = data
+	return json.Marshal(fields)
+}
@@ -0,0 +1,208 @@
+package eino
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hildam/eino-history/model"
+)
+
+// DefaultAttachmentGracePeriod 未设置宽限期时只回收创建超过该时长的附件
+const DefaultAttachmentGracePeriod = 24 * time.Hour
+
+// AttachmentGCConfig 附件回收配置
+type AttachmentGCConfig struct {
+	// GracePeriod 只回收创建时间早于该时长的附件，以及最近写入时间早于该时长的内容，为0时使用 DefaultAttachmentGracePeriod
+	// 上传附件时先保存内容再创建附件记录和消息关联，宽限期避免回收刚上传还未关联的附件，以及去重命中后还未创建附件记录的内容
+	GracePeriod time.Duration
+	// Limit 单次最多回收的附件数，为0时不限制
+	Limit int
+}
+
+// AttachmentGCItem 一个未被引用附件的回收记录
+type AttachmentGCItem struct {
+	AttachID    string
+	FileName    string
+	FileSize    int64
+	ContentHash string
+	CreatedAt   int64
+	// BlobDeleted 附件内容是否一并删除(演练时为将要删除)，内容仍被其他附件引用或不在当前内容存储中时为false
+	BlobDeleted bool
+}
+
+// AttachmentGCReport 一次附件回收的结果
+type AttachmentGCReport struct {
+	// DryRun 是否为演练，演练不会修改数据
+	DryRun bool
+	// Attachments 删除(演练时为将要删除)的附件数
+	Attachments int
+	// Blobs 删除(演练时为将要删除)的内容数
+	Blobs int
+	// FreedBytes 删除内容释放的字节数
+	FreedBytes int64
+	// Items 回收明细
+	Items []*AttachmentGCItem
+	// StartedAt 开始时间
+	StartedAt time.Time
+	// Duration 执行耗时
+	Duration time.Duration
+}
+
+// CollectAttachments 回收没有任何消息关联的附件，以及不再被任何附件引用的附件内容
+// 永久删除消息或会话时只删除消息与附件的关联，附件和内容由回收统一清理；回收站中的消息仍保留关联，不会被回收
+// 回收不区分归属范围，限定归属范围时返回 ErrForbidden
+// 参数:
+//   - config: 回收配置，为nil时使用默认配置
+//   - dryRun: 为true时只列出将要删除的附件和内容，不修改数据
+//
+// 返回:
+//   - *AttachmentGCReport: 执行结果
+//   - error: 如果执行过程中发生错误，已处理的附件会体现在结果中
+func (x *History) CollectAttachments(config *AttachmentGCConfig, dryRun bool) (*AttachmentGCReport, error) {
+	report := &AttachmentGCReport{DryRun: dryRun, StartedAt: time.Now()}
+	err := x.collectAttachments(config, report)
+	report.Duration = time.Since(report.StartedAt)
+	return report, err
+}
+
+// collectAttachments 先删除未被引用的附件，再删除引用数降为0的内容
+func (x *History) collectAttachments(config *AttachmentGCConfig, report *AttachmentGCReport) error {
+	if x.owner != nil {
+		return ErrForbidden
+	}
+	cfg := AttachmentGCConfig{}
+	if config != nil {
+		cfg = *config
+	}
+	if cfg.GracePeriod <= 0 {
+		cfg.GracePeriod = DefaultAttachmentGracePeriod
+	}
+
+	cutoff := report.StartedAt.Add(-cfg.GracePeriod).Unix()
+	attachments, err := x.ar.ListUnreferenced(cutoff, cfg.Limit)
+	if err != nil {
+		return err
+	}
+
+	// 按内容分组，记录本次回收的附件中引用各内容的数量和存储类型
+	var hashes []string
+	pending := make(map[string]int64)
+	storageTypes := make(map[string]string)
+	fresh := make(map[string]bool)
+	for _, attachment := range attachments {
+		// 内容在宽限期内写入过时保留附件，下次回收时附件和内容一并处理，避免内容失去引用后不再被检查
+		if hash := attachment.ContentHash; hash != "" {
+			skip, checked := fresh[hash]
+			if !checked {
+				if skip, err = x.blobFresh(hash, attachment.StorageType, cutoff); err != nil {
+					return fmt.Errorf("获取附件内容 %s 失败: %v", hash, err)
+				}
+				fresh[hash] = skip
+			}
+			if skip {
+				continue
+			}
+		}
+		if !report.DryRun {
+			deleted, err := x.ar.DeleteUnreferenced(attachment.AttachID)
+			if err != nil || deleted {
+				event := &models.AuditEvent{Action: models.AuditAttachmentPurge, TargetID: attachment.AttachID}
+				if err := x.audited(event, err); err != nil {
+					return fmt.Errorf("删除附件 %s 失败: %v", attachment.AttachID, err)
+				}
+			}
+			// 列出后又被关联的附件不再回收
+			if !deleted {
+				continue
+			}
+			if err := x.dropAttachmentIndex(attachment.AttachID); err != nil {
+				return fmt.Errorf("删除附件 %s 的分块失败: %v", attachment.AttachID, err)
+			}
+		}
+
+		report.Attachments++
+		report.Items = append(report.Items, &AttachmentGCItem{
+			AttachID:    attachment.AttachID,
+			FileName:    attachment.FileName,
+			FileSize:    attachment.FileSize,
+			ContentHash: attachment.ContentHash,
+			CreatedAt:   attachment.CreatedAt,
+		})
+		if hash := attachment.ContentHash; hash != "" {
+			if pending[hash] == 0 {
+				hashes = append(hashes, hash)
+				storageTypes[hash] = attachment.StorageType
+			}
+			pending[hash]++
+		}
+	}
+
+	for _, hash := range hashes {
+		freed, err := x.collectBlob(hash, storageTypes[hash], pending[hash], cutoff, report.DryRun)
+		if err != nil {
+			return fmt.Errorf("删除附件内容 %s 失败: %v", hash, err)
+		}
+		if freed < 0 {
+			continue
+		}
+		report.Blobs++
+		report.FreedBytes += freed
+		for _, item := range report.Items {
+			if item.ContentHash == hash {
+				item.BlobDeleted = true
+			}
+		}
+	}
+	return nil
+}
+
+// blobFresh 返回内容是否在 cutoff 之后写入或去重命中过，内容不在当前内容存储中时返回false
+func (x *History) blobFresh(hash, storageType string, cutoff int64) (bool, error) {
+	info, err := x.attach.Store.Stat(hash)
+	if errors.Is(err, models.ErrBlobNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return info.StorageType == storageType && info.TouchedAt > cutoff, nil
+}
+
+// collectBlob 内容不再被引用且最近写入时间早于 cutoff 时删除，返回释放的字节数，未删除时返回-1
+// 演练时附件还未删除，引用数需扣除本次将要删除的附件数
+func (x *History) collectBlob(hash, storageType string, pending, cutoff int64, dryRun bool) (int64, error) {
+	refs, err := x.ar.CountByContentHash(hash)
+	if err != nil {
+		return -1, err
+	}
+	if dryRun {
+		refs -= pending
+	}
+	if refs > 0 {
+		return -1, nil
+	}
+
+	// 切换内容存储后旧附件的内容不在当前存储中，不做处理
+	info, err := x.attach.Store.Stat(hash)
+	if errors.Is(err, models.ErrBlobNotFound) {
+		return -1, nil
+	}
+	if err != nil {
+		return -1, err
+	}
+	if info.StorageType != storageType {
+		return -1, nil
+	}
+	// 检查之后又被去重命中的内容可能属于还未创建记录的附件
+	if info.TouchedAt > cutoff {
+		return -1, nil
+	}
+
+	if !dryRun {
+		if err := x.attach.Store.Delete(hash); err != nil {
+			return -1, err
+		}
+	}
+	return info.Size, nil
+}
@@ -1,10 +1,22 @@
 package eino
 
 import (
+	"encoding/json"
+
 	"github.com/cloudwego/eino/schema"
 	"github.com/hildam/eino-history/model"
 )
 
+// messageExtra 保存在 Message.Metadata 中的 schema.Message 扩展字段
+type messageExtra struct {
+	Name       string            `json:"name,omitempty"`
+	ToolCalls  []schema.ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string            `json:"tool_call_id,omitempty"`
+	Parts      []messagePart     `json:"parts,omitempty"`
+	// ContentDigest 保存时消息内容的 SHA-256，加载时与当前内容比较，判断布局中的文本是否因编辑而过期
+	ContentDigest string `json:"content_digest,omitempty"`
+}
+
 func messageList2ChatHistory(mess []*models.Message) (history []*schema.Message) {
 	for _, m := range mess {
 		history = append(history, message2MessagesTemplate(m))
@@ -13,8 +25,48 @@ func messageList2ChatHistory(mess []*models.Message) (history []*schema.Message)
 }
 
 func message2MessagesTemplate(mess *models.Message) *schema.Message {
-	return &schema.Message{
+	msg := &schema.Message{
 		Role:    schema.RoleType(mess.Role),
 		Content: mess.Content,
 	}
+	if extra := decodeMessageExtra(mess.Metadata); extra != nil {
+		msg.Name = extra.Name
+		msg.ToolCalls = extra.ToolCalls
+		msg.ToolCallID = extra.ToolCallID
+	}
+	return msg
+}
+
+// encodeMessageExtra 将工具调用、多模态片段布局等扩展字段编码为消息元数据，没有扩展字段时返回nil
+// 有片段布局时同时记录保存的消息内容 content 的摘要
+func encodeMessageExtra(mess *schema.Message, parts []messagePart, content string) json.RawMessage {
+	if mess.Name == "" && len(mess.ToolCalls) == 0 && mess.ToolCallID == "" && len(parts) == 0 {
+		return nil
+	}
+	extra := &messageExtra{
+		Name:       mess.Name,
+		ToolCalls:  mess.ToolCalls,
+		ToolCallID: mess.ToolCallID,
+		Parts:      parts,
+	}
+	if len(parts) > 0 {
+		extra.ContentDigest = contentDigest(content)
+	}
+	data, err := json.Marshal(extra)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// decodeMessageExtra 从消息元数据中解析扩展字段，元数据为空或无法解析时返回nil
+func decodeMessageExtra(metadata json.RawMessage) *messageExtra {
+	if len(metadata) == 0 {
+		return nil
+	}
+	var extra messageExtra
+	if err := json.Unmarshal(metadata, &extra); err != nil {
+		return nil
+	}
+	return &extra
 }
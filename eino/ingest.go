@@ -0,0 +1,491 @@
+package eino
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/hildam/eino-history/model"
+)
+
+const (
+	// DefaultChunkSize 附件文本分块的默认字符数
+	DefaultChunkSize = 800
+	// DefaultChunkOverlap 相邻分块默认重叠的字符数
+	DefaultChunkOverlap = 100
+	// defaultIngestRetries 摄取失败后的默认重试次数
+	defaultIngestRetries = 3
+	// defaultIngestRetryDelay 摄取首次重试的默认等待时间，之后每次翻倍
+	defaultIngestRetryDelay = 2 * time.Second
+	// defaultIngestTimeout 单次摄取中生成摘要和向量化的默认超时时间
+	defaultIngestTimeout = 2 * time.Minute
+	// defaultIngestConcurrency 默认同时摄取的附件数
+	defaultIngestConcurrency = 2
+	// defaultSummaryMaxInput 生成摘要时默认最多输入的字符数
+	defaultSummaryMaxInput = 8000
+)
+
+// summaryPrompt 使用 ChatModel 生成附件摘要时的系统提示
+const summaryPrompt = "你是一个文档摘要助手。请用简洁的中文概括用户提供的附件内容，" +
+	"说明主题和关键信息，不超过200字，只输出摘要本身，不要添加任何解释。"
+
+// IngestConfig 附件摄取配置
+type IngestConfig struct {
+	// Extractor 文本提取器，为nil时使用 ExtractText
+	Extractor TextExtractor
+	// ChunkSize 分块字符数，为0时使用 DefaultChunkSize
+	ChunkSize int
+	// ChunkOverlap 相邻分块重叠的字符数，为0时使用 DefaultChunkOverlap，小于0时不重叠
+	ChunkOverlap int
+	// Summarizer 生成附件摘要(DataSummary)的模型，为nil时不生成摘要
+	Summarizer model.ChatModel
+	// SummaryMaxInput 生成摘要时最多输入的字符数，为0时使用默认值8000
+	SummaryMaxInput int
+	// Retries 摄取失败后的重试次数，为0时使用默认值3，小于0时不重试
+	Retries int
+	// RetryDelay 首次重试前的等待时间，之后每次翻倍，为0时使用默认值2秒
+	RetryDelay time.Duration
+	// Timeout 单次摄取中生成摘要和向量化的超时时间，为0时使用默认值2分钟
+	Timeout time.Duration
+	// Concurrency 同时摄取的附件数，为0时使用默认值2
+	Concurrency int
+	// OnStatus 附件摄取状态变化时的回调，可以为nil
+	OnStatus func(attachment *models.Attachment)
+}
+
+// ingestState 附件摄取的运行状态，在 WithOwner 返回的副本之间共享
+type ingestState struct {
+	config   IngestConfig
+	sem      chan struct{}
+	inflight sync.Map
+	wg       sync.WaitGroup
+}
+
+// SetIngestion 开启附件摄取，为nil时关闭
+// 开启后上传的附件在后台提取文本、分块保存、生成摘要，设置了向量化器时将分块和摘要向量化
+// 参数:
+//   - config: 摄取配置
+func (x *History) SetIngestion(config *IngestConfig) {
+	if config == nil {
+		x.ingest = nil
+		return
+	}
+
+	state := &ingestState{config: *config}
+	if state.config.Extractor == nil {
+		state.config.Extractor = TextExtractorFunc(ExtractText)
+	}
+	if state.config.ChunkSize <= 0 {
+		state.config.ChunkSize = DefaultChunkSize
+	}
+	if state.config.ChunkOverlap == 0 {
+		state.config.ChunkOverlap = DefaultChunkOverlap
+	}
+	if state.config.SummaryMaxInput <= 0 {
+		state.config.SummaryMaxInput = defaultSummaryMaxInput
+	}
+	if state.config.Retries == 0 {
+		state.config.Retries = defaultIngestRetries
+	}
+	if state.config.RetryDelay <= 0 {
+		state.config.RetryDelay = defaultIngestRetryDelay
+	}
+	if state.config.Timeout <= 0 {
+		state.config.Timeout = defaultIngestTimeout
+	}
+	if state.config.Concurrency <= 0 {
+		state.config.Concurrency = defaultIngestConcurrency
+	}
+	state.sem = make(chan struct{}, state.config.Concurrency)
+	x.ingest = state
+}
+
+// WaitIngestion 等待后台正在进行的附件摄取结束
+func (x *History) WaitIngestion() {
+	if x.ingest != nil {
+		x.ingest.wg.Wait()
+	}
+}
+
+// IngestAttachment 将附件加入后台摄取，用于配置变化后或摄取功能开启前上传的附件
+// 参数:
+//   - attachID: 附件ID
+//
+// 返回:
+//   - error: 如果未开启附件摄取、附件不存在或没有保存内容
+func (x *History) IngestAttachment(attachID string) error {
+	state := x.ingest
+	if state == nil {
+		return fmt.Errorf("未开启附件摄取")
+	}
+
+	attachment, err := x.ar.GetByID(attachID)
+	if err != nil {
+		return err
+	}
+	convID, err := x.attachmentConversation(attachment)
+	if err != nil {
+		return err
+	}
+	if err := x.authorize(convID); err != nil {
+		return err
+	}
+	if attachment.ContentHash == "" {
+		return fmt.Errorf("附件 %s 没有保存内容", attachID)
+	}
+
+	if err := x.setIngestStatus(state, attachment, models.IngestStatusPending, ""); err != nil {
+		return err
+	}
+	x.scheduleIngest(attachID)
+	return nil
+}
+
+// ResumeIngestion 重新加入等待中和中断的摄取任务，用于进程重启后恢复
+// 摄取不区分归属范围，限定归属范围时返回 ErrForbidden
+// 返回:
+//   - int: 加入摄取的附件数
+//   - error: 如果未开启附件摄取或获取附件过程中发生错误
+func (x *History) ResumeIngestion() (int, error) {
+	if x.ingest == nil {
+		return 0, fmt.Errorf("未开启附件摄取")
+	}
+	if x.owner != nil {
+		return 0, ErrForbidden
+	}
+
+	count := 0
+	for _, status := range []string{models.IngestStatusPending, models.IngestStatusProcessing} {
+		attachments, err := x.ar.ListByIngestStatus(status, 0)
+		if err != nil {
+			return count, err
+		}
+		for _, attachment := range attachments {
+			x.scheduleIngest(attachment.AttachID)
+			count++
+		}
+	}
+	return count, nil
+}
+
+// IngestionStatus 获取附件的摄取状态
+// 参数:
+//   - attachID: 附件ID
+//
+// 返回:
+//   - string: 摄取状态，取值见 models.IngestStatusPending 等，为空时未摄取
+//   - string: 最近一次摄取失败的原因
+//   - error: 如果附件不存在
+func (x *History) IngestionStatus(attachID string) (string, string, error) {
+	attachment, err := x.ar.GetByID(attachID)
+	if err != nil {
+		return "", "", err
+	}
+	convID, err := x.attachmentConversation(attachment)
+	if err != nil {
+		return "", "", err
+	}
+	if err := x.authorizeAny(convID); err != nil {
+		return "", "", err
+	}
+	return attachment.IngestStatus, attachment.IngestError, nil
+}
+
+// AttachmentChunks 获取附件摄取后保存的文本分块
+// 参数:
+//   - attachID: 附件ID
+//
+// 返回:
+//   - []*models.AttachmentChunk: 分块列表，按序号升序
+//   - error: 如果附件不存在或获取过程中发生错误
+func (x *History) AttachmentChunks(attachID string) ([]*models.AttachmentChunk, error) {
+	attachment, err := x.ar.GetByID(attachID)
+	if err != nil {
+		return nil, err
+	}
+	convID, err := x.attachmentConversation(attachment)
+	if err != nil {
+		return nil, err
+	}
+	if err := x.authorizeAny(convID); err != nil {
+		return nil, err
+	}
+	return x.acr.ListByAttachment(attachID)
+}
+
+// ChunkText 将文本按字符数分块，相邻分块重叠 overlap 个字符
+// 分块尽量在换行或句末标点处断开，断点只在分块最后20%的范围内查找
+// 参数:
+//   - text: 文本
+//   - size: 每块最多的字符数，小于等于0时使用 DefaultChunkSize
+//   - overlap: 相邻分块重叠的字符数，小于0时不重叠
+//
+// 返回:
+//   - []string: 分块列表，文本为空时返回nil
+func ChunkText(text string, size, overlap int) []string {
+	if size <= 0 {
+		size = DefaultChunkSize
+	}
+	if overlap < 0 {
+		overlap = 0
+	}
+	runes := []rune(strings.TrimSpace(text))
+
+	var chunks []string
+	for start := 0; start < len(runes); {
+		end := start + size
+		if end >= len(runes) {
+			end = len(runes)
+		} else {
+			for i := end - 1; i > start && i >= end-size/5; i-- {
+				if isChunkBreak(runes[i]) {
+					end = i + 1
+					break
+				}
+			}
+		}
+		if chunk := strings.TrimSpace(string(runes[start:end])); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		if end == len(runes) {
+			break
+		}
+		// 重叠过大时不再回退，保证每次都向后推进
+		if next := end - overlap; next > start {
+			start = next
+		} else {
+			start = end
+		}
+	}
+	return chunks
+}
+
+// isChunkBreak 判断字符是否适合作为分块的断点
+func isChunkBreak(r rune) bool {
+	switch r {
+	case '\n', '。', '！', '？', '；', '.', '!', '?', ';':
+		return true
+	}
+	return false
+}
+
+// scheduleIngest 在后台摄取附件，同一附件同时只有一个摄取任务
+func (x *History) scheduleIngest(attachID string) {
+	state := x.ingest
+	if state == nil {
+		return
+	}
+	if _, running := state.inflight.LoadOrStore(attachID, struct{}{}); running {
+		return
+	}
+
+	state.wg.Add(1)
+	go func() {
+		defer state.wg.Done()
+		defer state.inflight.Delete(attachID)
+
+		state.sem <- struct{}{}
+		defer func() { <-state.sem }()
+		x.runIngest(state, attachID)
+	}()
+}
+
+// runIngest 按退避策略重试摄取，重试前将状态恢复为等待中，重试耗尽后标记为失败
+func (x *History) runIngest(state *ingestState, attachID string) {
+	delay := state.config.RetryDelay
+	for attempt := 0; ; attempt++ {
+		err := x.ingestOnce(state, attachID)
+		if err == nil {
+			return
+		}
+
+		// 附件已被删除时不再重试
+		attachment, getErr := x.ar.GetByID(attachID)
+		if getErr != nil {
+			return
+		}
+		if attempt >= state.config.Retries {
+			_ = x.setIngestStatus(state, attachment, models.IngestStatusFailed, err.Error())
+			return
+		}
+		_ = x.setIngestStatus(state, attachment, models.IngestStatusPending, err.Error())
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// ingestOnce 执行一次摄取：提取文本、分块保存、生成摘要并向量化
+func (x *History) ingestOnce(state *ingestState, attachID string) error {
+	attachment, err := x.ar.GetByID(attachID)
+	if err != nil {
+		return err
+	}
+	attachment.IngestAttempts++
+	if err := x.setIngestStatus(state, attachment, models.IngestStatusProcessing, attachment.IngestError); err != nil {
+		return err
+	}
+
+	text, err := x.extractAttachmentText(state, attachment)
+	if err != nil {
+		return fmt.Errorf("提取附件文本失败: %v", err)
+	}
+	if strings.TrimSpace(text) == "" {
+		if err := x.dropAttachmentIndex(attachID); err != nil {
+			return err
+		}
+		return x.setIngestStatus(state, attachment, models.IngestStatusSkipped, "")
+	}
+
+	// 先移除旧分块的向量，新分块数可能少于旧分块数
+	if err := x.dropAttachmentEmbeddings(models.EmbeddingSourceAttachmentChunk, attachID); err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	var chunks []*models.AttachmentChunk
+	for i, content := range ChunkText(text, state.config.ChunkSize, state.config.ChunkOverlap) {
+		chunks = append(chunks, &models.AttachmentChunk{AttachmentID: attachID, Seq: i, Content: content, CreatedAt: now})
+	}
+	if err := x.acr.Replace(attachID, chunks); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), state.config.Timeout)
+	defer cancel()
+
+	if state.config.Summarizer != nil {
+		summary, err := summarizeText(ctx, state.config.Summarizer, attachment.FileName, text, state.config.SummaryMaxInput)
+		if err != nil {
+			return err
+		}
+		attachment.DataSummary = summary
+	}
+
+	if x.embedder != nil {
+		convID, err := x.attachmentConversation(attachment)
+		if err != nil {
+			return err
+		}
+		embeddings := make([]*models.Embedding, 0, len(chunks)+1)
+		for _, chunk := range chunks {
+			embeddings = append(embeddings, &models.Embedding{
+				SourceType:     models.EmbeddingSourceAttachmentChunk,
+				SourceID:       chunkSourceID(attachID, convID, chunk.Seq),
+				ConversationID: convID,
+				Content:        chunk.Content,
+			})
+		}
+		if attachment.DataSummary != "" {
+			embeddings = append(embeddings, &models.Embedding{
+				SourceType:     models.EmbeddingSourceAttachment,
+				SourceID:       attachmentSourceID(attachID, convID),
+				ConversationID: convID,
+				Content:        attachment.DataSummary,
+			})
+		}
+		if err := x.embedAndSave(ctx, embeddings); err != nil {
+			return err
+		}
+		attachment.Vectorized = true
+	}
+
+	attachment.IngestedAt = time.Now().Unix()
+	return x.setIngestStatus(state, attachment, models.IngestStatusDone, "")
+}
+
+// extractAttachmentText 读取附件内容并提取文本
+func (x *History) extractAttachmentText(state *ingestState, attachment *models.Attachment) (string, error) {
+	if attachment.ContentHash == "" {
+		return "", fmt.Errorf("附件 %s 没有保存内容", attachment.AttachID)
+	}
+	rc, err := x.attach.Store.Get(attachment.ContentHash)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	return state.config.Extractor.Extract(attachment, rc)
+}
+
+// setIngestStatus 更新附件的摄取状态并通知回调
+func (x *History) setIngestStatus(state *ingestState, attachment *models.Attachment, status, errMsg string) error {
+	attachment.IngestStatus = status
+	attachment.IngestError = errMsg
+	if err := x.ar.Update(attachment); err != nil {
+		return err
+	}
+	if state.config.OnStatus != nil {
+		state.config.OnStatus(attachment)
+	}
+	return nil
+}
+
+// dropAttachmentIndex 删除附件的分块及各会话中分块和摘要的向量
+func (x *History) dropAttachmentIndex(attachID string) error {
+	if err := x.dropAttachmentEmbeddings(models.EmbeddingSourceAttachmentChunk, attachID); err != nil {
+		return err
+	}
+	if err := x.acr.DeleteByAttachment(attachID); err != nil {
+		return err
+	}
+	return x.dropAttachmentEmbeddings(models.EmbeddingSourceAttachment, attachID)
+}
+
+// dropAttachmentEmbeddings 删除附件在全部会话中指定来源类型的向量，
+// 同时删除来源ID不含会话ID的旧格式向量(摘要为附件ID，分块为 <附件ID>#<分块序号>)
+func (x *History) dropAttachmentEmbeddings(sourceType, attachID string) error {
+	prefixes := []string{attachID + "@"}
+	if sourceType == models.EmbeddingSourceAttachmentChunk {
+		prefixes = append(prefixes, attachID+"#")
+	} else if err := x.dropEmbedding(sourceType, attachID); err != nil {
+		return err
+	}
+	for _, prefix := range prefixes {
+		if err := x.er.DeleteByPrefix(sourceType, prefix); err != nil {
+			return err
+		}
+		x.index.removePrefix(sourceType, prefix)
+	}
+	return nil
+}
+
+// attachmentSourceID 附件摘要向量的来源ID，格式为 <附件ID>@<会话ID>，
+// 分叉会话共享同一附件时各自保存向量，互不覆盖
+func attachmentSourceID(attachID, convID string) string {
+	return attachID + "@" + convID
+}
+
+// chunkSourceID 附件分块向量的来源ID，格式为 <附件ID>@<会话ID>#<分块序号>
+func chunkSourceID(attachID, convID string, seq int) string {
+	return fmt.Sprintf("%s#%d", attachmentSourceID(attachID, convID), seq)
+}
+
+// sourceAttachmentID 从附件摘要或分块向量的来源ID中取出附件ID
+func sourceAttachmentID(sourceID string) string {
+	if i := strings.IndexAny(sourceID, "@#"); i >= 0 {
+		return sourceID[:i]
+	}
+	return sourceID
+}
+
+// summarizeText 使用 ChatModel 概括附件文本，超过 maxInput 个字符的部分不参与概括
+func summarizeText(ctx context.Context, chatModel model.ChatModel, fileName, text string, maxInput int) (string, error) {
+	if runes := []rune(text); len(runes) > maxInput {
+		text = string(runes[:maxInput])
+	}
+
+	resp, err := chatModel.Generate(ctx, []*schema.Message{
+		schema.SystemMessage(summaryPrompt),
+		schema.UserMessage(fmt.Sprintf("文件名: %s\n\n%s", fileName, text)),
+	})
+	if err != nil {
+		return "", fmt.Errorf("模型生成摘要失败: %v", err)
+	}
+	summary := strings.TrimSpace(resp.Content)
+	if summary == "" {
+		return "", fmt.Errorf("模型返回的摘要为空")
+	}
+	return summary, nil
+}
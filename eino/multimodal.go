@@ -0,0 +1,534 @@
+package eino
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
+	"github.com/hildam/eino-history/model"
+	"github.com/hildam/eino-history/store/interfaces"
+)
+
+// 加载历史时附件在 MultiContent 中的表示方式
+const (
+	// MultimodalDataURL 读取附件内容内联为 base64 data URL，超过 MaxInlineSize 时使用附件引用
+	MultimodalDataURL = "data_url"
+	// MultimodalPresignedURL 使用附件存储生成的临时下载链接，附件存储不支持时回退为 MultimodalDataURL
+	MultimodalPresignedURL = "presigned_url"
+	// MultimodalReference 使用 attachment://<附件ID> 引用，由调用方通过 DownloadAttachment 读取
+	MultimodalReference = "reference"
+	// MultimodalText 提取附件文本作为文本片段，仅用于文档附件，无法提取文本时回退为附件引用
+	MultimodalText = "text"
+)
+
+// AttachmentURIPrefix 附件引用的 URI 前缀，完整形式为 attachment://<附件ID>
+// 保存消息时片段中的附件引用关联到已有附件，不会重复创建
+const AttachmentURIPrefix = "attachment://"
+
+const (
+	// defaultMultimodalURLExpires 临时下载链接的默认有效期
+	defaultMultimodalURLExpires = time.Hour
+	// defaultMaxInlineSize 内联为 data URL 的默认最大字节数
+	defaultMaxInlineSize = 4 << 20
+	// defaultMaxDocumentText 文档附件内联文本的默认最大字符数
+	defaultMaxDocumentText = 8000
+)
+
+// MultimodalConfig 加载历史时填充多模态内容的配置
+type MultimodalConfig struct {
+	// ImageMode 图片附件的表示方式，为空时使用 MultimodalDataURL
+	ImageMode string
+	// MediaMode 音频和视频附件的表示方式，取值同 ImageMode，为空时使用 MultimodalReference
+	MediaMode string
+	// DocumentMode 文档和代码附件的表示方式，可以使用 MultimodalText 及 ImageMode 的取值，为空时使用 MultimodalText
+	DocumentMode string
+	// URLExpires 临时下载链接的有效期，为0时使用默认值1小时
+	URLExpires time.Duration
+	// MaxInlineSize 内联为 data URL 的最大字节数，为0时使用默认值4MB
+	MaxInlineSize int64
+	// MaxDocumentText 文档附件内联文本的最大字符数，为0时使用默认值8000
+	MaxDocumentText int
+	// Extractor 文档附件的文本提取器，为nil时使用 ExtractText
+	Extractor TextExtractor
+}
+
+// messagePart 保存在消息元数据中的多模态片段布局，附件片段只记录附件ID
+type messagePart struct {
+	Type     schema.ChatMessagePartType `json:"type"`
+	Text     string                     `json:"text,omitempty"`
+	AttachID string                     `json:"attach_id,omitempty"`
+	Detail   schema.ImageURLDetail      `json:"detail,omitempty"`
+}
+
+// pendingAttachment 保存消息时由多模态片段创建或关联的附件
+type pendingAttachment struct {
+	attachment *models.Attachment
+	data       []byte // data URL 解码后的内容，为nil时只保存链接
+	existing   bool   // 已有附件，只创建关联
+}
+
+// SetMultimodal 开启加载历史时填充多模态内容，为nil时关闭
+// 开启后 GetHistory 将消息关联的附件按配置转换为 schema.Message.MultiContent 中的片段，Content 保持不变
+// 保存消息时 MultiContent 中的附件片段总会创建附件和关联，不受该配置影响
+// 参数:
+//   - config: 多模态内容配置
+func (x *History) SetMultimodal(config *MultimodalConfig) {
+	if config == nil {
+		x.multimodal = nil
+		return
+	}
+
+	cfg := *config
+	if cfg.ImageMode == "" {
+		cfg.ImageMode = MultimodalDataURL
+	}
+	if cfg.MediaMode == "" {
+		cfg.MediaMode = MultimodalReference
+	}
+	if cfg.DocumentMode == "" {
+		cfg.DocumentMode = MultimodalText
+	}
+	if cfg.URLExpires <= 0 {
+		cfg.URLExpires = defaultMultimodalURLExpires
+	}
+	if cfg.MaxInlineSize <= 0 {
+		cfg.MaxInlineSize = defaultMaxInlineSize
+	}
+	if cfg.MaxDocumentText <= 0 {
+		cfg.MaxDocumentText = defaultMaxDocumentText
+	}
+	if cfg.Extractor == nil {
+		cfg.Extractor = TextExtractorFunc(ExtractText)
+	}
+	x.multimodal = &cfg
+}
+
+// hydrateMessages 将消息关联的附件填充到对应 schema.Message 的 MultiContent
+// 附件关联和附件各批量读取一次，往返次数不随消息数量增加
+func (x *History) hydrateMessages(mess []*models.Message, list []*schema.Message) error {
+	if len(mess) == 0 {
+		return nil
+	}
+	msgIDs := make([]string, len(mess))
+	for i, m := range mess {
+		msgIDs[i] = m.MsgID
+	}
+	links, err := x.mar.ListByMessages(msgIDs)
+	if err != nil {
+		return err
+	}
+
+	linked := make(map[string][]string, len(mess))
+	var attachIDs []string
+	seen := make(map[string]bool, len(links))
+	for _, link := range links {
+		linked[link.MessageID] = append(linked[link.MessageID], link.AttachmentID)
+		if !seen[link.AttachmentID] {
+			seen[link.AttachmentID] = true
+			attachIDs = append(attachIDs, link.AttachmentID)
+		}
+	}
+	// 找不到的附件(如已被回收)不填充
+	found, err := x.ar.GetByIDs(attachIDs)
+	var batchErr *models.BatchError
+	if err != nil && !errors.As(err, &batchErr) {
+		return err
+	}
+	byID := make(map[string]*models.Attachment, len(found))
+	for _, attachment := range found {
+		byID[attachment.AttachID] = attachment
+	}
+
+	for i, m := range mess {
+		attachments := make(map[string]*models.Attachment, len(linked[m.MsgID]))
+		for _, id := range linked[m.MsgID] {
+			// 关联的附件记录已不存在时跳过
+			if attachment, ok := byID[id]; ok {
+				attachments[id] = attachment
+			}
+		}
+		list[i].MultiContent = x.messageParts(m, attachments)
+	}
+	return nil
+}
+
+// messageParts 按保存时的片段布局还原多模态片段，没有附件和布局时返回nil
+// 布局之外关联的附件(如通过 UploadAttachment 上传)按创建时间追加在最后
+func (x *History) messageParts(m *models.Message, attachments map[string]*models.Attachment) []schema.ChatMessagePart {
+	var layout []messagePart
+	var digest string
+	if extra := decodeMessageExtra(m.Metadata); extra != nil {
+		layout, digest = extra.Parts, extra.ContentDigest
+	}
+	if len(attachments) == 0 && len(layout) == 0 {
+		return nil
+	}
+
+	// 消息内容在保存后被编辑时，布局中的文本已过期，改用当前内容
+	// 没有内容摘要的旧消息以布局中文本的拼接结果比较
+	textStale := partsText(layout) != m.Content
+	if digest != "" {
+		textStale = contentDigest(m.Content) != digest
+	}
+	var parts []schema.ChatMessagePart
+	if textStale && m.Content != "" {
+		parts = append(parts, schema.ChatMessagePart{Type: schema.ChatMessagePartTypeText, Text: m.Content})
+	}
+	placed := make(map[string]bool)
+	for _, p := range layout {
+		if p.AttachID == "" {
+			if !textStale {
+				parts = append(parts, schema.ChatMessagePart{Type: schema.ChatMessagePartTypeText, Text: p.Text})
+			}
+			continue
+		}
+		attachment := attachments[p.AttachID]
+		if attachment == nil || placed[p.AttachID] {
+			continue
+		}
+		placed[p.AttachID] = true
+		parts = append(parts, x.attachmentPart(attachment, p.Detail))
+	}
+
+	var rest []*models.Attachment
+	for id, attachment := range attachments {
+		if !placed[id] {
+			rest = append(rest, attachment)
+		}
+	}
+	sort.Slice(rest, func(i, j int) bool {
+		if rest[i].CreatedAt != rest[j].CreatedAt {
+			return rest[i].CreatedAt < rest[j].CreatedAt
+		}
+		return rest[i].AttachID < rest[j].AttachID
+	})
+	for _, attachment := range rest {
+		parts = append(parts, x.attachmentPart(attachment, ""))
+	}
+	return parts
+}
+
+// attachmentPart 按附件类型和配置将附件转换为多模态片段
+func (x *History) attachmentPart(attachment *models.Attachment, detail schema.ImageURLDetail) schema.ChatMessagePart {
+	cfg := x.multimodal
+	switch attachment.AttachmentType {
+	case "image":
+		link, uri := x.attachmentURL(attachment, cfg.ImageMode)
+		return schema.ChatMessagePart{Type: schema.ChatMessagePartTypeImageURL, ImageURL: &schema.ChatMessageImageURL{
+			URL: link, URI: uri, Detail: detail, MIMEType: attachment.MimeType,
+		}}
+	case "audio":
+		link, uri := x.attachmentURL(attachment, cfg.MediaMode)
+		return schema.ChatMessagePart{Type: schema.ChatMessagePartTypeAudioURL, AudioURL: &schema.ChatMessageAudioURL{
+			URL: link, URI: uri, MIMEType: attachment.MimeType,
+		}}
+	case "video":
+		link, uri := x.attachmentURL(attachment, cfg.MediaMode)
+		return schema.ChatMessagePart{Type: schema.ChatMessagePartTypeVideoURL, VideoURL: &schema.ChatMessageVideoURL{
+			URL: link, URI: uri, MIMEType: attachment.MimeType,
+		}}
+	}
+
+	mode := cfg.DocumentMode
+	if mode == MultimodalText {
+		if text := x.attachmentText(attachment); text != "" {
+			return schema.ChatMessagePart{
+				Type: schema.ChatMessagePartTypeText,
+				Text: fmt.Sprintf("附件 %s:\n%s", attachment.FileName, text),
+			}
+		}
+		mode = MultimodalReference
+	}
+	link, uri := x.attachmentURL(attachment, mode)
+	return schema.ChatMessagePart{Type: schema.ChatMessagePartTypeFileURL, FileURL: &schema.ChatMessageFileURL{
+		URL: link, URI: uri, MIMEType: attachment.MimeType, Name: attachment.FileName,
+	}}
+}
+
+// attachmentURL 按表示方式生成附件的链接，无法生成链接时返回附件引用 URI
+// 外部链接附件总是使用原链接
+func (x *History) attachmentURL(attachment *models.Attachment, mode string) (string, string) {
+	if attachment.StorageType == models.StorageTypeURL {
+		return attachment.StoragePath, ""
+	}
+	reference := AttachmentURIPrefix + attachment.AttachID
+	if attachment.ContentHash == "" {
+		return "", reference
+	}
+
+	if mode == MultimodalPresignedURL {
+		if presigner, ok := x.attach.Store.(interfaces.BlobPresigner); ok {
+			if link, err := presigner.PresignGet(attachment.ContentHash, x.multimodal.URLExpires); err == nil {
+				return link, ""
+			}
+		}
+		mode = MultimodalDataURL
+	}
+	if mode != MultimodalDataURL || attachment.FileSize > x.multimodal.MaxInlineSize {
+		return "", reference
+	}
+
+	rc, err := x.attach.Store.Get(attachment.ContentHash)
+	if err != nil {
+		return "", reference
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return "", reference
+	}
+	mimeType := attachment.MimeType
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data), ""
+}
+
+// attachmentText 提取文档附件的文本，超过 MaxDocumentText 个字符时截断，无法提取时返回空
+func (x *History) attachmentText(attachment *models.Attachment) string {
+	if attachment.ContentHash == "" {
+		return ""
+	}
+	rc, err := x.attach.Store.Get(attachment.ContentHash)
+	if err != nil {
+		return ""
+	}
+	defer rc.Close()
+	text, err := x.multimodal.Extractor.Extract(attachment, rc)
+	if err != nil {
+		return ""
+	}
+	text = strings.TrimSpace(text)
+	if runes := []rune(text); len(runes) > x.multimodal.MaxDocumentText {
+		text = string(runes[:x.multimodal.MaxDocumentText]) + "\n...(已截断)"
+	}
+	return text
+}
+
+// captureParts 解析消息的多模态片段，返回片段布局和需要创建或关联的附件
+// data URL 解码后保存到附件存储，attachment:// 引用关联到已有附件，其他链接只保存链接
+// 新建的附件在保存消息前按附件配置校验，校验失败时不保存消息
+func (x *History) captureParts(mess *schema.Message, convID string) ([]messagePart, []*pendingAttachment, error) {
+	var layout []messagePart
+	var pending []*pendingAttachment
+	var pendingSize int64
+	seen := make(map[string]bool)
+	for i, part := range mess.MultiContent {
+		if part.Type == schema.ChatMessagePartTypeText {
+			layout = append(layout, messagePart{Type: part.Type, Text: part.Text})
+			continue
+		}
+
+		var link, mimeType, name, attachmentType string
+		var detail schema.ImageURLDetail
+		switch {
+		case part.Type == schema.ChatMessagePartTypeImageURL && part.ImageURL != nil:
+			link, mimeType, detail, attachmentType = firstNonEmpty(part.ImageURL.URL, part.ImageURL.URI), part.ImageURL.MIMEType, part.ImageURL.Detail, "image"
+		case part.Type == schema.ChatMessagePartTypeAudioURL && part.AudioURL != nil:
+			link, mimeType, attachmentType = firstNonEmpty(part.AudioURL.URL, part.AudioURL.URI), part.AudioURL.MIMEType, "audio"
+		case part.Type == schema.ChatMessagePartTypeVideoURL && part.VideoURL != nil:
+			link, mimeType, attachmentType = firstNonEmpty(part.VideoURL.URL, part.VideoURL.URI), part.VideoURL.MIMEType, "video"
+		case part.Type == schema.ChatMessagePartTypeFileURL && part.FileURL != nil:
+			link, mimeType, name, attachmentType = firstNonEmpty(part.FileURL.URL, part.FileURL.URI), part.FileURL.MIMEType, part.FileURL.Name, "file"
+		default:
+			return nil, nil, fmt.Errorf("第 %d 个消息片段的类型 %q 不支持或缺少内容", i, part.Type)
+		}
+		if link == "" {
+			return nil, nil, fmt.Errorf("第 %d 个消息片段没有链接", i)
+		}
+
+		p, err := x.partAttachment(link, mimeType, name, attachmentType)
+		if err != nil {
+			return nil, nil, fmt.Errorf("第 %d 个消息片段无效: %w", i, err)
+		}
+		if !p.existing {
+			if err := x.inspectAttachment(p.attachment, p.data); err != nil {
+				return nil, nil, err
+			}
+			if p.data != nil {
+				if err := x.checkAttachmentSize(p.attachment, int64(len(p.data)), pendingSize, convID); err != nil {
+					return nil, nil, err
+				}
+				pendingSize += int64(len(p.data))
+			}
+		}
+		layout = append(layout, messagePart{Type: part.Type, AttachID: p.attachment.AttachID, Detail: detail})
+		if !seen[p.attachment.AttachID] {
+			seen[p.attachment.AttachID] = true
+			pending = append(pending, p)
+		}
+	}
+	return layout, pending, nil
+}
+
+// partAttachment 根据片段链接创建待保存的附件
+func (x *History) partAttachment(link, mimeType, name, attachmentType string) (*pendingAttachment, error) {
+	if attachID, ok := strings.CutPrefix(link, AttachmentURIPrefix); ok {
+		attachment, err := x.ar.GetByID(attachID)
+		if err != nil {
+			return nil, err
+		}
+		convID, err := x.attachmentConversation(attachment)
+		if err != nil {
+			return nil, err
+		}
+		if err := x.authorizeAny(convID); err != nil {
+			return nil, err
+		}
+		return &pendingAttachment{attachment: attachment, existing: true}, nil
+	}
+
+	attachment := &models.Attachment{
+		AttachID:       uuid.NewString(),
+		AttachmentType: attachmentType,
+		FileName:       name,
+		MimeType:       mimeType,
+	}
+	if strings.HasPrefix(link, "data:") {
+		dataType, data, err := decodeDataURL(link)
+		if err != nil {
+			return nil, err
+		}
+		if attachment.MimeType == "" {
+			attachment.MimeType = dataType
+		}
+		if attachment.FileName == "" {
+			attachment.FileName = attachmentType
+		}
+		return &pendingAttachment{attachment: attachment, data: data}, nil
+	}
+
+	attachment.StorageType = models.StorageTypeURL
+	attachment.StoragePath = link
+	if attachment.FileName == "" {
+		attachment.FileName = attachmentType
+		if u, err := url.Parse(link); err == nil {
+			if base := path.Base(u.Path); base != "." && base != "/" {
+				attachment.FileName = base
+			}
+		}
+	}
+	return &pendingAttachment{attachment: attachment}, nil
+}
+
+// storePartAttachments 保存 data URL 片段的内容并补全新建附件的字段，不创建附件记录
+func (x *History) storePartAttachments(msgID, convID string, pending []*pendingAttachment) error {
+	now := time.Now().Unix()
+	for _, p := range pending {
+		switch {
+		case p.existing:
+		case p.data != nil:
+			if err := x.storeAttachment(p.attachment, msgID, convID, bytes.NewReader(p.data)); err != nil {
+				return err
+			}
+		default:
+			p.attachment.MessageID = msgID
+			p.attachment.CreatedAt = now
+		}
+	}
+	return nil
+}
+
+// createPartAttachments 在事务中创建片段的新附件，并把全部附件关联到消息
+func createPartAttachments(tx interfaces.TxStores, msgID string, pending []*pendingAttachment) error {
+	for _, p := range pending {
+		if p.existing {
+			if err := tx.GetMessageAttachmentStore().Create(&models.MessageAttachment{
+				MessageID: msgID, AttachmentID: p.attachment.AttachID,
+			}); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := createAttachment(tx, msgID, p.attachment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finishPartAttachments 为 data URL 片段记录附件上传的审计事件，保存成功时开始摄取，返回最终错误
+func (x *History) finishPartAttachments(convID string, pending []*pendingAttachment, err error) error {
+	result := err
+	for _, p := range pending {
+		if p.data == nil {
+			continue
+		}
+		if err == nil {
+			x.scheduleIngest(p.attachment.AttachID)
+		}
+		auditErr := x.audited(&models.AuditEvent{
+			Action: models.AuditAttachmentUpload, ConversationID: convID, TargetID: p.attachment.AttachID,
+		}, err)
+		if result == nil {
+			result = auditErr
+		}
+	}
+	return result
+}
+
+// decodeDataURL 解析 RFC 2397 data URL，返回媒体类型和内容
+func decodeDataURL(link string) (string, []byte, error) {
+	header, payload, ok := strings.Cut(strings.TrimPrefix(link, "data:"), ",")
+	if !ok {
+		return "", nil, fmt.Errorf("data URL 格式错误")
+	}
+	mediaType, isBase64 := strings.CutSuffix(header, ";base64")
+	mediaType, _, _ = strings.Cut(mediaType, ";")
+	if mediaType == "" {
+		mediaType = "text/plain"
+	}
+
+	if isBase64 {
+		data, err := base64.StdEncoding.DecodeString(payload)
+		if err != nil {
+			if data, err = base64.RawStdEncoding.DecodeString(payload); err != nil {
+				return "", nil, fmt.Errorf("data URL 的 base64 内容无效: %v", err)
+			}
+		}
+		return mediaType, data, nil
+	}
+	data, err := url.PathUnescape(payload)
+	if err != nil {
+		return "", nil, fmt.Errorf("data URL 的内容无效: %v", err)
+	}
+	return mediaType, []byte(data), nil
+}
+
+// partsText 拼接片段布局中的文本
+func partsText(layout []messagePart) string {
+	var texts []string
+	for _, p := range layout {
+		if p.AttachID == "" {
+			texts = append(texts, p.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// contentDigest 返回消息内容的 SHA-256，十六进制小写
+func contentDigest(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// firstNonEmpty 返回第一个非空字符串
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
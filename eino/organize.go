@@ -0,0 +1,350 @@
+package eino
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hildam/eino-history/model"
+)
+
+// CreateTag 在当前归属范围内创建标签
+// 参数:
+//   - name: 标签名称，首尾空白会被去除
+//   - color: 标签颜色，可以为空
+//
+// 返回:
+//   - *models.Tag: 创建的标签
+//   - error: 如果名称无效、已存在同名标签(models.ErrNameConflict)或创建过程中发生错误
+func (x *History) CreateTag(name, color string) (tag *models.Tag, err error) {
+	defer func() { x.auditCall(&err, models.AuditTagCreate, "", tagIDOf(tag)) }()
+
+	name, err = organizeName(name)
+	if err != nil {
+		return nil, err
+	}
+	tenantID, userID := x.scope()
+	tag = &models.Tag{TenantID: tenantID, UserID: userID, Name: name, Color: color}
+	if err := x.tr.Create(tag); err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// ListTags 获取当前归属范围内的全部标签
+// 返回:
+//   - []*models.Tag: 按名称排序的标签列表
+//   - error: 如果获取过程中发生错误
+func (x *History) ListTags() ([]*models.Tag, error) {
+	return x.tr.List(x.scope())
+}
+
+// RenameTag 重命名标签，已添加标签的会话不受影响
+// 参数:
+//   - tagID: 标签ID
+//   - name: 新名称
+//
+// 返回:
+//   - error: 如果名称无效、已存在同名标签(models.ErrNameConflict)或重命名过程中发生错误
+func (x *History) RenameTag(tagID, name string) (err error) {
+	defer x.auditCall(&err, models.AuditTagRename, "", tagID)
+	name, err = organizeName(name)
+	if err != nil {
+		return err
+	}
+	if _, err := x.getTag(tagID); err != nil {
+		return err
+	}
+	return x.tr.Rename(tagID, name)
+}
+
+// DeleteTag 删除标签，并从全部会话上移除该标签
+// 参数:
+//   - tagID: 标签ID
+//
+// 返回:
+//   - error: 如果删除过程中发生错误
+func (x *History) DeleteTag(tagID string) (err error) {
+	defer x.auditCall(&err, models.AuditTagDelete, "", tagID)
+	if _, err := x.getTag(tagID); err != nil {
+		return err
+	}
+	return x.tr.Delete(tagID)
+}
+
+// TagConversation 为会话添加标签
+// 参数:
+//   - convID: 会话ID
+//   - tagID: 标签ID
+//
+// 返回:
+//   - error: 如果会话或标签不存在或添加过程中发生错误
+func (x *History) TagConversation(convID, tagID string) (err error) {
+	defer x.auditCall(&err, models.AuditConversationTag, convID, tagID)
+	if err := x.authorize(convID); err != nil {
+		return err
+	}
+	if _, err := x.getTag(tagID); err != nil {
+		return err
+	}
+	return x.tr.AddToConversation(convID, tagID)
+}
+
+// UntagConversation 移除会话的标签
+// 参数:
+//   - convID: 会话ID
+//   - tagID: 标签ID
+//
+// 返回:
+//   - error: 如果移除过程中发生错误
+func (x *History) UntagConversation(convID, tagID string) (err error) {
+	defer x.auditCall(&err, models.AuditConversationUntag, convID, tagID)
+	if err := x.authorize(convID); err != nil {
+		return err
+	}
+	return x.tr.RemoveFromConversation(convID, tagID)
+}
+
+// ConversationTags 获取会话的全部标签
+// 参数:
+//   - convID: 会话ID
+//
+// 返回:
+//   - []*models.Tag: 按名称排序的标签列表
+//   - error: 如果获取过程中发生错误
+func (x *History) ConversationTags(convID string) ([]*models.Tag, error) {
+	if err := x.authorize(convID); err != nil {
+		return nil, err
+	}
+	return x.tr.ListByConversation(convID)
+}
+
+// ListConversationsByTag 按更新时间降序获取带有标签的会话
+// 参数:
+//   - tagID: 标签ID
+//   - offset: 分页偏移量
+//   - limit: 返回会话数量上限
+//
+// 返回:
+//   - []*models.Conversation: 会话列表
+//   - error: 如果获取过程中发生错误
+func (x *History) ListConversationsByTag(tagID string, offset, limit int) ([]*models.Conversation, error) {
+	if _, err := x.getTag(tagID); err != nil {
+		return nil, err
+	}
+	return x.tr.ListConversations(tagID, offset, limit)
+}
+
+// CreateFolder 在当前归属范围内创建文件夹
+// 参数:
+//   - name: 文件夹名称，首尾空白会被去除
+//   - parentID: 父文件夹ID，为空时创建在根目录
+//
+// 返回:
+//   - *models.Folder: 创建的文件夹
+//   - error: 如果名称无效、父文件夹不存在、同级已存在同名文件夹(models.ErrNameConflict)或创建过程中发生错误
+func (x *History) CreateFolder(name, parentID string) (folder *models.Folder, err error) {
+	defer func() { x.auditCall(&err, models.AuditFolderCreate, "", folderIDOf(folder)) }()
+
+	name, err = organizeName(name)
+	if err != nil {
+		return nil, err
+	}
+	tenantID, userID := x.scope()
+	folder = &models.Folder{TenantID: tenantID, UserID: userID, ParentID: parentID, Name: name}
+	if err := x.fdr.Create(folder); err != nil {
+		return nil, err
+	}
+	return folder, nil
+}
+
+// ListFolders 获取当前归属范围内的全部文件夹，可按 ParentID 组装为树
+// 返回:
+//   - []*models.Folder: 按名称排序的文件夹列表
+//   - error: 如果获取过程中发生错误
+func (x *History) ListFolders() ([]*models.Folder, error) {
+	return x.fdr.List(x.scope())
+}
+
+// FolderPath 获取从根目录到文件夹的路径
+// 参数:
+//   - folderID: 文件夹ID
+//
+// 返回:
+//   - []*models.Folder: 路径上的文件夹，第一个为根文件夹，最后一个为该文件夹
+//   - error: 如果文件夹不存在或获取过程中发生错误
+func (x *History) FolderPath(folderID string) ([]*models.Folder, error) {
+	var path []*models.Folder
+	for id := folderID; id != ""; {
+		folder, err := x.getFolder(id)
+		if err != nil {
+			return nil, err
+		}
+		path = append([]*models.Folder{folder}, path...)
+		id = folder.ParentID
+	}
+	return path, nil
+}
+
+// RenameFolder 重命名文件夹，子文件夹和其中的会话不受影响
+// 参数:
+//   - folderID: 文件夹ID
+//   - name: 新名称
+//
+// 返回:
+//   - error: 如果名称无效、同级已存在同名文件夹(models.ErrNameConflict)或重命名过程中发生错误
+func (x *History) RenameFolder(folderID, name string) (err error) {
+	defer x.auditCall(&err, models.AuditFolderRename, "", folderID)
+	name, err = organizeName(name)
+	if err != nil {
+		return err
+	}
+	if _, err := x.getFolder(folderID); err != nil {
+		return err
+	}
+	return x.fdr.Rename(folderID, name)
+}
+
+// MoveFolder 移动文件夹到新的父文件夹下，子文件夹和其中的会话随之移动
+// 参数:
+//   - folderID: 文件夹ID
+//   - parentID: 新的父文件夹ID，为空时移动到根目录
+//
+// 返回:
+//   - error: 如果移动到自身或子文件夹下(models.ErrFolderCycle)、同级已存在同名文件夹(models.ErrNameConflict)或移动过程中发生错误
+func (x *History) MoveFolder(folderID, parentID string) (err error) {
+	defer x.auditCall(&err, models.AuditFolderMove, "", folderID)
+	if _, err := x.getFolder(folderID); err != nil {
+		return err
+	}
+	return x.fdr.Move(folderID, parentID)
+}
+
+// DeleteFolder 删除文件夹及其全部子文件夹，其中的会话移出文件夹，会话本身不会被删除
+// 参数:
+//   - folderID: 文件夹ID
+//
+// 返回:
+//   - error: 如果删除过程中发生错误
+func (x *History) DeleteFolder(folderID string) (err error) {
+	defer x.auditCall(&err, models.AuditFolderDelete, "", folderID)
+	if _, err := x.getFolder(folderID); err != nil {
+		return err
+	}
+	return x.fdr.Delete(folderID)
+}
+
+// MoveConversation 将会话移动到文件夹
+// 参数:
+//   - convID: 会话ID
+//   - folderID: 文件夹ID，为空时将会话移出文件夹
+//
+// 返回:
+//   - error: 如果会话或文件夹不存在或移动过程中发生错误
+func (x *History) MoveConversation(convID, folderID string) (err error) {
+	defer x.auditCall(&err, models.AuditConversationMove, convID, folderID)
+	if err := x.authorize(convID); err != nil {
+		return err
+	}
+	if folderID != "" {
+		if _, err := x.getFolder(folderID); err != nil {
+			return err
+		}
+	}
+	return x.fdr.SetConversationFolder(convID, folderID)
+}
+
+// ConversationFolder 获取会话所在的文件夹ID
+// 参数:
+//   - convID: 会话ID
+//
+// 返回:
+//   - string: 文件夹ID，不在文件夹中时为空
+//   - error: 如果获取过程中发生错误
+func (x *History) ConversationFolder(convID string) (string, error) {
+	if err := x.authorize(convID); err != nil {
+		return "", err
+	}
+	return x.fdr.GetConversationFolder(convID)
+}
+
+// ListConversationsInFolder 按更新时间降序获取文件夹中的会话，不包括子文件夹中的会话
+// 参数:
+//   - folderID: 文件夹ID
+//   - offset: 分页偏移量
+//   - limit: 返回会话数量上限
+//
+// 返回:
+//   - []*models.Conversation: 会话列表
+//   - error: 如果获取过程中发生错误
+func (x *History) ListConversationsInFolder(folderID string, offset, limit int) ([]*models.Conversation, error) {
+	if _, err := x.getFolder(folderID); err != nil {
+		return nil, err
+	}
+	return x.fdr.ListConversations(folderID, offset, limit)
+}
+
+// scope 返回标签和文件夹的归属，未限定归属范围时为空
+func (x *History) scope() (tenantID, userID string) {
+	if x.owner == nil {
+		return "", ""
+	}
+	return x.owner.TenantID, x.owner.UserID
+}
+
+// ownsItem 判断标签或文件夹是否属于当前归属范围
+func (x *History) ownsItem(tenantID, userID string) bool {
+	return x.owner == nil || (tenantID == x.owner.TenantID && (x.owner.UserID == "" || userID == x.owner.UserID))
+}
+
+// getTag 获取标签并校验归属
+func (x *History) getTag(tagID string) (*models.Tag, error) {
+	tag, err := x.tr.GetByID(tagID)
+	if err != nil {
+		return nil, err
+	}
+	if !x.ownsItem(tag.TenantID, tag.UserID) {
+		return nil, ErrForbidden
+	}
+	return tag, nil
+}
+
+// getFolder 获取文件夹并校验归属
+func (x *History) getFolder(folderID string) (*models.Folder, error) {
+	folder, err := x.fdr.GetByID(folderID)
+	if err != nil {
+		return nil, err
+	}
+	if !x.ownsItem(folder.TenantID, folder.UserID) {
+		return nil, ErrForbidden
+	}
+	return folder, nil
+}
+
+// tagIDOf 返回标签ID，标签为nil时返回空
+func tagIDOf(tag *models.Tag) string {
+	if tag == nil {
+		return ""
+	}
+	return tag.TagID
+}
+
+// folderIDOf 返回文件夹ID，文件夹为nil时返回空
+func folderIDOf(folder *models.Folder) string {
+	if folder == nil {
+		return ""
+	}
+	return folder.FolderID
+}
+
+// organizeName 校验并规范标签或文件夹名称
+func organizeName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("名称不能为空")
+	}
+	if utf8.RuneCountInString(name) > models.MaxOrganizeNameLength {
+		return "", fmt.Errorf("名称不能超过 %d 个字符", models.MaxOrganizeNameLength)
+	}
+	return name, nil
+}
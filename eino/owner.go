@@ -0,0 +1,90 @@
+package eino
+
+import (
+	"errors"
+
+	"github.com/hildam/eino-history/model"
+)
+
+// ErrForbidden 当前归属范围无权访问该会话
+var ErrForbidden = errors.New("无权访问该会话")
+
+// ownerPageSize 读取归属范围内全部会话时的分页大小
+const ownerPageSize = 100
+
+// WithOwner 返回限定在指定租户和用户范围内的历史实例
+// 限定后的实例只能读写属于该范围的会话，新建的会话自动归属该范围，
+// 访问其他范围的会话时返回 ErrForbidden。返回的实例与原实例共享数据库连接和审计配置
+// 参数:
+//   - tenantID: 租户ID
+//   - userID: 用户ID，为空时可访问租户下全部用户的会话
+//
+// 返回:
+//   - *History: 限定归属范围的历史实例
+func (x *History) WithOwner(tenantID, userID string) *History {
+	scoped := *x
+	scoped.owner = &models.Owner{TenantID: tenantID, UserID: userID}
+	return &scoped
+}
+
+// Owner 返回当前实例的归属范围
+// 返回:
+//   - *models.Owner: 归属范围，未限定时返回nil
+func (x *History) Owner() *models.Owner {
+	return x.owner
+}
+
+// authorize 校验会话是否属于当前归属范围，未限定归属范围时不做校验
+func (x *History) authorize(convID string) error {
+	if x.owner == nil {
+		return nil
+	}
+	conv, err := x.cr.GetByID(convID)
+	if err != nil {
+		return err
+	}
+	if !x.owner.Owns(conv) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// ensureConversation 查找会话，不存在时在当前归属范围内创建，并校验归属
+func (x *History) ensureConversation(convID string) (*models.Conversation, error) {
+	if x.owner == nil {
+		return x.cr.FirstOrCreat(convID)
+	}
+	conv, err := x.cr.FirstOrCreatForOwner(convID, x.owner.TenantID, x.owner.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !x.owner.Owns(conv) {
+		return nil, ErrForbidden
+	}
+	return conv, nil
+}
+
+// listConversations 按当前归属范围分页读取会话
+func (x *History) listConversations(offset, limit int) ([]*models.Conversation, error) {
+	if x.owner == nil {
+		return x.cr.List(offset, limit)
+	}
+	return x.cr.ListByOwner(x.owner.TenantID, x.owner.UserID, offset, limit)
+}
+
+// ownedConvIDs 读取当前归属范围内的全部会话ID
+func (x *History) ownedConvIDs() ([]string, error) {
+	var convIDs []string
+	for offset := 0; ; offset += ownerPageSize {
+		convs, err := x.listConversations(offset, ownerPageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, conv := range convs {
+			convIDs = append(convIDs, conv.ConvID)
+		}
+		if len(convs) < ownerPageSize {
+			return convIDs, nil
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package eino
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/hildam/eino-history/model"
+)
+
+// Preview 附件预览的生成结果
+type Preview struct {
+	// Thumbnail 缩略图(JPEG)，为空时不修改附件的缩略图
+	Thumbnail []byte
+	// Text 文本预览，为空时不修改附件的文本预览
+	Text string
+	// Metadata 元数据，如图片尺寸、视频时长，与附件已有的元数据合并
+	Metadata map[string]interface{}
+}
+
+// Previewer 附件预览生成器
+type Previewer interface {
+	// Preview 读取附件内容生成预览
+	// 参数:
+	//   - attachment: 附件信息
+	//   - r: 附件内容
+	// 返回:
+	//   - *Preview: 预览，不支持该内容时返回nil
+	//   - error: 如果内容无法解析
+	Preview(attachment *models.Attachment, r io.Reader) (*Preview, error)
+}
+
+// PreviewerFunc 函数形式的预览生成器
+type PreviewerFunc func(attachment *models.Attachment, r io.Reader) (*Preview, error)
+
+// Preview 实现 Previewer 接口
+func (f PreviewerFunc) Preview(attachment *models.Attachment, r io.Reader) (*Preview, error) {
+	return f(attachment, r)
+}
+
+// DefaultPreviewers 默认的预览生成器，按附件类型选择
+// 图片生成缩略图并提取尺寸，代码和文本文件生成首页预览，视频提取尺寸和时长，音频不生成预览
+// 返回的 map 可以修改后用于 AttachmentConfig.Previewers，删除某个类型即关闭该类型的预览
+func DefaultPreviewers() map[string]Previewer {
+	text := &TextPreviewer{}
+	return map[string]Previewer{
+		"image": &ImagePreviewer{},
+		"code":  text,
+		"file":  text,
+		"video": &VideoPreviewer{},
+	}
+}
+
+// GeneratePreview 重新生成附件的预览，用于配置变化后或预览功能开启前上传的附件
+// 参数:
+//   - attachID: 附件ID
+//
+// 返回:
+//   - error: 如果附件不存在、没有保存内容或生成过程中发生错误
+func (x *History) GeneratePreview(attachID string) error {
+	attachment, err := x.ar.GetByID(attachID)
+	if err != nil {
+		return err
+	}
+	convID, err := x.attachmentConversation(attachment)
+	if err != nil {
+		return err
+	}
+	if err := x.authorize(convID); err != nil {
+		return err
+	}
+	if attachment.ContentHash == "" {
+		return fmt.Errorf("附件 %s 没有保存内容", attachID)
+	}
+
+	if err := x.applyPreview(attachment); err != nil {
+		return err
+	}
+	return x.ar.Update(attachment)
+}
+
+// previewAttachment 上传时生成预览，失败时交给 OnPreviewError 处理，不影响上传
+func (x *History) previewAttachment(attachment *models.Attachment) {
+	if err := x.applyPreview(attachment); err != nil && x.attach.OnPreviewError != nil {
+		x.attach.OnPreviewError(attachment, err)
+	}
+}
+
+// applyPreview 读取附件内容生成预览并写入附件，附件类型没有预览生成器时不做处理
+func (x *History) applyPreview(attachment *models.Attachment) error {
+	previewer := x.attach.Previewers[attachment.AttachmentType]
+	if previewer == nil {
+		return nil
+	}
+
+	rc, err := x.attach.Store.Get(attachment.ContentHash)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	preview, err := previewer.Preview(attachment, rc)
+	if err != nil || preview == nil {
+		return err
+	}
+
+	if len(preview.Thumbnail) > 0 {
+		attachment.Thumbnail = preview.Thumbnail
+	}
+	if preview.Text != "" {
+		attachment.PreviewText = preview.Text
+	}
+	if len(preview.Metadata) > 0 {
+		var metadata map[string]interface{}
+		if len(attachment.Metadata) > 0 {
+			_ = json.Unmarshal(attachment.Metadata, &metadata)
+		}
+		if metadata == nil {
+			metadata = make(map[string]interface{})
+		}
+		for k, v := range preview.Metadata {
+			metadata[k] = v
+		}
+		data, err := json.Marshal(metadata)
+		if err != nil {
+			return err
+		}
+		attachment.Metadata = data
+	}
+	return nil
+}
@@ -0,0 +1,399 @@
+package eino
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // 注册GIF解码器
+	"image/jpeg"
+	_ "image/png" // 注册PNG解码器
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hildam/eino-history/model"
+)
+
+const (
+	// defaultThumbnailSize 缩略图长边的默认像素数
+	defaultThumbnailSize = 256
+	// defaultThumbnailQuality 缩略图的默认JPEG质量
+	defaultThumbnailQuality = 80
+	// defaultMaxImagePixels 默认可解码的最大像素数，防止解压炸弹
+	defaultMaxImagePixels = 40_000_000
+	// thumbnailSamples 缩小时每个缩略图像素每个方向的最大采样数
+	thumbnailSamples = 4
+
+	// defaultPreviewBytes 文本预览的默认最大字节数
+	defaultPreviewBytes = 4096
+	// defaultPreviewLines 文本预览的默认最大行数
+	defaultPreviewLines = 50
+
+	// maxMoovSize 视频元数据(moov)的最大字节数
+	maxMoovSize = 16 << 20
+)
+
+// ImagePreviewer 图片预览生成器，支持 PNG、JPEG 和 GIF，生成 JPEG 缩略图并提取尺寸和格式
+// 透明区域以白色填充，不处理 EXIF 方向
+type ImagePreviewer struct {
+	// MaxSize 缩略图长边的像素数，为0时使用256，小于该尺寸的图片保持原尺寸
+	MaxSize int
+	// Quality 缩略图的JPEG质量(1-100)，为0时使用80
+	Quality int
+	// MaxPixels 可解码的最大像素数，超过时只提取尺寸，为0时使用4000万
+	MaxPixels int
+}
+
+// Preview 实现 Previewer 接口
+func (p *ImagePreviewer) Preview(attachment *models.Attachment, r io.Reader) (*Preview, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err == image.ErrFormat {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &Preview{Metadata: map[string]interface{}{
+		"width":  cfg.Width,
+		"height": cfg.Height,
+		"format": format,
+	}}
+	maxPixels := p.MaxPixels
+	if maxPixels <= 0 {
+		maxPixels = defaultMaxImagePixels
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxPixels {
+		return preview, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	maxSize := p.MaxSize
+	if maxSize <= 0 {
+		maxSize = defaultThumbnailSize
+	}
+	quality := p.Quality
+	if quality <= 0 {
+		quality = defaultThumbnailQuality
+	}
+
+	w, h := fitSize(cfg.Width, cfg.Height, maxSize)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, thumbnail(img, w, h), &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	preview.Thumbnail = buf.Bytes()
+	return preview, nil
+}
+
+// fitSize 按比例缩放到长边不超过 maxSize，不放大
+func fitSize(w, h, maxSize int) (int, int) {
+	if w <= maxSize && h <= maxSize {
+		return w, h
+	}
+	if w >= h {
+		return maxSize, max(1, h*maxSize/w)
+	}
+	return max(1, w*maxSize/h), maxSize
+}
+
+// thumbnail 按区域平均缩小图片，每个缩略图像素在对应区域内最多均匀采样 thumbnailSamples² 个像素
+func thumbnail(src image.Image, w, h int) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := b.Min.Y+y*b.Dy()/h, b.Min.Y+(y+1)*b.Dy()/h
+		y1 = max(y1, y0+1)
+		stepY := max(1, (y1-y0)/thumbnailSamples)
+		for x := 0; x < w; x++ {
+			x0, x1 := b.Min.X+x*b.Dx()/w, b.Min.X+(x+1)*b.Dx()/w
+			x1 = max(x1, x0+1)
+			stepX := max(1, (x1-x0)/thumbnailSamples)
+
+			var r, g, bl, a, n uint32
+			for sy := y0; sy < y1; sy += stepY {
+				for sx := x0; sx < x1; sx += stepX {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, bl, a, n = r+cr, g+cg, bl+cb, a+ca, n+1
+				}
+			}
+			// 预乘颜色叠加到白色背景
+			bg := 0xffff - a/n
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8((r/n + bg) >> 8),
+				G: uint8((g/n + bg) >> 8),
+				B: uint8((bl/n + bg) >> 8),
+				A: 0xff,
+			})
+		}
+	}
+	return dst
+}
+
+// TextPreviewer 文本预览生成器，截取开头的若干行作为预览并统计总行数
+// 附件类型为 file 时只处理文本类 MIME 类型，内容不是 UTF-8 文本时不生成预览
+type TextPreviewer struct {
+	// MaxBytes 预览的最大字节数，为0时使用4096
+	MaxBytes int
+	// MaxLines 预览的最大行数，为0时使用50
+	MaxLines int
+}
+
+// Preview 实现 Previewer 接口
+func (p *TextPreviewer) Preview(attachment *models.Attachment, r io.Reader) (*Preview, error) {
+	if attachment.AttachmentType == "file" && !isTextMIME(attachment.MimeType) {
+		return nil, nil
+	}
+	maxBytes := p.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultPreviewBytes
+	}
+	maxLines := p.MaxLines
+	if maxLines <= 0 {
+		maxLines = defaultPreviewLines
+	}
+
+	head := make([]byte, maxBytes)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	head = head[:n]
+	counter := &lineCounter{}
+	rest, err := io.Copy(counter, r)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := bytes.Count(head, []byte("\n")) + counter.lines
+	if len(head) > 0 && (rest > 0 && !counter.endsWithNewline || rest == 0 && head[len(head)-1] != '\n') {
+		lines++
+	}
+
+	// 按字节截断时去掉末尾不完整的字符
+	text := head
+	if rest > 0 {
+		for i := 0; i < utf8.UTFMax && len(text) > 0 && !utf8.Valid(text); i++ {
+			text = text[:len(text)-1]
+		}
+	}
+	if !utf8.Valid(text) || bytes.IndexByte(text, 0) >= 0 {
+		return nil, nil
+	}
+
+	truncated := rest > 0
+	if idx := nthIndex(text, '\n', maxLines); idx >= 0 {
+		text = text[:idx]
+		truncated = true
+	}
+	return &Preview{
+		Text: string(text),
+		Metadata: map[string]interface{}{
+			"lines":     lines,
+			"truncated": truncated,
+		},
+	}, nil
+}
+
+// lineCounter 统计写入内容的行数
+type lineCounter struct {
+	lines           int
+	endsWithNewline bool
+}
+
+// Write 实现 io.Writer 接口
+func (c *lineCounter) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		c.lines += bytes.Count(p, []byte("\n"))
+		c.endsWithNewline = p[len(p)-1] == '\n'
+	}
+	return len(p), nil
+}
+
+// nthIndex 返回第n个分隔符的位置，不足n个时返回-1
+func nthIndex(data []byte, sep byte, n int) int {
+	offset := 0
+	for i := 0; i < n; i++ {
+		idx := bytes.IndexByte(data[offset:], sep)
+		if idx < 0 {
+			return -1
+		}
+		offset += idx + 1
+	}
+	return offset - 1
+}
+
+// isTextMIME 判断是否为文本类 MIME 类型
+func isTextMIME(mimeType string) bool {
+	mimeType, _, _ = strings.Cut(strings.ToLower(mimeType), ";")
+	mimeType = strings.TrimSpace(mimeType)
+	if strings.HasPrefix(mimeType, "text/") || strings.HasSuffix(mimeType, "+json") || strings.HasSuffix(mimeType, "+xml") {
+		return true
+	}
+	switch mimeType {
+	case "application/json", "application/xml", "application/javascript", "application/x-javascript",
+		"application/x-yaml", "application/yaml", "application/toml", "application/sql",
+		"application/x-sh", "application/x-ndjson":
+		return true
+	}
+	return false
+}
+
+// VideoPreviewer 视频预览生成器，从 MP4/MOV 的 moov 中提取尺寸和时长
+// 不解码视频帧，不生成缩略图
+type VideoPreviewer struct{}
+
+// Preview 实现 Previewer 接口
+func (p *VideoPreviewer) Preview(attachment *models.Attachment, r io.Reader) (*Preview, error) {
+	moov, err := findBox(r, "moov")
+	if err != nil || moov == nil {
+		return nil, err
+	}
+
+	metadata := make(map[string]interface{})
+	for _, box := range boxes(moov) {
+		switch box.typ {
+		case "mvhd":
+			if timescale, duration, ok := parseMvhd(box.data); ok && timescale > 0 {
+				metadata["duration_ms"] = duration * 1000 / uint64(timescale)
+			}
+		case "trak":
+			if _, ok := metadata["width"]; ok {
+				continue
+			}
+			for _, child := range boxes(box.data) {
+				if child.typ != "tkhd" {
+					continue
+				}
+				// 音频轨道的宽高为0
+				if w, h, ok := parseTkhd(child.data); ok && w > 0 && h > 0 {
+					metadata["width"], metadata["height"] = w, h
+				}
+			}
+		}
+	}
+	if len(metadata) == 0 {
+		return nil, nil
+	}
+	return &Preview{Metadata: metadata}, nil
+}
+
+// mp4Box MP4 的一个 box
+type mp4Box struct {
+	typ  string
+	data []byte
+}
+
+// findBox 顺序读取顶层 box，返回指定类型 box 的内容，不存在或不是 MP4 时返回nil
+func findBox(r io.Reader, typ string) ([]byte, error) {
+	header := make([]byte, 16)
+	for {
+		if _, err := io.ReadFull(r, header[:8]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil, nil
+			}
+			return nil, err
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		name := string(header[4:8])
+		headerSize := int64(8)
+		if size == 1 {
+			if _, err := io.ReadFull(r, header[8:16]); err != nil {
+				return nil, nil
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		}
+		if !validBoxType(name) || (size != 0 && size < headerSize) {
+			return nil, nil
+		}
+
+		if name == typ {
+			if size == 0 || size-headerSize > maxMoovSize {
+				return nil, fmt.Errorf("视频元数据 %s 过大", typ)
+			}
+			data := make([]byte, size-headerSize)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return nil, nil
+			}
+			return data, nil
+		}
+		if size == 0 {
+			return nil, nil
+		}
+		if _, err := io.CopyN(io.Discard, r, size-headerSize); err != nil {
+			return nil, nil
+		}
+	}
+}
+
+// boxes 解析内存中的子 box，遇到无效的 box 时停止
+func boxes(data []byte) []mp4Box {
+	var list []mp4Box
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data[:4]))
+		headerSize := uint64(8)
+		if size == 1 && len(data) >= 16 {
+			size = binary.BigEndian.Uint64(data[8:16])
+			headerSize = 16
+		} else if size == 0 {
+			size = uint64(len(data))
+		}
+		if size < headerSize || size > uint64(len(data)) {
+			break
+		}
+		list = append(list, mp4Box{typ: string(data[4:8]), data: data[headerSize:size]})
+		data = data[size:]
+	}
+	return list
+}
+
+// parseMvhd 解析 mvhd 中的时间刻度和时长
+func parseMvhd(data []byte) (uint32, uint64, bool) {
+	if len(data) < 4 {
+		return 0, 0, false
+	}
+	if data[0] == 1 {
+		if len(data) < 32 {
+			return 0, 0, false
+		}
+		return binary.BigEndian.Uint32(data[20:24]), binary.BigEndian.Uint64(data[24:32]), true
+	}
+	if len(data) < 20 {
+		return 0, 0, false
+	}
+	return binary.BigEndian.Uint32(data[12:16]), uint64(binary.BigEndian.Uint32(data[16:20])), true
+}
+
+// parseTkhd 解析 tkhd 中的宽高，宽高为16.16定点数
+func parseTkhd(data []byte) (int, int, bool) {
+	offset := 76
+	if len(data) > 0 && data[0] == 1 {
+		offset = 88
+	}
+	if len(data) < offset+8 {
+		return 0, 0, false
+	}
+	w := binary.BigEndian.Uint32(data[offset : offset+4])
+	h := binary.BigEndian.Uint32(data[offset+4 : offset+8])
+	return int(w >> 16), int(h >> 16), true
+}
+
+// validBoxType box 类型应为4个可打印字符
+func validBoxType(typ string) bool {
+	for i := 0; i < len(typ); i++ {
+		if typ[i] < 0x20 || typ[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
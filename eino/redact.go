@@ -0,0 +1,74 @@
+package eino
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// piiRule 个人信息匹配规则
+type piiRule struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// piiRules 内置的个人信息脱敏规则，按顺序匹配，较长的数字串优先，避免被短规则截断
+var piiRules = []piiRule{
+	{regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`), "[EMAIL]"},
+	{regexp.MustCompile(`\b\d{17}[\dXx]\b`), "[ID_CARD]"},
+	{regexp.MustCompile(`\b(?:\d[ \-]?){13,19}\b`), "[CARD_NUMBER]"},
+	{regexp.MustCompile(`(?:\+?86[ \-]?)?\b1[3-9]\d{9}\b`), "[PHONE]"},
+	{regexp.MustCompile(`\+\d{1,3}[ \-]?\(?\d{1,4}\)?[ \-]?\d{3,4}[ \-]?\d{3,4}\b`), "[PHONE]"},
+	{regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|1?\d?\d)\b`), "[IP]"},
+}
+
+// RedactPII 使用内置规则对文本中的个人信息进行脱敏
+// 会替换邮箱、身份证号、银行卡号、手机号和IPv4地址
+// 参数:
+//   - text: 原始文本
+//
+// 返回:
+//   - string: 脱敏后的文本
+func RedactPII(text string) string {
+	for _, rule := range piiRules {
+		text = rule.pattern.ReplaceAllString(text, rule.replacement)
+	}
+	return text
+}
+
+// redactArguments 对工具调用参数中的字符串值脱敏，保持参数为合法的 JSON
+// 数字、布尔值和对象的键保持不变；参数不是合法 JSON 时按普通文本脱敏
+func redactArguments(args string, redact func(string) string) string {
+	decoder := json.NewDecoder(strings.NewReader(args))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil || decoder.More() {
+		return redact(args)
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(redactJSONValue(value, redact)); err != nil {
+		return redact(args)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// redactJSONValue 递归脱敏 JSON 值中的字符串
+func redactJSONValue(value interface{}, redact func(string) string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return redact(v)
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = redactJSONValue(item, redact)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactJSONValue(item, redact)
+		}
+	}
+	return value
+}
@@ -0,0 +1,497 @@
+package eino
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hildam/eino-history/model"
+)
+
+// 保留策略的处理方式
+const (
+	// RetentionPurge 永久删除会话及其消息和附件关联
+	RetentionPurge = "purge"
+	// RetentionAnonymize 保留会话结构，对消息内容脱敏，删除回收站中的消息、修订、评价说明和附件的提取文本，并清除标题和用户归属
+	RetentionAnonymize = "anonymize"
+)
+
+const (
+	// SettingsAnonymizedKey 会话设置中记录匿名化时间的 key，已匿名化的会话不再处理
+	SettingsAnonymizedKey = "anonymized_at"
+	// defaultRetentionBatchSize 每批扫描的会话数
+	defaultRetentionBatchSize = 100
+	// defaultRetentionInterval 后台任务的默认执行间隔
+	defaultRetentionInterval = time.Hour
+)
+
+// retentionAuditActions 处理方式对应的审计操作类型
+var retentionAuditActions = map[string]string{
+	RetentionPurge:     models.AuditConversationPurge,
+	RetentionAnonymize: models.AuditConversationAnonymize,
+}
+
+// RetentionPolicy 会话保留策略
+// 会话的年龄按最后更新时间计算，MaxAge 和 ArchivedMaxAge 都为0的策略不会使任何会话过期
+type RetentionPolicy struct {
+	// Name 策略名称，出现在报告中
+	Name string
+	// TenantID 仅作用于指定租户，为空时作用于全部租户
+	TenantID string
+	// SettingsMatch 仅作用于会话设置中顶层字段取值匹配的会话，字符串按原值比较，其他类型按JSON文本比较
+	SettingsMatch map[string]string
+	// Match 自定义匹配条件，可以为nil
+	Match func(conv *models.Conversation) bool
+	// MaxAge 会话的最长保留时间，为0时不限制
+	MaxAge time.Duration
+	// ArchivedMaxAge 已归档会话的最长保留时间，为0时使用 MaxAge
+	ArchivedMaxAge time.Duration
+	// Action 过期会话的处理方式，为空时使用 RetentionPurge
+	Action string
+}
+
+// RetentionConfig 保留策略配置
+type RetentionConfig struct {
+	// Policies 按顺序匹配的保留策略，每个会话只使用第一个匹配的策略
+	Policies []RetentionPolicy
+	// BatchSize 每批扫描的会话数，为0时使用默认值100
+	BatchSize int
+	// Interval 后台任务的执行间隔，为0时使用默认值1小时
+	Interval time.Duration
+	// OnReport 后台任务每次执行后的回调，可以为nil
+	OnReport func(report *RetentionReport)
+	// OnError 后台任务执行失败时的回调，可以为nil
+	OnError func(err error)
+}
+
+// RetentionItem 一个过期会话的处理记录
+type RetentionItem struct {
+	ConvID    string
+	TenantID  string
+	Policy    string
+	Action    string
+	UpdatedAt int64
+	// ExpiredAt 会话按策略过期的时间(Unix秒)
+	ExpiredAt int64
+}
+
+// RetentionReport 一次保留策略执行的结果
+type RetentionReport struct {
+	// DryRun 是否为演练，演练不会修改数据
+	DryRun bool
+	// Scanned 扫描的会话数
+	Scanned int
+	// Purged 永久删除(演练时为将要删除)的会话数
+	Purged int
+	// Anonymized 匿名化(演练时为将要匿名化)的会话数
+	Anonymized int
+	// Items 过期会话明细，仅演练时填充
+	Items []*RetentionItem
+	// StartedAt 开始时间
+	StartedAt time.Time
+	// Duration 执行耗时
+	Duration time.Duration
+}
+
+// RetentionMetrics 保留策略执行的累计指标
+type RetentionMetrics struct {
+	Runs       int64
+	Scanned    int64
+	Purged     int64
+	Anonymized int64
+	Errors     int64
+	// LastRunAt 最近一次执行的开始时间(Unix秒)
+	LastRunAt int64
+	// LastDuration 最近一次执行的耗时
+	LastDuration time.Duration
+}
+
+// retentionState 保留策略的累计指标，在 WithOwner 返回的副本之间共享
+type retentionState struct {
+	runs, scanned, purged, anonymized, errors int64
+	lastRunAt, lastDuration                   int64
+}
+
+// ApplyRetention 按保留策略处理过期会话，限定归属范围时只处理范围内的会话
+// 参数:
+//   - config: 保留策略配置
+//   - dryRun: 为true时只生成报告，不修改数据
+//
+// 返回:
+//   - *RetentionReport: 执行结果
+//   - error: 如果执行过程中发生错误，已处理的会话会体现在结果中
+func (x *History) ApplyRetention(config *RetentionConfig, dryRun bool) (*RetentionReport, error) {
+	report := &RetentionReport{DryRun: dryRun, StartedAt: time.Now()}
+	err := x.applyRetention(config, report)
+	report.Duration = time.Since(report.StartedAt)
+
+	if !dryRun {
+		m := x.retention
+		atomic.AddInt64(&m.runs, 1)
+		atomic.AddInt64(&m.scanned, int64(report.Scanned))
+		atomic.AddInt64(&m.purged, int64(report.Purged))
+		atomic.AddInt64(&m.anonymized, int64(report.Anonymized))
+		atomic.StoreInt64(&m.lastRunAt, report.StartedAt.Unix())
+		atomic.StoreInt64(&m.lastDuration, int64(report.Duration))
+		if err != nil {
+			atomic.AddInt64(&m.errors, 1)
+		}
+	}
+	return report, err
+}
+
+// applyRetention 按更新时间升序分批扫描可能过期的会话
+func (x *History) applyRetention(config *RetentionConfig, report *RetentionReport) error {
+	if config == nil || len(config.Policies) == 0 {
+		return nil
+	}
+	for _, p := range config.Policies {
+		if p.Action != "" && p.Action != RetentionPurge && p.Action != RetentionAnonymize {
+			return fmt.Errorf("保留策略 %s 的处理方式无效: %s", p.Name, p.Action)
+		}
+	}
+
+	// 只扫描超过最短保留时间的会话
+	var minAge time.Duration
+	for _, p := range config.Policies {
+		for _, age := range []time.Duration{p.MaxAge, p.ArchivedMaxAge} {
+			if age > 0 && (minAge == 0 || age < minAge) {
+				minAge = age
+			}
+		}
+	}
+	if minAge == 0 {
+		return nil
+	}
+
+	batchSize := config.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultRetentionBatchSize
+	}
+	now := report.StartedAt
+	query := &models.ConversationQuery{
+		SortBy:        models.ConversationSortUpdatedAt,
+		Ascending:     true,
+		UpdatedBefore: now.Add(-minAge).Unix(),
+		Limit:         batchSize,
+	}
+
+	for {
+		page, err := x.queryConversations(query)
+		if err != nil {
+			return err
+		}
+		for _, conv := range page.Items {
+			report.Scanned++
+			policy, expiredAt := matchRetention(config.Policies, conv, now)
+			if policy == nil {
+				continue
+			}
+
+			action := policy.Action
+			if action == "" {
+				action = RetentionPurge
+			}
+			if report.DryRun {
+				report.Items = append(report.Items, &RetentionItem{
+					ConvID:    conv.ConvID,
+					TenantID:  conv.TenantID,
+					Policy:    policy.Name,
+					Action:    action,
+					UpdatedAt: conv.UpdatedAt,
+					ExpiredAt: expiredAt,
+				})
+			} else {
+				event := &models.AuditEvent{
+					Action:         retentionAuditActions[action],
+					TenantID:       conv.TenantID,
+					ConversationID: conv.ConvID,
+					Detail:         auditDetail(map[string]string{"policy": policy.Name}),
+				}
+				if err := x.audited(event, x.expireConversation(conv, action)); err != nil {
+					return fmt.Errorf("处理过期会话 %s 失败: %v", conv.ConvID, err)
+				}
+			}
+
+			if action == RetentionPurge {
+				report.Purged++
+			} else {
+				report.Anonymized++
+			}
+		}
+		if page.NextCursor == "" {
+			return nil
+		}
+		query.Cursor = page.NextCursor
+	}
+}
+
+// matchRetention 返回会话匹配的第一个策略及过期时间，未匹配或未过期时返回nil
+func matchRetention(policies []RetentionPolicy, conv *models.Conversation, now time.Time) (*RetentionPolicy, int64) {
+	if _, anonymized := settingsFields(conv.Settings)[SettingsAnonymizedKey]; anonymized {
+		return nil, 0
+	}
+
+	for i := range policies {
+		p := &policies[i]
+		if p.TenantID != "" && p.TenantID != conv.TenantID {
+			continue
+		}
+		if !matchSettings(conv.Settings, p.SettingsMatch) {
+			continue
+		}
+		if p.Match != nil && !p.Match(conv) {
+			continue
+		}
+
+		maxAge := p.MaxAge
+		if conv.IsArchived && p.ArchivedMaxAge > 0 {
+			maxAge = p.ArchivedMaxAge
+		}
+		if maxAge <= 0 {
+			return nil, 0
+		}
+		expiredAt := time.Unix(conv.UpdatedAt, 0).Add(maxAge)
+		if expiredAt.After(now) {
+			return nil, 0
+		}
+		return p, expiredAt.Unix()
+	}
+	return nil, 0
+}
+
+// matchSettings 判断会话设置的顶层字段是否与期望值一致
+func matchSettings(settings json.RawMessage, expected map[string]string) bool {
+	if len(expected) == 0 {
+		return true
+	}
+	fields := settingsFields(settings)
+	for key, want := range expected {
+		raw, ok := fields[key]
+		if !ok {
+			return false
+		}
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			s = string(raw)
+		}
+		if s != want {
+			return false
+		}
+	}
+	return true
+}
+
+// settingsFields 解析会话设置的顶层字段，设置无效时返回空
+func settingsFields(settings json.RawMessage) map[string]json.RawMessage {
+	var fields map[string]json.RawMessage
+	if len(settings) > 0 {
+		_ = json.Unmarshal(settings, &fields)
+	}
+	return fields
+}
+
+// expireConversation 按处理方式处理过期会话
+func (x *History) expireConversation(conv *models.Conversation, action string) error {
+	embeddings, err := x.er.ListByConversation(conv.ConvID)
+	if err != nil {
+		return err
+	}
+	for _, emb := range embeddings {
+		if err := x.dropEmbedding(emb.SourceType, emb.SourceID); err != nil {
+			return err
+		}
+	}
+
+	if action == RetentionPurge {
+		if err := x.cr.Delete(conv.ConvID); err != nil {
+			return err
+		}
+		return x.cr.Purge(conv.ConvID)
+	}
+
+	return x.anonymizeConversation(conv)
+}
+
+// anonymizeConversation 脱敏会话：脱敏消息内容并删除修订，永久删除回收站中的消息，清除评价的文字说明，
+// 删除附件的文本分块、摘要和文本预览，最后清除标题和用户并标记为已匿名化
+func (x *History) anonymizeConversation(conv *models.Conversation) error {
+	mess, err := x.listAllMessages(conv.ConvID)
+	if err != nil {
+		return err
+	}
+	deleted, err := x.listDeletedMessages(conv.ConvID)
+	if err != nil {
+		return err
+	}
+
+	// 附件可能同时关联到回收站中的消息，先于永久删除消息处理
+	msgIDs := make([]string, 0, len(mess)+len(deleted))
+	for _, m := range mess {
+		msgIDs = append(msgIDs, m.MsgID)
+	}
+	for _, m := range deleted {
+		msgIDs = append(msgIDs, m.MsgID)
+	}
+	if err := x.redactAttachments(msgIDs); err != nil {
+		return err
+	}
+
+	// 回收站中的消息恢复后会带回未脱敏的内容
+	for _, m := range deleted {
+		if err := x.mr.Purge(m.MsgID); err != nil {
+			return err
+		}
+	}
+
+	for _, m := range mess {
+		m.Content = RedactPII(m.Content)
+		m.Metadata = nil
+		if err := x.mr.Update(m); err != nil {
+			return err
+		}
+		// 修订中保留着脱敏前的内容
+		if err := x.mr.DeleteRevisions(m.MsgID); err != nil {
+			return err
+		}
+	}
+
+	feedback, err := x.fr.ListByConversation(conv.ConvID)
+	if err != nil {
+		return err
+	}
+	for _, f := range feedback {
+		if f.Comment == "" {
+			continue
+		}
+		f.Comment = ""
+		if err := x.fr.Upsert(f); err != nil {
+			return err
+		}
+	}
+
+	settings, err := withSetting(conv.Settings, SettingsAnonymizedKey, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	conv.Title = ""
+	conv.UserID = ""
+	conv.Settings = settings
+	return x.cr.Update(conv)
+}
+
+// listDeletedMessages 获取会话在回收站中的全部消息
+func (x *History) listDeletedMessages(convID string) ([]*models.Message, error) {
+	var all []*models.Message
+	for offset := 0; ; offset += exportPageSize {
+		mess, err := x.mr.ListDeleted(convID, 0, offset, exportPageSize)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, mess...)
+		if len(mess) < exportPageSize {
+			return all, nil
+		}
+	}
+}
+
+// redactAttachments 删除消息关联附件的文本分块、向量、摘要和文本预览，附件内容保留
+// 附件被分叉出的会话共用时一并处理
+func (x *History) redactAttachments(msgIDs []string) error {
+	if len(msgIDs) == 0 {
+		return nil
+	}
+	links, err := x.mar.ListByMessages(msgIDs)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool, len(links))
+	var attachIDs []string
+	for _, link := range links {
+		if !seen[link.AttachmentID] {
+			seen[link.AttachmentID] = true
+			attachIDs = append(attachIDs, link.AttachmentID)
+		}
+	}
+	if len(attachIDs) == 0 {
+		return nil
+	}
+
+	// 找不到的附件已被回收，忽略
+	attachments, err := x.ar.GetByIDs(attachIDs)
+	var batchErr *models.BatchError
+	if err != nil && !errors.As(err, &batchErr) {
+		return err
+	}
+	for _, attachment := range attachments {
+		if err := x.dropAttachmentIndex(attachment.AttachID); err != nil {
+			return err
+		}
+		attachment.DataSummary = ""
+		attachment.PreviewText = ""
+		attachment.Vectorized = false
+		if err := x.ar.Update(attachment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartRetentionWorker 启动后台任务，按配置的间隔定期执行保留策略
+// 参数:
+//   - config: 保留策略配置
+//
+// 返回:
+//   - func(): 停止任务的函数，返回时任务已退出
+func (x *History) StartRetentionWorker(config *RetentionConfig) func() {
+	interval := config.Interval
+	if interval <= 0 {
+		interval = defaultRetentionInterval
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				report, err := x.ApplyRetention(config, false)
+				if err != nil && config.OnError != nil {
+					config.OnError(err)
+				}
+				if config.OnReport != nil {
+					config.OnReport(report)
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		wg.Wait()
+	}
+}
+
+// RetentionMetrics 返回保留策略执行的累计指标，演练不计入
+func (x *History) RetentionMetrics() RetentionMetrics {
+	m := x.retention
+	return RetentionMetrics{
+		Runs:         atomic.LoadInt64(&m.runs),
+		Scanned:      atomic.LoadInt64(&m.scanned),
+		Purged:       atomic.LoadInt64(&m.purged),
+		Anonymized:   atomic.LoadInt64(&m.anonymized),
+		Errors:       atomic.LoadInt64(&m.errors),
+		LastRunAt:    atomic.LoadInt64(&m.lastRunAt),
+		LastDuration: time.Duration(atomic.LoadInt64(&m.lastDuration)),
+	}
+}
@@ -0,0 +1,301 @@
+package eino
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/hildam/eino-history/model"
+)
+
+// 差异行的类型
+const (
+	DiffEqual  = ' '
+	DiffInsert = '+'
+	DiffDelete = '-'
+)
+
+// maxDiffCells 逐行比较的最大计算量，超过时只去除相同的首尾行后整体替换
+const maxDiffCells = 4 << 20
+
+// DiffLine 差异中的一行
+type DiffLine struct {
+	// Op 行的类型，取值为 DiffEqual、DiffInsert 或 DiffDelete
+	Op byte
+	// Text 行内容，不含换行符
+	Text string
+}
+
+// RevisionDiff 两个修订之间的差异
+type RevisionDiff struct {
+	MessageID string
+	From      int
+	To        int
+	// Lines 按行比较内容的结果
+	Lines []DiffLine
+	// MetadataChanged 元数据是否不同
+	MetadataChanged bool
+}
+
+// Unified 以每行前缀 " "、"+"、"-" 的文本形式输出差异
+func (d *RevisionDiff) Unified() string {
+	var b strings.Builder
+	for _, line := range d.Lines {
+		b.WriteByte(line.Op)
+		b.WriteString(line.Text)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// EditMessage 修改消息内容，修改前的内容保存为修订
+// 消息的向量会被删除，需要时重新调用 IndexConversation
+// 参数:
+//   - msgID: 消息ID
+//   - content: 新内容
+//   - editor: 编辑者，如用户ID或审核员ID
+//
+// 返回:
+//   - error: 如果消息不存在或修改过程中发生错误
+func (x *History) EditMessage(msgID, content, editor string) (err error) {
+	var convID string
+	defer func() { x.auditCall(&err, models.AuditMessageEdit, convID, msgID) }()
+
+	msg, err := x.mr.GetByID(msgID)
+	if err != nil {
+		return err
+	}
+	convID = msg.ConversationID
+	if err := x.authorize(msg.ConversationID); err != nil {
+		return err
+	}
+	if msg.Content == content {
+		return nil
+	}
+
+	msg.Content = content
+	msg.EditedBy = editor
+	if err := x.mr.Update(msg); err != nil {
+		return err
+	}
+	return x.dropEmbedding(models.EmbeddingSourceMessage, msgID)
+}
+
+// PatchMessage 部分更新消息，只写入 patch 中不为nil的字段
+// 内容或元数据发生变化时旧版本保存为修订；内容变化时消息的向量会被删除
+// patch.Version 不为nil时作为期望版本，消息已被其他写入修改时返回 models.ErrVersionConflict
+// 参数:
+//   - msgID: 消息ID
+//   - patch: 要更新的字段
+//
+// 返回:
+//   - *models.Message: 更新后的消息，Version 为新的版本号
+//   - error: 如果消息不存在、版本冲突或更新过程中发生错误
+func (x *History) PatchMessage(msgID string, patch *models.MessagePatch) (msg *models.Message, err error) {
+	var convID string
+	defer func() { x.auditCall(&err, models.AuditMessageEdit, convID, msgID) }()
+
+	old, err := x.mr.GetByID(msgID)
+	if err != nil {
+		return nil, err
+	}
+	convID = old.ConversationID
+	if err := x.authorize(convID); err != nil {
+		return nil, err
+	}
+
+	if msg, err = x.mr.Patch(msgID, patch); err != nil {
+		return nil, err
+	}
+	if patch.Content != nil {
+		if err := x.dropEmbedding(models.EmbeddingSourceMessage, msgID); err != nil {
+			return msg, err
+		}
+	}
+	return msg, nil
+}
+
+// ListRevisions 按修订号升序获取消息的历史修订，当前内容的修订号为 Message.Revision
+// 参数:
+//   - msgID: 消息ID
+//
+// 返回:
+//   - []*models.MessageRevision: 修订列表，不包括当前内容
+//   - error: 如果获取过程中发生错误
+func (x *History) ListRevisions(msgID string) (list []*models.MessageRevision, err error) {
+	defer x.auditCall(&err, models.AuditConversationRead, "", msgID)
+	if err := x.authorizeMessage(msgID); err != nil {
+		return nil, err
+	}
+	return x.mr.ListRevisions(msgID)
+}
+
+// DiffRevisions 按行比较消息的两个修订
+// 参数:
+//   - msgID: 消息ID
+//   - from: 旧修订号
+//   - to: 新修订号，等于 Message.Revision 时表示当前内容
+//
+// 返回:
+//   - *RevisionDiff: 差异
+//   - error: 如果修订不存在或比较过程中发生错误
+func (x *History) DiffRevisions(msgID string, from, to int) (diff *RevisionDiff, err error) {
+	var convID string
+	defer func() { x.auditCall(&err, models.AuditConversationRead, convID, msgID) }()
+
+	msg, err := x.mr.GetByID(msgID)
+	if err != nil {
+		return nil, err
+	}
+	convID = msg.ConversationID
+	if err := x.authorize(msg.ConversationID); err != nil {
+		return nil, err
+	}
+
+	fromRev, err := x.revisionOf(msg, from)
+	if err != nil {
+		return nil, err
+	}
+	toRev, err := x.revisionOf(msg, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RevisionDiff{
+		MessageID:       msgID,
+		From:            from,
+		To:              to,
+		Lines:           diffLines(fromRev.Content, toRev.Content),
+		MetadataChanged: models.ContentChanged(&models.Message{Metadata: fromRev.Metadata}, &models.Message{Metadata: toRev.Metadata}),
+	}, nil
+}
+
+// RollbackMessage 将消息内容和元数据恢复为指定修订，回滚本身作为一次新的修改记录
+// 参数:
+//   - msgID: 消息ID
+//   - revision: 要恢复的修订号
+//   - editor: 执行回滚的编辑者
+//
+// 返回:
+//   - error: 如果修订不存在或回滚过程中发生错误
+func (x *History) RollbackMessage(msgID string, revision int, editor string) (err error) {
+	var convID string
+	defer func() { x.auditCall(&err, models.AuditMessageRollback, convID, msgID) }()
+
+	msg, err := x.mr.GetByID(msgID)
+	if err != nil {
+		return err
+	}
+	convID = msg.ConversationID
+	if err := x.authorize(msg.ConversationID); err != nil {
+		return err
+	}
+	if revision == msg.Revision {
+		return nil
+	}
+	rev, err := x.mr.GetRevision(msgID, revision)
+	if err != nil {
+		return err
+	}
+
+	msg.Content = rev.Content
+	msg.Metadata = append(json.RawMessage(nil), rev.Metadata...)
+	msg.EditedBy = editor
+	if err := x.mr.Update(msg); err != nil {
+		return err
+	}
+	return x.dropEmbedding(models.EmbeddingSourceMessage, msgID)
+}
+
+// revisionOf 获取消息的指定修订，修订号等于当前修订号时返回当前内容
+func (x *History) revisionOf(msg *models.Message, revision int) (*models.MessageRevision, error) {
+	if revision == msg.Revision {
+		return &models.MessageRevision{
+			MessageID: msg.MsgID,
+			Revision:  msg.Revision,
+			Content:   msg.Content,
+			Metadata:  msg.Metadata,
+			EditedBy:  msg.EditedBy,
+			EditedAt:  msg.EditedAt,
+		}, nil
+	}
+	return x.mr.GetRevision(msg.MsgID, revision)
+}
+
+// diffLines 使用最长公共子序列按行比较两段文本
+func diffLines(a, b string) []DiffLine {
+	la, lb := strings.Split(a, "\n"), strings.Split(b, "\n")
+
+	// 去除相同的首尾行以减少计算量
+	prefix := 0
+	for prefix < len(la) && prefix < len(lb) && la[prefix] == lb[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(la)-prefix && suffix < len(lb)-prefix && la[len(la)-1-suffix] == lb[len(lb)-1-suffix] {
+		suffix++
+	}
+
+	var lines []DiffLine
+	for _, text := range la[:prefix] {
+		lines = append(lines, DiffLine{Op: DiffEqual, Text: text})
+	}
+	lines = append(lines, diffMiddle(la[prefix:len(la)-suffix], lb[prefix:len(lb)-suffix])...)
+	for _, text := range la[len(la)-suffix:] {
+		lines = append(lines, DiffLine{Op: DiffEqual, Text: text})
+	}
+	return lines
+}
+
+// diffMiddle 比较去除首尾相同行之后的部分，计算量过大时整体替换
+func diffMiddle(a, b []string) []DiffLine {
+	var lines []DiffLine
+	if len(a)*len(b) > maxDiffCells {
+		for _, text := range a {
+			lines = append(lines, DiffLine{Op: DiffDelete, Text: text})
+		}
+		for _, text := range b {
+			lines = append(lines, DiffLine{Op: DiffInsert, Text: text})
+		}
+		return lines
+	}
+
+	// lcs[i][j] 为 a[i:] 与 b[j:] 的最长公共子序列长度
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, DiffLine{Op: DiffEqual, Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, DiffLine{Op: DiffDelete, Text: a[i]})
+			i++
+		default:
+			lines = append(lines, DiffLine{Op: DiffInsert, Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, DiffLine{Op: DiffDelete, Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, DiffLine{Op: DiffInsert, Text: b[j]})
+	}
+	return lines
+}
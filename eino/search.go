@@ -0,0 +1,32 @@
+package eino
+
+import (
+	"strings"
+
+	"github.com/hildam/eino-history/model"
+)
+
+// Search 按关键词全文检索历史消息
+// 限定归属范围时只检索范围内的会话。MySQL 后端使用 messages.content 上的 FULLTEXT 索引，Redis 后端使用自维护的倒排索引
+// 参数:
+//   - query: 检索关键词
+//   - filter: 过滤与分页条件，为nil时检索全部会话并返回前 models.DefaultSearchLimit 条
+//
+// 返回:
+//   - *models.SearchResult: 按相关度降序排列的命中消息及命中总数
+//   - error: 如果检索过程中发生错误
+func (x *History) Search(query string, filter *models.SearchFilter) (result *models.SearchResult, err error) {
+	defer x.auditCall(&err, models.AuditSearch, "", "")
+	if strings.TrimSpace(query) == "" {
+		return &models.SearchResult{}, nil
+	}
+	if x.owner != nil {
+		scoped := models.SearchFilter{}
+		if filter != nil {
+			scoped = *filter
+		}
+		scoped.Owner = x.owner
+		filter = &scoped
+	}
+	return x.sr.Search(query, filter)
+}
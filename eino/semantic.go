@@ -0,0 +1,429 @@
+package eino
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cloudwego/eino/components/embedding"
+	"github.com/cloudwego/eino/components/retriever"
+	"github.com/cloudwego/eino/schema"
+	"github.com/hildam/eino-history/model"
+)
+
+// 检索结果 Document.MetaData 中的 key
+const (
+	// MetaConversationID 来源会话ID
+	MetaConversationID = "conversation_id"
+	// MetaSourceType 来源类型，取值为 models.EmbeddingSourceMessage、models.EmbeddingSourceAttachment
+	// 或 models.EmbeddingSourceAttachmentChunk
+	MetaSourceType = "source_type"
+	// MetaSourceID 来源消息ID、附件ID或附件分块ID
+	MetaSourceID = "source_id"
+	// MetaAttachmentID 来源附件ID，仅附件摘要和附件分块的结果包含
+	MetaAttachmentID = "attachment_id"
+	// MetaCreatedAt 向量创建时间(Unix秒)
+	MetaCreatedAt = "created_at"
+)
+
+const (
+	// defaultRetrieverTopK 未指定时检索返回的结果数
+	defaultRetrieverTopK = 5
+	// embedBatchSize 单次调用向量化器的文本数量
+	embedBatchSize = 32
+	// indexLoadPageSize 加载向量索引时的分页大小
+	indexLoadPageSize = 500
+)
+
+// vectorIndex 内存中的暴力检索向量索引，首次检索时从向量存储库加载
+type vectorIndex struct {
+	mu      sync.RWMutex
+	loaded  bool
+	entries map[string]*models.Embedding
+}
+
+// newVectorIndex 创建空的向量索引
+func newVectorIndex() *vectorIndex {
+	return &vectorIndex{entries: make(map[string]*models.Embedding)}
+}
+
+// put 写入或替换索引中的向量，索引尚未加载时忽略，加载时会从存储库读取
+func (i *vectorIndex) put(emb *models.Embedding) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.loaded {
+		i.entries[emb.SourceType+":"+emb.SourceID] = emb
+	}
+}
+
+// remove 从索引中移除向量
+func (i *vectorIndex) remove(sourceType, sourceID string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	delete(i.entries, sourceType+":"+sourceID)
+}
+
+// removePrefix 从索引中移除来源ID以指定前缀开头的向量
+func (i *vectorIndex) removePrefix(sourceType, prefix string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for key := range i.entries {
+		if strings.HasPrefix(key, sourceType+":"+prefix) {
+			delete(i.entries, key)
+		}
+	}
+}
+
+// reset 清空索引，下次检索时重新加载
+func (i *vectorIndex) reset() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.loaded = false
+	i.entries = make(map[string]*models.Embedding)
+}
+
+// SetEmbedder 设置用于向量化消息和附件摘要的向量化器
+// 参数:
+//   - embedder: Eino 向量化组件，测试时可使用 NewHashEmbedder
+func (x *History) SetEmbedder(embedder embedding.Embedder) {
+	x.embedder = embedder
+}
+
+// IndexConversation 为会话中尚未向量化或内容已变化的消息生成向量
+// 参数:
+//   - ctx: 上下文
+//   - convID: 会话ID
+//
+// 返回:
+//   - int: 本次新生成的向量数
+//   - error: 如果未设置向量化器或向量化过程中发生错误
+func (x *History) IndexConversation(ctx context.Context, convID string) (count int, err error) {
+	defer x.auditCall(&err, models.AuditConversationIndex, convID, "")
+	if x.embedder == nil {
+		return 0, fmt.Errorf("未设置向量化器")
+	}
+	if err := x.authorize(convID); err != nil {
+		return 0, err
+	}
+
+	existing, err := x.er.ListByConversation(convID)
+	if err != nil {
+		return 0, err
+	}
+	indexed := make(map[string]string, len(existing))
+	for _, emb := range existing {
+		if emb.SourceType == models.EmbeddingSourceMessage {
+			indexed[emb.SourceID] = emb.Content
+		}
+	}
+
+	mess, err := x.listAllMessages(convID)
+	if err != nil {
+		return 0, err
+	}
+
+	var pending []*models.Embedding
+	for _, m := range mess {
+		if m.Content == "" {
+			continue
+		}
+		if content, ok := indexed[m.MsgID]; ok && content == m.Content {
+			continue
+		}
+		pending = append(pending, &models.Embedding{
+			SourceType:     models.EmbeddingSourceMessage,
+			SourceID:       m.MsgID,
+			ConversationID: convID,
+			Content:        m.Content,
+		})
+	}
+
+	if err := x.embedAndSave(ctx, pending); err != nil {
+		return 0, err
+	}
+	return len(pending), nil
+}
+
+// IndexAttachment 为附件摘要生成向量，并将附件标记为已向量化
+// 参数:
+//   - ctx: 上下文
+//   - attachID: 附件ID
+//   - convID: 附件所属会话ID，附件必须关联到该会话的消息；向量按会话保存，分叉会话共享附件时互不覆盖
+//
+// 返回:
+//   - error: 如果未设置向量化器、附件不属于该会话、附件没有摘要或向量化过程中发生错误
+func (x *History) IndexAttachment(ctx context.Context, attachID, convID string) (err error) {
+	defer x.auditCall(&err, models.AuditConversationIndex, convID, attachID)
+	if x.embedder == nil {
+		return fmt.Errorf("未设置向量化器")
+	}
+	if err := x.authorize(convID); err != nil {
+		return err
+	}
+
+	attachment, err := x.ar.GetByID(attachID)
+	if err != nil {
+		return err
+	}
+	linked, err := x.attachmentInConversation(attachment, convID)
+	if err != nil {
+		return err
+	}
+	if !linked {
+		return fmt.Errorf("附件 %s 不属于会话 %s", attachID, convID)
+	}
+	if attachment.DataSummary == "" {
+		return fmt.Errorf("附件 %s 没有摘要，无法向量化", attachID)
+	}
+
+	err = x.embedAndSave(ctx, []*models.Embedding{{
+		SourceType:     models.EmbeddingSourceAttachment,
+		SourceID:       attachmentSourceID(attachID, convID),
+		ConversationID: convID,
+		Content:        attachment.DataSummary,
+	}})
+	if err != nil {
+		return err
+	}
+
+	attachment.Vectorized = true
+	return x.ar.Update(attachment)
+}
+
+// embedAndSave 分批向量化并保存到向量存储库和内存索引
+func (x *History) embedAndSave(ctx context.Context, embeddings []*models.Embedding) error {
+	for start := 0; start < len(embeddings); start += embedBatchSize {
+		end := start + embedBatchSize
+		if end > len(embeddings) {
+			end = len(embeddings)
+		}
+		batch := embeddings[start:end]
+
+		texts := make([]string, len(batch))
+		for i, emb := range batch {
+			texts[i] = emb.Content
+		}
+		vectors, err := x.embedder.EmbedStrings(ctx, texts)
+		if err != nil {
+			return fmt.Errorf("向量化失败: %v", err)
+		}
+		if len(vectors) != len(batch) {
+			return fmt.Errorf("向量化结果数量不匹配: 期望 %d, 实际 %d", len(batch), len(vectors))
+		}
+
+		for i, emb := range batch {
+			emb.Vector = vectors[i]
+			if err := x.er.Upsert(emb); err != nil {
+				return err
+			}
+			x.index.put(emb)
+		}
+	}
+	return nil
+}
+
+// loadIndex 首次检索时从向量存储库加载全部向量
+func (x *History) loadIndex() error {
+	x.index.mu.RLock()
+	loaded := x.index.loaded
+	x.index.mu.RUnlock()
+	if loaded {
+		return nil
+	}
+
+	entries := make(map[string]*models.Embedding)
+	for offset := 0; ; offset += indexLoadPageSize {
+		page, err := x.er.List(offset, indexLoadPageSize)
+		if err != nil {
+			return err
+		}
+		for _, emb := range page {
+			entries[emb.SourceType+":"+emb.SourceID] = emb
+		}
+		if len(page) < indexLoadPageSize {
+			break
+		}
+	}
+
+	x.index.mu.Lock()
+	defer x.index.mu.Unlock()
+	if !x.index.loaded {
+		x.index.entries = entries
+		x.index.loaded = true
+	}
+	return nil
+}
+
+// ReloadIndex 丢弃内存中的向量索引，下次检索时从存储库重新加载
+// 在其他进程写入向量后调用
+func (x *History) ReloadIndex() {
+	x.index.reset()
+}
+
+// RetrieverConfig 历史检索器配置
+type RetrieverConfig struct {
+	// TopK 返回结果数，小于等于0时使用默认值5，可通过 retriever.WithTopK 在调用时覆盖
+	TopK int
+	// ScoreThreshold 余弦相似度下限，为0时不限制，可通过 retriever.WithScoreThreshold 在调用时覆盖
+	ScoreThreshold float64
+	// ConversationIDs 仅检索指定会话，为空时跨全部会话检索
+	ConversationIDs []string
+	// SourceTypes 仅检索指定来源类型，为空时检索消息、附件摘要和附件分块
+	SourceTypes []string
+}
+
+// HistoryRetriever 基于历史向量的 Eino 检索器，使用暴力余弦相似度检索
+type HistoryRetriever struct {
+	history *History
+	config  RetrieverConfig
+}
+
+var _ retriever.Retriever = (*HistoryRetriever)(nil)
+
+// NewRetriever 创建基于历史向量的 Eino 检索器，限定归属范围时只检索范围内的会话
+// 使用 SetEmbedder 设置的向量化器对查询向量化，也可通过 retriever.WithEmbedding 在调用时指定
+// 参数:
+//   - config: 检索器配置，为nil时使用默认配置
+//
+// 返回:
+//   - *HistoryRetriever: 新创建的检索器
+func (x *History) NewRetriever(config *RetrieverConfig) *HistoryRetriever {
+	r := &HistoryRetriever{history: x}
+	if config != nil {
+		r.config = *config
+	}
+	if r.config.TopK <= 0 {
+		r.config.TopK = defaultRetrieverTopK
+	}
+	return r
+}
+
+// GetType 返回检索器类型名称
+func (r *HistoryRetriever) GetType() string {
+	return "EinoHistory"
+}
+
+// scoredEmbedding 带相似度得分的向量
+type scoredEmbedding struct {
+	emb   *models.Embedding
+	score float64
+}
+
+// Retrieve 检索与查询最相关的历史消息和附件摘要
+func (r *HistoryRetriever) Retrieve(ctx context.Context, query string, opts ...retriever.Option) ([]*schema.Document, error) {
+	topK := r.config.TopK
+	threshold := r.config.ScoreThreshold
+	options := retriever.GetCommonOptions(&retriever.Options{
+		TopK:           &topK,
+		ScoreThreshold: &threshold,
+		Embedding:      r.history.embedder,
+	}, opts...)
+
+	if options.Embedding == nil {
+		return nil, fmt.Errorf("未设置向量化器")
+	}
+
+	vectors, err := options.Embedding.EmbedStrings(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("查询向量化失败: %v", err)
+	}
+	if len(vectors) != 1 {
+		return nil, fmt.Errorf("查询向量化结果数量不匹配: %d", len(vectors))
+	}
+
+	if err := r.history.loadIndex(); err != nil {
+		return nil, err
+	}
+
+	// 限定归属范围时只检索范围内的会话
+	var owned map[string]bool
+	if r.history.owner != nil {
+		convIDs, err := r.history.ownedConvIDs()
+		if err != nil {
+			return nil, err
+		}
+		owned = make(map[string]bool, len(convIDs))
+		for _, convID := range convIDs {
+			owned[convID] = true
+		}
+	}
+
+	var results []scoredEmbedding
+	r.history.index.mu.RLock()
+	for _, emb := range r.history.index.entries {
+		if owned != nil && !owned[emb.ConversationID] {
+			continue
+		}
+		if len(r.config.ConversationIDs) > 0 && !containsString(r.config.ConversationIDs, emb.ConversationID) {
+			continue
+		}
+		if len(r.config.SourceTypes) > 0 && !containsString(r.config.SourceTypes, emb.SourceType) {
+			continue
+		}
+		score := cosineSimilarity(vectors[0], emb.Vector)
+		if *options.ScoreThreshold != 0 && score < *options.ScoreThreshold {
+			continue
+		}
+		results = append(results, scoredEmbedding{emb: emb, score: score})
+	}
+	r.history.index.mu.RUnlock()
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score > results[j].score
+		}
+		return results[i].emb.SourceID < results[j].emb.SourceID
+	})
+	if len(results) > *options.TopK {
+		results = results[:*options.TopK]
+	}
+
+	docs := make([]*schema.Document, 0, len(results))
+	for _, res := range results {
+		doc := &schema.Document{
+			ID:      res.emb.SourceID,
+			Content: res.emb.Content,
+			MetaData: map[string]any{
+				MetaConversationID: res.emb.ConversationID,
+				MetaSourceType:     res.emb.SourceType,
+				MetaSourceID:       res.emb.SourceID,
+				MetaCreatedAt:      res.emb.CreatedAt,
+			},
+		}
+		if res.emb.SourceType != models.EmbeddingSourceMessage {
+			doc.MetaData[MetaAttachmentID] = sourceAttachmentID(res.emb.SourceID)
+		}
+		docs = append(docs, doc.WithScore(res.score))
+	}
+	return docs, nil
+}
+
+// cosineSimilarity 计算两个向量的余弦相似度，维度不同或存在零向量时返回0
+func cosineSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// containsString 判断字符串是否在列表中
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
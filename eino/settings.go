@@ -0,0 +1,173 @@
+package eino
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/hildam/eino-history/model"
+)
+
+// versionConflictRetries 读取后按版本号写回的操作遇到版本冲突时的最大重试次数
+const versionConflictRetries = 3
+
+// GetSettings 获取会话的类型化设置
+// 参数:
+//   - convID: 会话ID
+//
+// 返回:
+//   - *models.ConversationSettings: 会话设置，未设置时返回零值
+//   - error: 如果会话不存在或设置无法解析
+func (x *History) GetSettings(convID string) (*models.ConversationSettings, error) {
+	if err := x.authorize(convID); err != nil {
+		return nil, err
+	}
+	conv, err := x.cr.GetByID(convID)
+	if err != nil {
+		return nil, err
+	}
+	return models.ParseConversationSettings(conv.Settings)
+}
+
+// SetSettings 设置会话的类型化字段，并合并扩展字段
+// 类型化字段整体替换，settings.Extra 中的字段覆盖同名的已有扩展字段，其他已有扩展字段(如 forked_from)保留
+// 参数:
+//   - convID: 会话ID
+//   - settings: 新的会话设置
+//
+// 返回:
+//   - error: 如果会话不存在或更新过程中发生错误
+func (x *History) SetSettings(convID string, settings *models.ConversationSettings) error {
+	return x.UpdateSettings(convID, func(s *models.ConversationSettings) error {
+		s.Model = settings.Model
+		s.Temperature = settings.Temperature
+		s.SystemPrompt = settings.SystemPrompt
+		s.Tools = settings.Tools
+		for key, raw := range settings.Extra {
+			if s.Extra == nil {
+				s.Extra = make(map[string]json.RawMessage, len(settings.Extra))
+			}
+			s.Extra[key] = raw
+		}
+		return nil
+	})
+}
+
+// UpdateSettings 读取会话设置，由 fn 修改后按版本号写回，期间会话被其他写入修改时重新读取并重试
+// 参数:
+//   - convID: 会话ID
+//   - fn: 修改设置的函数，返回错误时不写回；重试时会以最新的设置再次调用
+//
+// 返回:
+//   - error: 如果会话不存在、fn 返回错误或更新过程中发生错误
+func (x *History) UpdateSettings(convID string, fn func(s *models.ConversationSettings) error) (err error) {
+	defer x.auditCall(&err, models.AuditConversationSettings, convID, "")
+	if err := x.authorize(convID); err != nil {
+		return err
+	}
+	// 并发修改时以版本号比较写回，冲突后重新读取并再次调用 fn
+	for attempt := 0; ; attempt++ {
+		conv, err := x.cr.GetByID(convID)
+		if err != nil {
+			return err
+		}
+		settings, err := models.ParseConversationSettings(conv.Settings)
+		if err != nil {
+			return err
+		}
+		if err := fn(settings); err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(settings)
+		if err != nil {
+			return err
+		}
+		_, err = x.cr.Patch(convID, &models.ConversationPatch{Settings: data, Version: &conv.Version})
+		if !errors.Is(err, models.ErrVersionConflict) || attempt >= versionConflictRetries {
+			return err
+		}
+	}
+}
+
+// GetHistoryWithSettings 获取聊天历史，并按会话设置构建发送给模型的消息列表
+// 参数:
+//   - convID: 会话ID
+//   - limit: 返回的消息数量上限，0表示使用默认值(100)
+//
+// 返回:
+//   - []*schema.Message: 应用会话设置后的消息列表
+//   - *models.ConversationSettings: 会话设置，可用于 ModelOptions 生成模型参数
+//   - error: 如果获取过程中发生错误
+func (x *History) GetHistoryWithSettings(convID string, limit int) ([]*schema.Message, *models.ConversationSettings, error) {
+	list, err := x.GetHistory(convID, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	conv, err := x.cr.GetByID(convID)
+	if err != nil {
+		return nil, nil, err
+	}
+	settings, err := models.ParseConversationSettings(conv.Settings)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ApplySettings(settings, list), settings, nil
+}
+
+// ApplySettings 将会话设置应用到消息列表，目前会在最前面加入系统提示词
+// 消息列表已以相同内容的系统消息开头时不重复加入
+// 参数:
+//   - settings: 会话设置，为nil时原样返回
+//   - list: 消息列表
+//
+// 返回:
+//   - []*schema.Message: 应用设置后的消息列表
+func ApplySettings(settings *models.ConversationSettings, list []*schema.Message) []*schema.Message {
+	if settings == nil || settings.SystemPrompt == "" {
+		return list
+	}
+	if len(list) > 0 && list[0].Role == schema.System && list[0].Content == settings.SystemPrompt {
+		return list
+	}
+	return append([]*schema.Message{schema.SystemMessage(settings.SystemPrompt)}, list...)
+}
+
+// ModelOptions 根据会话设置生成调用模型时的选项
+// 参数:
+//   - settings: 会话设置，为nil时返回空
+//   - tools: 可用的工具，只有名称在 settings.Tools 中的工具会被启用
+//
+// 返回:
+//   - []model.Option: 模型选项
+func ModelOptions(settings *models.ConversationSettings, tools []*schema.ToolInfo) []model.Option {
+	if settings == nil {
+		return nil
+	}
+
+	var opts []model.Option
+	if settings.Model != "" {
+		opts = append(opts, model.WithModel(settings.Model))
+	}
+	if settings.Temperature != nil {
+		opts = append(opts, model.WithTemperature(*settings.Temperature))
+	}
+
+	if len(settings.Tools) > 0 {
+		enabled := make(map[string]bool, len(settings.Tools))
+		for _, name := range settings.Tools {
+			enabled[name] = true
+		}
+		var selected []*schema.ToolInfo
+		for _, tool := range tools {
+			if enabled[tool.Name] {
+				selected = append(selected, tool)
+			}
+		}
+		if len(selected) > 0 {
+			opts = append(opts, model.WithTools(selected))
+		}
+	}
+	return opts
+}
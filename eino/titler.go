@@ -0,0 +1,285 @@
+package eino
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/hildam/eino-history/model"
+)
+
+const (
+	// DefaultTitleMaxLength 生成标题的默认最大字符数
+	DefaultTitleMaxLength = 20
+	// defaultTitleRetries 标题生成失败后的默认重试次数
+	defaultTitleRetries = 3
+	// defaultTitleRetryDelay 标题生成首次重试的默认等待时间，之后每次翻倍
+	defaultTitleRetryDelay = time.Second
+	// defaultTitleTimeout 单次标题生成的默认超时时间
+	defaultTitleTimeout = 30 * time.Second
+	// titleContextMessages 生成标题时读取的消息数
+	titleContextMessages = 6
+)
+
+// titlePrompt 使用 ChatModel 生成标题时的系统提示
+const titlePrompt = "你是一个对话标题生成助手。请根据用户提供的对话内容生成一个简短的标题，" +
+	"不超过%d个字，只输出标题本身，不要添加引号、标点或任何解释。"
+
+// Titler 根据对话内容生成会话标题
+type Titler interface {
+	// Title 生成会话标题
+	// 参数:
+	//   - ctx: 上下文
+	//   - messages: 会话开头的消息
+	//
+	// 返回:
+	//   - string: 生成的标题
+	//   - error: 如果生成过程中发生错误
+	Title(ctx context.Context, messages []*schema.Message) (string, error)
+}
+
+// HeuristicTitler 使用第一条用户消息的开头作为标题，不依赖模型
+type HeuristicTitler struct {
+	// MaxLength 标题最大字符数，小于等于0时使用 DefaultTitleMaxLength
+	MaxLength int
+}
+
+// Title 截取第一条用户消息的首行作为标题
+func (t *HeuristicTitler) Title(_ context.Context, messages []*schema.Message) (string, error) {
+	for _, m := range messages {
+		if m.Role != schema.User {
+			continue
+		}
+		if title := cleanTitle(m.Content, t.MaxLength); title != "" {
+			return title, nil
+		}
+	}
+	return "", fmt.Errorf("没有可用于生成标题的用户消息")
+}
+
+// ChatModelTitler 使用 Eino ChatModel 概括对话生成标题
+type ChatModelTitler struct {
+	chatModel model.ChatModel
+	maxLength int
+}
+
+// NewChatModelTitler 创建基于 ChatModel 的标题生成器
+// 参数:
+//   - chatModel: Eino 对话模型
+//   - maxLength: 标题最大字符数，小于等于0时使用 DefaultTitleMaxLength
+//
+// 返回:
+//   - *ChatModelTitler: 新创建的标题生成器
+func NewChatModelTitler(chatModel model.ChatModel, maxLength int) *ChatModelTitler {
+	if maxLength <= 0 {
+		maxLength = DefaultTitleMaxLength
+	}
+	return &ChatModelTitler{chatModel: chatModel, maxLength: maxLength}
+}
+
+// Title 将对话整理为文本交给模型概括
+func (t *ChatModelTitler) Title(ctx context.Context, messages []*schema.Message) (string, error) {
+	var transcript strings.Builder
+	for _, m := range messages {
+		if m.Content == "" {
+			continue
+		}
+		switch m.Role {
+		case schema.User:
+			transcript.WriteString("用户: ")
+		case schema.Assistant:
+			transcript.WriteString("助手: ")
+		default:
+			continue
+		}
+		transcript.WriteString(m.Content)
+		transcript.WriteString("\n")
+	}
+	if transcript.Len() == 0 {
+		return "", fmt.Errorf("没有可用于生成标题的对话内容")
+	}
+
+	resp, err := t.chatModel.Generate(ctx, []*schema.Message{
+		schema.SystemMessage(fmt.Sprintf(titlePrompt, t.maxLength)),
+		schema.UserMessage(transcript.String()),
+	})
+	if err != nil {
+		return "", fmt.Errorf("模型生成标题失败: %v", err)
+	}
+
+	title := cleanTitle(resp.Content, t.maxLength)
+	if title == "" {
+		return "", fmt.Errorf("模型返回的标题为空")
+	}
+	return title, nil
+}
+
+// cleanTitle 取首个非空行，去除常见的前缀、引号和结尾标点并截断
+func cleanTitle(text string, maxLength int) string {
+	if maxLength <= 0 {
+		maxLength = DefaultTitleMaxLength
+	}
+
+	var line string
+	for _, l := range strings.Split(text, "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			line = l
+			break
+		}
+	}
+	for _, prefix := range []string{"标题：", "标题:", "Title:", "title:"} {
+		line = strings.TrimPrefix(line, prefix)
+	}
+	line = strings.Join(strings.Fields(line), " ")
+	for {
+		trimmed := strings.Trim(line, "\"'`“”‘’「」《》【】*# ")
+		trimmed = strings.TrimRight(trimmed, "。.!！?？,，;；:：")
+		if trimmed == line {
+			break
+		}
+		line = trimmed
+	}
+
+	runes := []rune(line)
+	if len(runes) > maxLength {
+		runes = runes[:maxLength]
+	}
+	return strings.TrimSpace(string(runes))
+}
+
+// TitlerConfig 自动标题生成配置
+type TitlerConfig struct {
+	// Titler 标题生成器，为nil时使用 HeuristicTitler
+	Titler Titler
+	// Retries 生成失败后的重试次数，为0时使用默认值3，小于0时不重试
+	Retries int
+	// RetryDelay 首次重试前的等待时间，之后每次翻倍，为0时使用默认值1秒
+	RetryDelay time.Duration
+	// Timeout 单次生成的超时时间，为0时使用默认值30秒
+	Timeout time.Duration
+	// DisableFallback 重试耗尽后不再使用 HeuristicTitler 兜底
+	DisableFallback bool
+	// OnError 最终失败时的回调，可以为nil
+	OnError func(convID string, err error)
+}
+
+// titleState 自动标题生成的运行状态，在 WithOwner 返回的副本之间共享
+type titleState struct {
+	config   TitlerConfig
+	inflight sync.Map
+	wg       sync.WaitGroup
+}
+
+// SetTitler 开启自动标题生成，为nil时关闭
+// 会话中第一次保存助手回复后在后台生成标题，只为标题为空的会话生成，不会覆盖手动设置的标题
+// 参数:
+//   - config: 标题生成配置
+func (x *History) SetTitler(config *TitlerConfig) {
+	if config == nil {
+		x.titles = nil
+		return
+	}
+
+	state := &titleState{config: *config}
+	if state.config.Titler == nil {
+		state.config.Titler = &HeuristicTitler{}
+	}
+	if state.config.Retries == 0 {
+		state.config.Retries = defaultTitleRetries
+	}
+	if state.config.RetryDelay <= 0 {
+		state.config.RetryDelay = defaultTitleRetryDelay
+	}
+	if state.config.Timeout <= 0 {
+		state.config.Timeout = defaultTitleTimeout
+	}
+	x.titles = state
+}
+
+// WaitTitles 等待后台正在进行的标题生成结束
+func (x *History) WaitTitles() {
+	if x.titles != nil {
+		x.titles.wg.Wait()
+	}
+}
+
+// scheduleTitle 在助手回复保存后触发后台标题生成，同一会话同时只有一个生成任务
+func (x *History) scheduleTitle(convID string, role schema.RoleType) {
+	state := x.titles
+	if state == nil || role != schema.Assistant {
+		return
+	}
+	if _, running := state.inflight.LoadOrStore(convID, struct{}{}); running {
+		return
+	}
+
+	state.wg.Add(1)
+	go func() {
+		defer state.wg.Done()
+		defer state.inflight.Delete(convID)
+
+		if err := x.generateTitle(state, convID); err != nil && state.config.OnError != nil {
+			state.config.OnError(convID, err)
+		}
+	}()
+}
+
+// generateTitle 按退避策略重试生成标题，重试耗尽后使用启发式标题兜底，启发式标题不依赖模型调用因而不重试
+func (x *History) generateTitle(state *titleState, convID string) error {
+	conv, err := x.cr.GetByID(convID)
+	if err != nil {
+		return err
+	}
+	if conv.Title != "" {
+		return nil
+	}
+
+	mess, err := x.mr.ListByConversation(convID, 0, titleContextMessages)
+	if err != nil {
+		return err
+	}
+	history := messageList2ChatHistory(mess)
+
+	_, heuristic := state.config.Titler.(*HeuristicTitler)
+	delay := state.config.RetryDelay
+	var title string
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), state.config.Timeout)
+		title, err = state.config.Titler.Title(ctx, history)
+		cancel()
+		if err == nil || heuristic || attempt >= state.config.Retries {
+			break
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+	if err != nil {
+		if heuristic || state.config.DisableFallback {
+			return err
+		}
+		if title, err = (&HeuristicTitler{}).Title(context.Background(), history); err != nil {
+			return err
+		}
+	}
+
+	// 生成期间用户可能已手动设置标题，写入前重新读取，并按版本号写回避免覆盖并发设置的标题；
+	// 后台生成标题不是用户活动，不刷新更新时间，会话在最近列表中的位置保持不变
+	for attempt := 0; ; attempt++ {
+		conv, err = x.cr.GetByID(convID)
+		if err != nil {
+			return err
+		}
+		if conv.Title != "" {
+			return nil
+		}
+		_, err = x.cr.Patch(convID, &models.ConversationPatch{Title: &title, Version: &conv.Version, KeepUpdatedAt: true})
+		if !errors.Is(err, models.ErrVersionConflict) || attempt >= versionConflictRetries {
+			return err
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package eino
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hildam/eino-history/model"
+)
+
+// trashPageSize 清理回收站时的分页大小
+const trashPageSize = 100
+
+// PurgeReport 回收站清理结果
+type PurgeReport struct {
+	// Conversations 永久删除的会话数
+	Conversations int
+	// Messages 永久删除的消息数，不包括随会话一起删除的消息
+	Messages int
+}
+
+// DeleteConversation 将会话及其消息移入回收站
+// 会话的向量会被删除，恢复后需要重新调用 IndexConversation
+// 参数:
+//   - convID: 会话ID
+//
+// 返回:
+//   - error: 如果删除过程中发生错误
+func (x *History) DeleteConversation(convID string) (err error) {
+	defer x.auditCall(&err, models.AuditConversationDelete, convID, "")
+	if err := x.authorize(convID); err != nil {
+		return err
+	}
+
+	embeddings, err := x.er.ListByConversation(convID)
+	if err != nil {
+		return err
+	}
+	for _, emb := range embeddings {
+		if err := x.dropEmbedding(emb.SourceType, emb.SourceID); err != nil {
+			return err
+		}
+	}
+	return x.cr.Delete(convID)
+}
+
+// DeleteMessage 将消息移入回收站
+// 参数:
+//   - msgID: 消息ID
+//
+// 返回:
+//   - error: 如果删除过程中发生错误
+func (x *History) DeleteMessage(msgID string) (err error) {
+	var convID string
+	defer func() { x.auditCall(&err, models.AuditMessageDelete, convID, msgID) }()
+
+	msg, err := x.mr.GetByID(msgID)
+	if err != nil {
+		return err
+	}
+	convID = msg.ConversationID
+	if err := x.authorize(msg.ConversationID); err != nil {
+		return err
+	}
+	if err := x.dropEmbedding(models.EmbeddingSourceMessage, msgID); err != nil {
+		return err
+	}
+	return x.mr.Delete(msgID)
+}
+
+// ListTrash 按删除时间降序获取回收站中的会话，限定归属范围时只返回范围内的会话
+// 参数:
+//   - offset: 分页偏移量
+//   - limit: 返回会话数量上限
+//
+// 返回:
+//   - []*models.Conversation: 会话列表
+//   - error: 如果获取过程中发生错误
+func (x *History) ListTrash(offset, limit int) (list []*models.Conversation, err error) {
+	defer x.auditCall(&err, models.AuditConversationList, "", "")
+	return x.cr.ListDeleted(x.owner, 0, offset, limit)
+}
+
+// ListDeletedMessages 按删除时间降序获取会话中被单独删除的消息
+// 参数:
+//   - convID: 会话ID
+//   - offset: 分页偏移量
+//   - limit: 返回消息数量上限
+//
+// 返回:
+//   - []*models.Message: 消息列表
+//   - error: 如果获取过程中发生错误
+func (x *History) ListDeletedMessages(convID string, offset, limit int) (list []*models.Message, err error) {
+	defer x.auditCall(&err, models.AuditConversationRead, convID, "")
+	if err := x.authorize(convID); err != nil {
+		return nil, err
+	}
+	return x.mr.ListDeleted(convID, 0, offset, limit)
+}
+
+// RestoreConversation 从回收站恢复会话，以及随会话一起删除的消息
+// 参数:
+//   - convID: 会话ID
+//
+// 返回:
+//   - error: 如果会话不在回收站或恢复过程中发生错误
+func (x *History) RestoreConversation(convID string) (err error) {
+	defer x.auditCall(&err, models.AuditConversationRestore, convID, "")
+	conv, err := x.cr.GetDeleted(convID)
+	if err != nil {
+		return err
+	}
+	if x.owner != nil && !x.owner.Owns(conv) {
+		return ErrForbidden
+	}
+	return x.cr.Restore(convID)
+}
+
+// RestoreMessage 从回收站恢复消息，所属会话在回收站中时需先恢复会话
+// 参数:
+//   - msgID: 消息ID
+//
+// 返回:
+//   - error: 如果消息不在回收站、所属会话已被删除或恢复过程中发生错误
+func (x *History) RestoreMessage(msgID string) (err error) {
+	var convID string
+	defer func() { x.auditCall(&err, models.AuditMessageRestore, convID, msgID) }()
+
+	msg, err := x.mr.GetDeleted(msgID)
+	if err != nil {
+		return err
+	}
+	convID = msg.ConversationID
+	if err := x.authorizeAny(msg.ConversationID); err != nil {
+		return err
+	}
+	return x.mr.Restore(msgID)
+}
+
+// PurgeTrash 永久删除回收站中超过保留时间的会话和消息，以及它们的附件关联
+// 限定归属范围时只清理范围内的数据
+// 参数:
+//   - retention: 保留时间，删除时间早于当前时间减去保留时间的数据会被清理
+//
+// 返回:
+//   - *PurgeReport: 清理结果
+//   - error: 如果清理过程中发生错误
+func (x *History) PurgeTrash(retention time.Duration) (*PurgeReport, error) {
+	cutoff := time.Now().Add(-retention).Unix()
+	report := &PurgeReport{}
+
+	// 未能删除的数据会再次出现在列表前部，已处理过的数据跳过并计入偏移量，避免重复处理同一页
+	purged := make(map[string]bool)
+	skipped := 0
+	for {
+		convs, err := x.cr.ListDeleted(x.owner, cutoff, skipped, trashPageSize)
+		if err != nil {
+			return report, err
+		}
+		for _, conv := range convs {
+			if purged[conv.ConvID] {
+				skipped++
+				continue
+			}
+			purged[conv.ConvID] = true
+			err := x.cr.Purge(conv.ConvID)
+			event := &models.AuditEvent{Action: models.AuditConversationPurge, ConversationID: conv.ConvID, TenantID: conv.TenantID}
+			if err := x.audited(event, err); err != nil {
+				return report, err
+			}
+			report.Conversations++
+		}
+		if len(convs) < trashPageSize {
+			break
+		}
+	}
+
+	// 跳过不属于当前归属范围的消息，它们会一直留在列表前部
+	purged = make(map[string]bool)
+	skipped = 0
+	for {
+		mess, err := x.mr.ListDeleted("", cutoff, skipped, trashPageSize)
+		if err != nil {
+			return report, err
+		}
+		for _, m := range mess {
+			if purged[m.MsgID] || x.authorizeAny(m.ConversationID) != nil {
+				skipped++
+				continue
+			}
+			purged[m.MsgID] = true
+			err := x.mr.Purge(m.MsgID)
+			event := &models.AuditEvent{Action: models.AuditMessagePurge, ConversationID: m.ConversationID, TargetID: m.MsgID}
+			if err := x.audited(event, err); err != nil {
+				return report, err
+			}
+			report.Messages++
+		}
+		if len(mess) < trashPageSize {
+			break
+		}
+	}
+
+	return report, nil
+}
+
+// StartTrashPurger 启动后台任务，定期清理回收站中超过保留时间的数据
+// 参数:
+//   - retention: 保留时间
+//   - interval: 清理间隔
+//   - onError: 清理失败时的回调，可以为nil
+//
+// 返回:
+//   - func(): 停止任务的函数，返回时任务已退出
+func (x *History) StartTrashPurger(retention, interval time.Duration, onError func(error)) func() {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if _, err := x.PurgeTrash(retention); err != nil && onError != nil {
+					onError(err)
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		wg.Wait()
+	}
+}
+
+// authorizeAny 校验会话是否属于当前归属范围，会话可以在回收站中
+func (x *History) authorizeAny(convID string) error {
+	if x.owner == nil {
+		return nil
+	}
+	conv, err := x.cr.GetByID(convID)
+	if err != nil {
+		if conv, err = x.cr.GetDeleted(convID); err != nil {
+			return err
+		}
+	}
+	if !x.owner.Owns(conv) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// dropEmbedding 删除向量存储和内存索引中的向量
+func (x *History) dropEmbedding(sourceType, sourceID string) error {
+	if err := x.er.Delete(sourceType, sourceID); err != nil {
+		return err
+	}
+	x.index.remove(sourceType, sourceID)
+	return nil
+}
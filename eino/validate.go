@@ -0,0 +1,315 @@
+package eino
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/hildam/eino-history/model"
+)
+
+// sniffLen 检测内容类型时读取的字节数，与 http.DetectContentType 一致
+const sniffLen = 512
+
+// 附件校验失败的原因，通过 errors.Is 判断；超过大小限制时为 models.ErrBlobTooLarge
+var (
+	// ErrAttachmentTypeDenied 附件类型在拒绝列表中或不在允许列表中
+	ErrAttachmentTypeDenied = errors.New("附件类型不允许上传")
+	// ErrAttachmentExtensionMismatch 文件扩展名与检测到的内容类型不符
+	ErrAttachmentExtensionMismatch = errors.New("附件扩展名与内容不符")
+	// ErrAttachmentQuotaExceeded 会话中附件的总大小超过配额
+	ErrAttachmentQuotaExceeded = errors.New("会话附件总大小超过配额")
+)
+
+// AttachmentError 附件校验失败的错误，可以通过 errors.As 获取详情
+type AttachmentError struct {
+	// Err 失败原因，取值为 ErrAttachmentTypeDenied、ErrAttachmentExtensionMismatch、
+	// ErrAttachmentQuotaExceeded 或 models.ErrBlobTooLarge
+	Err error
+	// FileName 文件名
+	FileName string
+	// MimeType 检测到的 MIME 类型
+	MimeType string
+	// AttachmentType 附件类型
+	AttachmentType string
+	// Limit 超过的大小限制或配额(字节)，其他原因时为0
+	Limit int64
+}
+
+// Error 实现 error 接口
+func (e *AttachmentError) Error() string {
+	msg := fmt.Sprintf("附件 %s 校验失败: %v", e.FileName, e.Err)
+	if e.MimeType != "" {
+		msg += fmt.Sprintf("，类型 %s", e.MimeType)
+	}
+	if e.Limit > 0 {
+		msg += fmt.Sprintf("，限制 %d 字节", e.Limit)
+	}
+	return msg
+}
+
+// Unwrap 返回失败原因
+func (e *AttachmentError) Unwrap() error {
+	return e.Err
+}
+
+// extensionTypes 按扩展名推断的 MIME 类型，用于校验扩展名和补充内容检测无法区分的类型
+var extensionTypes = map[string]string{
+	".png": "image/png", ".jpg": "image/jpeg", ".jpeg": "image/jpeg", ".gif": "image/gif", ".webp": "image/webp",
+	".bmp": "image/bmp", ".ico": "image/x-icon", ".svg": "image/svg+xml", ".tif": "image/tiff", ".tiff": "image/tiff",
+	".heic": "image/heic", ".mp3": "audio/mpeg", ".wav": "audio/wave", ".ogg": "audio/ogg", ".oga": "audio/ogg",
+	".flac": "audio/flac", ".m4a": "audio/mp4", ".aac": "audio/aac", ".mid": "audio/midi", ".midi": "audio/midi",
+	".aif": "audio/aiff", ".aiff": "audio/aiff", ".mp4": "video/mp4", ".m4v": "video/mp4", ".mov": "video/quicktime",
+	".webm": "video/webm", ".avi": "video/avi", ".ogv": "video/ogg", ".mkv": "video/x-matroska",
+	".pdf": "application/pdf", ".zip": "application/zip", ".gz": "application/x-gzip", ".rar": "application/x-rar-compressed",
+	".7z": "application/x-7z-compressed", ".tar": "application/x-tar", ".wasm": "application/wasm",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".odt":  "application/vnd.oasis.opendocument.text", ".ods": "application/vnd.oasis.opendocument.spreadsheet",
+	".epub": "application/epub+zip", ".jar": "application/java-archive", ".apk": "application/vnd.android.package-archive",
+	".doc": "application/msword", ".xls": "application/vnd.ms-excel", ".ppt": "application/vnd.ms-powerpoint",
+	".exe": "application/vnd.microsoft.portable-executable", ".dll": "application/vnd.microsoft.portable-executable",
+	".ttf": "font/ttf", ".otf": "font/otf", ".woff": "font/woff", ".woff2": "font/woff2",
+	".html": "text/html", ".htm": "text/html", ".xml": "text/xml", ".json": "application/json", ".md": "text/markdown",
+	".markdown": "text/markdown", ".txt": "text/plain", ".log": "text/plain", ".csv": "text/csv", ".tsv": "text/tab-separated-values",
+	".css": "text/css", ".js": "text/javascript", ".yaml": "application/yaml", ".yml": "application/yaml",
+}
+
+// sniffableTypes http.DetectContentType 能够识别的二进制类型，内容检测不到这些类型时说明声明的类型不可信
+var sniffableTypes = map[string]bool{
+	"image/png": true, "image/jpeg": true, "image/gif": true, "image/webp": true, "image/bmp": true, "image/x-icon": true,
+	"audio/mpeg": true, "audio/wave": true, "audio/aiff": true, "audio/basic": true, "audio/midi": true,
+	"application/ogg": true, "video/mp4": true, "video/webm": true, "video/avi": true, "application/pdf": true,
+	"application/zip": true, "application/x-gzip": true, "application/x-rar-compressed": true, "application/wasm": true,
+	"font/ttf": true, "font/otf": true, "font/woff": true, "font/woff2": true, "font/collection": true,
+	"application/vnd.ms-fontobject": true, "application/postscript": true,
+}
+
+// typeAliases 内容检测结果与扩展名类型的等价关系，映射到同一个类型视为相符
+var typeAliases = map[string]string{
+	"image/jpg": "image/jpeg", "audio/mp3": "audio/mpeg", "audio/wav": "audio/wave", "audio/x-wav": "audio/wave",
+	"audio/ogg": "application/ogg", "video/ogg": "application/ogg", "audio/mp4": "video/mp4", "video/quicktime": "video/mp4",
+	"application/gzip": "application/x-gzip",
+}
+
+// DetectMIMEType 根据内容开头、文件名和声明的类型确定附件的 MIME 类型
+// 内容可识别时使用检测结果；检测结果为文本或 ZIP 时，使用与之兼容的扩展名类型或声明类型以区分具体格式；
+// 内容无法识别时，只有内容检测本可识别却未识别出的类型不被采信
+// 参数:
+//   - head: 内容开头，最多使用前512字节，为空时只根据文件名和声明类型确定
+//   - fileName: 文件名
+//   - declared: 调用方声明的 MIME 类型
+//
+// 返回:
+//   - string: MIME 类型，无法确定时为 application/octet-stream
+func DetectMIMEType(head []byte, fileName, declared string) string {
+	extType := extensionTypes[strings.ToLower(path.Ext(fileName))]
+	declared = mimeEssence(declared)
+
+	if len(head) == 0 {
+		return firstNonEmpty(declared, extType, "application/octet-stream")
+	}
+	sniffed := mimeEssence(http.DetectContentType(head))
+
+	switch family := typeFamily(sniffed); {
+	case family == "text" || family == "zip":
+		for _, candidate := range []string{extType, declared} {
+			if candidate != "" && typeFamily(candidate) == family {
+				return candidate
+			}
+		}
+	case sniffed == "application/octet-stream":
+		for _, candidate := range []string{extType, declared} {
+			if candidate != "" && !sniffableTypes[normalizeType(candidate)] && typeFamily(candidate) != "text" {
+				return candidate
+			}
+		}
+	}
+	return sniffed
+}
+
+// inspectAttachment 检测附件的 MIME 类型和附件类型，并校验类型的允许、拒绝列表和扩展名
+// head 为内容开头，为空时附件没有内容(如外部链接)，只根据文件名和声明类型确定且不校验扩展名
+func (x *History) inspectAttachment(attachment *models.Attachment, head []byte) error {
+	attachment.MimeType = DetectMIMEType(head, attachment.FileName, attachment.MimeType)
+	attachment.AttachmentType = attachmentTypeFor(attachment.MimeType, attachment.FileName, attachment.AttachmentType)
+	ext := strings.ToLower(path.Ext(attachment.FileName))
+
+	denied := matchesType(x.attach.DeniedTypes, attachment.MimeType, ext)
+	if len(x.attach.AllowedTypes) > 0 && !matchesType(x.attach.AllowedTypes, attachment.MimeType, ext) {
+		denied = true
+	}
+	if denied {
+		return x.attachmentError(attachment, ErrAttachmentTypeDenied, 0)
+	}
+
+	if !x.attach.AllowExtensionMismatch && extensionMismatch(head, ext) {
+		return x.attachmentError(attachment, ErrAttachmentExtensionMismatch, 0)
+	}
+	return nil
+}
+
+// typeLimit 附件所属类型的单个附件最大字节数，取 MaxSize 和 MaxSizeByType 中较小的一个，小于等于0时不限制
+func (x *History) typeLimit(attachment *models.Attachment) int64 {
+	limit := x.attach.MaxSize
+	if typeLimit := x.attach.MaxSizeByType[attachment.AttachmentType]; typeLimit > 0 && (limit <= 0 || typeLimit < limit) {
+		limit = typeLimit
+	}
+	return limit
+}
+
+// uploadLimit 计算流式上传时允许的最大字节数，小于等于0时不限制
+// 返回的 bool 表示限制来自会话配额，超出时应报告 ErrAttachmentQuotaExceeded
+func (x *History) uploadLimit(attachment *models.Attachment, convID string) (int64, bool, error) {
+	limit := x.typeLimit(attachment)
+	if x.attach.MaxConversationSize <= 0 {
+		return limit, false, nil
+	}
+
+	used, err := x.ar.SumSizeByConversation(convID)
+	if err != nil {
+		return 0, false, err
+	}
+	remaining := x.attach.MaxConversationSize - used
+	if remaining <= 0 {
+		return 0, false, x.sizeError(attachment, 0, true)
+	}
+	if limit <= 0 || remaining < limit {
+		return remaining, true, nil
+	}
+	return limit, false, nil
+}
+
+// checkAttachmentSize 校验已知大小的附件是否超过大小限制或会话配额，pending 为同一批次中尚未保存的附件总字节数
+func (x *History) checkAttachmentSize(attachment *models.Attachment, size, pending int64, convID string) error {
+	if limit := x.typeLimit(attachment); limit > 0 && size > limit {
+		return x.sizeError(attachment, limit, false)
+	}
+	if x.attach.MaxConversationSize <= 0 {
+		return nil
+	}
+	used, err := x.ar.SumSizeByConversation(convID)
+	if err != nil {
+		return err
+	}
+	if used+pending+size > x.attach.MaxConversationSize {
+		return x.sizeError(attachment, 0, true)
+	}
+	return nil
+}
+
+// sizeError 超过大小限制或会话配额时的错误
+func (x *History) sizeError(attachment *models.Attachment, limit int64, quota bool) error {
+	if quota {
+		return x.attachmentError(attachment, ErrAttachmentQuotaExceeded, x.attach.MaxConversationSize)
+	}
+	return x.attachmentError(attachment, models.ErrBlobTooLarge, limit)
+}
+
+// attachmentError 创建附件校验错误
+func (x *History) attachmentError(attachment *models.Attachment, reason error, limit int64) error {
+	return &AttachmentError{
+		Err:            reason,
+		FileName:       attachment.FileName,
+		MimeType:       attachment.MimeType,
+		AttachmentType: attachment.AttachmentType,
+		Limit:          limit,
+	}
+}
+
+// extensionMismatch 判断扩展名对应的类型与内容检测结果是否不符，扩展名未知时不校验
+func extensionMismatch(head []byte, ext string) bool {
+	extType := extensionTypes[ext]
+	if extType == "" || len(head) == 0 {
+		return false
+	}
+	sniffed := mimeEssence(http.DetectContentType(head))
+	if sniffed == "application/octet-stream" {
+		// 扩展名声称是可识别的类型或文本，内容却无法识别
+		return sniffableTypes[normalizeType(extType)] || typeFamily(extType) == "text"
+	}
+	if !sniffableTypes[normalizeType(extType)] && typeFamily(extType) != "text" && typeFamily(extType) != "zip" {
+		// 扩展名类型本身不可识别(如 .doc)，只要内容不是可识别的其他二进制格式即可
+		return sniffableTypes[sniffed] && sniffed != "application/zip"
+	}
+	return typeFamily(sniffed) != typeFamily(extType)
+}
+
+// attachmentTypeFor 按 MIME 类型和扩展名确定附件类型，文本内容保留调用方指定的 code 类型
+func attachmentTypeFor(mimeType, fileName, declared string) string {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return "image"
+	case strings.HasPrefix(mimeType, "audio/") || mimeType == "application/ogg":
+		return "audio"
+	case strings.HasPrefix(mimeType, "video/"):
+		return "video"
+	}
+	if typeFamily(mimeType) == "text" {
+		ext := strings.ToLower(path.Ext(fileName))
+		if declared == "code" || codeExtensions[ext] && !documentExtensions[ext] {
+			return "code"
+		}
+	}
+	return "file"
+}
+
+// documentExtensions 按扩展名识别为文本但不属于代码的文件
+var documentExtensions = map[string]bool{
+	".txt": true, ".log": true, ".csv": true, ".tsv": true, ".md": true, ".markdown": true, ".rst": true,
+}
+
+// typeFamily 将 MIME 类型归类，同一类的类型视为相符
+// 文本、HTML、XML、JSON 等归为 text，ZIP 及基于 ZIP 的格式归为 zip，其他类型按别名归一后各自成类
+func typeFamily(mimeType string) string {
+	switch {
+	case isTextMIME(mimeType) || mimeType == "image/svg+xml":
+		return "text"
+	case mimeType == "application/zip" || strings.HasSuffix(mimeType, "+zip") ||
+		strings.HasPrefix(mimeType, "application/vnd.openxmlformats-officedocument.") ||
+		strings.HasPrefix(mimeType, "application/vnd.oasis.opendocument.") ||
+		mimeType == "application/java-archive" || mimeType == "application/vnd.android.package-archive":
+		return "zip"
+	}
+	return normalizeType(mimeType)
+}
+
+// normalizeType 按别名归一 MIME 类型
+func normalizeType(mimeType string) string {
+	if alias, ok := typeAliases[mimeType]; ok {
+		return alias
+	}
+	return mimeType
+}
+
+// mimeEssence 去除 MIME 类型的参数并转为小写
+func mimeEssence(mimeType string) string {
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	return strings.ToLower(strings.TrimSpace(mimeType))
+}
+
+// matchesType 判断 MIME 类型或扩展名是否匹配列表中的任一项
+// 列表项可以是 MIME 类型、"image/*" 形式的通配、"*" 或以 "." 开头的扩展名
+func matchesType(patterns []string, mimeType, ext string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		switch {
+		case strings.HasPrefix(pattern, "."):
+			if pattern == ext {
+				return true
+			}
+		case pattern == "*" || pattern == "*/*":
+			return true
+		case strings.HasSuffix(pattern, "/*"):
+			if strings.HasPrefix(mimeType, strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+		case pattern == mimeType:
+			return true
+		}
+	}
+	return false
+}
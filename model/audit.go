@@ -0,0 +1,160 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// 审计事件的操作类型
+const (
+	AuditConversationCreate    = "conversation.create"
+	AuditConversationRead      = "conversation.read"
+	AuditConversationList      = "conversation.list"
+	AuditConversationUpdate    = "conversation.update"
+	AuditConversationArchive   = "conversation.archive"
+	AuditConversationUnarchive = "conversation.unarchive"
+	AuditConversationPin       = "conversation.pin"
+	AuditConversationUnpin     = "conversation.unpin"
+	AuditConversationDelete    = "conversation.delete"
+	AuditConversationRestore   = "conversation.restore"
+	AuditConversationPurge     = "conversation.purge"
+	AuditConversationAnonymize = "conversation.anonymize"
+	AuditConversationFork      = "conversation.fork"
+	AuditConversationExport    = "conversation.export"
+	AuditConversationSettings  = "conversation.settings"
+	AuditConversationTag       = "conversation.tag"
+	AuditConversationUntag     = "conversation.untag"
+	AuditConversationMove      = "conversation.move"
+	AuditConversationIndex     = "conversation.index"
+	AuditMessageCreate         = "message.create"
+	AuditMessageEdit           = "message.edit"
+	AuditMessageRollback       = "message.rollback"
+	AuditMessageDelete         = "message.delete"
+	AuditMessageRestore        = "message.restore"
+	AuditMessagePurge          = "message.purge"
+	AuditAttachmentUpload      = "attachment.upload"
+	AuditAttachmentDownload    = "attachment.download"
+	AuditAttachmentPurge       = "attachment.purge"
+	AuditFeedbackRecord        = "feedback.record"
+	AuditFeedbackDelete        = "feedback.delete"
+	AuditSearch                = "search"
+	AuditTagCreate             = "tag.create"
+	AuditTagRename             = "tag.rename"
+	AuditTagDelete             = "tag.delete"
+	AuditFolderCreate          = "folder.create"
+	AuditFolderRename          = "folder.rename"
+	AuditFolderMove            = "folder.move"
+	AuditFolderDelete          = "folder.delete"
+)
+
+// AuditEvent 审计日志表，只追加不修改
+// 每条事件的 Hash 由其内容和前一条事件的 Hash 计算，篡改或删除任意一条都会使之后的链校验失败
+type AuditEvent struct {
+	ID             uint64          `gorm:"primaryKey;column:id"`
+	Seq            int64           `gorm:"uniqueIndex:idx_audit_seq;column:seq"` // 链上的序号，从1开始连续递增
+	EventID        string          `gorm:"uniqueIndex:idx_audit_event_id;column:event_id;type:varchar(255)"`
+	TenantID       string          `gorm:"index:idx_audit_tenant;column:tenant_id;type:varchar(255);default:''"`
+	Actor          string          `gorm:"index:idx_audit_actor;column:actor;type:varchar(255);default:''"`
+	ActorSource    string          `gorm:"column:actor_source;type:varchar(255);default:''"` // 操作来源，如客户端IP或服务名
+	Action         string          `gorm:"index:idx_audit_action;column:action;type:varchar(64)"`
+	ConversationID string          `gorm:"index:idx_audit_conversation;column:conversation_id;type:varchar(255);default:''"`
+	TargetID       string          `gorm:"column:target_id;type:varchar(255);default:''"` // 消息、标签、文件夹等操作对象的ID
+	Detail         json.RawMessage `gorm:"column:detail;type:text" json:",omitempty"`     // 按原样保存，JSON列会被数据库重新格式化导致哈希变化
+	Error          string          `gorm:"column:error;type:text"`                        // 操作失败时的错误信息
+	CreatedAt      int64           `gorm:"index:idx_audit_created_at;column:created_at"`
+	PrevHash       string          `gorm:"column:prev_hash;type:char(64)"`
+	Hash           string          `gorm:"column:hash;type:char(64)"`
+}
+
+// TableName 设置表名
+func (AuditEvent) TableName() string {
+	return "audit_events"
+}
+
+// ComputeHash 计算事件在链上的哈希，包含 PrevHash 但不包含 ID 和 Hash 本身
+func (e *AuditEvent) ComputeHash() string {
+	fields := []string{
+		strconv.FormatInt(e.Seq, 10),
+		e.EventID,
+		e.TenantID,
+		e.Actor,
+		e.ActorSource,
+		e.Action,
+		e.ConversationID,
+		e.TargetID,
+		string(e.Detail),
+		e.Error,
+		strconv.FormatInt(e.CreatedAt, 10),
+		e.PrevHash,
+	}
+	// 每个字段带上长度前缀，避免字段内容中的分隔符造成歧义
+	var b strings.Builder
+	for _, f := range fields {
+		b.WriteString(strconv.Itoa(len(f)))
+		b.WriteByte(':')
+		b.WriteString(f)
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// Chain 将事件接在前一条事件之后，设置序号、前一条哈希和自身哈希
+// 参数:
+//   - prev: 链上最后一条事件，为nil时事件作为链的第一条
+func (e *AuditEvent) Chain(prev *AuditEvent) {
+	// 规范化详情，保证序列化往返后哈希不变
+	if len(e.Detail) > 0 {
+		if detail, err := json.Marshal(e.Detail); err == nil {
+			e.Detail = detail
+		}
+	}
+	e.Seq, e.PrevHash = 1, ""
+	if prev != nil {
+		e.Seq, e.PrevHash = prev.Seq+1, prev.Hash
+	}
+	e.Hash = e.ComputeHash()
+}
+
+// AuditQuery 审计日志查询条件，零值字段不作为条件
+type AuditQuery struct {
+	TenantID       string
+	Actor          string
+	ConversationID string
+	Actions        []string
+	// Since 创建时间下限(Unix秒)，包含
+	Since int64
+	// Until 创建时间上限(Unix秒)，包含
+	Until int64
+	// Offset 分页偏移量
+	Offset int
+	// Limit 返回数量上限，为0时不限制
+	Limit int
+	// Desc 是否按序号降序返回，默认升序
+	Desc bool
+}
+
+// MatchAction 判断操作类型是否满足查询条件
+func (q *AuditQuery) MatchAction(action string) bool {
+	if len(q.Actions) == 0 {
+		return true
+	}
+	for _, a := range q.Actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Match 判断事件是否满足查询条件，不考虑分页
+func (q *AuditQuery) Match(e *AuditEvent) bool {
+	return (q.TenantID == "" || e.TenantID == q.TenantID) &&
+		(q.Actor == "" || e.Actor == q.Actor) &&
+		(q.ConversationID == "" || e.ConversationID == q.ConversationID) &&
+		(q.Since == 0 || e.CreatedAt >= q.Since) &&
+		(q.Until == 0 || e.CreatedAt <= q.Until) &&
+		q.MatchAction(e.Action)
+}
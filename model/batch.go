@@ -0,0 +1,55 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+)
+
+// BatchItemError 批量操作中单项的失败
+type BatchItemError struct {
+	Index int    // 在输入列表中的位置
+	ID    string // 记录ID，尚未分配时为空
+	Err   error
+}
+
+// Error 实现 error 接口
+func (e *BatchItemError) Error() string {
+	if e.ID == "" {
+		return fmt.Sprintf("第 %d 项: %v", e.Index, e.Err)
+	}
+	return fmt.Sprintf("第 %d 项(%s): %v", e.Index, e.ID, e.Err)
+}
+
+// Unwrap 返回该项的原始错误
+func (e *BatchItemError) Unwrap() error {
+	return e.Err
+}
+
+// BatchError 批量操作部分失败时返回的错误，未列出的项均已成功
+type BatchError struct {
+	Total  int               // 输入的总项数
+	Failed []*BatchItemError // 失败的项，按位置升序
+}
+
+// NewBatchError 按位置排序失败项并汇总为 *BatchError，没有失败项时返回 nil
+func NewBatchError(total int, failed []*BatchItemError) error {
+	if len(failed) == 0 {
+		return nil
+	}
+	sort.Slice(failed, func(i, j int) bool { return failed[i].Index < failed[j].Index })
+	return &BatchError{Total: total, Failed: failed}
+}
+
+// Error 实现 error 接口
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("批量操作 %d 项中 %d 项失败, %v", e.Total, len(e.Failed), e.Failed[0])
+}
+
+// Unwrap 返回各失败项的错误，便于用 errors.Is 判断失败原因
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, len(e.Failed))
+	for i, item := range e.Failed {
+		errs[i] = item
+	}
+	return errs
+}
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+)
+
+// 附件内容的存储类型，与 Attachment.StorageType 的取值一致
+const (
+	// StorageTypePath 本地文件系统
+	StorageTypePath = "path"
+	// StorageTypeBlob 数据库
+	StorageTypeBlob = "blob"
+	// StorageTypeCloud 对象存储
+	StorageTypeCloud = "cloud"
+	// StorageTypeURL 外部链接，只保存链接(StoragePath)不保存内容
+	StorageTypeURL = "url"
+)
+
+// BlobChunkSize 数据库存储中每个分块的字节数，读取时按分块逐块加载
+const BlobChunkSize = 1 << 20
+
+// BlobInfo 内容存储中的一个内容对象，以内容的 SHA-256 寻址
+type BlobInfo struct {
+	// Hash 内容的 SHA-256，十六进制小写
+	Hash string
+	// Size 内容字节数
+	Size int64
+	// StorageType 存储类型，取值为 StorageTypePath、StorageTypeBlob 或 StorageTypeCloud
+	StorageType string
+	// Path 内容在存储中的位置，如文件相对路径或对象键
+	Path string
+	// CreatedAt 首次写入时间(Unix秒)
+	CreatedAt int64
+	// TouchedAt 最近一次写入或去重命中的时间(Unix秒)，附件回收不删除宽限期内写入过的内容
+	TouchedAt int64
+	// Deduplicated 写入时是否已存在相同内容
+	Deduplicated bool
+}
+
+// Blob 数据库内容存储的内容表
+type Blob struct {
+	ID         uint64 `gorm:"primaryKey;column:id"`
+	Hash       string `gorm:"uniqueIndex;column:hash;type:char(64)"`
+	Size       int64  `gorm:"column:size"`
+	ChunkCount int    `gorm:"column:chunk_count"`
+	CreatedAt  int64  `gorm:"column:created_at"`
+	TouchedAt  int64  `gorm:"column:touched_at;default:0"` // 最近一次写入或去重命中的时间，为0时取创建时间
+}
+
+// TableName 设置表名
+func (Blob) TableName() string {
+	return "blobs"
+}
+
+// BlobChunk 数据库内容存储的分块表
+type BlobChunk struct {
+	ID   uint64 `gorm:"primaryKey;column:id"`
+	Hash string `gorm:"uniqueIndex:idx_blob_chunk;column:hash;type:char(64)"`
+	Seq  int    `gorm:"uniqueIndex:idx_blob_chunk;column:seq"`
+	Data []byte `gorm:"column:data;type:mediumblob"`
+}
+
+// TableName 设置表名
+func (BlobChunk) TableName() string {
+	return "blob_chunks"
+}
+
+// ValidBlobHash 判断是否为合法的 SHA-256 十六进制小写字符串
+func ValidBlobHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	for _, c := range hash {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadBlob 读取全部内容并计算 SHA-256
+// 参数:
+//   - r: 内容
+//   - maxSize: 最大字节数，小于等于0时不限制
+//
+// 返回:
+//   - []byte: 内容
+//   - string: 内容的 SHA-256
+//   - error: 如果超过最大字节数(ErrBlobTooLarge)或读取过程中发生错误
+func ReadBlob(r io.Reader, maxSize int64) ([]byte, string, error) {
+	var buf bytes.Buffer
+	h := sha256.New()
+	if _, err := CopyBlob(io.MultiWriter(&buf, h), r, maxSize); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// CopyBlob 复制内容并校验大小，最多多读1个字节用于判断是否超限
+// 参数:
+//   - w: 写入目标
+//   - r: 内容
+//   - maxSize: 最大字节数，小于等于0时不限制
+//
+// 返回:
+//   - int64: 复制的字节数
+//   - error: 如果超过最大字节数(ErrBlobTooLarge)或复制过程中发生错误
+func CopyBlob(w io.Writer, r io.Reader, maxSize int64) (int64, error) {
+	if maxSize <= 0 {
+		return io.Copy(w, r)
+	}
+	n, err := io.Copy(w, io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return n, err
+	}
+	if n > maxSize {
+		return n, ErrBlobTooLarge
+	}
+	return n, nil
+}
@@ -0,0 +1,56 @@
+package models
+
+// 会话列表的排序字段
+const (
+	// ConversationSortUpdatedAt 按更新时间排序
+	ConversationSortUpdatedAt = "updated_at"
+	// ConversationSortCreatedAt 按创建时间排序
+	ConversationSortCreatedAt = "created_at"
+	// ConversationSortTitle 按标题排序
+	ConversationSortTitle = "title"
+)
+
+const (
+	// DefaultConversationQueryLimit 未指定数量上限时会话列表返回的条数
+	DefaultConversationQueryLimit = 20
+	// ConversationPreviewLength 会话中最后一条消息预览保留的字符数
+	ConversationPreviewLength = 100
+)
+
+// ConversationQuery 会话列表查询条件
+type ConversationQuery struct {
+	// Owner 仅查询指定归属的会话，为nil时不限制
+	Owner *Owner
+	// Archived 按归档状态过滤，为nil时包含全部会话，false 时排除已归档会话
+	Archived *bool
+	// PinnedFirst 置顶会话排在最前
+	PinnedFirst bool
+	// TitleContains 标题包含的子串，为空时不限制
+	TitleContains string
+	// CreatedAfter 创建时间下限(Unix秒)，为0时不限制
+	CreatedAfter int64
+	// CreatedBefore 创建时间上限(Unix秒)，为0时不限制
+	CreatedBefore int64
+	// UpdatedAfter 更新时间下限(Unix秒)，为0时不限制
+	UpdatedAfter int64
+	// UpdatedBefore 更新时间上限(Unix秒)，为0时不限制
+	UpdatedBefore int64
+	// SortBy 排序字段，为空时按更新时间排序
+	SortBy string
+	// Ascending 是否升序，默认降序
+	Ascending bool
+	// Cursor 上一页返回的 NextCursor，为空时从第一页开始
+	Cursor string
+	// Limit 每页数量，小于等于0时使用 DefaultConversationQueryLimit
+	Limit int
+}
+
+// ConversationPage 会话列表的一页结果
+type ConversationPage struct {
+	// Items 当前页的会话，消息数和最后一条消息预览见会话的活动字段
+	Items []*Conversation
+	// Total 满足过滤条件的会话总数
+	Total int64
+	// NextCursor 下一页的游标，没有更多数据时为空
+	NextCursor string
+}
@@ -0,0 +1,24 @@
+package models
+
+import "errors"
+
+// ErrDeleted 记录已被移入回收站
+var ErrDeleted = errors.New("记录已被删除")
+
+// ErrNameConflict 同一范围内已存在同名的标签或文件夹
+var ErrNameConflict = errors.New("名称已存在")
+
+// ErrFolderCycle 文件夹不能移动到自身或其子文件夹下
+var ErrFolderCycle = errors.New("文件夹不能移动到自身或其子文件夹下")
+
+// ErrBlobNotFound 内容存储中不存在该内容
+var ErrBlobNotFound = errors.New("内容不存在")
+
+// ErrBlobTooLarge 内容超过大小限制
+var ErrBlobTooLarge = errors.New("内容超过大小限制")
+
+// ErrNotFound 记录不存在
+var ErrNotFound = errors.New("记录不存在")
+
+// ErrVersionConflict 记录已被其他写入修改，调用方持有的版本已过期
+var ErrVersionConflict = errors.New("版本冲突，记录已被其他写入修改")
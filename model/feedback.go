@@ -0,0 +1,70 @@
+package models
+
+// 消息评价的取值
+const (
+	// FeedbackRatingUp 点赞
+	FeedbackRatingUp = 1
+	// FeedbackRatingNone 未打分，仅包含原因标签或文字反馈
+	FeedbackRatingNone = 0
+	// FeedbackRatingDown 点踩
+	FeedbackRatingDown = -1
+)
+
+// MessageFeedback 消息评价表，每个用户对一条消息只保留一条评价
+type MessageFeedback struct {
+	ID             uint64   `gorm:"primaryKey;column:id"`
+	MessageID      string   `gorm:"uniqueIndex:idx_feedback_message_user;column:message_id;type:varchar(255)"`
+	UserID         string   `gorm:"uniqueIndex:idx_feedback_message_user;column:user_id;type:varchar(255)"`
+	ConversationID string   `gorm:"index;column:conversation_id;type:varchar(255)"`
+	TenantID       string   `gorm:"column:tenant_id;type:varchar(255);default:''"`
+	Model          string   `gorm:"index;column:model;type:varchar(255);default:''"` // 生成被评价消息的模型
+	Rating         int      `gorm:"column:rating;default:0"`
+	Reasons        []string `gorm:"column:reasons;type:json;serializer:json"` // 原因标签，如 inaccurate、too_long
+	Comment        string   `gorm:"column:comment;type:text"`
+	CreatedAt      int64    `gorm:"column:created_at"`
+	UpdatedAt      int64    `gorm:"column:updated_at"`
+}
+
+// TableName 设置表名
+func (MessageFeedback) TableName() string {
+	return "message_feedback"
+}
+
+// FeedbackStats 评价汇总
+type FeedbackStats struct {
+	// Key 汇总维度的取值，按会话汇总时为会话ID，按模型汇总时为模型名称
+	Key string
+	// Total 评价总数
+	Total int64
+	// Up 点赞数
+	Up int64
+	// Down 点踩数
+	Down int64
+	// Reasons 各原因标签出现的次数
+	Reasons map[string]int64
+}
+
+// Add 将一条评价计入汇总
+func (s *FeedbackStats) Add(fb *MessageFeedback) {
+	s.Total++
+	switch {
+	case fb.Rating > 0:
+		s.Up++
+	case fb.Rating < 0:
+		s.Down++
+	}
+	for _, reason := range fb.Reasons {
+		if s.Reasons == nil {
+			s.Reasons = make(map[string]int64)
+		}
+		s.Reasons[reason]++
+	}
+}
+
+// Approval 点赞数在已打分评价中的占比，没有打分时返回0
+func (s *FeedbackStats) Approval() float64 {
+	if s.Up+s.Down == 0 {
+		return 0
+	}
+	return float64(s.Up) / float64(s.Up+s.Down)
+}
@@ -0,0 +1,29 @@
+package models
+
+// 附件摄取状态，对应 Attachment.IngestStatus
+const (
+	// IngestStatusPending 等待摄取
+	IngestStatusPending = "pending"
+	// IngestStatusProcessing 正在摄取
+	IngestStatusProcessing = "processing"
+	// IngestStatusDone 摄取完成
+	IngestStatusDone = "done"
+	// IngestStatusSkipped 附件不包含可提取的文本
+	IngestStatusSkipped = "skipped"
+	// IngestStatusFailed 重试耗尽后仍然失败
+	IngestStatusFailed = "failed"
+)
+
+// AttachmentChunk 附件文本分块表
+type AttachmentChunk struct {
+	ID           uint64 `gorm:"primaryKey;column:id"`
+	AttachmentID string `gorm:"uniqueIndex:idx_attachment_chunk;column:attachment_id;type:varchar(255)"`
+	Seq          int    `gorm:"uniqueIndex:idx_attachment_chunk;column:seq"`
+	Content      string `gorm:"column:content;type:text"`
+	CreatedAt    int64  `gorm:"column:created_at"`
+}
+
+// TableName 设置表名
+func (AttachmentChunk) TableName() string {
+	return "attachment_chunks"
+}
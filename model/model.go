@@ -14,6 +14,34 @@ type Conversation struct {
 	Settings   json.RawMessage `gorm:"column:settings;type:json"`
 	IsArchived bool            `gorm:"column:is_archived;default:0"`
 	IsPinned   bool            `gorm:"column:is_pinned;default:0"`
+	TenantID   string          `gorm:"column:tenant_id;type:varchar(255);default:'';index:idx_conversations_owner"`
+	UserID     string          `gorm:"column:user_id;type:varchar(255);default:'';index:idx_conversations_owner"`
+	DeletedAt  int64           `gorm:"column:deleted_at;default:0;index"` // 移入回收站的时间，0表示未删除
+	Version    int64           `gorm:"column:version;default:0"`          // 乐观锁版本号，新建为0，每次更新会话字段加1，活动字段的变化不改变版本
+
+	// 以下为活动字段，由消息写入时维护，会话更新不会覆盖
+	MessageCount       int64  `gorm:"column:message_count;default:0"`
+	TotalTokens        int64  `gorm:"column:total_tokens;default:0"`
+	LastMessageID      string `gorm:"column:last_message_id;type:varchar(255);default:''"`
+	LastMessageRole    string `gorm:"column:last_message_role;type:varchar(32);default:''"`
+	LastMessagePreview string `gorm:"column:last_message_preview;type:varchar(255);default:''"`
+	LastMessageAt      int64  `gorm:"column:last_message_at;default:0"`
+}
+
+// ActivityColumns 会话活动字段对应的列名
+var ActivityColumns = []string{
+	"message_count", "total_tokens", "last_message_id",
+	"last_message_role", "last_message_preview", "last_message_at",
+}
+
+// CopyActivity 从另一个会话复制活动字段
+func (c *Conversation) CopyActivity(from *Conversation) {
+	c.MessageCount = from.MessageCount
+	c.TotalTokens = from.TotalTokens
+	c.LastMessageID = from.LastMessageID
+	c.LastMessageRole = from.LastMessageRole
+	c.LastMessagePreview = from.LastMessagePreview
+	c.LastMessageAt = from.LastMessageAt
 }
 
 // TableName 设置表名
@@ -21,21 +49,37 @@ func (Conversation) TableName() string {
 	return "conversations"
 }
 
+// Owner 会话归属，UserID 为空时表示租户下的全部用户
+type Owner struct {
+	TenantID string
+	UserID   string
+}
+
+// Owns 判断会话是否属于该归属范围
+func (o *Owner) Owns(conv *Conversation) bool {
+	return conv.TenantID == o.TenantID && (o.UserID == "" || conv.UserID == o.UserID)
+}
+
 // Message 消息表
 type Message struct {
 	ID             uint64          `gorm:"primaryKey;column:id"`
 	MsgID          string          `gorm:"uniqueIndex;column:msg_id;type:varchar(255)"`
-	ConversationID string          `gorm:"column:conversation_id;type:varchar(255)"`
+	ConversationID string          `gorm:"column:conversation_id;type:varchar(255);index:idx_messages_conv_seq,priority:1"`
 	ParentID       string          `gorm:"column:parent_id;type:varchar(255);default:''"`
-	Role           string          `gorm:"column:role;type:enum('user','assistant','system','function')"`
-	Content        string          `gorm:"column:content;type:text"`
+	Role           string          `gorm:"column:role;type:enum('user','assistant','system','function','tool')"`
+	Content        string          `gorm:"column:content;type:text;index:idx_messages_content,class:FULLTEXT,option:WITH PARSER ngram"`
 	CreatedAt      int64           `gorm:"column:created_at"`
-	OrderSeq       int             `gorm:"column:order_seq;default:0"`
+	OrderSeq       int             `gorm:"column:order_seq;default:0;index:idx_messages_conv_seq,priority:2"`
 	TokenCount     int             `gorm:"column:token_count;default:0"`
 	Status         string          `gorm:"column:status;type:enum('sent','pending','error');default:'sent'"`
 	Metadata       json.RawMessage `gorm:"column:metadata;type:json"`
 	IsContextEdge  bool            `gorm:"column:is_context_edge;default:0"`
 	IsVariant      bool            `gorm:"column:is_variant;default:0"`
+	DeletedAt      int64           `gorm:"column:deleted_at;default:0;index"` // 移入回收站的时间，0表示未删除
+	Revision       int             `gorm:"column:revision;default:0"`         // 内容修订号，原始内容为0，每次修改内容或元数据加1
+	EditedBy       string          `gorm:"column:edited_by;type:varchar(255);default:''"`
+	EditedAt       int64           `gorm:"column:edited_at;default:0"`
+	Version        int64           `gorm:"column:version;default:0"` // 乐观锁版本号，新建为0，每次更新消息加1，与内容修订号相互独立
 }
 
 // TableName 设置表名
@@ -45,19 +89,26 @@ func (Message) TableName() string {
 
 // Attachment 附件表
 type Attachment struct {
-	ID             uint64 `gorm:"primaryKey;column:id"`
-	AttachID       string `gorm:"uniqueIndex;column:attach_id;type:varchar(255)"`
-	MessageID      string `gorm:"column:message_id;type:varchar(255)"`
-	AttachmentType string `gorm:"column:attachment_type;type:enum('file','image','code','audio','video')"`
-	FileName       string `gorm:"column:file_name;type:varchar(255)"`
-	FileSize       int64  `gorm:"column:file_size"`
-	StorageType    string `gorm:"column:storage_type;type:enum('path','blob','cloud')"`
-	StoragePath    string `gorm:"column:storage_path;type:varchar(1024)"`
-	Thumbnail      []byte `gorm:"column:thumbnail;type:mediumblob"`
-	Vectorized     bool   `gorm:"column:vectorized;default:0"`
-	DataSummary    string `gorm:"column:data_summary;type:text"`
-	MimeType       string `gorm:"column:mime_type;type:varchar(255)"`
-	CreatedAt      int64  `gorm:"column:created_at"`
+	ID             uint64          `gorm:"primaryKey;column:id"`
+	AttachID       string          `gorm:"uniqueIndex;column:attach_id;type:varchar(255)"`
+	MessageID      string          `gorm:"column:message_id;type:varchar(255)"`
+	AttachmentType string          `gorm:"column:attachment_type;type:enum('file','image','code','audio','video')"`
+	FileName       string          `gorm:"column:file_name;type:varchar(255)"`
+	FileSize       int64           `gorm:"column:file_size"`
+	StorageType    string          `gorm:"column:storage_type;type:enum('path','blob','cloud','url')"`
+	StoragePath    string          `gorm:"column:storage_path;type:varchar(1024)"`
+	ContentHash    string          `gorm:"index;column:content_hash;type:char(64);default:''"` // 内容的 SHA-256，内容保存在内容存储中时设置
+	Thumbnail      []byte          `gorm:"column:thumbnail;type:mediumblob"`
+	PreviewText    string          `gorm:"column:preview_text;type:text"`               // 文本类附件的首页预览
+	Metadata       json.RawMessage `gorm:"column:metadata;type:json" json:",omitempty"` // 预览时提取的元数据，如图片尺寸、视频时长
+	Vectorized     bool            `gorm:"column:vectorized;default:0"`
+	IngestStatus   string          `gorm:"index;column:ingest_status;type:varchar(16);default:''"` // 摄取状态，为空时未摄取
+	IngestError    string          `gorm:"column:ingest_error;type:text"`                          // 最近一次摄取失败的原因
+	IngestAttempts int             `gorm:"column:ingest_attempts;default:0"`                       // 摄取尝试次数
+	IngestedAt     int64           `gorm:"column:ingested_at;default:0"`                           // 最近一次摄取成功的时间(Unix秒)
+	DataSummary    string          `gorm:"column:data_summary;type:text"`
+	MimeType       string          `gorm:"column:mime_type;type:varchar(255)"`
+	CreatedAt      int64           `gorm:"column:created_at"`
 }
 
 // TableName 设置表名
@@ -76,3 +127,30 @@ type MessageAttachment struct {
 func (MessageAttachment) TableName() string {
 	return "message_attachments"
 }
+
+// Embedding 向量表，保存消息内容或附件摘要的向量
+type Embedding struct {
+	ID             uint64    `gorm:"primaryKey;column:id"`
+	SourceType     string    `gorm:"uniqueIndex:idx_embedding_source;column:source_type;type:enum('message','attachment','attachment_chunk')"`
+	SourceID       string    `gorm:"uniqueIndex:idx_embedding_source;column:source_id;type:varchar(255)"`
+	ConversationID string    `gorm:"index;column:conversation_id;type:varchar(255)"`
+	Content        string    `gorm:"column:content;type:text"`
+	Vector         []float64 `gorm:"column:vector;type:json;serializer:json"`
+	Dimension      int       `gorm:"column:dimension"`
+	CreatedAt      int64     `gorm:"column:created_at"`
+}
+
+// TableName 设置表名
+func (Embedding) TableName() string {
+	return "embeddings"
+}
+
+// 向量来源类型
+const (
+	// EmbeddingSourceMessage 消息内容
+	EmbeddingSourceMessage = "message"
+	// EmbeddingSourceAttachment 附件摘要，来源ID为 <附件ID>@<会话ID>
+	EmbeddingSourceAttachment = "attachment"
+	// EmbeddingSourceAttachmentChunk 附件文本分块，来源ID为 <附件ID>@<会话ID>#<分块序号>
+	EmbeddingSourceAttachmentChunk = "attachment_chunk"
+)
@@ -0,0 +1,63 @@
+package models
+
+// MaxOrganizeNameLength 标签和文件夹名称的最大字符数
+const MaxOrganizeNameLength = 255
+
+// Tag 标签表，标签名称在同一归属内唯一
+type Tag struct {
+	ID        uint64 `gorm:"primaryKey;column:id"`
+	TagID     string `gorm:"uniqueIndex;column:tag_id;type:varchar(255)"`
+	TenantID  string `gorm:"column:tenant_id;type:varchar(255);default:'';uniqueIndex:idx_tags_owner_name,priority:1"`
+	UserID    string `gorm:"column:user_id;type:varchar(255);default:'';uniqueIndex:idx_tags_owner_name,priority:2"`
+	Name      string `gorm:"column:name;type:varchar(255);uniqueIndex:idx_tags_owner_name,priority:3"`
+	Color     string `gorm:"column:color;type:varchar(32);default:''"`
+	CreatedAt int64  `gorm:"column:created_at"`
+}
+
+// TableName 设置表名
+func (Tag) TableName() string {
+	return "tags"
+}
+
+// ConversationTag 会话标签关联表
+type ConversationTag struct {
+	ID             uint64 `gorm:"primaryKey;column:id"`
+	ConversationID string `gorm:"column:conversation_id;type:varchar(255);uniqueIndex:idx_conversation_tag,priority:1"`
+	TagID          string `gorm:"column:tag_id;type:varchar(255);uniqueIndex:idx_conversation_tag,priority:2;index"`
+	CreatedAt      int64  `gorm:"column:created_at"`
+}
+
+// TableName 设置表名
+func (ConversationTag) TableName() string {
+	return "conversation_tags"
+}
+
+// Folder 文件夹表，支持嵌套，同一父文件夹下的名称唯一
+type Folder struct {
+	ID        uint64 `gorm:"primaryKey;column:id"`
+	FolderID  string `gorm:"uniqueIndex;column:folder_id;type:varchar(255)"`
+	TenantID  string `gorm:"column:tenant_id;type:varchar(255);default:'';index:idx_folders_owner;uniqueIndex:idx_folders_sibling_name,priority:1,length:64"`
+	UserID    string `gorm:"column:user_id;type:varchar(255);default:'';index:idx_folders_owner;uniqueIndex:idx_folders_sibling_name,priority:2,length:64"`
+	ParentID  string `gorm:"column:parent_id;type:varchar(255);default:'';index;uniqueIndex:idx_folders_sibling_name,priority:3,length:64"` // 为空表示根文件夹
+	Name      string `gorm:"column:name;type:varchar(255);uniqueIndex:idx_folders_sibling_name,priority:4"`
+	CreatedAt int64  `gorm:"column:created_at"`
+	UpdatedAt int64  `gorm:"column:updated_at"`
+}
+
+// TableName 设置表名
+func (Folder) TableName() string {
+	return "folders"
+}
+
+// ConversationFolder 会话所在文件夹的关联表，每个会话最多在一个文件夹中
+type ConversationFolder struct {
+	ID             uint64 `gorm:"primaryKey;column:id"`
+	ConversationID string `gorm:"uniqueIndex;column:conversation_id;type:varchar(255)"`
+	FolderID       string `gorm:"index;column:folder_id;type:varchar(255)"`
+	CreatedAt      int64  `gorm:"column:created_at"`
+}
+
+// TableName 设置表名
+func (ConversationFolder) TableName() string {
+	return "conversation_folders"
+}
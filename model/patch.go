@@ -0,0 +1,75 @@
+package models
+
+import "encoding/json"
+
+// ConversationPatch 会话的部分字段更新，为nil的字段保持不变
+type ConversationPatch struct {
+	Title      *string
+	Settings   json.RawMessage // 会话设置，整体替换
+	IsArchived *bool
+	IsPinned   *bool
+	Version    *int64 // 期望的当前版本，与存储中的版本不同时返回 ErrVersionConflict；为nil时不检查
+	// KeepUpdatedAt 为true时不刷新更新时间，会话在最近列表和分页中的位置不变，
+	// 用于后台生成标题等不代表用户活动的写入
+	KeepUpdatedAt bool
+}
+
+// Apply 将更新应用到会话
+func (p *ConversationPatch) Apply(conv *Conversation) {
+	if p.Title != nil {
+		conv.Title = *p.Title
+	}
+	if p.Settings != nil {
+		conv.Settings = append(json.RawMessage(nil), p.Settings...)
+	}
+	if p.IsArchived != nil {
+		conv.IsArchived = *p.IsArchived
+	}
+	if p.IsPinned != nil {
+		conv.IsPinned = *p.IsPinned
+	}
+}
+
+// MessagePatch 消息的部分字段更新，为nil的字段保持不变
+// 内容或元数据发生变化时与 MessageStore.Update 相同，旧版本保存为修订
+type MessagePatch struct {
+	Content       *string
+	Metadata      json.RawMessage // 元数据，整体替换
+	Status        *string
+	TokenCount    *int
+	IsContextEdge *bool
+	IsVariant     *bool
+	EditedBy      string // 内容或元数据发生变化时记录的编辑者
+	Version       *int64 // 期望的当前版本，与存储中的版本不同时返回 ErrVersionConflict；为nil时不检查
+}
+
+// Apply 将更新应用到消息
+func (p *MessagePatch) Apply(msg *Message) {
+	if p.Content != nil {
+		msg.Content = *p.Content
+	}
+	if p.Metadata != nil {
+		msg.Metadata = append(json.RawMessage(nil), p.Metadata...)
+	}
+	if p.Status != nil {
+		msg.Status = *p.Status
+	}
+	if p.TokenCount != nil {
+		msg.TokenCount = *p.TokenCount
+	}
+	if p.IsContextEdge != nil {
+		msg.IsContextEdge = *p.IsContextEdge
+	}
+	if p.IsVariant != nil {
+		msg.IsVariant = *p.IsVariant
+	}
+	msg.EditedBy = p.EditedBy
+}
+
+// CheckVersion 校验期望的版本，expected 为nil时不检查
+func CheckVersion(expected *int64, current int64) error {
+	if expected != nil && *expected != current {
+		return ErrVersionConflict
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+)
+
+// MessageRevision 消息修订表，保存消息被修改前的内容
+// 消息的当前内容不在修订表中，修订号为 Message.Revision
+type MessageRevision struct {
+	ID        uint64          `gorm:"primaryKey;column:id"`
+	MessageID string          `gorm:"uniqueIndex:idx_revision_message;column:message_id;type:varchar(255)"`
+	Revision  int             `gorm:"uniqueIndex:idx_revision_message;column:revision"`
+	Content   string          `gorm:"column:content;type:text"`
+	Metadata  json.RawMessage `gorm:"column:metadata;type:json"`
+	EditedBy  string          `gorm:"column:edited_by;type:varchar(255);default:''"` // 该版本的编辑者，原始内容为空
+	EditedAt  int64           `gorm:"column:edited_at"`                              // 该版本的产生时间
+	CreatedAt int64           `gorm:"column:created_at"`                             // 该版本被替换的时间
+}
+
+// TableName 设置表名
+func (MessageRevision) TableName() string {
+	return "message_revisions"
+}
+
+// NextRevision 比较消息的旧版本和新内容，内容或元数据发生变化时返回旧版本的修订，
+// 并将新内容的修订号加1、编辑时间设为 now；未发生变化时返回nil，并沿用旧版本的修订信息
+func NextRevision(old, msg *Message, now int64) *MessageRevision {
+	if !ContentChanged(old, msg) {
+		msg.Revision = old.Revision
+		msg.EditedBy = old.EditedBy
+		msg.EditedAt = old.EditedAt
+		return nil
+	}
+
+	editedAt := old.EditedAt
+	if editedAt == 0 {
+		editedAt = old.CreatedAt
+	}
+	msg.Revision = old.Revision + 1
+	msg.EditedAt = now
+	return &MessageRevision{
+		MessageID: old.MsgID,
+		Revision:  old.Revision,
+		Content:   old.Content,
+		Metadata:  old.Metadata,
+		EditedBy:  old.EditedBy,
+		EditedAt:  editedAt,
+		CreatedAt: now,
+	}
+}
+
+// ContentChanged 判断消息内容或元数据相对于旧版本是否发生变化
+// 元数据按JSON值比较，数据库对JSON列的格式化不视为变化
+func ContentChanged(old, msg *Message) bool {
+	return old.Content != msg.Content || !sameJSON(old.Metadata, msg.Metadata)
+}
+
+// sameJSON 判断两段JSON是否表示相同的值，空内容与 null 相同
+func sameJSON(a, b json.RawMessage) bool {
+	if bytes.Equal(a, b) {
+		return true
+	}
+	var va, vb interface{}
+	if len(a) > 0 {
+		if err := json.Unmarshal(a, &va); err != nil {
+			return false
+		}
+	}
+	if len(b) > 0 {
+		if err := json.Unmarshal(b, &vb); err != nil {
+			return false
+		}
+	}
+	return reflect.DeepEqual(va, vb)
+}
@@ -0,0 +1,47 @@
+package models
+
+// DefaultSearchLimit 未指定数量上限时全文检索返回的结果数
+const DefaultSearchLimit = 20
+
+// SearchFilter 全文检索的过滤与分页条件
+type SearchFilter struct {
+	// ConversationID 仅检索指定会话，为空时检索全部会话
+	ConversationID string
+	// Owner 仅检索指定归属的会话，为nil时不限制
+	Owner *Owner
+	// Roles 仅检索指定角色的消息，为空时不限制
+	Roles []string
+	// Since 消息创建时间下限(Unix秒)，为0时不限制
+	Since int64
+	// Until 消息创建时间上限(Unix秒)，为0时不限制
+	Until int64
+	// Archived 按会话归档状态过滤，为nil时不限制
+	Archived *bool
+	// Pinned 按会话置顶状态过滤，为nil时不限制
+	Pinned *bool
+	// Offset 分页偏移量
+	Offset int
+	// Limit 返回结果数量上限，小于等于0时使用 DefaultSearchLimit
+	Limit int
+}
+
+// SearchHit 全文检索命中的消息
+type SearchHit struct {
+	MsgID          string
+	ConversationID string
+	Role           string
+	// Snippet 命中位置附近的内容片段
+	Snippet string
+	// Score 相关度得分，越大越相关
+	Score     float64
+	CreatedAt int64
+}
+
+// SearchResult 全文检索结果
+type SearchResult struct {
+	// Hits 当前页的命中列表，按相关度降序排列
+	Hits []*SearchHit
+	// Total 满足条件的命中总数；Redis 后端取满当前页后不再校验剩余的候选消息，
+	// 此时把它们计入总数，结果为上界
+	Total int64
+}
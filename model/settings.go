@@ -0,0 +1,146 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// 会话设置中类型化字段的 key
+const (
+	SettingsModelKey        = "model"
+	SettingsTemperatureKey  = "temperature"
+	SettingsSystemPromptKey = "system_prompt"
+	SettingsToolsKey        = "tools"
+)
+
+// ConversationSettings 类型化的会话设置，对应 Conversation.Settings 中的JSON对象
+// 未识别的字段保存在 Extra 中，序列化时原样写回
+type ConversationSettings struct {
+	// Model 使用的模型ID
+	Model string
+	// Temperature 采样温度，为nil时使用模型默认值
+	Temperature *float32
+	// SystemPrompt 系统提示词，构建消息列表时放在最前
+	SystemPrompt string
+	// Tools 启用的工具名称
+	Tools []string
+	// Extra 扩展字段，如分叉来源 forked_from
+	Extra map[string]json.RawMessage
+}
+
+// ParseConversationSettings 解析会话设置，设置为空时返回零值
+// 参数:
+//   - raw: Conversation.Settings 的内容
+//
+// 返回:
+//   - *ConversationSettings: 解析后的设置
+//   - error: 如果设置不是有效的JSON对象或类型化字段的类型不正确
+func ParseConversationSettings(raw json.RawMessage) (*ConversationSettings, error) {
+	s := &ConversationSettings{}
+	if len(raw) == 0 || string(raw) == "null" {
+		return s, nil
+	}
+	if err := json.Unmarshal(raw, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// UnmarshalJSON 解析类型化字段，其余字段放入 Extra
+func (s *ConversationSettings) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("会话设置不是有效的JSON对象: %v", err)
+	}
+
+	typed := map[string]interface{}{
+		SettingsModelKey:        &s.Model,
+		SettingsTemperatureKey:  &s.Temperature,
+		SettingsSystemPromptKey: &s.SystemPrompt,
+		SettingsToolsKey:        &s.Tools,
+	}
+	for key, target := range typed {
+		raw, ok := fields[key]
+		if !ok {
+			continue
+		}
+		if err := json.Unmarshal(raw, target); err != nil {
+			return fmt.Errorf("会话设置字段 %s 无效: %v", key, err)
+		}
+		delete(fields, key)
+	}
+
+	s.Extra = nil
+	if len(fields) > 0 {
+		s.Extra = fields
+	}
+	return nil
+}
+
+// MarshalJSON 将类型化字段和扩展字段合并为一个JSON对象，零值字段不输出
+func (s ConversationSettings) MarshalJSON() ([]byte, error) {
+	fields := make(map[string]interface{}, len(s.Extra)+4)
+	for key, raw := range s.Extra {
+		fields[key] = raw
+	}
+	if s.Model != "" {
+		fields[SettingsModelKey] = s.Model
+	}
+	if s.Temperature != nil {
+		fields[SettingsTemperatureKey] = *s.Temperature
+	}
+	if s.SystemPrompt != "" {
+		fields[SettingsSystemPromptKey] = s.SystemPrompt
+	}
+	if len(s.Tools) > 0 {
+		fields[SettingsToolsKey] = s.Tools
+	}
+	return json.Marshal(fields)
+}
+
+// GetExtra 将扩展字段解析到 out 中
+// 参数:
+//   - key: 扩展字段的 key
+//   - out: 接收结果的指针
+//
+// 返回:
+//   - bool: 字段是否存在
+//   - error: 如果字段内容无法解析到 out
+func (s *ConversationSettings) GetExtra(key string, out interface{}) (bool, error) {
+	raw, ok := s.Extra[key]
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return true, fmt.Errorf("会话设置字段 %s 无效: %v", key, err)
+	}
+	return true, nil
+}
+
+// SetExtra 设置扩展字段，value 为nil时删除该字段
+// 参数:
+//   - key: 扩展字段的 key，不能是类型化字段的 key
+//   - value: 字段值，会被序列化为JSON
+//
+// 返回:
+//   - error: 如果 key 是类型化字段或 value 无法序列化
+func (s *ConversationSettings) SetExtra(key string, value interface{}) error {
+	switch key {
+	case SettingsModelKey, SettingsTemperatureKey, SettingsSystemPromptKey, SettingsToolsKey:
+		return fmt.Errorf("会话设置字段 %s 不是扩展字段", key)
+	}
+	if value == nil {
+		delete(s.Extra, key)
+		return nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if s.Extra == nil {
+		s.Extra = make(map[string]json.RawMessage)
+	}
+	s.Extra[key] = data
+	return nil
+}
@@ -0,0 +1,161 @@
+package blob
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hildam/eino-history/model"
+	"github.com/hildam/eino-history/store/common/logger"
+	"github.com/hildam/eino-history/store/interfaces"
+)
+
+// tempPattern 写入中的临时文件名，完成后重命名为内容哈希
+const tempPattern = ".upload-*"
+
+// FileStore 实现BlobStore接口的本地文件系统实现
+// 内容保存在 <root>/<哈希前2位>/<哈希第3、4位>/<哈希>，写入时先写临时文件再重命名，不会出现写了一半的内容
+type FileStore struct {
+	root   string
+	logger *logger.Logger
+}
+
+// NewFileStore 创建本地文件系统内容存储实例，目录不存在时自动创建
+// 参数:
+//   - root: 内容存储的根目录
+//
+// 返回:
+//   - interfaces.BlobStore: 内容存储实例
+//   - error: 如果目录无法创建
+func NewFileStore(root string) (interfaces.BlobStore, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("创建内容存储目录失败: %v", err)
+	}
+	return &FileStore{root: root}, nil
+}
+
+// SetLogger 设置日志记录器
+func (s *FileStore) SetLogger(logger *logger.Logger) {
+	s.logger = logger
+}
+
+// Put 边读边写入临时文件并计算哈希，内容已存在时删除临时文件
+func (s *FileStore) Put(r io.Reader, maxSize int64) (*models.BlobInfo, error) {
+	tmp, err := os.CreateTemp(s.root, tempPattern)
+	if err != nil {
+		return nil, err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	h := sha256.New()
+	size, err := models.CopyBlob(io.MultiWriter(tmp, h), r, maxSize)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hash := hex.EncodeToString(h.Sum(nil))
+	rel := relPath(hash)
+	path := filepath.Join(s.root, rel)
+	// 内容已存在时刷新修改时间作为最近写入时间，避免回收在附件记录创建前删除内容
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err == nil {
+		info, err := s.Stat(hash)
+		if err != nil {
+			return nil, err
+		}
+		info.Deduplicated = true
+		return info, nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		s.logError("刷新内容 %s 的修改时间失败: %v", hash, err)
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		s.logError("保存内容 %s 失败: %v", hash, err)
+		return nil, err
+	}
+
+	if s.logger != nil {
+		s.logger.Info("内容 %s 保存成功，大小 %d", hash, size)
+	}
+	return s.Stat(hash)
+}
+
+// Get 打开内容文件
+func (s *FileStore) Get(hash string) (io.ReadCloser, error) {
+	if !models.ValidBlobHash(hash) {
+		return nil, models.ErrBlobNotFound
+	}
+	f, err := os.Open(filepath.Join(s.root, relPath(hash)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, models.ErrBlobNotFound
+	}
+	return f, err
+}
+
+// Stat 获取内容文件信息，文件系统不保存首次写入时间，首次写入时间和最近写入时间均取文件修改时间
+func (s *FileStore) Stat(hash string) (*models.BlobInfo, error) {
+	if !models.ValidBlobHash(hash) {
+		return nil, models.ErrBlobNotFound
+	}
+	rel := relPath(hash)
+	fi, err := os.Stat(filepath.Join(s.root, rel))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, models.ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &models.BlobInfo{
+		Hash:        hash,
+		Size:        fi.Size(),
+		StorageType: models.StorageTypePath,
+		Path:        filepath.ToSlash(rel),
+		CreatedAt:   fi.ModTime().Unix(),
+		TouchedAt:   fi.ModTime().Unix(),
+	}, nil
+}
+
+// Delete 删除内容文件
+func (s *FileStore) Delete(hash string) error {
+	if !models.ValidBlobHash(hash) {
+		return models.ErrBlobNotFound
+	}
+	err := os.Remove(filepath.Join(s.root, relPath(hash)))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		s.logError("删除内容 %s 失败: %v", hash, err)
+		return err
+	}
+	if s.logger != nil {
+		s.logger.Info("内容 %s 删除成功", hash)
+	}
+	return nil
+}
+
+// relPath 内容文件相对根目录的路径，按哈希前缀分两级目录避免单个目录文件过多
+func relPath(hash string) string {
+	return filepath.Join(hash[:2], hash[2:4], hash)
+}
+
+// logError 记录错误日志
+func (s *FileStore) logError(format string, args ...interface{}) {
+	if s.logger != nil {
+		s.logger.Error(format, args...)
+	}
+}
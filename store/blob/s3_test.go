@@ -0,0 +1,461 @@
+package blob
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hildam/eino-history/model"
+)
+
+const (
+	testAccessKey = "test-access"
+	testSecretKey = "test-secret"
+	testBucket    = "bucket"
+)
+
+// fakeS3 兼容 S3 API 的本地替身，校验每个请求的签名，支持单次上传、分片上传、复制、HEAD、GET 和 DELETE
+type fakeS3 struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	uploads  map[string]map[int][]byte
+	requests []string
+	// failPart 上传该分片号时返回500，为0时不失败
+	failPart int
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: make(map[string][]byte), uploads: make(map[string]map[int][]byte)}
+}
+
+// calls 返回记录的请求，格式为 "<方法> <子资源>"
+func (f *fakeS3) calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.requests...)
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeS3Error(w, http.StatusBadRequest, "IncompleteBody")
+		return
+	}
+	query := r.URL.Query()
+	if query.Get("X-Amz-Signature") != "" {
+		err = verifyPresigned(r)
+	} else {
+		err = verifyHeaderSignature(r, body)
+	}
+	if err != nil {
+		writeS3Error(w, http.StatusForbidden, "SignatureDoesNotMatch")
+		return
+	}
+
+	key := r.URL.Path
+	uploadID := query.Get("uploadId")
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		f.requests = append(f.requests, "POST uploads")
+		uploadID = strconv.Itoa(len(f.uploads) + 1)
+		f.uploads[uploadID] = make(map[int][]byte)
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", uploadID)
+	case r.Method == http.MethodPut && uploadID != "":
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		f.requests = append(f.requests, "PUT part "+strconv.Itoa(number))
+		if number == f.failPart {
+			writeS3Error(w, http.StatusInternalServerError, "InternalError")
+			return
+		}
+		f.uploads[uploadID][number] = body
+		w.Header().Set("ETag", fmt.Sprintf("%q", "etag-"+strconv.Itoa(number)))
+	case r.Method == http.MethodPost && uploadID != "":
+		f.requests = append(f.requests, "POST complete")
+		var complete struct {
+			Parts []struct {
+				PartNumber int
+				ETag       string
+			} `xml:"Part"`
+		}
+		if err := xml.Unmarshal(body, &complete); err != nil {
+			writeS3Error(w, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+		var data []byte
+		for i, part := range complete.Parts {
+			if part.PartNumber != i+1 || part.ETag != fmt.Sprintf("%q", "etag-"+strconv.Itoa(part.PartNumber)) {
+				writeS3Error(w, http.StatusBadRequest, "InvalidPart")
+				return
+			}
+			data = append(data, f.uploads[uploadID][part.PartNumber]...)
+		}
+		delete(f.uploads, uploadID)
+		f.objects[key] = data
+		fmt.Fprint(w, "<CompleteMultipartUploadResult/>")
+	case r.Method == http.MethodDelete && uploadID != "":
+		f.requests = append(f.requests, "DELETE upload")
+		delete(f.uploads, uploadID)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		f.requests = append(f.requests, "PUT copy")
+		data, ok := f.objects[r.Header.Get("X-Amz-Copy-Source")]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		f.objects[key] = data
+		fmt.Fprint(w, "<CopyObjectResult/>")
+	case r.Method == http.MethodPut:
+		f.requests = append(f.requests, "PUT object")
+		f.objects[key] = body
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		f.requests = append(f.requests, r.Method+" object")
+		data, ok := f.objects[key]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	case r.Method == http.MethodDelete:
+		f.requests = append(f.requests, "DELETE object")
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeS3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+// verifyHeaderSignature 按 AWS Signature Version 4 重新计算 Authorization 请求头中的签名
+func verifyHeaderSignature(r *http.Request, body []byte) error {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 ") {
+		return errors.New("missing authorization")
+	}
+	fields := make(map[string]string)
+	for _, field := range strings.Split(strings.TrimPrefix(auth, "AWS4-HMAC-SHA256 "), ", ") {
+		name, value, _ := strings.Cut(field, "=")
+		fields[name] = value
+	}
+	credential := strings.SplitN(fields["Credential"], "/", 2)
+	if len(credential) != 2 || credential[0] != testAccessKey {
+		return errors.New("unknown access key")
+	}
+
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	sum := sha256.Sum256(body)
+	if payloadHash != hex.EncodeToString(sum[:]) {
+		return errors.New("payload hash mismatch")
+	}
+
+	signed := strings.Split(fields["SignedHeaders"], ";")
+	for _, required := range []string{"host", "x-amz-content-sha256", "x-amz-date"} {
+		if !containsString(signed, required) {
+			return fmt.Errorf("header %s not signed", required)
+		}
+	}
+	for name := range r.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-amz-") && !containsString(signed, lower) {
+			return fmt.Errorf("header %s not signed", lower)
+		}
+	}
+	var canonicalHeaders strings.Builder
+	for _, name := range signed {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		r.Method, r.URL.EscapedPath(), testCanonicalQuery(r.URL.Query(), ""),
+		canonicalHeaders.String(), fields["SignedHeaders"], payloadHash,
+	}, "\n")
+	if fields["Signature"] != testSignature(r.Header.Get("X-Amz-Date"), credential[1], canonicalRequest) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+// verifyPresigned 校验预签名链接的签名和有效期
+func verifyPresigned(r *http.Request) error {
+	query := r.URL.Query()
+	credential := strings.SplitN(query.Get("X-Amz-Credential"), "/", 2)
+	if len(credential) != 2 || credential[0] != testAccessKey || query.Get("X-Amz-SignedHeaders") != "host" {
+		return errors.New("invalid credential")
+	}
+	amzDate := query.Get("X-Amz-Date")
+	issued, err := time.Parse("20060102T150405Z", amzDate)
+	if err != nil {
+		return err
+	}
+	expires, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil || time.Now().After(issued.Add(time.Duration(expires)*time.Second)) {
+		return errors.New("expired")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		r.Method, r.URL.EscapedPath(), testCanonicalQuery(query, "X-Amz-Signature"),
+		"host:" + r.Host + "\n", "host", "UNSIGNED-PAYLOAD",
+	}, "\n")
+	if query.Get("X-Amz-Signature") != testSignature(amzDate, credential[1], canonicalRequest) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+// testSignature 使用测试密钥计算签名
+func testSignature(amzDate, scope, canonicalRequest string) string {
+	sum := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+	parts := strings.Split(scope, "/")
+	key := []byte("AWS4" + testSecretKey)
+	for _, part := range parts {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(stringToSign))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// testCanonicalQuery 按参数名排序并以 RFC 3986 编码查询参数，exclude 为不参与签名的参数
+func testCanonicalQuery(query url.Values, exclude string) string {
+	var pairs []string
+	for name, values := range query {
+		if name == exclude {
+			continue
+		}
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(name)+"="+uriEncode(value))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+func uriEncode(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// newTestS3Store 创建指向本地替身的对象存储实例
+func newTestS3Store(t *testing.T, fake *fakeS3, secret string) *S3Store {
+	t.Helper()
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	store, err := NewS3Store(S3Config{
+		Endpoint:        srv.URL,
+		Bucket:          testBucket,
+		Prefix:          "attachments/",
+		AccessKeyID:     testAccessKey,
+		SecretAccessKey: secret,
+		PathStyle:       true,
+		PartSize:        S3MinPartSize,
+		TempDir:         t.TempDir(),
+	})
+	if err != nil {
+		t.Fatalf("NewS3Store: %v", err)
+	}
+	return store
+}
+
+func TestS3StorePutGetStat(t *testing.T) {
+	fake := newFakeS3()
+	store := newTestS3Store(t, fake, testSecretKey)
+
+	info, err := store.Put(strings.NewReader("hello world"), 0)
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if info.Size != 11 || info.Deduplicated || info.Path != "attachments/"+info.Hash {
+		t.Fatalf("Put 返回 %+v", info)
+	}
+	if _, ok := fake.objects["/"+testBucket+"/attachments/"+info.Hash]; !ok {
+		t.Fatalf("对象未写入: %v", fake.calls())
+	}
+
+	stat, err := store.Stat(info.Hash)
+	if err != nil || stat.Size != 11 || stat.TouchedAt == 0 {
+		t.Fatalf("Stat: %+v, %v", stat, err)
+	}
+
+	rc, err := store.Get(info.Hash)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil || string(data) != "hello world" {
+		t.Fatalf("Get 返回 %q, %v", data, err)
+	}
+
+	dup, err := store.Put(strings.NewReader("hello world"), 0)
+	if err != nil || !dup.Deduplicated || dup.Hash != info.Hash {
+		t.Fatalf("重复 Put: %+v, %v", dup, err)
+	}
+	if calls := fake.calls(); calls[len(calls)-1] != "PUT copy" {
+		t.Fatalf("去重时应复制对象刷新修改时间: %v", calls)
+	}
+
+	if _, err := store.Put(strings.NewReader("hello world"), 5); !errors.Is(err, models.ErrBlobTooLarge) {
+		t.Fatalf("超过大小限制: %v", err)
+	}
+}
+
+func TestS3StoreNotFound(t *testing.T) {
+	store := newTestS3Store(t, newFakeS3(), testSecretKey)
+	missing := strings.Repeat("0", 64)
+
+	if _, err := store.Stat(missing); !errors.Is(err, models.ErrBlobNotFound) {
+		t.Fatalf("Stat: %v", err)
+	}
+	if _, err := store.Get(missing); !errors.Is(err, models.ErrBlobNotFound) {
+		t.Fatalf("Get: %v", err)
+	}
+	if _, err := store.Get("not-a-hash"); !errors.Is(err, models.ErrBlobNotFound) {
+		t.Fatalf("无效哈希: %v", err)
+	}
+}
+
+func TestS3StoreDelete(t *testing.T) {
+	fake := newFakeS3()
+	store := newTestS3Store(t, fake, testSecretKey)
+
+	info, err := store.Put(strings.NewReader("to be deleted"), 0)
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := store.Delete(info.Hash); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Stat(info.Hash); !errors.Is(err, models.ErrBlobNotFound) {
+		t.Fatalf("删除后 Stat: %v", err)
+	}
+	if err := store.Delete(info.Hash); err != nil {
+		t.Fatalf("删除不存在的对象: %v", err)
+	}
+}
+
+func TestS3StoreMultipart(t *testing.T) {
+	fake := newFakeS3()
+	store := newTestS3Store(t, fake, testSecretKey)
+
+	content := bytes.Repeat([]byte("0123456789abcdef"), (2*S3MinPartSize+1024)/16)
+	info, err := store.Put(bytes.NewReader(content), 0)
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if info.Size != int64(len(content)) {
+		t.Fatalf("大小 %d, 期望 %d", info.Size, len(content))
+	}
+	want := []string{"HEAD object", "POST uploads", "PUT part 1", "PUT part 2", "PUT part 3", "POST complete"}
+	if calls := fake.calls(); strings.Join(calls, ",") != strings.Join(want, ",") {
+		t.Fatalf("请求序列 %v, 期望 %v", calls, want)
+	}
+	if !bytes.Equal(fake.objects["/"+testBucket+"/attachments/"+info.Hash], content) {
+		t.Fatal("分片合并后的内容不一致")
+	}
+}
+
+func TestS3StoreMultipartAbort(t *testing.T) {
+	fake := newFakeS3()
+	fake.failPart = 2
+	store := newTestS3Store(t, fake, testSecretKey)
+
+	content := bytes.Repeat([]byte("x"), 2*S3MinPartSize+1)
+	_, err := store.Put(bytes.NewReader(content), 0)
+	var s3Err *S3Error
+	if !errors.As(err, &s3Err) || s3Err.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("分片失败应返回 *S3Error: %v", err)
+	}
+	calls := fake.calls()
+	if calls[len(calls)-1] != "DELETE upload" || containsString(calls, "POST complete") {
+		t.Fatalf("分片失败时应取消上传: %v", calls)
+	}
+	if len(fake.uploads) != 0 || len(fake.objects) != 0 {
+		t.Fatalf("取消后仍有残留: uploads=%d objects=%d", len(fake.uploads), len(fake.objects))
+	}
+}
+
+func TestS3StoreSignatureMismatch(t *testing.T) {
+	store := newTestS3Store(t, newFakeS3(), "wrong-secret")
+
+	_, err := store.Put(strings.NewReader("hello"), 0)
+	var s3Err *S3Error
+	if !errors.As(err, &s3Err) || s3Err.StatusCode != http.StatusForbidden {
+		t.Fatalf("错误的密钥应被拒绝: %v", err)
+	}
+}
+
+func TestS3StorePresignGet(t *testing.T) {
+	store := newTestS3Store(t, newFakeS3(), testSecretKey)
+
+	info, err := store.Put(strings.NewReader("presigned content"), 0)
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	link, err := store.PresignGet(info.Hash, time.Minute)
+	if err != nil {
+		t.Fatalf("PresignGet: %v", err)
+	}
+
+	resp, err := http.Get(link)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(data) != "presigned content" {
+		t.Fatalf("预签名下载返回 %d %q", resp.StatusCode, data)
+	}
+
+	tampered := strings.Replace(link, "X-Amz-Expires=60", "X-Amz-Expires=600", 1)
+	resp, err = http.Get(tampered)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("篡改后的链接应被拒绝，返回 %d", resp.StatusCode)
+	}
+
+	if _, err := store.PresignGet(info.Hash, S3MaxPresignExpires+time.Second); err == nil {
+		t.Fatal("超过最长有效期应返回错误")
+	}
+}
@@ -0,0 +1,165 @@
+package fulltext
+
+import (
+	"strings"
+	"unicode"
+)
+
+// DefaultSnippetRadius 默认摘要长度，匹配位置前后各保留的字符数
+const DefaultSnippetRadius = 40
+
+// Tokenize 将文本切分为检索词
+// 字母和数字按单词切分并转为小写，中日韩文字按二元组切分（与MySQL ngram解析器一致），
+// 单个中日韩字符保留为单字词
+// 参数:
+//   - text: 要切分的文本
+//
+// 返回:
+//   - []string: 检索词列表，可能包含重复项
+func Tokenize(text string) []string {
+	var (
+		tokens []string
+		word   []rune
+		cjk    []rune
+	)
+
+	flushWord := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, strings.ToLower(string(word)))
+			word = word[:0]
+		}
+	}
+	flushCJK := func() {
+		switch {
+		case len(cjk) == 1:
+			tokens = append(tokens, string(cjk))
+		case len(cjk) > 1:
+			for i := 0; i+1 < len(cjk); i++ {
+				tokens = append(tokens, string(cjk[i:i+2]))
+			}
+		}
+		cjk = cjk[:0]
+	}
+
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCJK()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+
+	return tokens
+}
+
+// TermFrequencies 统计文本中每个检索词的出现次数
+// 参数:
+//   - text: 要统计的文本
+//
+// 返回:
+//   - map[string]int: 检索词到出现次数的映射
+func TermFrequencies(text string) map[string]int {
+	freqs := make(map[string]int)
+	for _, t := range Tokenize(text) {
+		freqs[t]++
+	}
+	return freqs
+}
+
+// Snippet 截取内容中第一个匹配检索词附近的片段
+// 参数:
+//   - content: 原始内容
+//   - terms: 检索词列表
+//   - radius: 匹配位置前后保留的字符数，小于等于0时使用默认值
+//
+// 返回:
+//   - string: 摘要片段，被截断的一侧以省略号标记
+func Snippet(content string, terms []string, radius int) string {
+	if radius <= 0 {
+		radius = DefaultSnippetRadius
+	}
+
+	runes := []rune(content)
+	lower := []rune(strings.ToLower(content))
+	// ToLower 可能改变个别字符的长度，此时按原文开头截取
+	if len(lower) != len(runes) {
+		lower = runes
+	}
+
+	pos, matchLen := -1, 0
+	for _, term := range terms {
+		if idx := runeIndex(lower, []rune(term)); idx >= 0 && (pos < 0 || idx < pos) {
+			pos, matchLen = idx, len([]rune(term))
+		}
+	}
+	if pos < 0 {
+		pos = 0
+	}
+
+	start := pos - radius
+	if start < 0 {
+		start = 0
+	}
+	end := pos + matchLen + radius
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	snippet := strings.TrimSpace(string(runes[start:end]))
+	if start > 0 {
+		snippet = "..." + snippet
+	}
+	if end < len(runes) {
+		snippet += "..."
+	}
+	return snippet
+}
+
+// Preview 截取内容开头作为预览，换行替换为空格
+// 参数:
+//   - content: 原始内容
+//   - length: 保留的最大字符数
+//
+// 返回:
+//   - string: 预览文本，被截断时以省略号结尾
+func Preview(content string, length int) string {
+	content = strings.Join(strings.Fields(content), " ")
+	runes := []rune(content)
+	if len(runes) <= length {
+		return content
+	}
+	return string(runes[:length]) + "..."
+}
+
+// runeIndex 返回子串在字符切片中第一次出现的位置，未找到时返回-1
+func runeIndex(s, sub []rune) int {
+	if len(sub) == 0 {
+		return -1
+	}
+	for i := 0; i+len(sub) <= len(s); i++ {
+		match := true
+		for j := range sub {
+			if s[i+j] != sub[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
+
+// isCJK 判断字符是否为中日韩文字
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
@@ -0,0 +1,158 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hildam/eino-history/model"
+)
+
+// Cursor 会话列表的游标，记录上一页最后一条会话的排序键
+type Cursor struct {
+	// Pinned 最后一条会话的置顶状态，仅在置顶优先时使用
+	Pinned bool `json:"p,omitempty"`
+	// Int 整数排序字段的值
+	Int int64 `json:"i,omitempty"`
+	// Str 字符串排序字段的值
+	Str string `json:"s,omitempty"`
+	// ConvID 最后一条会话的ID，用于排序值相同时的稳定排序
+	ConvID string `json:"c"`
+}
+
+// NewCursor 根据会话和排序字段创建游标
+// 参数:
+//   - conv: 当前页最后一条会话
+//   - sortBy: 排序字段
+//
+// 返回:
+//   - *Cursor: 新创建的游标
+func NewCursor(conv *models.Conversation, sortBy string) *Cursor {
+	c := &Cursor{Pinned: conv.IsPinned, ConvID: conv.ConvID}
+	switch sortBy {
+	case models.ConversationSortCreatedAt:
+		c.Int = conv.CreatedAt
+	case models.ConversationSortTitle:
+		c.Str = conv.Title
+	default:
+		c.Int = conv.UpdatedAt
+	}
+	return c
+}
+
+// Encode 将游标编码为不透明字符串
+func (c *Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Decode 解析游标字符串
+// 参数:
+//   - s: Encode 生成的游标字符串
+//
+// 返回:
+//   - *Cursor: 解析出的游标
+//   - error: 如果游标格式不正确
+func Decode(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("游标格式不正确: %v", err)
+	}
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("游标格式不正确: %v", err)
+	}
+	return &c, nil
+}
+
+// Normalize 返回填充默认值并校验排序字段后的查询条件副本
+// 参数:
+//   - q: 原始查询条件，可以为nil
+//
+// 返回:
+//   - *models.ConversationQuery: 规范化后的查询条件
+//   - error: 如果排序字段不受支持
+func Normalize(q *models.ConversationQuery) (*models.ConversationQuery, error) {
+	normalized := models.ConversationQuery{}
+	if q != nil {
+		normalized = *q
+	}
+	switch normalized.SortBy {
+	case "":
+		normalized.SortBy = models.ConversationSortUpdatedAt
+	case models.ConversationSortUpdatedAt, models.ConversationSortCreatedAt, models.ConversationSortTitle:
+	default:
+		return nil, fmt.Errorf("不支持的排序字段: %s", normalized.SortBy)
+	}
+	if normalized.Limit <= 0 {
+		normalized.Limit = models.DefaultConversationQueryLimit
+	}
+	return &normalized, nil
+}
+
+// Compare 按查询条件的排序规则比较两个游标
+// 参数:
+//   - a: 第一个游标
+//   - b: 第二个游标
+//   - q: 规范化后的查询条件
+//
+// 返回:
+//   - int: a 排在 b 之前时返回负数，之后返回正数，相同返回0
+func Compare(a, b *Cursor, q *models.ConversationQuery) int {
+	if q.PinnedFirst && a.Pinned != b.Pinned {
+		if a.Pinned {
+			return -1
+		}
+		return 1
+	}
+
+	var c int
+	if q.SortBy == models.ConversationSortTitle {
+		c = strings.Compare(a.Str, b.Str)
+	} else if a.Int != b.Int {
+		c = -1
+		if a.Int > b.Int {
+			c = 1
+		}
+	}
+	if c == 0 {
+		c = strings.Compare(a.ConvID, b.ConvID)
+	}
+	if !q.Ascending {
+		c = -c
+	}
+	return c
+}
+
+// Match 判断会话是否满足查询条件中的过滤项，供无法下推过滤条件的后端使用
+// 参数:
+//   - conv: 会话
+//   - q: 规范化后的查询条件
+//
+// 返回:
+//   - bool: 是否满足过滤条件
+func Match(conv *models.Conversation, q *models.ConversationQuery) bool {
+	if q.Owner != nil && !q.Owner.Owns(conv) {
+		return false
+	}
+	if q.Archived != nil && conv.IsArchived != *q.Archived {
+		return false
+	}
+	if q.TitleContains != "" && !strings.Contains(strings.ToLower(conv.Title), strings.ToLower(q.TitleContains)) {
+		return false
+	}
+	if q.CreatedAfter > 0 && conv.CreatedAt < q.CreatedAfter {
+		return false
+	}
+	if q.CreatedBefore > 0 && conv.CreatedAt > q.CreatedBefore {
+		return false
+	}
+	if q.UpdatedAfter > 0 && conv.UpdatedAt < q.UpdatedAfter {
+		return false
+	}
+	if q.UpdatedBefore > 0 && conv.UpdatedAt > q.UpdatedBefore {
+		return false
+	}
+	return true
+}
@@ -1,6 +1,9 @@
 package interfaces
 
 import (
+	"io"
+	"time"
+
 	"github.com/hildam/eino-history/model"
 )
 
@@ -13,20 +16,103 @@ type MessageStore interface {
 	//   - error: 如果创建过程中发生错误
 	Create(msg *models.Message) error
 
-	// Update 更新已有消息
+	// CreateBatch 批量创建消息，同一会话的消息在一个事务中写入并更新会话的活动字段
+	// 未指定排序序号的消息按列表顺序在会话内顺延；某个会话写入失败不影响其他会话的消息
+	// 参数:
+	//   - msgs: 要创建的消息列表
+	// 返回:
+	//   - error: 部分消息失败时为 *models.BatchError，未列出的消息均已创建
+	CreateBatch(msgs []*models.Message) error
+
+	// Update 更新已有消息，不检查版本，后写入的覆盖先写入的；更新后 msg.Version 为新的版本号
+	// 内容或元数据发生变化时，旧版本在同一事务中保存为修订，修订号加1，编辑时间为当前时间，编辑者取 msg.EditedBy；
+	// 未发生变化时保留原有的修订号、编辑者和编辑时间
 	// 参数:
 	//   - msg: 包含更新数据的消息对象
 	// 返回:
 	//   - error: 如果更新过程中发生错误
 	Update(msg *models.Message) error
 
-	// Delete 删除指定ID的消息
+	// CompareAndUpdate 以 msg.Version 作为期望版本更新消息，其余规则与 Update 相同
+	// 参数:
+	//   - msg: 包含更新数据的消息对象，Version 为读取时的版本号
+	// 返回:
+	//   - error: 存储中的版本不同时为 models.ErrVersionConflict，消息不存在或更新过程中发生错误时返回对应错误
+	CompareAndUpdate(msg *models.Message) error
+
+	// Patch 在一个事务中读取消息、应用部分字段更新并写回，调用方无需读取和写回整条消息
+	// 参数:
+	//   - msgID: 消息ID
+	//   - patch: 要更新的字段，patch.Version 不为nil时校验版本
+	// 返回:
+	//   - *models.Message: 更新后的消息
+	//   - error: 版本不同时为 models.ErrVersionConflict，消息不存在或更新过程中发生错误时返回对应错误
+	Patch(msgID string, patch *models.MessagePatch) (*models.Message, error)
+
+	// ListRevisions 按修订号升序获取消息的历史修订，不包括当前内容
+	// 参数:
+	//   - msgID: 消息ID
+	// 返回:
+	//   - []*models.MessageRevision: 修订列表
+	//   - error: 如果获取过程中发生错误
+	ListRevisions(msgID string) ([]*models.MessageRevision, error)
+
+	// GetRevision 获取消息的指定历史修订
+	// 参数:
+	//   - msgID: 消息ID
+	//   - revision: 修订号
+	// 返回:
+	//   - *models.MessageRevision: 修订对象
+	//   - error: 如果修订不存在或获取过程中发生错误
+	GetRevision(msgID string, revision int) (*models.MessageRevision, error)
+
+	// DeleteRevisions 删除消息的全部历史修订，消息的当前内容和修订号不变
+	// 参数:
+	//   - msgID: 消息ID
+	// 返回:
+	//   - error: 如果删除过程中发生错误
+	DeleteRevisions(msgID string) error
+
+	// Delete 将指定ID的消息移入回收站，移入后的消息不再出现在常规读取中
 	// 参数:
 	//   - msgID: 要删除的消息ID
 	// 返回:
 	//   - error: 如果删除过程中发生错误
 	Delete(msgID string) error
 
+	// Restore 从回收站恢复消息
+	// 参数:
+	//   - msgID: 消息ID
+	// 返回:
+	//   - error: 如果消息不在回收站、所属会话已被删除或恢复过程中发生错误
+	Restore(msgID string) error
+
+	// GetDeleted 获取回收站中的消息
+	// 参数:
+	//   - msgID: 消息ID
+	// 返回:
+	//   - *models.Message: 获取到的消息对象
+	//   - error: 如果消息不在回收站或获取过程中发生错误
+	GetDeleted(msgID string) (*models.Message, error)
+
+	// ListDeleted 按删除时间降序获取回收站中的消息
+	// 参数:
+	//   - conversationID: 会话ID，为空时不限制会话
+	//   - before: 只返回删除时间早于该时间(Unix秒)的消息，为0时不限制
+	//   - offset: 分页偏移量
+	//   - limit: 返回消息数量上限
+	// 返回:
+	//   - []*models.Message: 消息列表
+	//   - error: 如果获取过程中发生错误
+	ListDeleted(conversationID string, before int64, offset, limit int) ([]*models.Message, error)
+
+	// Purge 永久删除回收站中的消息及其附件关联、评价和历史修订
+	// 参数:
+	//   - msgID: 消息ID
+	// 返回:
+	//   - error: 如果删除过程中发生错误
+	Purge(msgID string) error
+
 	// GetByID 根据ID获取消息
 	// 参数:
 	//   - msgID: 消息ID
@@ -35,6 +121,14 @@ type MessageStore interface {
 	//   - error: 如果获取过程中发生错误
 	GetByID(msgID string) (*models.Message, error)
 
+	// GetByIDs 批量获取消息，回收站中的消息视为不存在
+	// 参数:
+	//   - msgIDs: 消息ID列表
+	// 返回:
+	//   - []*models.Message: 找到的消息，按 msgIDs 的顺序排列
+	//   - error: 部分消息不存在时为 *models.BatchError(各项为 models.ErrNotFound)，同时返回找到的消息
+	GetByIDs(msgIDs []string) ([]*models.Message, error)
+
 	// ListByConversation 获取指定会话的消息列表
 	// 参数:
 	//   - conversationID: 会话ID
@@ -87,20 +181,69 @@ type ConversationStore interface {
 	//   - error: 如果创建过程中发生错误
 	Create(conv *models.Conversation) error
 
-	// Update 更新已有会话
+	// Update 更新已有会话，不检查版本，后写入的覆盖先写入的；更新后 conv.Version 为新的版本号
 	// 参数:
 	//   - conv: 包含更新数据的会话对象
 	// 返回:
 	//   - error: 如果更新过程中发生错误
 	Update(conv *models.Conversation) error
 
-	// Delete 删除指定ID的会话
+	// CompareAndUpdate 以 conv.Version 作为期望版本更新会话，其余规则与 Update 相同
+	// 参数:
+	//   - conv: 包含更新数据的会话对象，Version 为读取时的版本号
+	// 返回:
+	//   - error: 存储中的版本不同时为 models.ErrVersionConflict，会话不存在或更新过程中发生错误时返回对应错误
+	CompareAndUpdate(conv *models.Conversation) error
+
+	// Patch 在一个事务中读取会话、应用部分字段更新并写回，更新时间设为当前时间
+	// 参数:
+	//   - convID: 会话ID
+	//   - patch: 要更新的字段，patch.Version 不为nil时校验版本
+	// 返回:
+	//   - *models.Conversation: 更新后的会话
+	//   - error: 版本不同时为 models.ErrVersionConflict，会话在回收站中时为 models.ErrDeleted
+	Patch(convID string, patch *models.ConversationPatch) (*models.Conversation, error)
+
+	// Delete 将指定ID的会话及其消息移入回收站，移入后的会话不再出现在常规读取中
 	// 参数:
 	//   - convID: 要删除的会话ID
 	// 返回:
 	//   - error: 如果删除过程中发生错误
 	Delete(convID string) error
 
+	// Restore 从回收站恢复会话，以及随会话一起删除的消息
+	// 参数:
+	//   - convID: 会话ID
+	// 返回:
+	//   - error: 如果会话不在回收站或恢复过程中发生错误
+	Restore(convID string) error
+
+	// GetDeleted 获取回收站中的会话
+	// 参数:
+	//   - convID: 会话ID
+	// 返回:
+	//   - *models.Conversation: 获取到的会话对象
+	//   - error: 如果会话不在回收站或获取过程中发生错误
+	GetDeleted(convID string) (*models.Conversation, error)
+
+	// ListDeleted 按删除时间降序获取回收站中的会话
+	// 参数:
+	//   - owner: 归属范围，为nil时不限制
+	//   - before: 只返回删除时间早于该时间(Unix秒)的会话，为0时不限制
+	//   - offset: 分页偏移量
+	//   - limit: 返回会话数量上限
+	// 返回:
+	//   - []*models.Conversation: 会话列表
+	//   - error: 如果获取过程中发生错误
+	ListDeleted(owner *models.Owner, before int64, offset, limit int) ([]*models.Conversation, error)
+
+	// Purge 永久删除回收站中的会话及其全部消息、附件关联、评价、历史修订、标签和文件夹关联
+	// 参数:
+	//   - convID: 会话ID
+	// 返回:
+	//   - error: 如果删除过程中发生错误
+	Purge(convID string) error
+
 	// GetByID 根据ID获取会话
 	// 参数:
 	//   - convID: 会话ID
@@ -114,9 +257,20 @@ type ConversationStore interface {
 	//   - convID: 会话ID
 	// 返回:
 	//   - *models.Conversation: 查找到或新创建的会话对象
-	//   - error: 如果操作过程中发生错误
+	//   - error: 如果操作过程中发生错误，会话在回收站中时返回 models.ErrDeleted
 	FirstOrCreat(convID string) (*models.Conversation, error)
 
+	// FirstOrCreatForOwner 根据ID查找会话，如不存在则以指定归属创建
+	// 已存在的会话保持原有归属，由调用方校验归属是否匹配
+	// 参数:
+	//   - convID: 会话ID
+	//   - tenantID: 新建会话的租户ID
+	//   - userID: 新建会话的用户ID
+	// 返回:
+	//   - *models.Conversation: 查找到或新创建的会话对象
+	//   - error: 如果操作过程中发生错误，会话在回收站中时返回 models.ErrDeleted
+	FirstOrCreatForOwner(convID, tenantID, userID string) (*models.Conversation, error)
+
 	// List 获取会话列表
 	// 参数:
 	//   - offset: 分页偏移量
@@ -126,6 +280,25 @@ type ConversationStore interface {
 	//   - error: 如果获取过程中发生错误
 	List(offset, limit int) ([]*models.Conversation, error)
 
+	// ListByOwner 获取指定归属的会话列表
+	// 参数:
+	//   - tenantID: 租户ID
+	//   - userID: 用户ID，为空时返回租户下全部用户的会话
+	//   - offset: 分页偏移量
+	//   - limit: 返回会话数量上限
+	// 返回:
+	//   - []*models.Conversation: 按更新时间降序排列的会话列表
+	//   - error: 如果获取过程中发生错误
+	ListByOwner(tenantID, userID string, offset, limit int) ([]*models.Conversation, error)
+
+	// Query 按条件查询会话列表，结果附带总数、消息数和最后一条消息预览
+	// 参数:
+	//   - query: 过滤、排序和游标分页条件
+	// 返回:
+	//   - *models.ConversationPage: 一页会话及下一页游标
+	//   - error: 如果查询过程中发生错误
+	Query(query *models.ConversationQuery) (*models.ConversationPage, error)
+
 	// Archive 归档指定会话
 	// 参数:
 	//   - convID: 要归档的会话ID
@@ -186,6 +359,14 @@ type AttachmentStore interface {
 	//   - error: 如果获取过程中发生错误
 	GetByID(attachID string) (*models.Attachment, error)
 
+	// GetByIDs 批量获取附件
+	// 参数:
+	//   - attachIDs: 附件ID列表
+	// 返回:
+	//   - []*models.Attachment: 找到的附件，按 attachIDs 的顺序排列
+	//   - error: 部分附件不存在时为 *models.BatchError(各项为 models.ErrNotFound)，同时返回找到的附件
+	GetByIDs(attachIDs []string) ([]*models.Attachment, error)
+
 	// ListByMessage 获取指定消息的附件列表
 	// 参数:
 	//   - messageID: 消息ID
@@ -193,6 +374,74 @@ type AttachmentStore interface {
 	//   - []*models.Attachment: 附件列表
 	//   - error: 如果获取过程中发生错误
 	ListByMessage(messageID string) ([]*models.Attachment, error)
+
+	// ListUnreferenced 获取没有任何消息关联的附件，按创建时间升序
+	// 参数:
+	//   - before: 只返回创建时间(Unix秒)早于该时间的附件
+	//   - limit: 最多返回的数量，小于等于0时不限制
+	// 返回:
+	//   - []*models.Attachment: 附件列表
+	//   - error: 如果获取过程中发生错误
+	ListUnreferenced(before int64, limit int) ([]*models.Attachment, error)
+
+	// DeleteUnreferenced 在附件没有任何消息关联时删除附件，判断和删除在同一事务中完成
+	// 参数:
+	//   - attachID: 附件ID
+	// 返回:
+	//   - bool: 是否已删除，附件仍有关联或不存在时为false
+	//   - error: 如果删除过程中发生错误
+	DeleteUnreferenced(attachID string) (bool, error)
+
+	// CountByContentHash 统计引用指定内容的附件数
+	// 参数:
+	//   - hash: 内容的 SHA-256
+	// 返回:
+	//   - int64: 附件数
+	//   - error: 如果统计过程中发生错误
+	CountByContentHash(hash string) (int64, error)
+
+	// SumSizeByConversation 统计会话中消息(包括回收站中的消息)关联的附件总字节数，同一附件只计算一次
+	// 参数:
+	//   - conversationID: 会话ID
+	// 返回:
+	//   - int64: 附件总字节数
+	//   - error: 如果统计过程中发生错误
+	SumSizeByConversation(conversationID string) (int64, error)
+
+	// ListByIngestStatus 获取指定摄取状态的附件，按创建时间升序
+	// 参数:
+	//   - status: 摄取状态，取值见 models.IngestStatusPending 等
+	//   - limit: 最多返回的数量，小于等于0时不限制
+	// 返回:
+	//   - []*models.Attachment: 附件列表
+	//   - error: 如果获取过程中发生错误
+	ListByIngestStatus(status string, limit int) ([]*models.Attachment, error)
+}
+
+// AttachmentChunkStore 定义附件文本分块存储库接口
+type AttachmentChunkStore interface {
+	// Replace 替换附件的全部分块，分块序号按列表顺序从0开始
+	// 参数:
+	//   - attachmentID: 附件ID
+	//   - chunks: 新的分块列表，为空时删除全部分块
+	// 返回:
+	//   - error: 如果替换过程中发生错误
+	Replace(attachmentID string, chunks []*models.AttachmentChunk) error
+
+	// ListByAttachment 获取附件的全部分块，按序号升序
+	// 参数:
+	//   - attachmentID: 附件ID
+	// 返回:
+	//   - []*models.AttachmentChunk: 分块列表
+	//   - error: 如果获取过程中发生错误
+	ListByAttachment(attachmentID string) ([]*models.AttachmentChunk, error)
+
+	// DeleteByAttachment 删除附件的全部分块
+	// 参数:
+	//   - attachmentID: 附件ID
+	// 返回:
+	//   - error: 如果删除过程中发生错误
+	DeleteByAttachment(attachmentID string) error
 }
 
 // MessageAttachmentStore 定义消息-附件关联存储库接口
@@ -219,6 +468,14 @@ type MessageAttachmentStore interface {
 	//   - error: 如果获取过程中发生错误
 	ListByMessage(messageID string) ([]*models.MessageAttachment, error)
 
+	// ListByMessages 批量获取多条消息的附件关联
+	// 参数:
+	//   - messageIDs: 消息ID列表
+	// 返回:
+	//   - []*models.MessageAttachment: 这些消息的全部附件关联
+	//   - error: 如果获取过程中发生错误
+	ListByMessages(messageIDs []string) ([]*models.MessageAttachment, error)
+
 	// ListByAttachment 获取指定附件的所有消息关联
 	// 参数:
 	//   - attachmentID: 附件ID
@@ -226,4 +483,359 @@ type MessageAttachmentStore interface {
 	//   - []*models.MessageAttachment: 消息附件关联列表
 	//   - error: 如果获取过程中发生错误
 	ListByAttachment(attachmentID string) ([]*models.MessageAttachment, error)
+
+	// CountByAttachment 统计附件的消息关联数，即附件的引用计数
+	// 参数:
+	//   - attachmentID: 附件ID
+	// 返回:
+	//   - int64: 关联数
+	//   - error: 如果统计过程中发生错误
+	CountByAttachment(attachmentID string) (int64, error)
+}
+
+// SearchStore 定义消息全文检索接口
+type SearchStore interface {
+	// Search 按关键词检索消息
+	// 参数:
+	//   - query: 检索关键词
+	//   - filter: 过滤与分页条件
+	// 返回:
+	//   - *models.SearchResult: 按相关度排序的检索结果
+	//   - error: 如果检索过程中发生错误
+	Search(query string, filter *models.SearchFilter) (*models.SearchResult, error)
+}
+
+// EmbeddingStore 定义向量存储库接口
+type EmbeddingStore interface {
+	// Upsert 创建或更新向量，以来源类型和来源ID唯一确定
+	// 参数:
+	//   - embedding: 要保存的向量对象
+	// 返回:
+	//   - error: 如果保存过程中发生错误
+	Upsert(embedding *models.Embedding) error
+
+	// Delete 删除指定来源的向量
+	// 参数:
+	//   - sourceType: 来源类型
+	//   - sourceID: 来源ID
+	// 返回:
+	//   - error: 如果删除过程中发生错误
+	Delete(sourceType, sourceID string) error
+
+	// DeleteByPrefix 删除来源ID以指定前缀开头的全部向量
+	// 参数:
+	//   - sourceType: 来源类型
+	//   - prefix: 来源ID前缀
+	// 返回:
+	//   - error: 如果删除过程中发生错误
+	DeleteByPrefix(sourceType, prefix string) error
+
+	// ListByConversation 获取指定会话的全部向量
+	// 参数:
+	//   - conversationID: 会话ID
+	// 返回:
+	//   - []*models.Embedding: 向量列表
+	//   - error: 如果获取过程中发生错误
+	ListByConversation(conversationID string) ([]*models.Embedding, error)
+
+	// List 分页获取全部向量
+	// 参数:
+	//   - offset: 分页偏移量
+	//   - limit: 返回向量数量上限
+	// 返回:
+	//   - []*models.Embedding: 向量列表
+	//   - error: 如果获取过程中发生错误
+	List(offset, limit int) ([]*models.Embedding, error)
+}
+
+// FeedbackStore 定义消息评价存储库接口
+type FeedbackStore interface {
+	// Upsert 创建或更新评价，以消息ID和用户ID唯一确定，更新时保留创建时间
+	// 参数:
+	//   - feedback: 要保存的评价对象
+	// 返回:
+	//   - error: 如果保存过程中发生错误
+	Upsert(feedback *models.MessageFeedback) error
+
+	// Delete 删除用户对消息的评价
+	// 参数:
+	//   - messageID: 消息ID
+	//   - userID: 评价用户ID
+	// 返回:
+	//   - error: 如果删除过程中发生错误
+	Delete(messageID, userID string) error
+
+	// ListByMessage 获取消息的全部评价
+	// 参数:
+	//   - messageID: 消息ID
+	// 返回:
+	//   - []*models.MessageFeedback: 评价列表
+	//   - error: 如果获取过程中发生错误
+	ListByMessage(messageID string) ([]*models.MessageFeedback, error)
+
+	// ListByConversation 获取会话中全部消息的评价
+	// 参数:
+	//   - conversationID: 会话ID
+	// 返回:
+	//   - []*models.MessageFeedback: 评价列表
+	//   - error: 如果获取过程中发生错误
+	ListByConversation(conversationID string) ([]*models.MessageFeedback, error)
+
+	// StatsByConversation 汇总会话的评价
+	// 参数:
+	//   - conversationID: 会话ID
+	// 返回:
+	//   - *models.FeedbackStats: 评价汇总，Key 为会话ID
+	//   - error: 如果汇总过程中发生错误
+	StatsByConversation(conversationID string) (*models.FeedbackStats, error)
+
+	// StatsByModel 按模型汇总评价
+	// 参数:
+	//   - owner: 仅汇总该归属租户的评价，为nil时不限制
+	//   - since: 评价更新时间下限(Unix秒)，为0时不限制
+	//   - until: 评价更新时间上限(Unix秒)，为0时不限制
+	// 返回:
+	//   - []*models.FeedbackStats: 各模型的评价汇总，按模型名称排序
+	//   - error: 如果汇总过程中发生错误
+	StatsByModel(owner *models.Owner, since, until int64) ([]*models.FeedbackStats, error)
+}
+
+// TagStore 定义标签存储库接口
+type TagStore interface {
+	// Create 创建标签，TagID 为空时自动生成
+	// 参数:
+	//   - tag: 要创建的标签对象
+	// 返回:
+	//   - error: 如果同一归属内已存在同名标签则返回 models.ErrNameConflict
+	Create(tag *models.Tag) error
+
+	// GetByID 根据ID获取标签
+	// 参数:
+	//   - tagID: 标签ID
+	// 返回:
+	//   - *models.Tag: 标签对象
+	//   - error: 如果标签不存在或获取过程中发生错误
+	GetByID(tagID string) (*models.Tag, error)
+
+	// List 获取指定归属的全部标签，按名称排序
+	// 参数:
+	//   - tenantID: 租户ID
+	//   - userID: 用户ID
+	// 返回:
+	//   - []*models.Tag: 标签列表
+	//   - error: 如果获取过程中发生错误
+	List(tenantID, userID string) ([]*models.Tag, error)
+
+	// Rename 重命名标签，会话关联按标签ID保存，不受影响
+	// 参数:
+	//   - tagID: 标签ID
+	//   - name: 新名称
+	// 返回:
+	//   - error: 如果标签不存在，或同一归属内已存在同名标签则返回 models.ErrNameConflict
+	Rename(tagID, name string) error
+
+	// Delete 删除标签及其全部会话关联
+	// 参数:
+	//   - tagID: 标签ID
+	// 返回:
+	//   - error: 如果删除过程中发生错误
+	Delete(tagID string) error
+
+	// AddToConversation 为会话添加标签，已添加时不做处理
+	// 参数:
+	//   - convID: 会话ID
+	//   - tagID: 标签ID
+	// 返回:
+	//   - error: 如果标签不存在或添加过程中发生错误
+	AddToConversation(convID, tagID string) error
+
+	// RemoveFromConversation 移除会话的标签
+	// 参数:
+	//   - convID: 会话ID
+	//   - tagID: 标签ID
+	// 返回:
+	//   - error: 如果移除过程中发生错误
+	RemoveFromConversation(convID, tagID string) error
+
+	// ListByConversation 获取会话的全部标签，按名称排序
+	// 参数:
+	//   - convID: 会话ID
+	// 返回:
+	//   - []*models.Tag: 标签列表
+	//   - error: 如果获取过程中发生错误
+	ListByConversation(convID string) ([]*models.Tag, error)
+
+	// ListConversations 按更新时间降序获取带有标签的会话，不包括回收站中的会话
+	// 参数:
+	//   - tagID: 标签ID
+	//   - offset: 分页偏移量
+	//   - limit: 返回会话数量上限
+	// 返回:
+	//   - []*models.Conversation: 会话列表
+	//   - error: 如果获取过程中发生错误
+	ListConversations(tagID string, offset, limit int) ([]*models.Conversation, error)
+}
+
+// FolderStore 定义文件夹存储库接口
+type FolderStore interface {
+	// Create 创建文件夹，FolderID 为空时自动生成
+	// 参数:
+	//   - folder: 要创建的文件夹对象，ParentID 为空时创建在根目录
+	// 返回:
+	//   - error: 如果父文件夹不存在或不属于同一归属，或同级已存在同名文件夹则返回 models.ErrNameConflict
+	Create(folder *models.Folder) error
+
+	// GetByID 根据ID获取文件夹
+	// 参数:
+	//   - folderID: 文件夹ID
+	// 返回:
+	//   - *models.Folder: 文件夹对象
+	//   - error: 如果文件夹不存在或获取过程中发生错误
+	GetByID(folderID string) (*models.Folder, error)
+
+	// List 获取指定归属的全部文件夹，按名称排序
+	// 参数:
+	//   - tenantID: 租户ID
+	//   - userID: 用户ID
+	// 返回:
+	//   - []*models.Folder: 文件夹列表
+	//   - error: 如果获取过程中发生错误
+	List(tenantID, userID string) ([]*models.Folder, error)
+
+	// Rename 重命名文件夹，子文件夹和会话按文件夹ID关联，不受影响
+	// 参数:
+	//   - folderID: 文件夹ID
+	//   - name: 新名称
+	// 返回:
+	//   - error: 如果文件夹不存在，或同级已存在同名文件夹则返回 models.ErrNameConflict
+	Rename(folderID, name string) error
+
+	// Move 移动文件夹到新的父文件夹下，子文件夹随之移动
+	// 参数:
+	//   - folderID: 文件夹ID
+	//   - parentID: 新的父文件夹ID，为空时移动到根目录
+	// 返回:
+	//   - error: 如果移动到自身或子文件夹下则返回 models.ErrFolderCycle，同级已存在同名文件夹则返回 models.ErrNameConflict
+	Move(folderID, parentID string) error
+
+	// Delete 删除文件夹及其全部子文件夹，其中的会话移出文件夹，会话本身不会被删除
+	// 参数:
+	//   - folderID: 文件夹ID
+	// 返回:
+	//   - error: 如果删除过程中发生错误
+	Delete(folderID string) error
+
+	// SetConversationFolder 将会话移动到文件夹
+	// 参数:
+	//   - convID: 会话ID
+	//   - folderID: 文件夹ID，为空时将会话移出文件夹
+	// 返回:
+	//   - error: 如果文件夹不存在或移动过程中发生错误
+	SetConversationFolder(convID, folderID string) error
+
+	// GetConversationFolder 获取会话所在的文件夹ID
+	// 参数:
+	//   - convID: 会话ID
+	// 返回:
+	//   - string: 文件夹ID，不在文件夹中时为空
+	//   - error: 如果获取过程中发生错误
+	GetConversationFolder(convID string) (string, error)
+
+	// ListConversations 按更新时间降序获取文件夹中的会话，不包括子文件夹中的会话和回收站中的会话
+	// 参数:
+	//   - folderID: 文件夹ID
+	//   - offset: 分页偏移量
+	//   - limit: 返回会话数量上限
+	// 返回:
+	//   - []*models.Conversation: 会话列表
+	//   - error: 如果获取过程中发生错误
+	ListConversations(folderID string, offset, limit int) ([]*models.Conversation, error)
+}
+
+// AuditStore 定义审计日志存储库接口，只支持追加，不提供修改和删除
+type AuditStore interface {
+	// Append 追加审计事件，EventID 和 CreatedAt 为空时自动生成
+	// 存储库串行化并发追加，将事件接在链上最后一条事件之后并计算哈希
+	// 参数:
+	//   - event: 要追加的审计事件，Seq、PrevHash 和 Hash 会被覆盖
+	// 返回:
+	//   - error: 如果追加过程中发生错误
+	Append(event *models.AuditEvent) error
+
+	// Query 按条件查询审计事件
+	// 参数:
+	//   - query: 查询条件
+	// 返回:
+	//   - []*models.AuditEvent: 按序号排序的事件列表
+	//   - error: 如果查询过程中发生错误
+	Query(query *models.AuditQuery) ([]*models.AuditEvent, error)
+
+	// Range 按序号升序读取链上的事件，用于校验哈希链
+	// 参数:
+	//   - afterSeq: 只返回序号大于该值的事件
+	//   - limit: 返回数量上限
+	// 返回:
+	//   - []*models.AuditEvent: 事件列表
+	//   - error: 如果读取过程中发生错误
+	Range(afterSeq int64, limit int) ([]*models.AuditEvent, error)
+}
+
+// BlobStore 定义附件内容存储接口，内容以 SHA-256 寻址，相同内容只保存一份
+type BlobStore interface {
+	// Put 流式写入内容，已存在相同内容时不重复保存，只刷新最近写入时间(BlobInfo.TouchedAt)
+	// 参数:
+	//   - r: 内容
+	//   - maxSize: 最大字节数，小于等于0时不限制
+	// 返回:
+	//   - *models.BlobInfo: 内容信息，Deduplicated 表示内容已存在
+	//   - error: 如果超过最大字节数(models.ErrBlobTooLarge)或写入过程中发生错误
+	Put(r io.Reader, maxSize int64) (*models.BlobInfo, error)
+
+	// Get 流式读取内容，调用方负责关闭返回的读取器
+	// 参数:
+	//   - hash: 内容的 SHA-256
+	// 返回:
+	//   - io.ReadCloser: 内容读取器
+	//   - error: 如果内容不存在(models.ErrBlobNotFound)或读取过程中发生错误
+	Get(hash string) (io.ReadCloser, error)
+
+	// Stat 获取内容信息
+	// 参数:
+	//   - hash: 内容的 SHA-256
+	// 返回:
+	//   - *models.BlobInfo: 内容信息
+	//   - error: 如果内容不存在(models.ErrBlobNotFound)或获取过程中发生错误
+	Stat(hash string) (*models.BlobInfo, error)
+
+	// Delete 删除内容，内容不存在时不返回错误
+	// 调用方需确认没有附件仍引用该内容
+	// 参数:
+	//   - hash: 内容的 SHA-256
+	// 返回:
+	//   - error: 如果删除过程中发生错误
+	Delete(hash string) error
+}
+
+// BlobPresigner 定义可以生成临时下载链接的内容存储，如对象存储
+type BlobPresigner interface {
+	// PresignGet 生成内容的临时下载链接，持有链接即可在有效期内直接下载，不经过本服务
+	// 参数:
+	//   - hash: 内容的 SHA-256
+	//   - expires: 链接有效期
+	// 返回:
+	//   - string: 下载链接
+	//   - error: 如果生成过程中发生错误
+	PresignGet(hash string, expires time.Duration) (string, error)
+}
+
+// TxStores 定义事务作用域的存储库集合，通过它们执行的写入随事务一起提交或回滚
+type TxStores interface {
+	// GetMessageStore 获取事务内的消息存储库
+	GetMessageStore() MessageStore
+	// GetConversationStore 获取事务内的对话存储库
+	GetConversationStore() ConversationStore
+	// GetAttachmentStore 获取事务内的附件存储库
+	GetAttachmentStore() AttachmentStore
+	// GetMessageAttachmentStore 获取事务内的消息附件关联存储库
+	GetMessageAttachmentStore() MessageAttachmentStore
 }
@@ -0,0 +1,61 @@
+package mysql
+
+import (
+	"errors"
+	"time"
+
+	"github.com/hildam/eino-history/model"
+	"github.com/hildam/eino-history/store/common/fulltext"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// lockConversation 在事务中锁定会话行，串行化同一会话的消息写入
+// 会话不存在时返回nil，此时消息照常写入但不维护活动字段
+func lockConversation(tx *gorm.DB, convID string) (*models.Conversation, error) {
+	var conv models.Conversation
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("conv_id = ?", convID).Take(&conv).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &conv, nil
+}
+
+// nextOrderSeq 返回会话中下一条消息的排序序号
+func nextOrderSeq(tx *gorm.DB, convID string) (int, error) {
+	var maxSeq int
+	err := tx.Model(&models.Message{}).
+		Select("COALESCE(MAX(order_seq), 0)").
+		Where("conversation_id = ?", convID).
+		Scan(&maxSeq).Error
+	return maxSeq + 1, err
+}
+
+// touchConversation 刷新会话的最后一条消息和更新时间，并合并其他活动字段的增量更新
+func touchConversation(tx *gorm.DB, convID string, updates map[string]interface{}) error {
+	var last models.Message
+	err := tx.Where("conversation_id = ? AND deleted_at = 0", convID).
+		Order("order_seq DESC").
+		Order("id DESC").
+		Take(&last).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		updates["last_message_id"] = ""
+		updates["last_message_role"] = ""
+		updates["last_message_preview"] = ""
+		updates["last_message_at"] = 0
+	case err != nil:
+		return err
+	default:
+		updates["last_message_id"] = last.MsgID
+		updates["last_message_role"] = last.Role
+		updates["last_message_preview"] = fulltext.Preview(last.Content, models.ConversationPreviewLength)
+		updates["last_message_at"] = last.CreatedAt
+	}
+
+	updates["updated_at"] = time.Now().Unix()
+	return tx.Model(&models.Conversation{}).Where("conv_id = ?", convID).Updates(updates).Error
+}
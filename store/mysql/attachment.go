@@ -66,6 +66,35 @@ func (r *AttachmentStore) GetByID(attachID string) (*models.Attachment, error) {
 	return &attachment, nil
 }
 
+// GetByIDs 批量获取附件，按 IN 查询分批读取后按输入顺序排列
+func (r *AttachmentStore) GetByIDs(attachIDs []string) ([]*models.Attachment, error) {
+	found := make(map[string]*models.Attachment, len(attachIDs))
+	for start := 0; start < len(attachIDs); start += messageBatchSize {
+		var attachments []*models.Attachment
+		ids := attachIDs[start:min(start+messageBatchSize, len(attachIDs))]
+		if err := r.db.Where("attach_id IN ?", ids).Find(&attachments).Error; err != nil {
+			if r.logger != nil {
+				r.logger.Error("批量获取附件失败: %v", err)
+			}
+			return nil, err
+		}
+		for _, attachment := range attachments {
+			found[attachment.AttachID] = attachment
+		}
+	}
+
+	result := make([]*models.Attachment, 0, len(found))
+	var failed []*models.BatchItemError
+	for i, id := range attachIDs {
+		if attachment, ok := found[id]; ok {
+			result = append(result, attachment)
+		} else {
+			failed = append(failed, &models.BatchItemError{Index: i, ID: id, Err: models.ErrNotFound})
+		}
+	}
+	return result, models.NewBatchError(len(attachIDs), failed)
+}
+
 // ListByMessage 获取消息的附件列表
 func (r *AttachmentStore) ListByMessage(messageID string) ([]*models.Attachment, error) {
 	// 使用关联表查询
@@ -100,3 +129,74 @@ func (r *AttachmentStore) ListByMessage(messageID string) ([]*models.Attachment,
 
 	return attachments, err
 }
+
+// unreferencedCondition 附件没有任何消息关联的条件
+const unreferencedCondition = "NOT EXISTS (SELECT 1 FROM message_attachments WHERE message_attachments.attachment_id = attachments.attach_id)"
+
+// ListUnreferenced 获取没有任何消息关联且创建时间早于 before 的附件
+func (r *AttachmentStore) ListUnreferenced(before int64, limit int) ([]*models.Attachment, error) {
+	var attachments []*models.Attachment
+	query := r.db.Where("created_at < ?", before).Where(unreferencedCondition).Order("created_at ASC, id ASC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if err := query.Find(&attachments).Error; err != nil {
+		if r.logger != nil {
+			r.logger.Error("查询未被引用的附件失败: %v", err)
+		}
+		return nil, err
+	}
+	return attachments, nil
+}
+
+// DeleteUnreferenced 使用带条件的单条删除语句，附件在判断后被关联时不会删除
+func (r *AttachmentStore) DeleteUnreferenced(attachID string) (bool, error) {
+	result := r.db.Where("attach_id = ?", attachID).Where(unreferencedCondition).Delete(&models.Attachment{})
+	if result.Error != nil {
+		if r.logger != nil {
+			r.logger.Error("删除附件 %s 失败: %v", attachID, result.Error)
+		}
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 && r.logger != nil {
+		r.logger.Info("未被引用的附件 %s 删除成功", attachID)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// CountByContentHash 统计引用指定内容的附件数
+func (r *AttachmentStore) CountByContentHash(hash string) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.Attachment{}).Where("content_hash = ?", hash).Count(&count).Error
+	return count, err
+}
+
+// SumSizeByConversation 统计会话中消息关联的附件总字节数，消息表不做软删除过滤，回收站中的消息一并统计
+func (r *AttachmentStore) SumSizeByConversation(conversationID string) (int64, error) {
+	var total int64
+	err := r.db.Model(&models.Attachment{}).
+		Select("COALESCE(SUM(file_size), 0)").
+		Where("attach_id IN (?)", r.db.Table("message_attachments").
+			Select("message_attachments.attachment_id").
+			Joins("JOIN messages ON messages.msg_id = message_attachments.message_id").
+			Where("messages.conversation_id = ?", conversationID)).
+		Scan(&total).Error
+	if err != nil && r.logger != nil {
+		r.logger.Error("统计会话 %s 的附件大小失败: %v", conversationID, err)
+	}
+	return total, err
+}
+
+// ListByIngestStatus 获取指定摄取状态的附件
+func (r *AttachmentStore) ListByIngestStatus(status string, limit int) ([]*models.Attachment, error) {
+	var attachments []*models.Attachment
+	query := r.db.Where("ingest_status = ?", status).Order("created_at ASC, id ASC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	err := query.Find(&attachments).Error
+	if err != nil && r.logger != nil {
+		r.logger.Error("查询摄取状态为 %s 的附件失败: %v", status, err)
+	}
+	return attachments, err
+}
@@ -0,0 +1,78 @@
+package mysql
+
+import (
+	"time"
+
+	"github.com/hildam/eino-history/model"
+	"github.com/hildam/eino-history/store/common/logger"
+	"github.com/hildam/eino-history/store/interfaces"
+	"gorm.io/gorm"
+)
+
+// AttachmentChunkStore 实现AttachmentChunkStore接口的MySQL实现
+type AttachmentChunkStore struct {
+	db     *gorm.DB
+	logger *logger.Logger
+}
+
+// NewAttachmentChunkStore 创建MySQL附件文本分块存储库实例
+func NewAttachmentChunkStore(db *gorm.DB) interfaces.AttachmentChunkStore {
+	return &AttachmentChunkStore{db: db}
+}
+
+// SetLogger 设置日志记录器
+func (r *AttachmentChunkStore) SetLogger(logger *logger.Logger) {
+	r.logger = logger
+}
+
+// Replace 在事务中删除旧分块并写入新分块
+func (r *AttachmentChunkStore) Replace(attachmentID string, chunks []*models.AttachmentChunk) error {
+	now := time.Now().Unix()
+	for i, chunk := range chunks {
+		chunk.ID = 0
+		chunk.AttachmentID = attachmentID
+		chunk.Seq = i
+		if chunk.CreatedAt == 0 {
+			chunk.CreatedAt = now
+		}
+	}
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("attachment_id = ?", attachmentID).Delete(&models.AttachmentChunk{}).Error; err != nil {
+			return err
+		}
+		if len(chunks) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(chunks, 100).Error
+	})
+	if err != nil {
+		if r.logger != nil {
+			r.logger.Error("保存附件 %s 的分块失败: %v", attachmentID, err)
+		}
+		return err
+	}
+	if r.logger != nil {
+		r.logger.Info("附件 %s 的 %d 个分块保存成功", attachmentID, len(chunks))
+	}
+	return nil
+}
+
+// ListByAttachment 获取附件的全部分块
+func (r *AttachmentChunkStore) ListByAttachment(attachmentID string) ([]*models.AttachmentChunk, error) {
+	var chunks []*models.AttachmentChunk
+	err := r.db.Where("attachment_id = ?", attachmentID).Order("seq ASC").Find(&chunks).Error
+	if err == nil && r.logger != nil {
+		r.logger.Debug("查询到附件 %s 的 %d 个分块", attachmentID, len(chunks))
+	}
+	return chunks, err
+}
+
+// DeleteByAttachment 删除附件的全部分块
+func (r *AttachmentChunkStore) DeleteByAttachment(attachmentID string) error {
+	err := r.db.Where("attachment_id = ?", attachmentID).Delete(&models.AttachmentChunk{}).Error
+	if err == nil && r.logger != nil {
+		r.logger.Info("附件 %s 的分块删除成功", attachmentID)
+	}
+	return err
+}
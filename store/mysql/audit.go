@@ -0,0 +1,120 @@
+package mysql
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hildam/eino-history/model"
+	"github.com/hildam/eino-history/store/common/logger"
+	"github.com/hildam/eino-history/store/interfaces"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// auditAppendAttempts 并发追加冲突(序号重复或死锁)时的最大尝试次数
+const auditAppendAttempts = 5
+
+// AuditStore 实现AuditStore接口的MySQL实现
+type AuditStore struct {
+	db     *gorm.DB
+	logger *logger.Logger
+}
+
+// NewAuditStore 创建MySQL审计日志存储库实例
+func NewAuditStore(db *gorm.DB) interfaces.AuditStore {
+	return &AuditStore{db: db}
+}
+
+// SetLogger 设置日志记录器
+func (r *AuditStore) SetLogger(logger *logger.Logger) {
+	r.logger = logger
+}
+
+// Append 追加审计事件，锁定链上最后一条事件后接续，序号唯一索引保证链不会分叉
+func (r *AuditStore) Append(event *models.AuditEvent) error {
+	if event.EventID == "" {
+		event.EventID = uuid.NewString()
+	}
+	if event.CreatedAt == 0 {
+		event.CreatedAt = time.Now().Unix()
+	}
+
+	var err error
+	for attempt := 0; attempt < auditAppendAttempts; attempt++ {
+		err = r.db.Transaction(func(tx *gorm.DB) error {
+			var last []*models.AuditEvent
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Order("seq DESC").Limit(1).Find(&last).Error
+			if err != nil {
+				return err
+			}
+			var prev *models.AuditEvent
+			if len(last) > 0 {
+				prev = last[0]
+			}
+			event.ID = 0
+			event.Chain(prev)
+			return tx.Create(event).Error
+		})
+		if err == nil {
+			return nil
+		}
+	}
+	if r.logger != nil {
+		r.logger.Error("追加审计事件 %s 失败: %v", event.Action, err)
+	}
+	return err
+}
+
+// Query 按条件查询审计事件
+func (r *AuditStore) Query(query *models.AuditQuery) ([]*models.AuditEvent, error) {
+	db := r.db.Model(&models.AuditEvent{})
+	if query.TenantID != "" {
+		db = db.Where("tenant_id = ?", query.TenantID)
+	}
+	if query.Actor != "" {
+		db = db.Where("actor = ?", query.Actor)
+	}
+	if query.ConversationID != "" {
+		db = db.Where("conversation_id = ?", query.ConversationID)
+	}
+	if len(query.Actions) > 0 {
+		db = db.Where("action IN ?", query.Actions)
+	}
+	if query.Since > 0 {
+		db = db.Where("created_at >= ?", query.Since)
+	}
+	if query.Until > 0 {
+		db = db.Where("created_at <= ?", query.Until)
+	}
+	if query.Desc {
+		db = db.Order("seq DESC")
+	} else {
+		db = db.Order("seq ASC")
+	}
+	if query.Offset > 0 {
+		db = db.Offset(query.Offset)
+	}
+	if query.Limit > 0 {
+		db = db.Limit(query.Limit)
+	}
+
+	var events []*models.AuditEvent
+	if err := db.Find(&events).Error; err != nil {
+		if r.logger != nil {
+			r.logger.Error("查询审计事件失败: %v", err)
+		}
+		return nil, err
+	}
+	return events, nil
+}
+
+// Range 按序号升序读取链上的事件
+func (r *AuditStore) Range(afterSeq int64, limit int) ([]*models.AuditEvent, error) {
+	var events []*models.AuditEvent
+	err := r.db.Where("seq > ?", afterSeq).Order("seq ASC").Limit(limit).Find(&events).Error
+	if err != nil && r.logger != nil {
+		r.logger.Error("读取审计事件失败: %v", err)
+	}
+	return events, err
+}
@@ -0,0 +1,196 @@
+package mysql
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/hildam/eino-history/model"
+	"github.com/hildam/eino-history/store/common/logger"
+	"github.com/hildam/eino-history/store/interfaces"
+	"gorm.io/gorm"
+)
+
+// BlobStore 实现BlobStore接口的MySQL实现，内容按 models.BlobChunkSize 分块保存
+type BlobStore struct {
+	db     *gorm.DB
+	logger *logger.Logger
+}
+
+// NewBlobStore 创建MySQL附件内容存储实例
+func NewBlobStore(db *gorm.DB) interfaces.BlobStore {
+	return &BlobStore{db: db}
+}
+
+// SetLogger 设置日志记录器
+func (r *BlobStore) SetLogger(logger *logger.Logger) {
+	r.logger = logger
+}
+
+// Put 读取全部内容后计算哈希，内容不存在时在事务中写入内容记录和分块
+func (r *BlobStore) Put(reader io.Reader, maxSize int64) (*models.BlobInfo, error) {
+	data, hash, err := models.ReadBlob(reader, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := r.touch(hash); err == nil {
+		return info, nil
+	} else if !errors.Is(err, models.ErrBlobNotFound) {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	blob := &models.Blob{
+		Hash:       hash,
+		Size:       int64(len(data)),
+		ChunkCount: (len(data) + models.BlobChunkSize - 1) / models.BlobChunkSize,
+		CreatedAt:  now,
+		TouchedAt:  now,
+	}
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(blob).Error; err != nil {
+			return err
+		}
+		for seq := 0; seq < blob.ChunkCount; seq++ {
+			end := (seq + 1) * models.BlobChunkSize
+			if end > len(data) {
+				end = len(data)
+			}
+			chunk := &models.BlobChunk{Hash: hash, Seq: seq, Data: data[seq*models.BlobChunkSize : end]}
+			if err := tx.Create(chunk).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// 并发写入相同内容时唯一索引冲突，以已写入的内容为准
+		if info, touchErr := r.touch(hash); touchErr == nil {
+			return info, nil
+		}
+		if r.logger != nil {
+			r.logger.Error("保存内容 %s 失败: %v", hash, err)
+		}
+		return nil, err
+	}
+
+	if r.logger != nil {
+		r.logger.Info("内容 %s 保存成功，大小 %d", hash, blob.Size)
+	}
+	return blobInfo(blob), nil
+}
+
+// Get 返回按分块逐块读取的读取器
+func (r *BlobStore) Get(hash string) (io.ReadCloser, error) {
+	blob, err := r.getBlob(hash)
+	if err != nil {
+		return nil, err
+	}
+	return &chunkReader{db: r.db, hash: hash, count: blob.ChunkCount}, nil
+}
+
+// Stat 获取内容信息
+func (r *BlobStore) Stat(hash string) (*models.BlobInfo, error) {
+	blob, err := r.getBlob(hash)
+	if err != nil {
+		return nil, err
+	}
+	return blobInfo(blob), nil
+}
+
+// Delete 删除内容记录及其全部分块
+func (r *BlobStore) Delete(hash string) error {
+	if !models.ValidBlobHash(hash) {
+		return models.ErrBlobNotFound
+	}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("hash = ?", hash).Delete(&models.BlobChunk{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("hash = ?", hash).Delete(&models.Blob{}).Error
+	})
+	if err == nil && r.logger != nil {
+		r.logger.Info("内容 %s 删除成功", hash)
+	}
+	return err
+}
+
+// touch 内容已存在时刷新最近写入时间，避免回收在附件记录创建前删除内容，返回的内容信息标记为去重
+func (r *BlobStore) touch(hash string) (*models.BlobInfo, error) {
+	if !models.ValidBlobHash(hash) {
+		return nil, models.ErrBlobNotFound
+	}
+	if err := r.db.Model(&models.Blob{}).Where("hash = ?", hash).Update("touched_at", time.Now().Unix()).Error; err != nil {
+		return nil, err
+	}
+	blob, err := r.getBlob(hash)
+	if err != nil {
+		return nil, err
+	}
+	info := blobInfo(blob)
+	info.Deduplicated = true
+	return info, nil
+}
+
+// getBlob 获取内容记录，不存在时返回 models.ErrBlobNotFound
+func (r *BlobStore) getBlob(hash string) (*models.Blob, error) {
+	if !models.ValidBlobHash(hash) {
+		return nil, models.ErrBlobNotFound
+	}
+	var blobs []*models.Blob
+	if err := r.db.Where("hash = ?", hash).Limit(1).Find(&blobs).Error; err != nil {
+		if r.logger != nil {
+			r.logger.Error("获取内容 %s 失败: %v", hash, err)
+		}
+		return nil, err
+	}
+	if len(blobs) == 0 {
+		return nil, models.ErrBlobNotFound
+	}
+	return blobs[0], nil
+}
+
+// blobInfo 将内容记录转换为内容信息，旧记录没有最近写入时间时取创建时间
+func blobInfo(blob *models.Blob) *models.BlobInfo {
+	return &models.BlobInfo{
+		Hash:        blob.Hash,
+		Size:        blob.Size,
+		StorageType: models.StorageTypeBlob,
+		Path:        blob.Hash,
+		CreatedAt:   blob.CreatedAt,
+		TouchedAt:   max(blob.TouchedAt, blob.CreatedAt),
+	}
+}
+
+// chunkReader 按序号逐块加载分块的读取器
+type chunkReader struct {
+	db    *gorm.DB
+	hash  string
+	count int
+	next  int
+	buf   bytes.Reader
+}
+
+// Read 当前分块读完后加载下一个分块
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for c.buf.Len() == 0 {
+		if c.next >= c.count {
+			return 0, io.EOF
+		}
+		var chunk models.BlobChunk
+		if err := c.db.Where("hash = ? AND seq = ?", c.hash, c.next).First(&chunk).Error; err != nil {
+			return 0, err
+		}
+		c.buf.Reset(chunk.Data)
+		c.next++
+	}
+	return c.buf.Read(p)
+}
+
+// Close 关闭读取器
+func (c *chunkReader) Close() error {
+	c.next = c.count
+	c.buf.Reset(nil)
+	return nil
+}
@@ -1,6 +1,8 @@
 package mysql
 
 import (
+	"time"
+
 	"github.com/hildam/eino-history/model"
 	"github.com/hildam/eino-history/store/common/logger"
 	"github.com/hildam/eino-history/store/interfaces"
@@ -32,20 +34,213 @@ func (r *ConversationStore) Create(conv *models.Conversation) error {
 	return err
 }
 
-// Update 更新会话
+// Update 更新会话，活动字段由消息写入维护，删除时间由回收站操作维护，均不会被覆盖
 func (r *ConversationStore) Update(conv *models.Conversation) error {
-	err := r.db.Save(conv).Error
+	return r.update(conv, false)
+}
+
+// CompareAndUpdate 锁定会话行后比较版本号，一致时更新会话
+func (r *ConversationStore) CompareAndUpdate(conv *models.Conversation) error {
+	return r.update(conv, true)
+}
+
+// update 锁定会话行后写入会话并递增版本号，check 为true时先比较版本号
+func (r *ConversationStore) update(conv *models.Conversation, check bool) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		cur, err := lockConversation(tx, conv.ConvID)
+		if err != nil {
+			return err
+		}
+		if cur == nil {
+			if check {
+				return gorm.ErrRecordNotFound
+			}
+			conv.Version = 0
+		} else {
+			if check && cur.Version != conv.Version {
+				return models.ErrVersionConflict
+			}
+			conv.ID = cur.ID
+			conv.Version = cur.Version
+		}
+		conv.Version++
+		return saveConversation(tx, conv)
+	})
+	if err != nil {
+		if r.logger != nil {
+			r.logger.Error("更新会话 %s 失败: %v", conv.ConvID, err)
+		}
+		return err
+	}
+	if r.logger != nil {
+		r.logger.Info("会话 %s 更新成功，版本 %d", conv.ConvID, conv.Version)
+	}
+	return nil
+}
+
+// Patch 锁定会话行后应用部分字段更新
+func (r *ConversationStore) Patch(convID string, patch *models.ConversationPatch) (*models.Conversation, error) {
+	var conv *models.Conversation
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		cur, err := lockConversation(tx, convID)
+		if err != nil {
+			return err
+		}
+		if cur == nil {
+			return gorm.ErrRecordNotFound
+		}
+		if cur.DeletedAt != 0 {
+			return models.ErrDeleted
+		}
+		if err := models.CheckVersion(patch.Version, cur.Version); err != nil {
+			return err
+		}
+		patch.Apply(cur)
+		if !patch.KeepUpdatedAt {
+			cur.UpdatedAt = time.Now().Unix()
+		}
+		cur.Version++
+		conv = cur
+		return saveConversation(tx, cur)
+	})
+	if err != nil {
+		if r.logger != nil {
+			r.logger.Error("更新会话 %s 的字段失败: %v", convID, err)
+		}
+		return nil, err
+	}
+	if r.logger != nil {
+		r.logger.Info("会话 %s 更新成功，版本 %d", convID, conv.Version)
+	}
+	return conv, nil
+}
+
+// saveConversation 写入会话，不覆盖删除时间和活动字段
+func saveConversation(tx *gorm.DB, conv *models.Conversation) error {
+	omit := append([]string{"deleted_at"}, models.ActivityColumns...)
+	return tx.Omit(omit...).Save(conv).Error
+}
+
+// Delete 将会话及其消息移入回收站，消息与会话使用相同的删除时间，恢复时据此区分
+func (r *ConversationStore) Delete(convID string) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// 删除时间需晚于已单独删除的消息，避免恢复会话时把它们一并恢复
+		var lastDeleted int64
+		err := tx.Model(&models.Message{}).
+			Select("COALESCE(MAX(deleted_at), 0)").
+			Where("conversation_id = ?", convID).
+			Scan(&lastDeleted).Error
+		if err != nil {
+			return err
+		}
+		now := time.Now().Unix()
+		if now <= lastDeleted {
+			now = lastDeleted + 1
+		}
+
+		result := tx.Model(&models.Conversation{}).
+			Where("conv_id = ? AND deleted_at = 0", convID).
+			Update("deleted_at", now)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return tx.Model(&models.Message{}).
+			Where("conversation_id = ? AND deleted_at = 0", convID).
+			Update("deleted_at", now).Error
+	})
 	if err == nil && r.logger != nil {
-		r.logger.Info("会话 %s 更新成功", conv.ConvID)
+		r.logger.Info("会话 %s 已移入回收站", convID)
 	}
 	return err
 }
 
-// Delete 删除会话
-func (r *ConversationStore) Delete(convID string) error {
-	err := r.db.Where("conv_id = ?", convID).Delete(&models.Conversation{}).Error
+// Restore 从回收站恢复会话，以及随会话一起删除的消息
+func (r *ConversationStore) Restore(convID string) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var conv models.Conversation
+		if err := tx.Where("conv_id = ? AND deleted_at > 0", convID).Take(&conv).Error; err != nil {
+			return err
+		}
+		err := tx.Model(&models.Message{}).
+			Where("conversation_id = ? AND deleted_at = ?", convID, conv.DeletedAt).
+			Update("deleted_at", 0).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.Conversation{}).Where("conv_id = ?", convID).Update("deleted_at", 0).Error
+	})
+	if err != nil {
+		if r.logger != nil {
+			r.logger.Error("恢复会话 %s 失败: %v", convID, err)
+		}
+		return err
+	}
+	if r.logger != nil {
+		r.logger.Info("会话 %s 已恢复", convID)
+	}
+	return nil
+}
+
+// GetDeleted 获取回收站中的会话
+func (r *ConversationStore) GetDeleted(convID string) (*models.Conversation, error) {
+	var conv models.Conversation
+	err := r.db.Where("conv_id = ? AND deleted_at > 0", convID).First(&conv).Error
+	if err != nil {
+		if r.logger != nil {
+			r.logger.Error("获取回收站会话 %s 失败: %v", convID, err)
+		}
+		return nil, err
+	}
+	return &conv, nil
+}
+
+// ListDeleted 按删除时间降序获取回收站中的会话
+func (r *ConversationStore) ListDeleted(owner *models.Owner, before int64, offset, limit int) ([]*models.Conversation, error) {
+	var convs []*models.Conversation
+	tx := r.db.Where("deleted_at > 0")
+	if before > 0 {
+		tx = tx.Where("deleted_at < ?", before)
+	}
+	if owner != nil {
+		tx = tx.Where("tenant_id = ?", owner.TenantID)
+		if owner.UserID != "" {
+			tx = tx.Where("user_id = ?", owner.UserID)
+		}
+	}
+	err := tx.Order("deleted_at DESC").Offset(offset).Limit(limit).Find(&convs).Error
 	if err == nil && r.logger != nil {
-		r.logger.Info("会话 %s 删除成功", convID)
+		r.logger.Info("查询到回收站中的 %d 个会话", len(convs))
+	}
+	return convs, err
+}
+
+// Purge 永久删除回收站中的会话及其全部消息、附件关联、评价、历史修订、标签和文件夹关联
+func (r *ConversationStore) Purge(convID string) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("conv_id = ? AND deleted_at > 0", convID).Delete(&models.Conversation{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		msgIDs := tx.Model(&models.Message{}).Select("msg_id").Where("conversation_id = ?", convID)
+		if err := tx.Where("message_id IN (?)", msgIDs).Delete(&models.MessageAttachment{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("message_id IN (?)", msgIDs).Delete(&models.MessageRevision{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("conversation_id = ?", convID).Delete(&models.MessageFeedback{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("conversation_id = ?", convID).Delete(&models.ConversationTag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("conversation_id = ?", convID).Delete(&models.ConversationFolder{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("conversation_id = ?", convID).Delete(&models.Message{}).Error
+	})
+	if err == nil && r.logger != nil {
+		r.logger.Info("会话 %s 已永久删除", convID)
 	}
 	return err
 }
@@ -53,9 +248,12 @@ func (r *ConversationStore) Delete(convID string) error {
 // GetByID 根据ID获取会话
 func (r *ConversationStore) GetByID(convID string) (*models.Conversation, error) {
 	var conv models.Conversation
-	err := r.db.Where("conv_id = ?", convID).First(&conv).Error
-	if err != nil && r.logger != nil {
-		r.logger.Error("获取会话 %s 失败: %v", convID, err)
+	err := r.db.Where("conv_id = ? AND deleted_at = 0", convID).First(&conv).Error
+	if err != nil {
+		if r.logger != nil {
+			r.logger.Error("获取会话 %s 失败: %v", convID, err)
+		}
+		return nil, err
 	}
 	return &conv, nil
 }
@@ -64,6 +262,24 @@ func (r *ConversationStore) GetByID(convID string) (*models.Conversation, error)
 func (r *ConversationStore) FirstOrCreat(convID string) (*models.Conversation, error) {
 	var conv models.Conversation
 	err := r.db.Where(models.Conversation{ConvID: convID}).FirstOrCreate(&conv).Error
+	if err == nil && conv.DeletedAt != 0 {
+		return nil, models.ErrDeleted
+	}
+	if err == nil && r.logger != nil {
+		r.logger.Info("会话 %s 查找或创建成功", convID)
+	}
+	return &conv, err
+}
+
+// FirstOrCreatForOwner 根据ID查找会话，如果不存在则以指定归属创建
+func (r *ConversationStore) FirstOrCreatForOwner(convID, tenantID, userID string) (*models.Conversation, error) {
+	var conv models.Conversation
+	err := r.db.Where(models.Conversation{ConvID: convID}).
+		Attrs(models.Conversation{TenantID: tenantID, UserID: userID}).
+		FirstOrCreate(&conv).Error
+	if err == nil && conv.DeletedAt != 0 {
+		return nil, models.ErrDeleted
+	}
 	if err == nil && r.logger != nil {
 		r.logger.Info("会话 %s 查找或创建成功", convID)
 	}
@@ -73,7 +289,7 @@ func (r *ConversationStore) FirstOrCreat(convID string) (*models.Conversation, e
 // List 获取会话列表
 func (r *ConversationStore) List(offset, limit int) ([]*models.Conversation, error) {
 	var convs []*models.Conversation
-	err := r.db.Offset(offset).Limit(limit).Order("updated_at DESC").Find(&convs).Error
+	err := r.db.Where("deleted_at = 0").Offset(offset).Limit(limit).Order("updated_at DESC").Find(&convs).Error
 	if err == nil && r.logger != nil {
 		r.logger.Info("查询到 %d 个会话记录", len(convs))
 	}
@@ -82,7 +298,10 @@ func (r *ConversationStore) List(offset, limit int) ([]*models.Conversation, err
 
 // Archive 归档会话
 func (r *ConversationStore) Archive(convID string) error {
-	err := r.db.Model(&models.Conversation{}).Where("conv_id = ?", convID).Update("is_archived", true).Error
+	err := r.db.Model(&models.Conversation{}).Where("conv_id = ? AND deleted_at = 0", convID).Updates(map[string]interface{}{
+		"is_archived": true,
+		"version":     gorm.Expr("version + 1"),
+	}).Error
 	if err == nil && r.logger != nil {
 		r.logger.Info("会话 %s 已归档", convID)
 	}
@@ -91,7 +310,10 @@ func (r *ConversationStore) Archive(convID string) error {
 
 // Unarchive 取消归档会话
 func (r *ConversationStore) Unarchive(convID string) error {
-	err := r.db.Model(&models.Conversation{}).Where("conv_id = ?", convID).Update("is_archived", false).Error
+	err := r.db.Model(&models.Conversation{}).Where("conv_id = ? AND deleted_at = 0", convID).Updates(map[string]interface{}{
+		"is_archived": false,
+		"version":     gorm.Expr("version + 1"),
+	}).Error
 	if err == nil && r.logger != nil {
 		r.logger.Info("会话 %s 已取消归档", convID)
 	}
@@ -100,7 +322,10 @@ func (r *ConversationStore) Unarchive(convID string) error {
 
 // Pin 置顶会话
 func (r *ConversationStore) Pin(convID string) error {
-	err := r.db.Model(&models.Conversation{}).Where("conv_id = ?", convID).Update("is_pinned", true).Error
+	err := r.db.Model(&models.Conversation{}).Where("conv_id = ? AND deleted_at = 0", convID).Updates(map[string]interface{}{
+		"is_pinned": true,
+		"version":   gorm.Expr("version + 1"),
+	}).Error
 	if err == nil && r.logger != nil {
 		r.logger.Info("会话 %s 已置顶", convID)
 	}
@@ -109,9 +334,26 @@ func (r *ConversationStore) Pin(convID string) error {
 
 // Unpin 取消置顶会话
 func (r *ConversationStore) Unpin(convID string) error {
-	err := r.db.Model(&models.Conversation{}).Where("conv_id = ?", convID).Update("is_pinned", false).Error
+	err := r.db.Model(&models.Conversation{}).Where("conv_id = ? AND deleted_at = 0", convID).Updates(map[string]interface{}{
+		"is_pinned": false,
+		"version":   gorm.Expr("version + 1"),
+	}).Error
 	if err == nil && r.logger != nil {
 		r.logger.Info("会话 %s 已取消置顶", convID)
 	}
 	return err
 }
+
+// ListByOwner 获取指定归属的会话列表
+func (r *ConversationStore) ListByOwner(tenantID, userID string, offset, limit int) ([]*models.Conversation, error) {
+	var convs []*models.Conversation
+	tx := r.db.Where("tenant_id = ? AND deleted_at = 0", tenantID)
+	if userID != "" {
+		tx = tx.Where("user_id = ?", userID)
+	}
+	err := tx.Offset(offset).Limit(limit).Order("updated_at DESC").Find(&convs).Error
+	if err == nil && r.logger != nil {
+		r.logger.Info("查询到租户 %s 用户 %s 的 %d 个会话记录", tenantID, userID, len(convs))
+	}
+	return convs, err
+}
@@ -0,0 +1,113 @@
+package mysql
+
+import (
+	"strings"
+
+	"github.com/hildam/eino-history/model"
+	"github.com/hildam/eino-history/store/common/pagination"
+	"gorm.io/gorm"
+)
+
+// likeEscaper 转义 LIKE 模式中的通配符
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Query 按条件查询会话列表
+func (r *ConversationStore) Query(query *models.ConversationQuery) (*models.ConversationPage, error) {
+	q, err := pagination.Normalize(query)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := r.db.Model(&models.Conversation{}).Where("deleted_at = 0")
+	if q.Owner != nil {
+		tx = tx.Where("tenant_id = ?", q.Owner.TenantID)
+		if q.Owner.UserID != "" {
+			tx = tx.Where("user_id = ?", q.Owner.UserID)
+		}
+	}
+	if q.Archived != nil {
+		tx = tx.Where("is_archived = ?", *q.Archived)
+	}
+	if q.TitleContains != "" {
+		tx = tx.Where("title LIKE ?", "%"+likeEscaper.Replace(q.TitleContains)+"%")
+	}
+	if q.CreatedAfter > 0 {
+		tx = tx.Where("created_at >= ?", q.CreatedAfter)
+	}
+	if q.CreatedBefore > 0 {
+		tx = tx.Where("created_at <= ?", q.CreatedBefore)
+	}
+	if q.UpdatedAfter > 0 {
+		tx = tx.Where("updated_at >= ?", q.UpdatedAfter)
+	}
+	if q.UpdatedBefore > 0 {
+		tx = tx.Where("updated_at <= ?", q.UpdatedBefore)
+	}
+
+	page := &models.ConversationPage{}
+	if err := tx.Session(&gorm.Session{}).Count(&page.Total).Error; err != nil {
+		if r.logger != nil {
+			r.logger.Error("统计会话数量失败: %v", err)
+		}
+		return nil, err
+	}
+
+	if q.Cursor != "" {
+		cursor, err := pagination.Decode(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		sql, args := keysetCondition(cursor, q)
+		tx = tx.Where(sql, args...)
+	}
+
+	dir := " DESC"
+	if q.Ascending {
+		dir = " ASC"
+	}
+	if q.PinnedFirst {
+		tx = tx.Order("is_pinned DESC")
+	}
+	tx = tx.Order(q.SortBy + dir).Order("conv_id" + dir)
+
+	// 多取一条用于判断是否还有下一页
+	var convs []*models.Conversation
+	if err := tx.Limit(q.Limit + 1).Find(&convs).Error; err != nil {
+		if r.logger != nil {
+			r.logger.Error("查询会话列表失败: %v", err)
+		}
+		return nil, err
+	}
+	if len(convs) > q.Limit {
+		convs = convs[:q.Limit]
+		page.NextCursor = pagination.NewCursor(convs[len(convs)-1], q.SortBy).Encode()
+	}
+
+	page.Items = convs
+
+	if r.logger != nil {
+		r.logger.Info("查询到 %d 个会话，共 %d 个", len(page.Items), page.Total)
+	}
+	return page, nil
+}
+
+// keysetCondition 根据游标构造"排在游标之后"的条件
+func keysetCondition(cursor *pagination.Cursor, q *models.ConversationQuery) (string, []interface{}) {
+	op := "<"
+	if q.Ascending {
+		op = ">"
+	}
+
+	var sortValue interface{} = cursor.Int
+	if q.SortBy == models.ConversationSortTitle {
+		sortValue = cursor.Str
+	}
+
+	sql := "(" + q.SortBy + " " + op + " ? OR (" + q.SortBy + " = ? AND conv_id " + op + " ?))"
+	args := []interface{}{sortValue, sortValue, cursor.ConvID}
+	if q.PinnedFirst {
+		sql = "(is_pinned < ? OR (is_pinned = ? AND " + sql + "))"
+		args = append([]interface{}{cursor.Pinned, cursor.Pinned}, args...)
+	}
+	return sql, args
+}
@@ -0,0 +1,83 @@
+package mysql
+
+import (
+	"time"
+
+	"github.com/hildam/eino-history/model"
+	"github.com/hildam/eino-history/store/common/logger"
+	"github.com/hildam/eino-history/store/interfaces"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// EmbeddingStore 实现EmbeddingStore接口的MySQL实现
+type EmbeddingStore struct {
+	db     *gorm.DB
+	logger *logger.Logger
+}
+
+// NewEmbeddingStore 创建MySQL向量存储库实例
+func NewEmbeddingStore(db *gorm.DB) interfaces.EmbeddingStore {
+	return &EmbeddingStore{db: db}
+}
+
+// SetLogger 设置日志记录器
+func (r *EmbeddingStore) SetLogger(logger *logger.Logger) {
+	r.logger = logger
+}
+
+// Upsert 创建或更新向量
+func (r *EmbeddingStore) Upsert(embedding *models.Embedding) error {
+	if embedding.CreatedAt == 0 {
+		embedding.CreatedAt = time.Now().Unix()
+	}
+	embedding.Dimension = len(embedding.Vector)
+
+	err := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "source_type"}, {Name: "source_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"conversation_id", "content", "vector", "dimension", "created_at"}),
+	}).Create(embedding).Error
+	if err == nil && r.logger != nil {
+		r.logger.Debug("%s %s 的向量保存成功", embedding.SourceType, embedding.SourceID)
+	}
+	return err
+}
+
+// Delete 删除指定来源的向量
+func (r *EmbeddingStore) Delete(sourceType, sourceID string) error {
+	err := r.db.Where("source_type = ? AND source_id = ?", sourceType, sourceID).Delete(&models.Embedding{}).Error
+	if err == nil && r.logger != nil {
+		r.logger.Debug("%s %s 的向量删除成功", sourceType, sourceID)
+	}
+	return err
+}
+
+// DeleteByPrefix 删除来源ID以指定前缀开头的全部向量
+func (r *EmbeddingStore) DeleteByPrefix(sourceType, prefix string) error {
+	err := r.db.Where("source_type = ? AND source_id LIKE ?", sourceType, likeEscaper.Replace(prefix)+"%").
+		Delete(&models.Embedding{}).Error
+	if err == nil && r.logger != nil {
+		r.logger.Debug("%s %s* 的向量删除成功", sourceType, prefix)
+	}
+	return err
+}
+
+// ListByConversation 获取会话的全部向量
+func (r *EmbeddingStore) ListByConversation(conversationID string) ([]*models.Embedding, error) {
+	var embeddings []*models.Embedding
+	err := r.db.Where("conversation_id = ?", conversationID).Find(&embeddings).Error
+	if err == nil && r.logger != nil {
+		r.logger.Debug("查询到会话 %s 的 %d 个向量", conversationID, len(embeddings))
+	}
+	return embeddings, err
+}
+
+// List 分页获取全部向量
+func (r *EmbeddingStore) List(offset, limit int) ([]*models.Embedding, error) {
+	var embeddings []*models.Embedding
+	err := r.db.Order("id ASC").Offset(offset).Limit(limit).Find(&embeddings).Error
+	if err == nil && r.logger != nil {
+		r.logger.Debug("查询到 %d 个向量", len(embeddings))
+	}
+	return embeddings, err
+}
@@ -0,0 +1,159 @@
+package mysql
+
+import (
+	"time"
+
+	"github.com/hildam/eino-history/model"
+	"github.com/hildam/eino-history/store/common/logger"
+	"github.com/hildam/eino-history/store/interfaces"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FeedbackStore 实现FeedbackStore接口的MySQL实现
+type FeedbackStore struct {
+	db     *gorm.DB
+	logger *logger.Logger
+}
+
+// NewFeedbackStore 创建MySQL消息评价存储库实例
+func NewFeedbackStore(db *gorm.DB) interfaces.FeedbackStore {
+	return &FeedbackStore{db: db}
+}
+
+// SetLogger 设置日志记录器
+func (r *FeedbackStore) SetLogger(logger *logger.Logger) {
+	r.logger = logger
+}
+
+// Upsert 创建或更新评价
+func (r *FeedbackStore) Upsert(feedback *models.MessageFeedback) error {
+	now := time.Now().Unix()
+	if feedback.CreatedAt == 0 {
+		feedback.CreatedAt = now
+	}
+	feedback.UpdatedAt = now
+
+	err := r.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "message_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"conversation_id", "tenant_id", "model", "rating", "reasons", "comment", "updated_at",
+		}),
+	}).Create(feedback).Error
+	if err == nil && r.logger != nil {
+		r.logger.Debug("用户 %s 对消息 %s 的评价保存成功", feedback.UserID, feedback.MessageID)
+	}
+	return err
+}
+
+// Delete 删除用户对消息的评价
+func (r *FeedbackStore) Delete(messageID, userID string) error {
+	err := r.db.Where("message_id = ? AND user_id = ?", messageID, userID).Delete(&models.MessageFeedback{}).Error
+	if err == nil && r.logger != nil {
+		r.logger.Debug("用户 %s 对消息 %s 的评价删除成功", userID, messageID)
+	}
+	return err
+}
+
+// ListByMessage 获取消息的全部评价
+func (r *FeedbackStore) ListByMessage(messageID string) ([]*models.MessageFeedback, error) {
+	var feedback []*models.MessageFeedback
+	err := r.db.Where("message_id = ?", messageID).Order("id ASC").Find(&feedback).Error
+	if err == nil && r.logger != nil {
+		r.logger.Debug("查询到消息 %s 的 %d 条评价", messageID, len(feedback))
+	}
+	return feedback, err
+}
+
+// ListByConversation 获取会话中全部消息的评价
+func (r *FeedbackStore) ListByConversation(conversationID string) ([]*models.MessageFeedback, error) {
+	var feedback []*models.MessageFeedback
+	err := r.db.Where("conversation_id = ?", conversationID).Order("id ASC").Find(&feedback).Error
+	if err == nil && r.logger != nil {
+		r.logger.Debug("查询到会话 %s 的 %d 条评价", conversationID, len(feedback))
+	}
+	return feedback, err
+}
+
+// StatsByConversation 汇总会话的评价
+func (r *FeedbackStore) StatsByConversation(conversationID string) (*models.FeedbackStats, error) {
+	feedback, err := r.ListByConversation(conversationID)
+	if err != nil {
+		return nil, err
+	}
+	stats := &models.FeedbackStats{Key: conversationID}
+	for _, fb := range feedback {
+		stats.Add(fb)
+	}
+	return stats, nil
+}
+
+// feedbackCounts 按模型分组的评价计数
+type feedbackCounts struct {
+	Model string
+	Total int64
+	Up    int64
+	Down  int64
+}
+
+// StatsByModel 按模型汇总评价，计数在数据库中分组统计，原因标签只读取非空的记录
+func (r *FeedbackStore) StatsByModel(owner *models.Owner, since, until int64) ([]*models.FeedbackStats, error) {
+	scope := func(db *gorm.DB) *gorm.DB {
+		if owner != nil {
+			db = db.Where("tenant_id = ?", owner.TenantID)
+		}
+		if since > 0 {
+			db = db.Where("updated_at >= ?", since)
+		}
+		if until > 0 {
+			db = db.Where("updated_at <= ?", until)
+		}
+		return db
+	}
+
+	var counts []*feedbackCounts
+	err := r.db.Model(&models.MessageFeedback{}).Scopes(scope).
+		Select("model, COUNT(*) AS total, " +
+			"COALESCE(SUM(CASE WHEN rating > 0 THEN 1 ELSE 0 END), 0) AS up, " +
+			"COALESCE(SUM(CASE WHEN rating < 0 THEN 1 ELSE 0 END), 0) AS down").
+		Group("model").
+		Order("model ASC").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*models.FeedbackStats, 0, len(counts))
+	byModel := make(map[string]*models.FeedbackStats, len(counts))
+	for _, c := range counts {
+		stats := &models.FeedbackStats{Key: c.Model, Total: c.Total, Up: c.Up, Down: c.Down}
+		byModel[c.Model] = stats
+		result = append(result, stats)
+	}
+
+	var withReasons []*models.MessageFeedback
+	err = r.db.Scopes(scope).
+		Select("model", "reasons").
+		Where("reasons IS NOT NULL AND JSON_LENGTH(reasons) > 0").
+		Find(&withReasons).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, fb := range withReasons {
+		stats, ok := byModel[fb.Model]
+		if !ok {
+			continue
+		}
+		for _, reason := range fb.Reasons {
+			if stats.Reasons == nil {
+				stats.Reasons = make(map[string]int64)
+			}
+			stats.Reasons[reason]++
+		}
+	}
+
+	if r.logger != nil {
+		r.logger.Debug("汇总了 %d 个模型的评价", len(result))
+	}
+	return result, nil
+}
@@ -0,0 +1,258 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hildam/eino-history/model"
+	"github.com/hildam/eino-history/store/common/logger"
+	"github.com/hildam/eino-history/store/interfaces"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FolderStore 实现FolderStore接口的MySQL实现
+type FolderStore struct {
+	db     *gorm.DB
+	logger *logger.Logger
+}
+
+// NewFolderStore 创建MySQL文件夹存储库实例
+func NewFolderStore(db *gorm.DB) interfaces.FolderStore {
+	return &FolderStore{db: db}
+}
+
+// SetLogger 设置日志记录器
+func (r *FolderStore) SetLogger(logger *logger.Logger) {
+	r.logger = logger
+}
+
+// folderNameTaken 判断同级是否已有同名文件夹，excludeID 为文件夹自身
+func folderNameTaken(tx *gorm.DB, folder *models.Folder, parentID, name string) (bool, error) {
+	var count int64
+	err := tx.Model(&models.Folder{}).
+		Where("tenant_id = ? AND user_id = ? AND parent_id = ? AND name = ? AND folder_id <> ?",
+			folder.TenantID, folder.UserID, parentID, name, folder.FolderID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// nameConflict 将指定唯一索引上的重复键错误转换为 models.ErrNameConflict，
+// 名称检查之后并发写入的同名记录由唯一索引兜底
+func nameConflict(tx *gorm.DB, err error, index string) error {
+	translator, ok := tx.Dialector.(gorm.ErrorTranslator)
+	if err == nil || !ok {
+		return err
+	}
+	if errors.Is(translator.Translate(err), gorm.ErrDuplicatedKey) && strings.Contains(err.Error(), index) {
+		return models.ErrNameConflict
+	}
+	return err
+}
+
+// lockFolder 在事务中锁定文件夹行
+func lockFolder(tx *gorm.DB, folderID string) (*models.Folder, error) {
+	var folder models.Folder
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("folder_id = ?", folderID).Take(&folder).Error
+	if err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
+// checkParent 校验父文件夹存在且与文件夹属于同一归属
+func checkParent(tx *gorm.DB, folder *models.Folder, parentID string) (*models.Folder, error) {
+	parent, err := lockFolder(tx, parentID)
+	if err != nil {
+		return nil, err
+	}
+	if parent.TenantID != folder.TenantID || parent.UserID != folder.UserID {
+		return nil, fmt.Errorf("父文件夹 %s 不属于同一归属", parentID)
+	}
+	return parent, nil
+}
+
+// Create 创建文件夹
+func (r *FolderStore) Create(folder *models.Folder) error {
+	if folder.FolderID == "" {
+		folder.FolderID = uuid.NewString()
+	}
+	now := time.Now().Unix()
+	if folder.CreatedAt == 0 {
+		folder.CreatedAt = now
+	}
+	folder.UpdatedAt = now
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if folder.ParentID != "" {
+			if _, err := checkParent(tx, folder, folder.ParentID); err != nil {
+				return err
+			}
+		}
+		taken, err := folderNameTaken(tx, folder, folder.ParentID, folder.Name)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return models.ErrNameConflict
+		}
+		return nameConflict(tx, tx.Create(folder).Error, "idx_folders_sibling_name")
+	})
+	if err == nil && r.logger != nil {
+		r.logger.Info("文件夹 %s 创建成功", folder.FolderID)
+	}
+	return err
+}
+
+// GetByID 根据ID获取文件夹
+func (r *FolderStore) GetByID(folderID string) (*models.Folder, error) {
+	var folder models.Folder
+	if err := r.db.Where("folder_id = ?", folderID).First(&folder).Error; err != nil {
+		if r.logger != nil {
+			r.logger.Error("获取文件夹 %s 失败: %v", folderID, err)
+		}
+		return nil, err
+	}
+	return &folder, nil
+}
+
+// List 获取指定归属的全部文件夹
+func (r *FolderStore) List(tenantID, userID string) ([]*models.Folder, error) {
+	var folders []*models.Folder
+	err := r.db.Where("tenant_id = ? AND user_id = ?", tenantID, userID).
+		Order("name ASC").
+		Find(&folders).Error
+	return folders, err
+}
+
+// Rename 重命名文件夹
+func (r *FolderStore) Rename(folderID, name string) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		folder, err := lockFolder(tx, folderID)
+		if err != nil {
+			return err
+		}
+		taken, err := folderNameTaken(tx, folder, folder.ParentID, name)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return models.ErrNameConflict
+		}
+		err = tx.Model(&models.Folder{}).Where("folder_id = ?", folderID).
+			Updates(map[string]interface{}{"name": name, "updated_at": time.Now().Unix()}).Error
+		return nameConflict(tx, err, "idx_folders_sibling_name")
+	})
+	if err == nil && r.logger != nil {
+		r.logger.Info("文件夹 %s 重命名为 %s", folderID, name)
+	}
+	return err
+}
+
+// Move 移动文件夹到新的父文件夹下，沿新父文件夹向上查找以防止出现环
+func (r *FolderStore) Move(folderID, parentID string) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		folder, err := lockFolder(tx, folderID)
+		if err != nil {
+			return err
+		}
+
+		for ancestorID := parentID; ancestorID != ""; {
+			if ancestorID == folderID {
+				return models.ErrFolderCycle
+			}
+			ancestor, err := checkParent(tx, folder, ancestorID)
+			if err != nil {
+				return err
+			}
+			ancestorID = ancestor.ParentID
+		}
+
+		taken, err := folderNameTaken(tx, folder, parentID, folder.Name)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return models.ErrNameConflict
+		}
+		err = tx.Model(&models.Folder{}).Where("folder_id = ?", folderID).
+			Updates(map[string]interface{}{"parent_id": parentID, "updated_at": time.Now().Unix()}).Error
+		return nameConflict(tx, err, "idx_folders_sibling_name")
+	})
+	if err == nil && r.logger != nil {
+		r.logger.Info("文件夹 %s 移动到 %q 下", folderID, parentID)
+	}
+	return err
+}
+
+// Delete 删除文件夹及其全部子文件夹，逐层收集子文件夹ID后一并删除
+func (r *FolderStore) Delete(folderID string) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		folderIDs := []string{folderID}
+		for level := []string{folderID}; len(level) > 0; {
+			var children []string
+			if err := tx.Model(&models.Folder{}).Where("parent_id IN ?", level).Pluck("folder_id", &children).Error; err != nil {
+				return err
+			}
+			folderIDs = append(folderIDs, children...)
+			level = children
+		}
+
+		if err := tx.Where("folder_id IN ?", folderIDs).Delete(&models.ConversationFolder{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("folder_id IN ?", folderIDs).Delete(&models.Folder{}).Error
+	})
+	if err == nil && r.logger != nil {
+		r.logger.Info("文件夹 %s 及其子文件夹删除成功", folderID)
+	}
+	return err
+}
+
+// SetConversationFolder 将会话移动到文件夹
+func (r *FolderStore) SetConversationFolder(convID, folderID string) error {
+	if folderID == "" {
+		return r.db.Where("conversation_id = ?", convID).Delete(&models.ConversationFolder{}).Error
+	}
+	if _, err := r.GetByID(folderID); err != nil {
+		return err
+	}
+
+	link := &models.ConversationFolder{ConversationID: convID, FolderID: folderID, CreatedAt: time.Now().Unix()}
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "conversation_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"folder_id", "created_at"}),
+	}).Create(link).Error
+}
+
+// GetConversationFolder 获取会话所在的文件夹ID
+func (r *FolderStore) GetConversationFolder(convID string) (string, error) {
+	var folderIDs []string
+	err := r.db.Model(&models.ConversationFolder{}).
+		Where("conversation_id = ?", convID).
+		Limit(1).
+		Pluck("folder_id", &folderIDs).Error
+	if err != nil || len(folderIDs) == 0 {
+		return "", err
+	}
+	return folderIDs[0], nil
+}
+
+// ListConversations 按更新时间降序获取文件夹中的会话
+func (r *FolderStore) ListConversations(folderID string, offset, limit int) ([]*models.Conversation, error) {
+	var convs []*models.Conversation
+	err := r.db.Joins("JOIN conversation_folders ON conversation_folders.conversation_id = conversations.conv_id").
+		Where("conversation_folders.folder_id = ? AND conversations.deleted_at = 0", folderID).
+		Order("conversations.updated_at DESC").
+		Order("conversations.id DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&convs).Error
+	if err == nil && r.logger != nil {
+		r.logger.Debug("查询到文件夹 %s 的 %d 个会话", folderID, len(convs))
+	}
+	return convs, err
+}
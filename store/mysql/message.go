@@ -1,6 +1,9 @@
 package mysql
 
 import (
+	"errors"
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/hildam/eino-history/model"
 	"github.com/hildam/eino-history/store/common/logger"
@@ -24,33 +27,370 @@ func (r *MessageStore) SetLogger(logger *logger.Logger) {
 	r.logger = logger
 }
 
-// Create 创建消息
+// Create 创建消息，并在同一事务中更新所属会话的活动字段
+// 未指定排序序号时按会话内已有消息顺延
 func (r *MessageStore) Create(msg *models.Message) error {
 	if len(msg.MsgID) == 0 {
 		msg.MsgID = uuid.NewString()
 	}
 
-	err := r.db.Create(msg).Error
-	if err == nil && r.logger != nil {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		conv, err := lockConversation(tx, msg.ConversationID)
+		if err != nil {
+			return err
+		}
+		if conv != nil && conv.DeletedAt != 0 {
+			return models.ErrDeleted
+		}
+		if msg.OrderSeq == 0 {
+			if msg.OrderSeq, err = nextOrderSeq(tx, msg.ConversationID); err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(msg).Error; err != nil {
+			return err
+		}
+		if conv == nil {
+			return nil
+		}
+		return touchConversation(tx, msg.ConversationID, map[string]interface{}{
+			"message_count": gorm.Expr("message_count + 1"),
+			"total_tokens":  gorm.Expr("total_tokens + ?", msg.TokenCount),
+		})
+	})
+	if err != nil {
+		if r.logger != nil {
+			r.logger.Error("创建消息失败: %v", err)
+		}
+		return err
+	}
+	if r.logger != nil {
 		r.logger.Info("消息 %s 创建成功", msg.MsgID)
 	}
+	return nil
+}
+
+// messageBatchSize 批量写入时单条 INSERT 语句包含的最大行数
+const messageBatchSize = 100
+
+// CreateBatch 按会话分组批量创建消息
+// 每个会话在一个事务中多行插入消息并更新活动字段，某个会话失败时只回滚该会话的消息
+func (r *MessageStore) CreateBatch(msgs []*models.Message) error {
+	convIDs, groups, failed := groupByConversation(msgs)
+	for _, convID := range convIDs {
+		idx := groups[convID]
+		if err := r.createGroup(convID, msgs, idx); err != nil {
+			if r.logger != nil {
+				r.logger.Error("批量创建会话 %s 的 %d 条消息失败: %v", convID, len(idx), err)
+			}
+			for _, i := range idx {
+				failed = append(failed, &models.BatchItemError{Index: i, ID: msgs[i].MsgID, Err: err})
+			}
+		}
+	}
+	if r.logger != nil {
+		r.logger.Info("批量创建消息 %d 条，失败 %d 条", len(msgs), len(failed))
+	}
+	return models.NewBatchError(len(msgs), failed)
+}
+
+// createGroup 在一个事务中写入同一会话的消息，失败时还原自动分配的主键和排序序号
+func (r *MessageStore) createGroup(convID string, msgs []*models.Message, idx []int) error {
+	batch := make([]*models.Message, len(idx))
+	assigned := make([]bool, len(idx))
+	for k, i := range idx {
+		batch[k] = msgs[i]
+	}
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		conv, err := lockConversation(tx, convID)
+		if err != nil {
+			return err
+		}
+		if conv != nil && conv.DeletedAt != 0 {
+			return models.ErrDeleted
+		}
+		next, err := nextOrderSeq(tx, convID)
+		if err != nil {
+			return err
+		}
+		tokens := 0
+		for k, msg := range batch {
+			if msg.OrderSeq == 0 {
+				msg.OrderSeq, assigned[k] = next, true
+			}
+			if msg.OrderSeq >= next {
+				next = msg.OrderSeq + 1
+			}
+			tokens += msg.TokenCount
+		}
+		if err := tx.CreateInBatches(batch, messageBatchSize).Error; err != nil {
+			return err
+		}
+		if conv == nil {
+			return nil
+		}
+		return touchConversation(tx, convID, map[string]interface{}{
+			"message_count": gorm.Expr("message_count + ?", len(batch)),
+			"total_tokens":  gorm.Expr("total_tokens + ?", tokens),
+		})
+	})
+	if err != nil {
+		for k, msg := range batch {
+			msg.ID = 0
+			if assigned[k] {
+				msg.OrderSeq = 0
+			}
+		}
+	}
 	return err
 }
 
-// Update 更新消息
+// groupByConversation 为消息补全ID并按会话分组，返回会话的出现顺序、各会话的消息下标和无效项
+func groupByConversation(msgs []*models.Message) ([]string, map[string][]int, []*models.BatchItemError) {
+	var convIDs []string
+	var failed []*models.BatchItemError
+	groups := make(map[string][]int)
+	for i, msg := range msgs {
+		if msg == nil {
+			failed = append(failed, &models.BatchItemError{Index: i, Err: errors.New("消息为空")})
+			continue
+		}
+		if len(msg.MsgID) == 0 {
+			msg.MsgID = uuid.NewString()
+		}
+		if _, ok := groups[msg.ConversationID]; !ok {
+			convIDs = append(convIDs, msg.ConversationID)
+		}
+		groups[msg.ConversationID] = append(groups[msg.ConversationID], i)
+	}
+	return convIDs, groups, failed
+}
+
+// Update 更新消息，并在同一事务中更新所属会话的活动字段
 func (r *MessageStore) Update(msg *models.Message) error {
-	err := r.db.Save(msg).Error
-	if err == nil && r.logger != nil {
-		r.logger.Info("消息 %s 更新成功", msg.MsgID)
+	return r.update(msg, false)
+}
+
+// CompareAndUpdate 锁定会话后比较消息的版本号，一致时更新消息
+func (r *MessageStore) CompareAndUpdate(msg *models.Message) error {
+	return r.update(msg, true)
+}
+
+// update 锁定会话后写入消息，check 为true时先比较版本号
+// 同一会话的消息写入都先锁定会话行，锁定后读取到的消息版本不会被并发修改
+func (r *MessageStore) update(msg *models.Message, check bool) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := lockConversation(tx, msg.ConversationID); err != nil {
+			return err
+		}
+		var old models.Message
+		if err := tx.Where("msg_id = ?", msg.MsgID).Take(&old).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if old.DeletedAt != 0 {
+			return models.ErrDeleted
+		}
+		if check {
+			if old.MsgID == "" {
+				return gorm.ErrRecordNotFound
+			}
+			if old.Version != msg.Version {
+				return models.ErrVersionConflict
+			}
+		}
+		return saveMessage(tx, &old, msg)
+	})
+	if err != nil {
+		if r.logger != nil {
+			r.logger.Error("更新消息 %s 失败: %v", msg.MsgID, err)
+		}
+		return err
 	}
-	return err
+	if r.logger != nil {
+		r.logger.Info("消息 %s 更新成功，版本 %d", msg.MsgID, msg.Version)
+	}
+	return nil
+}
+
+// Patch 锁定会话后读取消息，应用部分字段更新并写回
+func (r *MessageStore) Patch(msgID string, patch *models.MessagePatch) (*models.Message, error) {
+	var msg models.Message
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var old models.Message
+		if err := tx.Where("msg_id = ? AND deleted_at = 0", msgID).Take(&old).Error; err != nil {
+			return err
+		}
+		if _, err := lockConversation(tx, old.ConversationID); err != nil {
+			return err
+		}
+		// 锁定会话后重新读取，得到最新的版本
+		if err := tx.Where("msg_id = ? AND deleted_at = 0", msgID).Take(&old).Error; err != nil {
+			return err
+		}
+		if err := models.CheckVersion(patch.Version, old.Version); err != nil {
+			return err
+		}
+		msg = old
+		patch.Apply(&msg)
+		return saveMessage(tx, &old, &msg)
+	})
+	if err != nil {
+		if r.logger != nil {
+			r.logger.Error("更新消息 %s 的字段失败: %v", msgID, err)
+		}
+		return nil, err
+	}
+	if r.logger != nil {
+		r.logger.Info("消息 %s 更新成功，版本 %d", msgID, msg.Version)
+	}
+	return &msg, nil
 }
 
-// Delete 删除消息
+// saveMessage 在事务中写入消息的新内容并递增版本号，旧版本存在时记录修订，同时更新会话的活动字段
+func saveMessage(tx *gorm.DB, old, msg *models.Message) error {
+	if old.MsgID != "" {
+		if err := recordRevision(tx, old, msg); err != nil {
+			return err
+		}
+	}
+	msg.Version = old.Version + 1
+	if err := tx.Omit("deleted_at").Save(msg).Error; err != nil {
+		return err
+	}
+	return touchConversation(tx, msg.ConversationID, map[string]interface{}{
+		"total_tokens": gorm.Expr("total_tokens + ?", msg.TokenCount-old.TokenCount),
+	})
+}
+
+// Delete 将消息移入回收站，并在同一事务中更新所属会话的活动字段
 func (r *MessageStore) Delete(msgID string) error {
-	err := r.db.Where("msg_id = ?", msgID).Delete(&models.Message{}).Error
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var msg models.Message
+		err := tx.Where("msg_id = ? AND deleted_at = 0", msgID).Take(&msg).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := lockConversation(tx, msg.ConversationID); err != nil {
+			return err
+		}
+		// 锁定会话后重新读取，并发删除时只有一次生效并更新会话计数
+		err = tx.Where("msg_id = ? AND deleted_at = 0", msgID).Take(&msg).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		result := tx.Model(&models.Message{}).Where("msg_id = ? AND deleted_at = 0", msgID).
+			Update("deleted_at", time.Now().Unix())
+		if result.Error != nil || result.RowsAffected != 1 {
+			return result.Error
+		}
+		return touchConversation(tx, msg.ConversationID, map[string]interface{}{
+			"message_count": gorm.Expr("GREATEST(message_count, 1) - 1"),
+			"total_tokens":  gorm.Expr("total_tokens - ?", msg.TokenCount),
+		})
+	})
+	if err != nil {
+		if r.logger != nil {
+			r.logger.Error("删除消息 %s 失败: %v", msgID, err)
+		}
+		return err
+	}
+	if r.logger != nil {
+		r.logger.Info("消息 %s 已移入回收站", msgID)
+	}
+	return nil
+}
+
+// Restore 从回收站恢复消息，并在同一事务中更新所属会话的活动字段
+func (r *MessageStore) Restore(msgID string) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var msg models.Message
+		if err := tx.Where("msg_id = ? AND deleted_at > 0", msgID).Take(&msg).Error; err != nil {
+			return err
+		}
+		conv, err := lockConversation(tx, msg.ConversationID)
+		if err != nil {
+			return err
+		}
+		if conv != nil && conv.DeletedAt != 0 {
+			return models.ErrDeleted
+		}
+		if err := tx.Model(&msg).Update("deleted_at", 0).Error; err != nil {
+			return err
+		}
+		if conv == nil {
+			return nil
+		}
+		return touchConversation(tx, msg.ConversationID, map[string]interface{}{
+			"message_count": gorm.Expr("message_count + 1"),
+			"total_tokens":  gorm.Expr("total_tokens + ?", msg.TokenCount),
+		})
+	})
+	if err != nil {
+		if r.logger != nil {
+			r.logger.Error("恢复消息 %s 失败: %v", msgID, err)
+		}
+		return err
+	}
+	if r.logger != nil {
+		r.logger.Info("消息 %s 已恢复", msgID)
+	}
+	return nil
+}
+
+// GetDeleted 获取回收站中的消息
+func (r *MessageStore) GetDeleted(msgID string) (*models.Message, error) {
+	var msg models.Message
+	err := r.db.Where("msg_id = ? AND deleted_at > 0", msgID).First(&msg).Error
+	if err != nil {
+		if r.logger != nil {
+			r.logger.Error("获取回收站消息 %s 失败: %v", msgID, err)
+		}
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// ListDeleted 按删除时间降序获取回收站中的消息
+func (r *MessageStore) ListDeleted(conversationID string, before int64, offset, limit int) ([]*models.Message, error) {
+	var msgs []*models.Message
+	tx := r.db.Where("deleted_at > 0")
+	if conversationID != "" {
+		tx = tx.Where("conversation_id = ?", conversationID)
+	}
+	if before > 0 {
+		tx = tx.Where("deleted_at < ?", before)
+	}
+	err := tx.Order("deleted_at DESC").Order("id DESC").Offset(offset).Limit(limit).Find(&msgs).Error
+	if err == nil && r.logger != nil {
+		r.logger.Info("查询到回收站中的 %d 条消息", len(msgs))
+	}
+	return msgs, err
+}
+
+// Purge 永久删除回收站中的消息及其附件关联、评价和历史修订
+func (r *MessageStore) Purge(msgID string) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("msg_id = ? AND deleted_at > 0", msgID).Delete(&models.Message{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		if err := tx.Where("message_id = ?", msgID).Delete(&models.MessageAttachment{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("message_id = ?", msgID).Delete(&models.MessageRevision{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("message_id = ?", msgID).Delete(&models.MessageFeedback{}).Error
+	})
 	if err == nil && r.logger != nil {
-		r.logger.Info("消息 %s 删除成功", msgID)
+		r.logger.Info("消息 %s 已永久删除", msgID)
 	}
 	return err
 }
@@ -58,19 +398,51 @@ func (r *MessageStore) Delete(msgID string) error {
 // GetByID 根据ID获取消息
 func (r *MessageStore) GetByID(msgID string) (*models.Message, error) {
 	var msg models.Message
-	err := r.db.Where("msg_id = ?", msgID).First(&msg).Error
-	if err != nil && r.logger != nil {
-		r.logger.Error("获取消息 %s 失败: %v", msgID, err)
+	err := r.db.Where("msg_id = ? AND deleted_at = 0", msgID).First(&msg).Error
+	if err != nil {
+		if r.logger != nil {
+			r.logger.Error("获取消息 %s 失败: %v", msgID, err)
+		}
 		return nil, err
 	}
 	return &msg, nil
 }
 
+// GetByIDs 批量获取消息，按 IN 查询分批读取后按输入顺序排列
+func (r *MessageStore) GetByIDs(msgIDs []string) ([]*models.Message, error) {
+	found := make(map[string]*models.Message, len(msgIDs))
+	for start := 0; start < len(msgIDs); start += messageBatchSize {
+		end := min(start+messageBatchSize, len(msgIDs))
+		var msgs []*models.Message
+		if err := r.db.Where("msg_id IN ? AND deleted_at = 0", msgIDs[start:end]).Find(&msgs).Error; err != nil {
+			if r.logger != nil {
+				r.logger.Error("批量获取消息失败: %v", err)
+			}
+			return nil, err
+		}
+		for _, msg := range msgs {
+			found[msg.MsgID] = msg
+		}
+	}
+
+	result := make([]*models.Message, 0, len(found))
+	var failed []*models.BatchItemError
+	for i, id := range msgIDs {
+		if msg, ok := found[id]; ok {
+			result = append(result, msg)
+		} else {
+			failed = append(failed, &models.BatchItemError{Index: i, ID: id, Err: models.ErrNotFound})
+		}
+	}
+	return result, models.NewBatchError(len(msgIDs), failed)
+}
+
 // ListByConversation 获取对话的消息列表
 func (r *MessageStore) ListByConversation(conversationID string, offset, limit int) ([]*models.Message, error) {
 	var msgs []*models.Message
-	err := r.db.Where("conversation_id = ?", conversationID).
+	err := r.db.Where("conversation_id = ? AND deleted_at = 0", conversationID).
 		Order("order_seq ASC").
+		Order("id ASC").
 		Offset(offset).
 		Limit(limit).
 		Find(&msgs).Error
@@ -84,16 +456,20 @@ func (r *MessageStore) ListByConversation(conversationID string, offset, limit i
 
 // UpdateStatus 更新消息状态
 func (r *MessageStore) UpdateStatus(msgID string, status string) error {
-	err := r.db.Model(&models.Message{}).Where("msg_id = ?", msgID).Update("status", status).Error
+	err := r.updateField(msgID, "status", status, nil)
 	if err == nil && r.logger != nil {
 		r.logger.Debug("消息 %s 状态更新为 %s", msgID, status)
 	}
 	return err
 }
 
-// UpdateTokenCount 更新消息token数量
+// UpdateTokenCount 更新消息token数量，会话的token总数同步增减
 func (r *MessageStore) UpdateTokenCount(msgID string, tokenCount int) error {
-	err := r.db.Model(&models.Message{}).Where("msg_id = ?", msgID).Update("token_count", tokenCount).Error
+	err := r.updateField(msgID, "token_count", tokenCount, func(old *models.Message) map[string]interface{} {
+		return map[string]interface{}{
+			"total_tokens": gorm.Expr("total_tokens + ?", tokenCount-old.TokenCount),
+		}
+	})
 	if err == nil && r.logger != nil {
 		r.logger.Debug("消息 %s token数量更新为 %d", msgID, tokenCount)
 	}
@@ -102,7 +478,7 @@ func (r *MessageStore) UpdateTokenCount(msgID string, tokenCount int) error {
 
 // SetContextEdge 设置消息为上下文边界
 func (r *MessageStore) SetContextEdge(msgID string, isContextEdge bool) error {
-	err := r.db.Model(&models.Message{}).Where("msg_id = ?", msgID).Update("is_context_edge", isContextEdge).Error
+	err := r.updateField(msgID, "is_context_edge", isContextEdge, nil)
 	if err == nil && r.logger != nil {
 		r.logger.Debug("消息 %s 上下文边界设置为 %t", msgID, isContextEdge)
 	}
@@ -111,9 +487,39 @@ func (r *MessageStore) SetContextEdge(msgID string, isContextEdge bool) error {
 
 // SetVariant 设置消息为变体
 func (r *MessageStore) SetVariant(msgID string, isVariant bool) error {
-	err := r.db.Model(&models.Message{}).Where("msg_id = ?", msgID).Update("is_variant", isVariant).Error
+	err := r.updateField(msgID, "is_variant", isVariant, nil)
 	if err == nil && r.logger != nil {
 		r.logger.Debug("消息 %s 变体设置为 %t", msgID, isVariant)
 	}
 	return err
 }
+
+// updateField 在事务中更新消息的单个字段并递增版本号，同时刷新所属会话的活动字段
+// activity 根据更新前的消息返回会话活动字段的增量更新，可以为nil
+func (r *MessageStore) updateField(msgID, column string, value interface{},
+	activity func(old *models.Message) map[string]interface{}) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var old models.Message
+		if err := tx.Where("msg_id = ? AND deleted_at = 0", msgID).Take(&old).Error; err != nil {
+			return err
+		}
+		if _, err := lockConversation(tx, old.ConversationID); err != nil {
+			return err
+		}
+		// 锁定会话后重新读取，增量按最新的值计算
+		if err := tx.Where("msg_id = ? AND deleted_at = 0", msgID).Take(&old).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Message{}).Where("msg_id = ?", msgID).Updates(map[string]interface{}{
+			column:    value,
+			"version": gorm.Expr("version + 1"),
+		}).Error; err != nil {
+			return err
+		}
+		updates := map[string]interface{}{}
+		if activity != nil {
+			updates = activity(&old)
+		}
+		return touchConversation(tx, old.ConversationID, updates)
+	})
+}
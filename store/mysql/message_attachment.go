@@ -81,6 +81,23 @@ func (r *MessageAttachmentStore) ListByMessage(messageID string) ([]*models.Mess
 	return messageAttachments, err
 }
 
+// ListByMessages 根据多个消息ID获取消息附件关联列表
+func (r *MessageAttachmentStore) ListByMessages(messageIDs []string) ([]*models.MessageAttachment, error) {
+	var messageAttachments []*models.MessageAttachment
+	for start := 0; start < len(messageIDs); start += messageBatchSize {
+		var links []*models.MessageAttachment
+		ids := messageIDs[start:min(start+messageBatchSize, len(messageIDs))]
+		if err := r.db.Where("message_id IN ?", ids).Order("id ASC").Find(&links).Error; err != nil {
+			return nil, err
+		}
+		messageAttachments = append(messageAttachments, links...)
+	}
+	if r.logger != nil {
+		r.logger.Debug("查询到 %d 条消息的 %d 个附件关联", len(messageIDs), len(messageAttachments))
+	}
+	return messageAttachments, nil
+}
+
 // ListByAttachment 根据附件ID获取消息附件关联列表
 func (r *MessageAttachmentStore) ListByAttachment(attachmentID string) ([]*models.MessageAttachment, error) {
 	var messageAttachments []*models.MessageAttachment
@@ -90,3 +107,10 @@ func (r *MessageAttachmentStore) ListByAttachment(attachmentID string) ([]*model
 	}
 	return messageAttachments, err
 }
+
+// CountByAttachment 统计附件的消息关联数
+func (r *MessageAttachmentStore) CountByAttachment(attachmentID string) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.MessageAttachment{}).Where("attachment_id = ?", attachmentID).Count(&count).Error
+	return count, err
+}
@@ -19,6 +19,14 @@ type Provider struct {
 	conversationRepo      interfaces.ConversationStore
 	attachmentRepo        interfaces.AttachmentStore
 	messageAttachmentRepo interfaces.MessageAttachmentStore
+	searchRepo            interfaces.SearchStore
+	embeddingRepo         interfaces.EmbeddingStore
+	feedbackRepo          interfaces.FeedbackStore
+	tagRepo               interfaces.TagStore
+	folderRepo            interfaces.FolderStore
+	auditRepo             interfaces.AuditStore
+	blobRepo              interfaces.BlobStore
+	attachmentChunkRepo   interfaces.AttachmentChunkStore
 	logger                *logger.Logger
 }
 
@@ -84,6 +92,14 @@ func NewProvider(dsn string, loggingEnabled bool, logLevel string) (*Provider, e
 	provider.conversationRepo = NewConversationStore(db)
 	provider.attachmentRepo = NewAttachmentStore(db)
 	provider.messageAttachmentRepo = NewMessageAttachmentStore(db)
+	provider.searchRepo = NewSearchStore(db)
+	provider.embeddingRepo = NewEmbeddingStore(db)
+	provider.feedbackRepo = NewFeedbackStore(db)
+	provider.tagRepo = NewTagStore(db)
+	provider.folderRepo = NewFolderStore(db)
+	provider.auditRepo = NewAuditStore(db)
+	provider.blobRepo = NewBlobStore(db)
+	provider.attachmentChunkRepo = NewAttachmentChunkStore(db)
 
 	// 注入日志记录器到仓库中
 	setLoggers(provider)
@@ -111,6 +127,38 @@ func setLoggers(p *Provider) {
 	if messageAttachmentRepo, ok := p.messageAttachmentRepo.(*MessageAttachmentStore); ok {
 		messageAttachmentRepo.SetLogger(p.logger)
 	}
+
+	if searchRepo, ok := p.searchRepo.(*SearchStore); ok {
+		searchRepo.SetLogger(p.logger)
+	}
+
+	if embeddingRepo, ok := p.embeddingRepo.(*EmbeddingStore); ok {
+		embeddingRepo.SetLogger(p.logger)
+	}
+
+	if feedbackRepo, ok := p.feedbackRepo.(*FeedbackStore); ok {
+		feedbackRepo.SetLogger(p.logger)
+	}
+
+	if tagRepo, ok := p.tagRepo.(*TagStore); ok {
+		tagRepo.SetLogger(p.logger)
+	}
+
+	if folderRepo, ok := p.folderRepo.(*FolderStore); ok {
+		folderRepo.SetLogger(p.logger)
+	}
+
+	if auditRepo, ok := p.auditRepo.(*AuditStore); ok {
+		auditRepo.SetLogger(p.logger)
+	}
+
+	if blobRepo, ok := p.blobRepo.(*BlobStore); ok {
+		blobRepo.SetLogger(p.logger)
+	}
+
+	if attachmentChunkRepo, ok := p.attachmentChunkRepo.(*AttachmentChunkStore); ok {
+		attachmentChunkRepo.SetLogger(p.logger)
+	}
 }
 
 // GetMessageStore 获取消息存储库
@@ -141,6 +189,62 @@ func (p *Provider) GetMessageAttachmentStore() interfaces.MessageAttachmentStore
 	return p.messageAttachmentRepo
 }
 
+// GetSearchStore 获取全文检索存储库
+// 返回:
+//   - interfaces.SearchStore: 全文检索存储库实例
+func (p *Provider) GetSearchStore() interfaces.SearchStore {
+	return p.searchRepo
+}
+
+// GetEmbeddingStore 获取向量存储库
+// 返回:
+//   - interfaces.EmbeddingStore: 向量存储库实例
+func (p *Provider) GetEmbeddingStore() interfaces.EmbeddingStore {
+	return p.embeddingRepo
+}
+
+// GetFeedbackStore 获取消息评价存储库
+// 返回:
+//   - interfaces.FeedbackStore: 消息评价存储库实例
+func (p *Provider) GetFeedbackStore() interfaces.FeedbackStore {
+	return p.feedbackRepo
+}
+
+// GetTagStore 获取标签存储库
+// 返回:
+//   - interfaces.TagStore: 标签存储库实例
+func (p *Provider) GetTagStore() interfaces.TagStore {
+	return p.tagRepo
+}
+
+// GetFolderStore 获取文件夹存储库
+// 返回:
+//   - interfaces.FolderStore: 文件夹存储库实例
+func (p *Provider) GetFolderStore() interfaces.FolderStore {
+	return p.folderRepo
+}
+
+// GetAuditStore 获取审计日志存储库
+// 返回:
+//   - interfaces.AuditStore: 审计日志存储库实例
+func (p *Provider) GetAuditStore() interfaces.AuditStore {
+	return p.auditRepo
+}
+
+// GetBlobStore 获取附件内容存储库
+// 返回:
+//   - interfaces.BlobStore: 附件内容存储库实例
+func (p *Provider) GetBlobStore() interfaces.BlobStore {
+	return p.blobRepo
+}
+
+// GetAttachmentChunkStore 获取附件文本分块存储库
+// 返回:
+//   - interfaces.AttachmentChunkStore: 附件文本分块存储库实例
+func (p *Provider) GetAttachmentChunkStore() interfaces.AttachmentChunkStore {
+	return p.attachmentChunkRepo
+}
+
 // Close 关闭数据库连接
 // 返回:
 //   - error: 如果关闭过程中发生错误
@@ -172,5 +276,16 @@ func autoMigrateTables(db *gorm.DB) error {
 		&models.Message{},
 		&models.Attachment{},
 		&models.MessageAttachment{},
+		&models.MessageFeedback{},
+		&models.MessageRevision{},
+		&models.Embedding{},
+		&models.Tag{},
+		&models.ConversationTag{},
+		&models.Folder{},
+		&models.ConversationFolder{},
+		&models.AuditEvent{},
+		&models.Blob{},
+		&models.BlobChunk{},
+		&models.AttachmentChunk{},
 	)
 }
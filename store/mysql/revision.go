@@ -0,0 +1,48 @@
+package mysql
+
+import (
+	"time"
+
+	"github.com/hildam/eino-history/model"
+	"gorm.io/gorm"
+)
+
+// recordRevision 内容或元数据发生变化时将旧版本保存为修订
+func recordRevision(tx *gorm.DB, old, msg *models.Message) error {
+	revision := models.NextRevision(old, msg, time.Now().Unix())
+	if revision == nil {
+		return nil
+	}
+	return tx.Create(revision).Error
+}
+
+// ListRevisions 按修订号升序获取消息的历史修订
+func (r *MessageStore) ListRevisions(msgID string) ([]*models.MessageRevision, error) {
+	var revisions []*models.MessageRevision
+	err := r.db.Where("message_id = ?", msgID).Order("revision ASC").Find(&revisions).Error
+	if err == nil && r.logger != nil {
+		r.logger.Debug("查询到消息 %s 的 %d 个修订", msgID, len(revisions))
+	}
+	return revisions, err
+}
+
+// GetRevision 获取消息的指定历史修订
+func (r *MessageStore) GetRevision(msgID string, revision int) (*models.MessageRevision, error) {
+	var rev models.MessageRevision
+	if err := r.db.Where("message_id = ? AND revision = ?", msgID, revision).First(&rev).Error; err != nil {
+		if r.logger != nil {
+			r.logger.Error("获取消息 %s 的修订 %d 失败: %v", msgID, revision, err)
+		}
+		return nil, err
+	}
+	return &rev, nil
+}
+
+// DeleteRevisions 删除消息的全部历史修订
+func (r *MessageStore) DeleteRevisions(msgID string) error {
+	err := r.db.Where("message_id = ?", msgID).Delete(&models.MessageRevision{}).Error
+	if err == nil && r.logger != nil {
+		r.logger.Info("消息 %s 的历史修订已删除", msgID)
+	}
+	return err
+}
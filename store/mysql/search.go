@@ -0,0 +1,119 @@
+package mysql
+
+import (
+	"github.com/hildam/eino-history/model"
+	"github.com/hildam/eino-history/store/common/fulltext"
+	"github.com/hildam/eino-history/store/common/logger"
+	"github.com/hildam/eino-history/store/interfaces"
+	"gorm.io/gorm"
+)
+
+// matchExpr 基于 messages.content 全文索引的相关度表达式
+const matchExpr = "MATCH(messages.content) AGAINST(? IN NATURAL LANGUAGE MODE)"
+
+// SearchStore 实现SearchStore接口的MySQL实现，基于FULLTEXT索引
+type SearchStore struct {
+	db     *gorm.DB
+	logger *logger.Logger
+}
+
+// NewSearchStore 创建MySQL全文检索实例
+func NewSearchStore(db *gorm.DB) interfaces.SearchStore {
+	return &SearchStore{db: db}
+}
+
+// SetLogger 设置日志记录器
+func (r *SearchStore) SetLogger(logger *logger.Logger) {
+	r.logger = logger
+}
+
+// searchRow 检索结果行
+type searchRow struct {
+	MsgID          string  `gorm:"column:msg_id"`
+	ConversationID string  `gorm:"column:conversation_id"`
+	Role           string  `gorm:"column:role"`
+	Content        string  `gorm:"column:content"`
+	CreatedAt      int64   `gorm:"column:created_at"`
+	Score          float64 `gorm:"column:score"`
+}
+
+// Search 按关键词检索消息
+func (r *SearchStore) Search(query string, filter *models.SearchFilter) (*models.SearchResult, error) {
+	if filter == nil {
+		filter = &models.SearchFilter{}
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = models.DefaultSearchLimit
+	}
+
+	tx := r.db.Table("messages").
+		Joins("LEFT JOIN conversations ON conversations.conv_id = messages.conversation_id").
+		Where(matchExpr, query).
+		Where("messages.deleted_at = 0 AND COALESCE(conversations.deleted_at, 0) = 0")
+
+	if filter.ConversationID != "" {
+		tx = tx.Where("messages.conversation_id = ?", filter.ConversationID)
+	}
+	if len(filter.Roles) > 0 {
+		tx = tx.Where("messages.role IN ?", filter.Roles)
+	}
+	if filter.Since > 0 {
+		tx = tx.Where("messages.created_at >= ?", filter.Since)
+	}
+	if filter.Until > 0 {
+		tx = tx.Where("messages.created_at <= ?", filter.Until)
+	}
+	if filter.Archived != nil {
+		tx = tx.Where("COALESCE(conversations.is_archived, 0) = ?", *filter.Archived)
+	}
+	if filter.Owner != nil {
+		tx = tx.Where("conversations.tenant_id = ?", filter.Owner.TenantID)
+		if filter.Owner.UserID != "" {
+			tx = tx.Where("conversations.user_id = ?", filter.Owner.UserID)
+		}
+	}
+	if filter.Pinned != nil {
+		tx = tx.Where("COALESCE(conversations.is_pinned, 0) = ?", *filter.Pinned)
+	}
+
+	var total int64
+	if err := tx.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		if r.logger != nil {
+			r.logger.Error("统计检索结果失败: %v", err)
+		}
+		return nil, err
+	}
+
+	var rows []*searchRow
+	err := tx.Select("messages.msg_id, messages.conversation_id, messages.role, messages.content, messages.created_at, "+matchExpr+" AS score", query).
+		Order("score DESC").
+		Order("messages.created_at DESC").
+		Offset(filter.Offset).
+		Limit(limit).
+		Find(&rows).Error
+	if err != nil {
+		if r.logger != nil {
+			r.logger.Error("检索消息失败: %v", err)
+		}
+		return nil, err
+	}
+
+	terms := fulltext.Tokenize(query)
+	result := &models.SearchResult{Total: total}
+	for _, row := range rows {
+		result.Hits = append(result.Hits, &models.SearchHit{
+			MsgID:          row.MsgID,
+			ConversationID: row.ConversationID,
+			Role:           row.Role,
+			Snippet:        fulltext.Snippet(row.Content, terms, 0),
+			Score:          row.Score,
+			CreatedAt:      row.CreatedAt,
+		})
+	}
+
+	if r.logger != nil {
+		r.logger.Info("检索 %q 命中 %d 条消息", query, total)
+	}
+	return result, nil
+}
@@ -0,0 +1,160 @@
+package mysql
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hildam/eino-history/model"
+	"github.com/hildam/eino-history/store/common/logger"
+	"github.com/hildam/eino-history/store/interfaces"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TagStore 实现TagStore接口的MySQL实现
+type TagStore struct {
+	db     *gorm.DB
+	logger *logger.Logger
+}
+
+// NewTagStore 创建MySQL标签存储库实例
+func NewTagStore(db *gorm.DB) interfaces.TagStore {
+	return &TagStore{db: db}
+}
+
+// SetLogger 设置日志记录器
+func (r *TagStore) SetLogger(logger *logger.Logger) {
+	r.logger = logger
+}
+
+// tagNameTaken 判断同一归属内是否已有同名标签，excludeID 为重命名时的标签自身
+func tagNameTaken(tx *gorm.DB, tenantID, userID, name, excludeID string) (bool, error) {
+	var count int64
+	err := tx.Model(&models.Tag{}).
+		Where("tenant_id = ? AND user_id = ? AND name = ? AND tag_id <> ?", tenantID, userID, name, excludeID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// Create 创建标签
+func (r *TagStore) Create(tag *models.Tag) error {
+	if tag.TagID == "" {
+		tag.TagID = uuid.NewString()
+	}
+	if tag.CreatedAt == 0 {
+		tag.CreatedAt = time.Now().Unix()
+	}
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		taken, err := tagNameTaken(tx, tag.TenantID, tag.UserID, tag.Name, tag.TagID)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return models.ErrNameConflict
+		}
+		return nameConflict(tx, tx.Create(tag).Error, "idx_tags_owner_name")
+	})
+	if err == nil && r.logger != nil {
+		r.logger.Info("标签 %s 创建成功", tag.TagID)
+	}
+	return err
+}
+
+// GetByID 根据ID获取标签
+func (r *TagStore) GetByID(tagID string) (*models.Tag, error) {
+	var tag models.Tag
+	if err := r.db.Where("tag_id = ?", tagID).First(&tag).Error; err != nil {
+		if r.logger != nil {
+			r.logger.Error("获取标签 %s 失败: %v", tagID, err)
+		}
+		return nil, err
+	}
+	return &tag, nil
+}
+
+// List 获取指定归属的全部标签
+func (r *TagStore) List(tenantID, userID string) ([]*models.Tag, error) {
+	var tags []*models.Tag
+	err := r.db.Where("tenant_id = ? AND user_id = ?", tenantID, userID).
+		Order("name ASC").
+		Find(&tags).Error
+	return tags, err
+}
+
+// Rename 重命名标签
+func (r *TagStore) Rename(tagID, name string) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var tag models.Tag
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("tag_id = ?", tagID).Take(&tag).Error; err != nil {
+			return err
+		}
+		taken, err := tagNameTaken(tx, tag.TenantID, tag.UserID, name, tagID)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return models.ErrNameConflict
+		}
+		err = tx.Model(&models.Tag{}).Where("tag_id = ?", tagID).Update("name", name).Error
+		return nameConflict(tx, err, "idx_tags_owner_name")
+	})
+	if err == nil && r.logger != nil {
+		r.logger.Info("标签 %s 重命名为 %s", tagID, name)
+	}
+	return err
+}
+
+// Delete 删除标签及其全部会话关联
+func (r *TagStore) Delete(tagID string) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("tag_id = ?", tagID).Delete(&models.ConversationTag{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("tag_id = ?", tagID).Delete(&models.Tag{}).Error
+	})
+	if err == nil && r.logger != nil {
+		r.logger.Info("标签 %s 删除成功", tagID)
+	}
+	return err
+}
+
+// AddToConversation 为会话添加标签
+func (r *TagStore) AddToConversation(convID, tagID string) error {
+	if _, err := r.GetByID(tagID); err != nil {
+		return err
+	}
+	link := &models.ConversationTag{ConversationID: convID, TagID: tagID, CreatedAt: time.Now().Unix()}
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(link).Error
+}
+
+// RemoveFromConversation 移除会话的标签
+func (r *TagStore) RemoveFromConversation(convID, tagID string) error {
+	return r.db.Where("conversation_id = ? AND tag_id = ?", convID, tagID).Delete(&models.ConversationTag{}).Error
+}
+
+// ListByConversation 获取会话的全部标签
+func (r *TagStore) ListByConversation(convID string) ([]*models.Tag, error) {
+	var tags []*models.Tag
+	err := r.db.Joins("JOIN conversation_tags ON conversation_tags.tag_id = tags.tag_id").
+		Where("conversation_tags.conversation_id = ?", convID).
+		Order("tags.name ASC").
+		Find(&tags).Error
+	return tags, err
+}
+
+// ListConversations 按更新时间降序获取带有标签的会话
+func (r *TagStore) ListConversations(tagID string, offset, limit int) ([]*models.Conversation, error) {
+	var convs []*models.Conversation
+	err := r.db.Joins("JOIN conversation_tags ON conversation_tags.conversation_id = conversations.conv_id").
+		Where("conversation_tags.tag_id = ? AND conversations.deleted_at = 0", tagID).
+		Order("conversations.updated_at DESC").
+		Order("conversations.id DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&convs).Error
+	if err == nil && r.logger != nil {
+		r.logger.Debug("查询到标签 %s 的 %d 个会话", tagID, len(convs))
+	}
+	return convs, err
+}
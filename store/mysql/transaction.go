@@ -0,0 +1,62 @@
+package mysql
+
+import (
+	"github.com/hildam/eino-history/store/common/logger"
+	"github.com/hildam/eino-history/store/interfaces"
+	"gorm.io/gorm"
+)
+
+// txStores 绑定到同一个 GORM 事务的存储库
+// 存储库方法内部的事务在外层事务中以保存点执行，随外层事务一起提交或回滚
+type txStores struct {
+	messageRepo           *MessageStore
+	conversationRepo      *ConversationStore
+	attachmentRepo        *AttachmentStore
+	messageAttachmentRepo *MessageAttachmentStore
+}
+
+// newTxStores 创建绑定到事务 tx 的存储库
+func newTxStores(tx *gorm.DB, logger *logger.Logger) *txStores {
+	return &txStores{
+		messageRepo:           &MessageStore{db: tx, logger: logger},
+		conversationRepo:      &ConversationStore{db: tx, logger: logger},
+		attachmentRepo:        &AttachmentStore{db: tx, logger: logger},
+		messageAttachmentRepo: &MessageAttachmentStore{db: tx, logger: logger},
+	}
+}
+
+// GetMessageStore 获取事务内的消息存储库
+func (s *txStores) GetMessageStore() interfaces.MessageStore {
+	return s.messageRepo
+}
+
+// GetConversationStore 获取事务内的对话存储库
+func (s *txStores) GetConversationStore() interfaces.ConversationStore {
+	return s.conversationRepo
+}
+
+// GetAttachmentStore 获取事务内的附件存储库
+func (s *txStores) GetAttachmentStore() interfaces.AttachmentStore {
+	return s.attachmentRepo
+}
+
+// GetMessageAttachmentStore 获取事务内的消息附件关联存储库
+func (s *txStores) GetMessageAttachmentStore() interfaces.MessageAttachmentStore {
+	return s.messageAttachmentRepo
+}
+
+// Transaction 在 GORM 事务中执行 fn，fn 返回错误或发生 panic 时回滚
+// 参数:
+//   - fn: 使用事务内存储库执行写入的函数
+//
+// 返回:
+//   - error: fn 返回的错误，或提交过程中发生的错误
+func (p *Provider) Transaction(fn func(tx interfaces.TxStores) error) error {
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		return fn(newTxStores(tx, p.logger))
+	})
+	if err != nil {
+		p.logger.Error("事务已回滚: %v", err)
+	}
+	return err
+}
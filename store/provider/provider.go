@@ -24,6 +24,25 @@ type Provider interface {
 	GetAttachmentStore() interfaces.AttachmentStore
 	// GetMessageAttachmentStore 获取消息附件关联存储库
 	GetMessageAttachmentStore() interfaces.MessageAttachmentStore
+	// GetSearchStore 获取全文检索存储库
+	GetSearchStore() interfaces.SearchStore
+	// GetEmbeddingStore 获取向量存储库
+	GetEmbeddingStore() interfaces.EmbeddingStore
+	// GetFeedbackStore 获取消息评价存储库
+	GetFeedbackStore() interfaces.FeedbackStore
+	// GetTagStore 获取标签存储库
+	GetTagStore() interfaces.TagStore
+	// GetFolderStore 获取文件夹存储库
+	GetFolderStore() interfaces.FolderStore
+	// GetAuditStore 获取审计日志存储库
+	GetAuditStore() interfaces.AuditStore
+	// GetBlobStore 获取附件内容存储库
+	GetBlobStore() interfaces.BlobStore
+	// GetAttachmentChunkStore 获取附件文本分块存储库
+	GetAttachmentChunkStore() interfaces.AttachmentChunkStore
+	// Transaction 在事务中执行 fn，fn 通过 tx 获取的存储库的写入全部提交或全部回滚
+	// fn 返回错误或发生 panic 时回滚，返回 fn 的错误；事务外的存储库看不到也不参与该事务
+	Transaction(fn func(tx interfaces.TxStores) error) error
 	// Close 关闭数据库连接
 	Close() error
 }
@@ -0,0 +1,170 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/hildam/eino-history/model"
+	"github.com/hildam/eino-history/store/common/fulltext"
+)
+
+// watchRetries 乐观事务因并发写入失败时的最大重试次数
+const watchRetries = 10
+
+// watchTx 使用 WATCH/MULTI 执行乐观事务，被监视的 key 在提交前被修改时自动重试
+func watchTx(ctx context.Context, client *redis.Client, fn func(tx *redis.Tx) error, keys ...string) error {
+	for i := 0; i < watchRetries; i++ {
+		err := client.Watch(ctx, fn, keys...)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return fmt.Errorf("并发写入冲突，重试 %d 次后仍未成功", watchRetries)
+}
+
+// readConversation 读取会话，不存在时返回nil
+func readConversation(ctx context.Context, c redis.Cmdable, convID string) (*models.Conversation, error) {
+	data, err := c.Get(ctx, ConversationKeyPrefix+convID).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var conv models.Conversation
+	if err := json.Unmarshal(data, &conv); err != nil {
+		return nil, err
+	}
+	return &conv, nil
+}
+
+// readMessage 读取消息，不存在时返回nil
+func readMessage(ctx context.Context, c redis.Cmdable, msgID string) (*models.Message, error) {
+	data, err := c.Get(ctx, MessageKeyPrefix+msgID).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var msg models.Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// writeConversation 在事务中写入会话，并以更新时间刷新全局、租户和用户有序集合中的分数
+func writeConversation(ctx context.Context, pipe redis.Pipeliner, conv *models.Conversation) error {
+	data, err := json.Marshal(conv)
+	if err != nil {
+		return err
+	}
+	pipe.Set(ctx, ConversationKeyPrefix+conv.ConvID, data, 0)
+
+	z := &redis.Z{
+		Score:  float64(conv.UpdatedAt),
+		Member: conv.ConvID,
+	}
+	pipe.ZAdd(ctx, ConversationsKey, z)
+	for _, key := range ownerIndexKeys(conv.TenantID, conv.UserID) {
+		pipe.ZAdd(ctx, key, z)
+	}
+	return nil
+}
+
+// nextOrderSeq 返回会话中下一条消息的排序序号，取已分配的最大序号与会话消息列表中最大序号的较大者顺延，
+// 回收站中的消息恢复后不会与新消息的序号重复
+func nextOrderSeq(ctx context.Context, c redis.Cmdable, convID string) (int, error) {
+	seq, err := c.Get(ctx, ConversationOrderSeqPrefix+convID).Int()
+	if err == redis.Nil {
+		// 尚未记录已分配序号的会话，从回收站中的消息补齐
+		seq, err = maxTrashedOrderSeq(ctx, c, convID)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	top, err := c.ZRevRangeWithScores(ctx, ConversationMessagesPrefix+convID, 0, 0).Result()
+	if err != nil {
+		return 0, err
+	}
+	if len(top) > 0 {
+		seq = max(seq, int(top[0].Score))
+	}
+	return seq + 1, nil
+}
+
+// maxTrashedOrderSeq 返回会话在回收站中的消息的最大排序序号，回收站为空时返回0
+func maxTrashedOrderSeq(ctx context.Context, c redis.Cmdable, convID string) (int, error) {
+	msgIDs, err := c.ZRange(ctx, ConversationDeletedMessagesPrefix+convID, 0, -1).Result()
+	if err != nil {
+		return 0, err
+	}
+	msgs, err := readMessages(ctx, c, msgIDs)
+	if err != nil {
+		return 0, err
+	}
+	seq := 0
+	for _, msg := range msgs {
+		seq = max(seq, msg.OrderSeq)
+	}
+	return seq, nil
+}
+
+// refreshLastMessage 按消息有序集合的排序规则重新确定会话的最后一条消息
+// candidate 为即将写入的消息，可以为nil；exclude 为即将移除或改写的消息ID
+func refreshLastMessage(ctx context.Context, c redis.Cmdable, conv *models.Conversation,
+	candidate *models.Message, exclude string) error {
+	top, err := c.ZRevRangeWithScores(ctx, ConversationMessagesPrefix+conv.ConvID, 0, 1).Result()
+	if err != nil {
+		return err
+	}
+
+	var (
+		topID    string
+		topScore float64
+	)
+	for _, z := range top {
+		if id := z.Member.(string); id != exclude {
+			topID, topScore = id, z.Score
+			break
+		}
+	}
+
+	// 分数相同时有序集合按成员字典序排列，与之保持一致
+	if candidate != nil && (topID == "" || float64(candidate.OrderSeq) > topScore ||
+		(float64(candidate.OrderSeq) == topScore && candidate.MsgID > topID)) {
+		setLastMessage(conv, candidate)
+		return nil
+	}
+	if topID == conv.LastMessageID && topID != "" {
+		return nil
+	}
+
+	var last *models.Message
+	if topID != "" {
+		if last, err = readMessage(ctx, c, topID); err != nil {
+			return err
+		}
+	}
+	setLastMessage(conv, last)
+	return nil
+}
+
+// setLastMessage 将消息记录为会话的最后一条消息，msg为nil时清空
+func setLastMessage(conv *models.Conversation, msg *models.Message) {
+	if msg == nil {
+		conv.LastMessageID = ""
+		conv.LastMessageRole = ""
+		conv.LastMessagePreview = ""
+		conv.LastMessageAt = 0
+		return
+	}
+	conv.LastMessageID = msg.MsgID
+	conv.LastMessageRole = msg.Role
+	conv.LastMessagePreview = fulltext.Preview(msg.Content, models.ConversationPreviewLength)
+	conv.LastMessageAt = msg.CreatedAt
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"sort"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
@@ -14,6 +15,12 @@ import (
 
 const (
 	AttachmentPrefix = "attachment:"
+	// AttachmentHashPrefix 引用同一内容的附件ID集合，按内容哈希索引
+	AttachmentHashPrefix = "attachments:hash:"
+	// AttachmentIngestPrefix 处于同一摄取状态的附件ID集合，按摄取状态索引
+	AttachmentIngestPrefix = "attachments:ingest:"
+	// attachmentScanCount 扫描附件时每批的数量
+	attachmentScanCount = 500
 )
 
 // AttachmentStore Redis implementation
@@ -47,9 +54,12 @@ func (r *AttachmentStore) Create(attachment *models.Attachment) error {
 		return err
 	}
 
-	// 存储附件
+	// 存储附件并加入内容哈希和摄取状态索引
 	key := AttachmentPrefix + attachment.AttachID
-	if err := r.client.Set(ctx, key, data, 0).Err(); err != nil {
+	pipe := r.client.TxPipeline()
+	pipe.Set(ctx, key, data, 0)
+	indexAttachment(ctx, pipe, nil, attachment)
+	if _, err := pipe.Exec(ctx); err != nil {
 		if r.debug {
 			log.Printf("Redis错误: 保存附件失败: %v", err)
 		}
@@ -69,26 +79,39 @@ func (r *AttachmentStore) Update(attachment *models.Attachment) error {
 		return err
 	}
 
-	// 更新附件
+	// 更新附件，内容哈希或摄取状态变化时同步更新索引
 	key := AttachmentPrefix + attachment.AttachID
-	if err := r.client.Set(ctx, key, data, 0).Err(); err != nil {
+	return watchTx(ctx, r.client, func(tx *redis.Tx) error {
+		old, err := readAttachment(ctx, tx, attachment.AttachID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, 0)
+			indexAttachment(ctx, pipe, old, attachment)
+			return nil
+		})
 		return err
-	}
-
-	return nil
+	}, key)
 }
 
 // Delete deletes an attachment
 func (r *AttachmentStore) Delete(attachID string) error {
 	ctx := context.Background()
 
-	// 删除附件
+	// 删除附件并移出索引
 	key := AttachmentPrefix + attachID
-	if err := r.client.Del(ctx, key).Err(); err != nil {
+	return watchTx(ctx, r.client, func(tx *redis.Tx) error {
+		old, err := readAttachment(ctx, tx, attachID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			deleteAttachment(ctx, pipe, old, attachID)
+			return nil
+		})
 		return err
-	}
-
-	return nil
+	}, key)
 }
 
 // GetByID gets an attachment by ID
@@ -112,6 +135,39 @@ func (r *AttachmentStore) GetByID(attachID string) (*models.Attachment, error) {
 	return &attachment, nil
 }
 
+// GetByIDs 批量获取附件，分批 MGET 后按输入顺序排列
+func (r *AttachmentStore) GetByIDs(attachIDs []string) ([]*models.Attachment, error) {
+	ctx := context.Background()
+
+	result := make([]*models.Attachment, 0, len(attachIDs))
+	var failed []*models.BatchItemError
+	for start := 0; start < len(attachIDs); start += messageBatchSize {
+		ids := attachIDs[start:min(start+messageBatchSize, len(attachIDs))]
+		keys := make([]string, len(ids))
+		for i, attachID := range ids {
+			keys[i] = AttachmentPrefix + attachID
+		}
+		values, err := r.client.MGet(ctx, keys...).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		for i, v := range values {
+			data, ok := v.(string)
+			if !ok {
+				failed = append(failed, &models.BatchItemError{Index: start + i, ID: ids[i], Err: models.ErrNotFound})
+				continue
+			}
+			var attachment models.Attachment
+			if err := json.Unmarshal([]byte(data), &attachment); err != nil {
+				return nil, err
+			}
+			result = append(result, &attachment)
+		}
+	}
+	return result, models.NewBatchError(len(attachIDs), failed)
+}
+
 // ListByMessage gets attachments by message ID
 func (r *AttachmentStore) ListByMessage(messageID string) ([]*models.Attachment, error) {
 	ctx := context.Background()
@@ -159,3 +215,270 @@ func (r *AttachmentStore) ListByMessage(messageID string) ([]*models.Attachment,
 
 	return attachments, nil
 }
+
+// ListUnreferenced 扫描全部附件，返回没有消息关联且创建时间早于 before 的附件
+func (r *AttachmentStore) ListUnreferenced(before int64, limit int) ([]*models.Attachment, error) {
+	ctx := context.Background()
+
+	var attachments []*models.Attachment
+	iter := r.client.Scan(ctx, 0, AttachmentPrefix+"*", attachmentScanCount).Iterator()
+	var keys []string
+	flush := func() error {
+		if len(keys) == 0 {
+			return nil
+		}
+		values, err := r.client.MGet(ctx, keys...).Result()
+		keys = keys[:0]
+		if err != nil {
+			return err
+		}
+
+		var candidates []*models.Attachment
+		for _, v := range values {
+			data, ok := v.(string)
+			if !ok {
+				continue
+			}
+			var attachment models.Attachment
+			if err := json.Unmarshal([]byte(data), &attachment); err != nil {
+				return err
+			}
+			if attachment.CreatedAt < before {
+				candidates = append(candidates, &attachment)
+			}
+		}
+
+		pipe := r.client.Pipeline()
+		counts := make([]*redis.IntCmd, len(candidates))
+		for i, attachment := range candidates {
+			counts[i] = pipe.SCard(ctx, MessageAttachmentsKey+attachment.AttachID)
+		}
+		if len(candidates) > 0 {
+			if _, err := pipe.Exec(ctx); err != nil {
+				return err
+			}
+		}
+		for i, attachment := range candidates {
+			if counts[i].Val() == 0 {
+				attachments = append(attachments, attachment)
+			}
+		}
+		return nil
+	}
+
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) >= attachmentScanCount {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(attachments, func(i, j int) bool {
+		if attachments[i].CreatedAt != attachments[j].CreatedAt {
+			return attachments[i].CreatedAt < attachments[j].CreatedAt
+		}
+		return attachments[i].AttachID < attachments[j].AttachID
+	})
+	if limit > 0 && len(attachments) > limit {
+		attachments = attachments[:limit]
+	}
+	return attachments, nil
+}
+
+// DeleteUnreferenced 监视附件的关联集合，附件在判断后被关联时事务失败并重新判断
+func (r *AttachmentStore) DeleteUnreferenced(attachID string) (bool, error) {
+	ctx := context.Background()
+
+	deleted := false
+	linksKey := MessageAttachmentsKey + attachID
+	err := watchTx(ctx, r.client, func(tx *redis.Tx) error {
+		deleted = false
+		count, err := tx.SCard(ctx, linksKey).Result()
+		if err != nil || count > 0 {
+			return err
+		}
+		attachment, err := readAttachment(ctx, tx, attachID)
+		if err != nil || attachment == nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			deleteAttachment(ctx, pipe, attachment, attachID)
+			return nil
+		})
+		deleted = err == nil
+		return err
+	}, AttachmentPrefix+attachID, linksKey)
+	if err != nil && r.debug {
+		log.Printf("Redis错误: 删除附件 %s 失败: %v", attachID, err)
+	}
+	return deleted, err
+}
+
+// CountByContentHash 统计引用指定内容的附件数
+func (r *AttachmentStore) CountByContentHash(hash string) (int64, error) {
+	return r.client.SCard(context.Background(), AttachmentHashPrefix+hash).Result()
+}
+
+// SumSizeByConversation 从会话的消息和回收站消息出发，经消息附件关联读取附件并累加大小
+func (r *AttachmentStore) SumSizeByConversation(conversationID string) (int64, error) {
+	ctx := context.Background()
+
+	var msgIDs []string
+	for _, key := range []string{ConversationMessagesPrefix + conversationID, ConversationDeletedMessagesPrefix + conversationID} {
+		ids, err := r.client.ZRange(ctx, key, 0, -1).Result()
+		if err != nil {
+			return 0, err
+		}
+		msgIDs = append(msgIDs, ids...)
+	}
+	if len(msgIDs) == 0 {
+		return 0, nil
+	}
+
+	// 读取每条消息的关联记录ID
+	pipe := r.client.Pipeline()
+	linkSets := make([]*redis.StringSliceCmd, len(msgIDs))
+	for i, msgID := range msgIDs {
+		linkSets[i] = pipe.SMembers(ctx, MessageAttachmentsKey+msgID)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	var linkKeys []string
+	for _, cmd := range linkSets {
+		for _, id := range cmd.Val() {
+			linkKeys = append(linkKeys, MessageAttachmentPrefix+id)
+		}
+	}
+	if len(linkKeys) == 0 {
+		return 0, nil
+	}
+
+	// 读取关联记录得到去重后的附件ID
+	links, err := r.client.MGet(ctx, linkKeys...).Result()
+	if err != nil {
+		return 0, err
+	}
+	seen := make(map[string]bool)
+	var attachKeys []string
+	for _, v := range links {
+		data, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var link models.MessageAttachment
+		if err := json.Unmarshal([]byte(data), &link); err != nil {
+			return 0, err
+		}
+		if !seen[link.AttachmentID] {
+			seen[link.AttachmentID] = true
+			attachKeys = append(attachKeys, AttachmentPrefix+link.AttachmentID)
+		}
+	}
+	if len(attachKeys) == 0 {
+		return 0, nil
+	}
+
+	values, err := r.client.MGet(ctx, attachKeys...).Result()
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, v := range values {
+		data, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var attachment models.Attachment
+		if err := json.Unmarshal([]byte(data), &attachment); err != nil {
+			return 0, err
+		}
+		total += attachment.FileSize
+	}
+	return total, nil
+}
+
+// readAttachment 读取附件，不存在时返回nil
+func readAttachment(ctx context.Context, c redis.Cmdable, attachID string) (*models.Attachment, error) {
+	data, err := c.Get(ctx, AttachmentPrefix+attachID).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var attachment models.Attachment
+	if err := json.Unmarshal(data, &attachment); err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// deleteAttachment 在事务中删除附件并移出索引，attachment 为nil时只删除附件
+func deleteAttachment(ctx context.Context, pipe redis.Pipeliner, attachment *models.Attachment, attachID string) {
+	pipe.Del(ctx, AttachmentPrefix+attachID)
+	indexAttachment(ctx, pipe, attachment, nil)
+}
+
+// indexAttachment 在事务中把附件从旧值的索引移到新值的索引，old 或 cur 为nil时只移出或只加入
+func indexAttachment(ctx context.Context, pipe redis.Pipeliner, old, cur *models.Attachment) {
+	var oldHash, oldStatus, curHash, curStatus, attachID string
+	if old != nil {
+		oldHash, oldStatus, attachID = old.ContentHash, old.IngestStatus, old.AttachID
+	}
+	if cur != nil {
+		curHash, curStatus, attachID = cur.ContentHash, cur.IngestStatus, cur.AttachID
+	}
+	if oldHash != "" && oldHash != curHash {
+		pipe.SRem(ctx, AttachmentHashPrefix+oldHash, attachID)
+	}
+	if curHash != "" {
+		pipe.SAdd(ctx, AttachmentHashPrefix+curHash, attachID)
+	}
+	if oldStatus != "" && oldStatus != curStatus {
+		pipe.SRem(ctx, AttachmentIngestPrefix+oldStatus, attachID)
+	}
+	if curStatus != "" {
+		pipe.SAdd(ctx, AttachmentIngestPrefix+curStatus, attachID)
+	}
+}
+
+// ListByIngestStatus 获取指定摄取状态的附件
+func (r *AttachmentStore) ListByIngestStatus(status string, limit int) ([]*models.Attachment, error) {
+	ctx := context.Background()
+
+	ids, err := r.client.SMembers(ctx, AttachmentIngestPrefix+status).Result()
+	if err != nil {
+		return nil, err
+	}
+	attachments := make([]*models.Attachment, 0, len(ids))
+	for _, id := range ids {
+		attachment, err := readAttachment(ctx, r.client, id)
+		if err != nil {
+			return nil, err
+		}
+		// 索引与附件不一致时以附件为准
+		if attachment != nil && attachment.IngestStatus == status {
+			attachments = append(attachments, attachment)
+		}
+	}
+
+	sort.Slice(attachments, func(i, j int) bool {
+		if attachments[i].CreatedAt != attachments[j].CreatedAt {
+			return attachments[i].CreatedAt < attachments[j].CreatedAt
+		}
+		return attachments[i].AttachID < attachments[j].AttachID
+	})
+	if limit > 0 && len(attachments) > limit {
+		attachments = attachments[:limit]
+	}
+	return attachments, nil
+}
@@ -0,0 +1,113 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/hildam/eino-history/model"
+	"github.com/hildam/eino-history/store/common/logger"
+	"github.com/hildam/eino-history/store/interfaces"
+)
+
+// AttachmentChunksPrefix 附件分块列表，元素为分块的JSON，按序号排列
+const AttachmentChunksPrefix = "attachment_chunks:"
+
+// AttachmentChunkStore 实现AttachmentChunkStore接口的Redis实现
+type AttachmentChunkStore struct {
+	client *redis.Client
+	debug  bool
+	logger *logger.Logger
+}
+
+// NewAttachmentChunkStore 创建Redis附件文本分块存储库实例
+func NewAttachmentChunkStore(client *redis.Client, debug bool) interfaces.AttachmentChunkStore {
+	return &AttachmentChunkStore{
+		client: client,
+		debug:  debug,
+	}
+}
+
+// SetLogger 设置日志记录器
+func (r *AttachmentChunkStore) SetLogger(logger *logger.Logger) {
+	r.logger = logger
+}
+
+// Replace 在事务中删除旧列表并写入新分块
+func (r *AttachmentChunkStore) Replace(attachmentID string, chunks []*models.AttachmentChunk) error {
+	ctx := context.Background()
+
+	now := time.Now().Unix()
+	values := make([]interface{}, 0, len(chunks))
+	for i, chunk := range chunks {
+		chunk.ID = uint64(i + 1)
+		chunk.AttachmentID = attachmentID
+		chunk.Seq = i
+		if chunk.CreatedAt == 0 {
+			chunk.CreatedAt = now
+		}
+		data, err := json.Marshal(chunk)
+		if err != nil {
+			return err
+		}
+		values = append(values, data)
+	}
+
+	key := AttachmentChunksPrefix + attachmentID
+	pipe := r.client.TxPipeline()
+	pipe.Del(ctx, key)
+	if len(values) > 0 {
+		pipe.RPush(ctx, key, values...)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		r.logError("保存附件 %s 的分块失败: %v", attachmentID, err)
+		return err
+	}
+
+	if r.logger != nil {
+		r.logger.Info("附件 %s 的 %d 个分块保存成功", attachmentID, len(chunks))
+	}
+	return nil
+}
+
+// ListByAttachment 获取附件的全部分块
+func (r *AttachmentChunkStore) ListByAttachment(attachmentID string) ([]*models.AttachmentChunk, error) {
+	ctx := context.Background()
+
+	values, err := r.client.LRange(ctx, AttachmentChunksPrefix+attachmentID, 0, -1).Result()
+	if err != nil {
+		r.logError("获取附件 %s 的分块失败: %v", attachmentID, err)
+		return nil, err
+	}
+	chunks := make([]*models.AttachmentChunk, 0, len(values))
+	for _, v := range values {
+		var chunk models.AttachmentChunk
+		if err := json.Unmarshal([]byte(v), &chunk); err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, &chunk)
+	}
+	return chunks, nil
+}
+
+// DeleteByAttachment 删除附件的全部分块
+func (r *AttachmentChunkStore) DeleteByAttachment(attachmentID string) error {
+	ctx := context.Background()
+
+	if err := r.client.Del(ctx, AttachmentChunksPrefix+attachmentID).Err(); err != nil {
+		r.logError("删除附件 %s 的分块失败: %v", attachmentID, err)
+		return err
+	}
+	if r.logger != nil {
+		r.logger.Info("附件 %s 的分块删除成功", attachmentID)
+	}
+	return nil
+}
+
+// logError 记录错误日志
+func (r *AttachmentChunkStore) logError(format string, args ...interface{}) {
+	if r.logger != nil {
+		r.logger.Error(format, args...)
+	}
+}
@@ -0,0 +1,257 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/hildam/eino-history/model"
+	"github.com/hildam/eino-history/store/common/logger"
+	"github.com/hildam/eino-history/store/interfaces"
+)
+
+// Redis key patterns
+const (
+	// AuditEventsKey 审计事件哈希，字段为补零的序号，值为事件JSON
+	AuditEventsKey = "audit:events"
+	// AuditHeadKey 链上最后一条事件
+	AuditHeadKey = "audit:head"
+	// AuditTimeKey 全部事件的时间索引，分数为创建时间，成员为补零的序号
+	AuditTimeKey = "audit:time"
+	// AuditTenantPrefix 租户的事件时间索引
+	AuditTenantPrefix = "audit:tenant:"
+	// AuditActorPrefix 操作者的事件时间索引
+	AuditActorPrefix = "audit:actor:"
+	// AuditConversationPrefix 会话的事件时间索引
+	AuditConversationPrefix = "audit:conversation:"
+)
+
+const (
+	// auditAppendAttempts 并发追加冲突时的最大尝试轮数，每轮内部还会按 watchRetries 重试
+	auditAppendAttempts = 5
+	// auditScanBatch 查询时每批读取的事件数量
+	auditScanBatch = 500
+)
+
+// auditMember 序号补零后作为有序集合成员，创建时间相同时按字典序即为序号顺序
+func auditMember(seq int64) string {
+	return fmt.Sprintf("%020d", seq)
+}
+
+// AuditStore 实现AuditStore接口的Redis实现
+type AuditStore struct {
+	client *redis.Client
+	debug  bool
+	logger *logger.Logger
+}
+
+// NewAuditStore 创建Redis审计日志存储库实例
+func NewAuditStore(client *redis.Client, debug bool) interfaces.AuditStore {
+	return &AuditStore{
+		client: client,
+		debug:  debug,
+	}
+}
+
+// SetLogger 设置日志记录器
+func (r *AuditStore) SetLogger(logger *logger.Logger) {
+	r.logger = logger
+}
+
+// Append 追加审计事件，监视链头保证并发追加时链不会分叉
+func (r *AuditStore) Append(event *models.AuditEvent) error {
+	ctx := context.Background()
+
+	if event.EventID == "" {
+		event.EventID = uuid.NewString()
+	}
+	if event.CreatedAt == 0 {
+		event.CreatedAt = time.Now().Unix()
+	}
+
+	var err error
+	for attempt := 0; attempt < auditAppendAttempts; attempt++ {
+		err = watchTx(ctx, r.client, func(tx *redis.Tx) error {
+			prev, err := readAuditHead(ctx, tx)
+			if err != nil {
+				return err
+			}
+			event.Chain(prev)
+			data, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+
+			member := auditMember(event.Seq)
+			z := &redis.Z{Score: float64(event.CreatedAt), Member: member}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.HSet(ctx, AuditEventsKey, member, data)
+				pipe.Set(ctx, AuditHeadKey, data, 0)
+				pipe.ZAdd(ctx, AuditTimeKey, z)
+				if event.TenantID != "" {
+					pipe.ZAdd(ctx, AuditTenantPrefix+event.TenantID, z)
+				}
+				if event.Actor != "" {
+					pipe.ZAdd(ctx, AuditActorPrefix+event.Actor, z)
+				}
+				if event.ConversationID != "" {
+					pipe.ZAdd(ctx, AuditConversationPrefix+event.ConversationID, z)
+				}
+				return nil
+			})
+			return err
+		}, AuditHeadKey)
+		if err == nil {
+			return nil
+		}
+	}
+	r.logError("追加审计事件 %s 失败: %v", event.Action, err)
+	return err
+}
+
+// Query 按条件查询审计事件，使用最具选择性的时间索引读取后在内存中过滤其余条件
+func (r *AuditStore) Query(query *models.AuditQuery) ([]*models.AuditEvent, error) {
+	ctx := context.Background()
+
+	key := AuditTimeKey
+	switch {
+	case query.ConversationID != "":
+		key = AuditConversationPrefix + query.ConversationID
+	case query.Actor != "":
+		key = AuditActorPrefix + query.Actor
+	case query.TenantID != "":
+		key = AuditTenantPrefix + query.TenantID
+	}
+	min, max := "-inf", "+inf"
+	if query.Since > 0 {
+		min = strconv.FormatInt(query.Since, 10)
+	}
+	if query.Until > 0 {
+		max = strconv.FormatInt(query.Until, 10)
+	}
+
+	events := make([]*models.AuditEvent, 0)
+	skip := query.Offset
+	for offset := int64(0); ; offset += auditScanBatch {
+		by := &redis.ZRangeBy{Min: min, Max: max, Offset: offset, Count: auditScanBatch}
+		var members []string
+		var err error
+		if query.Desc {
+			members, err = r.client.ZRevRangeByScore(ctx, key, by).Result()
+		} else {
+			members, err = r.client.ZRangeByScore(ctx, key, by).Result()
+		}
+		if err != nil {
+			r.logError("查询审计事件失败: %v", err)
+			return nil, err
+		}
+
+		batch, err := readAuditEvents(ctx, r.client, members)
+		if err != nil {
+			r.logError("读取审计事件失败: %v", err)
+			return nil, err
+		}
+		for _, event := range batch {
+			if !query.Match(event) {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			events = append(events, event)
+			if query.Limit > 0 && len(events) >= query.Limit {
+				return events, nil
+			}
+		}
+		if len(members) < auditScanBatch {
+			return events, nil
+		}
+	}
+}
+
+// Range 按序号升序读取链上的事件
+func (r *AuditStore) Range(afterSeq int64, limit int) ([]*models.AuditEvent, error) {
+	ctx := context.Background()
+
+	head, err := readAuditHead(ctx, r.client)
+	if err != nil {
+		r.logError("读取审计链头失败: %v", err)
+		return nil, err
+	}
+	if head == nil || afterSeq >= head.Seq {
+		return []*models.AuditEvent{}, nil
+	}
+
+	if limit <= 0 {
+		limit = auditScanBatch
+	}
+	// 被删除的事件会被跳过，逐段读取直到读到事件或到达链头，由校验方根据序号发现缺口
+	for start := afterSeq + 1; start <= head.Seq; start += int64(limit) {
+		end := start + int64(limit) - 1
+		if end > head.Seq {
+			end = head.Seq
+		}
+		members := make([]string, 0, end-start+1)
+		for seq := start; seq <= end; seq++ {
+			members = append(members, auditMember(seq))
+		}
+		events, err := readAuditEvents(ctx, r.client, members)
+		if err != nil || len(events) > 0 {
+			return events, err
+		}
+	}
+	return []*models.AuditEvent{}, nil
+}
+
+// readAuditHead 读取链上最后一条事件，链为空时返回nil
+func readAuditHead(ctx context.Context, c redis.Cmdable) (*models.AuditEvent, error) {
+	data, err := c.Get(ctx, AuditHeadKey).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var event models.AuditEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// readAuditEvents 使用HMGET批量读取事件，保持成员顺序，不存在的事件会被跳过
+func readAuditEvents(ctx context.Context, c redis.Cmdable, members []string) ([]*models.AuditEvent, error) {
+	events := make([]*models.AuditEvent, 0, len(members))
+	if len(members) == 0 {
+		return events, nil
+	}
+
+	values, err := c.HMGet(ctx, AuditEventsKey, members...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range values {
+		data, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var event models.AuditEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return nil, err
+		}
+		events = append(events, &event)
+	}
+	return events, nil
+}
+
+// logError 记录错误日志
+func (r *AuditStore) logError(format string, args ...interface{}) {
+	if r.logger != nil {
+		r.logger.Error(format, args...)
+	}
+}
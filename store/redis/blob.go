@@ -0,0 +1,234 @@
+package redis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/hildam/eino-history/model"
+	"github.com/hildam/eino-history/store/common/logger"
+	"github.com/hildam/eino-history/store/interfaces"
+)
+
+// Redis key patterns
+const (
+	// BlobKeyPrefix 内容信息哈希，字段为 size、chunks、created_at 和 touched_at
+	BlobKeyPrefix = "blob:"
+	// BlobDataPrefix 内容分块列表
+	BlobDataPrefix = "blob:data:"
+)
+
+// BlobStore 实现BlobStore接口的Redis实现，内容按 models.BlobChunkSize 分块保存在列表中
+type BlobStore struct {
+	client *redis.Client
+	debug  bool
+	logger *logger.Logger
+}
+
+// NewBlobStore 创建Redis附件内容存储实例
+func NewBlobStore(client *redis.Client, debug bool) interfaces.BlobStore {
+	return &BlobStore{
+		client: client,
+		debug:  debug,
+	}
+}
+
+// SetLogger 设置日志记录器
+func (r *BlobStore) SetLogger(logger *logger.Logger) {
+	r.logger = logger
+}
+
+// Put 读取全部内容后计算哈希，内容不存在时在事务中写入分块和内容信息
+func (r *BlobStore) Put(reader io.Reader, maxSize int64) (*models.BlobInfo, error) {
+	ctx := context.Background()
+
+	data, hash, err := models.ReadBlob(reader, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := r.touch(ctx, hash); err == nil {
+		return info, nil
+	} else if !errors.Is(err, models.ErrBlobNotFound) {
+		return nil, err
+	}
+
+	chunks := make([]interface{}, 0, len(data)/models.BlobChunkSize+1)
+	for start := 0; start < len(data); start += models.BlobChunkSize {
+		end := start + models.BlobChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		chunks = append(chunks, data[start:end])
+	}
+	info := &models.BlobInfo{
+		Hash:        hash,
+		Size:        int64(len(data)),
+		StorageType: models.StorageTypeBlob,
+		Path:        hash,
+		CreatedAt:   time.Now().Unix(),
+	}
+	info.TouchedAt = info.CreatedAt
+
+	// 并发写入相同内容时事务整体覆盖，结果一致
+	pipe := r.client.TxPipeline()
+	pipe.Del(ctx, BlobDataPrefix+hash)
+	if len(chunks) > 0 {
+		pipe.RPush(ctx, BlobDataPrefix+hash, chunks...)
+	}
+	pipe.HSet(ctx, BlobKeyPrefix+hash, "size", info.Size, "chunks", len(chunks), "created_at", info.CreatedAt, "touched_at", info.TouchedAt)
+	if _, err := pipe.Exec(ctx); err != nil {
+		r.logError("保存内容 %s 失败: %v", hash, err)
+		return nil, err
+	}
+
+	if r.logger != nil {
+		r.logger.Info("内容 %s 保存成功，大小 %d", hash, info.Size)
+	}
+	return info, nil
+}
+
+// touch 内容已存在时在乐观事务中刷新最近写入时间，避免回收在附件记录创建前删除内容，返回的内容信息标记为去重
+func (r *BlobStore) touch(ctx context.Context, hash string) (*models.BlobInfo, error) {
+	key := BlobKeyPrefix + hash
+	err := watchTx(ctx, r.client, func(tx *redis.Tx) error {
+		exists, err := tx.Exists(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		if exists == 0 {
+			return models.ErrBlobNotFound
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, key, "touched_at", time.Now().Unix())
+			return nil
+		})
+		return err
+	}, key)
+	if err != nil {
+		if !errors.Is(err, models.ErrBlobNotFound) {
+			r.logError("刷新内容 %s 的写入时间失败: %v", hash, err)
+		}
+		return nil, err
+	}
+	info, err := r.Stat(hash)
+	if err != nil {
+		return nil, err
+	}
+	info.Deduplicated = true
+	return info, nil
+}
+
+// Get 返回按分块逐块读取的读取器
+func (r *BlobStore) Get(hash string) (io.ReadCloser, error) {
+	count, err := r.chunkCount(hash)
+	if err != nil {
+		return nil, err
+	}
+	return &chunkReader{client: r.client, key: BlobDataPrefix + hash, count: count}, nil
+}
+
+// Stat 获取内容信息
+func (r *BlobStore) Stat(hash string) (*models.BlobInfo, error) {
+	ctx := context.Background()
+
+	if !models.ValidBlobHash(hash) {
+		return nil, models.ErrBlobNotFound
+	}
+	fields, err := r.client.HGetAll(ctx, BlobKeyPrefix+hash).Result()
+	if err != nil {
+		r.logError("获取内容 %s 失败: %v", hash, err)
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, models.ErrBlobNotFound
+	}
+	size, _ := strconv.ParseInt(fields["size"], 10, 64)
+	createdAt, _ := strconv.ParseInt(fields["created_at"], 10, 64)
+	touchedAt, _ := strconv.ParseInt(fields["touched_at"], 10, 64)
+	return &models.BlobInfo{
+		Hash:        hash,
+		Size:        size,
+		StorageType: models.StorageTypeBlob,
+		Path:        hash,
+		CreatedAt:   createdAt,
+		TouchedAt:   max(touchedAt, createdAt),
+	}, nil
+}
+
+// Delete 删除内容信息及其全部分块
+func (r *BlobStore) Delete(hash string) error {
+	ctx := context.Background()
+
+	if !models.ValidBlobHash(hash) {
+		return models.ErrBlobNotFound
+	}
+	if err := r.client.Del(ctx, BlobKeyPrefix+hash, BlobDataPrefix+hash).Err(); err != nil {
+		r.logError("删除内容 %s 失败: %v", hash, err)
+		return err
+	}
+	if r.logger != nil {
+		r.logger.Info("内容 %s 删除成功", hash)
+	}
+	return nil
+}
+
+// chunkCount 获取内容的分块数，不存在时返回 models.ErrBlobNotFound
+func (r *BlobStore) chunkCount(hash string) (int64, error) {
+	if !models.ValidBlobHash(hash) {
+		return 0, models.ErrBlobNotFound
+	}
+	count, err := r.client.HGet(context.Background(), BlobKeyPrefix+hash, "chunks").Int64()
+	if err == redis.Nil {
+		return 0, models.ErrBlobNotFound
+	}
+	if err != nil {
+		r.logError("获取内容 %s 失败: %v", hash, err)
+	}
+	return count, err
+}
+
+// logError 记录错误日志
+func (r *BlobStore) logError(format string, args ...interface{}) {
+	if r.logger != nil {
+		r.logger.Error(format, args...)
+	}
+}
+
+// chunkReader 按序号逐块加载分块的读取器
+type chunkReader struct {
+	client *redis.Client
+	key    string
+	count  int64
+	next   int64
+	buf    bytes.Reader
+}
+
+// Read 当前分块读完后加载下一个分块
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for c.buf.Len() == 0 {
+		if c.next >= c.count {
+			return 0, io.EOF
+		}
+		chunk, err := c.client.LIndex(context.Background(), c.key, c.next).Bytes()
+		if err == redis.Nil {
+			return 0, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		c.buf.Reset(chunk)
+		c.next++
+	}
+	return c.buf.Read(p)
+}
+
+// Close 关闭读取器
+func (c *chunkReader) Close() error {
+	c.next = c.count
+	c.buf.Reset(nil)
+	return nil
+}
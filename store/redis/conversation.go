@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"strconv"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -14,8 +15,21 @@ import (
 
 const (
 	ConversationKeyPrefix = "conversation:"
+	// ConversationsKey 全部会话的有序集合，按更新时间排序
+	ConversationsKey = "conversations"
+	// TenantConversationsPrefix 租户会话的有序集合，用户会话使用 <前缀><租户ID>:user:<用户ID>
+	TenantConversationsPrefix = "conversations:tenant:"
 )
 
+// ownerIndexKeys 返回会话所属的租户和用户有序集合
+func ownerIndexKeys(tenantID, userID string) []string {
+	keys := []string{TenantConversationsPrefix + tenantID}
+	if userID != "" {
+		keys = append(keys, TenantConversationsPrefix+tenantID+":user:"+userID)
+	}
+	return keys
+}
+
 // ConversationStore 实现ConversationStore接口的Redis实现
 type ConversationStore struct {
 	client *redis.Client
@@ -42,23 +56,12 @@ func (r *ConversationStore) Create(conv *models.Conversation) error {
 		conv.UpdatedAt = time.Now().Unix()
 	}
 
-	// 转换会话为JSON
-	data, err := json.Marshal(conv)
-	if err != nil {
-		return err
-	}
-
-	// 存储会话
-	key := ConversationKeyPrefix + conv.ConvID
-	if err := r.client.Set(ctx, key, data, 0).Err(); err != nil {
+	// 存储会话并添加到有序集合供列表查询
+	pipe := r.client.TxPipeline()
+	if err := writeConversation(ctx, pipe, conv); err != nil {
 		return err
 	}
-
-	// 添加到有序集合供列表查询
-	if err := r.client.ZAdd(ctx, "conversations", &redis.Z{
-		Score:  float64(conv.UpdatedAt),
-		Member: conv.ConvID,
-	}).Err(); err != nil {
+	if _, err := pipe.Exec(ctx); err != nil {
 		return err
 	}
 
@@ -68,68 +71,325 @@ func (r *ConversationStore) Create(conv *models.Conversation) error {
 	return nil
 }
 
-// Update 更新会话
+// Update 更新会话，活动字段由消息写入维护，保留存储中的值，回收站中的会话不能更新
 func (r *ConversationStore) Update(conv *models.Conversation) error {
+	return r.update(conv, false)
+}
+
+// CompareAndUpdate 在乐观事务中比较版本号，一致时更新会话
+func (r *ConversationStore) CompareAndUpdate(conv *models.Conversation) error {
+	return r.update(conv, true)
+}
+
+// update 在乐观事务中写入会话并递增版本号，保留活动字段，check 为true时先比较版本号
+func (r *ConversationStore) update(conv *models.Conversation, check bool) error {
 	ctx := context.Background()
 
-	conv.UpdatedAt = time.Now().Unix()
+	key := ConversationKeyPrefix + conv.ConvID
+	return watchTx(ctx, r.client, func(tx *redis.Tx) error {
+		old, err := readConversation(ctx, tx, conv.ConvID)
+		if err != nil {
+			return err
+		}
+		if old != nil && old.DeletedAt != 0 {
+			return models.ErrDeleted
+		}
+		if check {
+			if old == nil {
+				return fmt.Errorf("conversation not found")
+			}
+			if old.Version != conv.Version {
+				return models.ErrVersionConflict
+			}
+		}
+		var version int64
+		if old != nil {
+			conv.CopyActivity(old)
+			version = old.Version
+		}
+		conv.UpdatedAt = time.Now().Unix()
+		conv.Version = version + 1
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			// 归属发生变化时从原租户和用户的有序集合中移除
+			if old != nil && (old.TenantID != conv.TenantID || old.UserID != conv.UserID) {
+				for _, ownerKey := range ownerIndexKeys(old.TenantID, old.UserID) {
+					pipe.ZRem(ctx, ownerKey, conv.ConvID)
+				}
+			}
+			// 更新会话和有序集合中的分数
+			return writeConversation(ctx, pipe, conv)
+		})
+		return err
+	}, key)
+}
 
-	// 转换会话为JSON
-	data, err := json.Marshal(conv)
-	if err != nil {
+// Patch 在乐观事务中读取会话，应用部分字段更新并写回
+func (r *ConversationStore) Patch(convID string, patch *models.ConversationPatch) (*models.Conversation, error) {
+	ctx := context.Background()
+
+	var conv *models.Conversation
+	err := watchTx(ctx, r.client, func(tx *redis.Tx) error {
+		cur, err := readConversation(ctx, tx, convID)
+		if err != nil {
+			return err
+		}
+		if cur == nil {
+			return fmt.Errorf("conversation not found")
+		}
+		if cur.DeletedAt != 0 {
+			return models.ErrDeleted
+		}
+		if err := models.CheckVersion(patch.Version, cur.Version); err != nil {
+			return err
+		}
+		patch.Apply(cur)
+		if !patch.KeepUpdatedAt {
+			cur.UpdatedAt = time.Now().Unix()
+		}
+		cur.Version++
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			return writeConversation(ctx, pipe, cur)
+		})
+		if err == nil {
+			conv = cur
+		}
 		return err
+	}, ConversationKeyPrefix+convID)
+	if err != nil {
+		return nil, err
 	}
+	return conv, nil
+}
 
-	// 更新会话
-	key := ConversationKeyPrefix + conv.ConvID
-	if err := r.client.Set(ctx, key, data, 0).Err(); err != nil {
+// Delete 将会话及其消息移入回收站，消息与会话使用相同的删除时间，恢复时据此区分
+func (r *ConversationStore) Delete(convID string) error {
+	ctx := context.Background()
+
+	key := ConversationKeyPrefix + convID
+	messagesKey := ConversationMessagesPrefix + convID
+	deletedKey := ConversationDeletedMessagesPrefix + convID
+	var msgs []*models.Message
+	err := watchTx(ctx, r.client, func(tx *redis.Tx) error {
+		conv, err := readConversation(ctx, tx, convID)
+		if err != nil || conv == nil || conv.DeletedAt != 0 {
+			return err
+		}
+
+		// 删除时间需晚于已单独删除的消息，避免恢复会话时把它们一并恢复
+		now := time.Now().Unix()
+		lastDeleted, err := tx.ZRevRangeWithScores(ctx, deletedKey, 0, 0).Result()
+		if err != nil {
+			return err
+		}
+		if len(lastDeleted) > 0 && now <= int64(lastDeleted[0].Score) {
+			now = int64(lastDeleted[0].Score) + 1
+		}
+
+		msgIDs, err := tx.ZRange(ctx, messagesKey, 0, -1).Result()
+		if err != nil {
+			return err
+		}
+		if msgs, err = readMessages(ctx, tx, msgIDs); err != nil {
+			return err
+		}
+
+		conv.DeletedAt = now
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, msg := range msgs {
+				msg.DeletedAt = now
+				if err := trashMessage(ctx, pipe, msg); err != nil {
+					return err
+				}
+			}
+			pipe.Del(ctx, messagesKey)
+			return trashConversation(ctx, pipe, conv)
+		})
+		return err
+	}, key, messagesKey, deletedKey)
+	if err != nil {
 		return err
 	}
 
-	// 更新有序集合中的分数
-	if err := r.client.ZAdd(ctx, "conversations", &redis.Z{
-		Score:  float64(conv.UpdatedAt),
-		Member: conv.ConvID,
-	}).Err(); err != nil {
-		return err
+	// 回收站中的消息不参与检索
+	for _, msg := range msgs {
+		if err := unindexMessage(ctx, r.client, msg.MsgID); err != nil {
+			return err
+		}
 	}
 
+	if r.debug {
+		log.Printf("Redis: 会话 %s 已移入回收站", convID)
+	}
 	return nil
 }
 
-// Delete 删除会话
-func (r *ConversationStore) Delete(convID string) error {
+// Restore 从回收站恢复会话，以及随会话一起删除的消息
+func (r *ConversationStore) Restore(convID string) error {
 	ctx := context.Background()
 
-	// 删除会话
 	key := ConversationKeyPrefix + convID
-	if err := r.client.Del(ctx, key).Err(); err != nil {
+	deletedKey := ConversationDeletedMessagesPrefix + convID
+	var restored []*models.Message
+	err := watchTx(ctx, r.client, func(tx *redis.Tx) error {
+		conv, err := readConversation(ctx, tx, convID)
+		if err != nil {
+			return err
+		}
+		if conv == nil || conv.DeletedAt == 0 {
+			return fmt.Errorf("conversation not found in trash")
+		}
+		msgIDs, err := tx.ZRangeByScore(ctx, deletedKey, &redis.ZRangeBy{
+			Min: strconv.FormatInt(conv.DeletedAt, 10),
+			Max: strconv.FormatInt(conv.DeletedAt, 10),
+		}).Result()
+		if err != nil {
+			return err
+		}
+		msgs, err := readMessages(ctx, tx, msgIDs)
+		if err != nil {
+			return err
+		}
+
+		restored = restored[:0]
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, msg := range msgs {
+				if msg.DeletedAt != conv.DeletedAt {
+					continue
+				}
+				if err := restoreMessage(ctx, pipe, msg); err != nil {
+					return err
+				}
+				restored = append(restored, msg)
+			}
+			conv.DeletedAt = 0
+			pipe.ZRem(ctx, DeletedConversationsKey, convID)
+			return writeConversation(ctx, pipe, conv)
+		})
+		return err
+	}, key, deletedKey)
+	if err != nil {
 		return err
 	}
 
-	// 从有序集合中移除
-	if err := r.client.ZRem(ctx, "conversations", convID).Err(); err != nil {
+	for _, msg := range restored {
+		if err := indexMessage(ctx, r.client, msg); err != nil {
+			return err
+		}
+	}
+
+	if r.debug {
+		log.Printf("Redis: 会话 %s 已恢复", convID)
+	}
+	return nil
+}
+
+// GetDeleted 获取回收站中的会话
+func (r *ConversationStore) GetDeleted(convID string) (*models.Conversation, error) {
+	conv, err := readConversation(context.Background(), r.client, convID)
+	if err != nil {
+		return nil, err
+	}
+	if conv == nil || conv.DeletedAt == 0 {
+		return nil, fmt.Errorf("conversation not found in trash")
+	}
+	return conv, nil
+}
+
+// ListDeleted 按删除时间降序获取回收站中的会话
+// 限定归属范围时读取全部回收站会话后在内存中过滤
+func (r *ConversationStore) ListDeleted(owner *models.Owner, before int64, offset, limit int) ([]*models.Conversation, error) {
+	ctx := context.Background()
+
+	by := deletedRange(before)
+	if owner == nil {
+		by.Offset, by.Count = int64(offset), int64(limit)
+	}
+	convIDs, err := r.client.ZRevRangeByScore(ctx, DeletedConversationsKey, by).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	convs, err := readConversations(ctx, r.client, convIDs)
+	if err != nil {
+		return nil, err
+	}
+	if owner == nil {
+		return convs, nil
+	}
+
+	result := make([]*models.Conversation, 0, limit)
+	skipped := 0
+	for _, conv := range convs {
+		if !owner.Owns(conv) {
+			continue
+		}
+		if skipped < offset {
+			skipped++
+			continue
+		}
+		if len(result) >= limit {
+			break
+		}
+		result = append(result, conv)
+	}
+	return result, nil
+}
+
+// Purge 永久删除回收站中的会话及其全部消息、附件关联、评价、历史修订、标签和文件夹关联
+func (r *ConversationStore) Purge(convID string) error {
+	ctx := context.Background()
+
+	conv, err := readConversation(ctx, r.client, convID)
+	if err != nil || conv == nil || conv.DeletedAt == 0 {
 		return err
 	}
 
-	// 删除会话中的所有消息
 	messagesKey := ConversationMessagesPrefix + convID
-	messageIDs, err := r.client.ZRange(ctx, messagesKey, 0, -1).Result()
+	deletedKey := ConversationDeletedMessagesPrefix + convID
+	var msgIDs []string
+	for _, key := range []string{messagesKey, deletedKey} {
+		ids, err := r.client.ZRange(ctx, key, 0, -1).Result()
+		if err != nil {
+			return err
+		}
+		msgIDs = append(msgIDs, ids...)
+	}
+	msgs, err := readMessages(ctx, r.client, msgIDs)
 	if err != nil {
 		return err
 	}
 
-	for _, msgID := range messageIDs {
-		if err := r.client.Del(ctx, MessageKeyPrefix+msgID).Err(); err != nil {
+	pipe := r.client.TxPipeline()
+	for _, msg := range msgs {
+		links, err := readMessageLinks(ctx, r.client, msg.MsgID)
+		if err != nil {
 			return err
 		}
+		purgeMessage(ctx, pipe, msg, links)
+	}
+	pipe.Del(ctx, ConversationKeyPrefix+convID, messagesKey, deletedKey, ConversationOrderSeqPrefix+convID)
+	pipe.ZRem(ctx, DeletedConversationsKey, convID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
 	}
 
-	// 删除会话消息列表
-	if err := r.client.Del(ctx, messagesKey).Err(); err != nil {
+	for _, msgID := range msgIDs {
+		if err := unindexMessage(ctx, r.client, msgID); err != nil {
+			return err
+		}
+		if err := purgeFeedback(ctx, r.client, msgID); err != nil {
+			return err
+		}
+	}
+	if err := unlinkConversation(ctx, r.client, convID); err != nil {
 		return err
 	}
 
+	if r.debug {
+		log.Printf("Redis: 会话 %s 已永久删除", convID)
+	}
 	return nil
 }
 
@@ -151,14 +411,25 @@ func (r *ConversationStore) GetByID(convID string) (*models.Conversation, error)
 		return nil, err
 	}
 
+	// 回收站中的会话不参与常规读取
+	if conv.DeletedAt != 0 {
+		return nil, fmt.Errorf("conversation not found")
+	}
+
 	return &conv, nil
 }
 
 // FirstOrCreat 根据ID查找会话，如果不存在则创建
 func (r *ConversationStore) FirstOrCreat(convID string) (*models.Conversation, error) {
-	// 尝试获取已存在的会话
-	conv, err := r.GetByID(convID)
-	if err == nil {
+	// 尝试获取已存在的会话，包括回收站中的会话
+	conv, err := readConversation(context.Background(), r.client, convID)
+	if err != nil {
+		return nil, err
+	}
+	if conv != nil {
+		if conv.DeletedAt != 0 {
+			return nil, models.ErrDeleted
+		}
 		if r.debug {
 			log.Printf("Redis: 找到现有会话 %s", convID)
 		}
@@ -184,12 +455,56 @@ func (r *ConversationStore) FirstOrCreat(convID string) (*models.Conversation, e
 	return newConv, nil
 }
 
+// FirstOrCreatForOwner 根据ID查找会话，如果不存在则以指定归属创建
+func (r *ConversationStore) FirstOrCreatForOwner(convID, tenantID, userID string) (*models.Conversation, error) {
+	conv, err := readConversation(context.Background(), r.client, convID)
+	if err != nil {
+		return nil, err
+	}
+	if conv != nil {
+		if conv.DeletedAt != 0 {
+			return nil, models.ErrDeleted
+		}
+		return conv, nil
+	}
+
+	if r.debug {
+		log.Printf("Redis: 会话 %s 不存在，为租户 %s 用户 %s 创建新会话", convID, tenantID, userID)
+	}
+
+	now := time.Now().Unix()
+	newConv := &models.Conversation{
+		ConvID:    convID,
+		CreatedAt: now,
+		UpdatedAt: now,
+		TenantID:  tenantID,
+		UserID:    userID,
+	}
+
+	if err := r.Create(newConv); err != nil {
+		return nil, err
+	}
+
+	return newConv, nil
+}
+
 // List 获取会话列表
 func (r *ConversationStore) List(offset, limit int) ([]*models.Conversation, error) {
+	return r.listByKey(ConversationsKey, offset, limit)
+}
+
+// ListByOwner 获取指定归属的会话列表
+func (r *ConversationStore) ListByOwner(tenantID, userID string, offset, limit int) ([]*models.Conversation, error) {
+	keys := ownerIndexKeys(tenantID, userID)
+	return r.listByKey(keys[len(keys)-1], offset, limit)
+}
+
+// listByKey 按有序集合中的分数降序分页读取会话
+func (r *ConversationStore) listByKey(key string, offset, limit int) ([]*models.Conversation, error) {
 	ctx := context.Background()
 
 	// 获取会话ID列表，按UpdatedAt降序排序
-	convIDs, err := r.client.ZRevRange(ctx, "conversations", int64(offset), int64(offset+limit-1)).Result()
+	convIDs, err := r.client.ZRevRange(ctx, key, int64(offset), int64(offset+limit-1)).Result()
 	if err != nil {
 		return nil, err
 	}
@@ -217,44 +532,28 @@ func (r *ConversationStore) List(offset, limit int) ([]*models.Conversation, err
 
 // Archive 归档会话
 func (r *ConversationStore) Archive(convID string) error {
-	conv, err := r.GetByID(convID)
-	if err != nil {
-		return err
-	}
-
-	conv.IsArchived = true
-	return r.Update(conv)
+	value := true
+	_, err := r.Patch(convID, &models.ConversationPatch{IsArchived: &value})
+	return err
 }
 
 // Unarchive 取消归档会话
 func (r *ConversationStore) Unarchive(convID string) error {
-	conv, err := r.GetByID(convID)
-	if err != nil {
-		return err
-	}
-
-	conv.IsArchived = false
-	return r.Update(conv)
+	value := false
+	_, err := r.Patch(convID, &models.ConversationPatch{IsArchived: &value})
+	return err
 }
 
 // Pin 置顶会话
 func (r *ConversationStore) Pin(convID string) error {
-	conv, err := r.GetByID(convID)
-	if err != nil {
-		return err
-	}
-
-	conv.IsPinned = true
-	return r.Update(conv)
+	value := true
+	_, err := r.Patch(convID, &models.ConversationPatch{IsPinned: &value})
+	return err
 }
 
 // Unpin 取消置顶会话
 func (r *ConversationStore) Unpin(convID string) error {
-	conv, err := r.GetByID(convID)
-	if err != nil {
-		return err
-	}
-
-	conv.IsPinned = false
-	return r.Update(conv)
+	value := false
+	_, err := r.Patch(convID, &models.ConversationPatch{IsPinned: &value})
+	return err
 }
@@ -0,0 +1,108 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/hildam/eino-history/model"
+	"github.com/hildam/eino-history/store/common/pagination"
+)
+
+// Query 按条件查询会话列表
+// Redis 没有二级索引，先读取归属范围内的全部会话，在内存中过滤、排序并按游标分页
+func (r *ConversationStore) Query(query *models.ConversationQuery) (*models.ConversationPage, error) {
+	ctx := context.Background()
+
+	q, err := pagination.Normalize(query)
+	if err != nil {
+		return nil, err
+	}
+
+	key := ConversationsKey
+	if q.Owner != nil {
+		keys := ownerIndexKeys(q.Owner.TenantID, q.Owner.UserID)
+		key = keys[len(keys)-1]
+	}
+	convIDs, err := r.client.ZRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	convs, err := readConversations(ctx, r.client, convIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	type entry struct {
+		conv   *models.Conversation
+		cursor *pagination.Cursor
+	}
+	var matched []entry
+	for _, conv := range convs {
+		if pagination.Match(conv, q) {
+			matched = append(matched, entry{conv: conv, cursor: pagination.NewCursor(conv, q.SortBy)})
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return pagination.Compare(matched[i].cursor, matched[j].cursor, q) < 0
+	})
+
+	page := &models.ConversationPage{Total: int64(len(matched))}
+
+	start := 0
+	if q.Cursor != "" {
+		cursor, err := pagination.Decode(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		start = sort.Search(len(matched), func(i int) bool {
+			return pagination.Compare(matched[i].cursor, cursor, q) > 0
+		})
+	}
+	end := start + q.Limit
+	if end < len(matched) {
+		page.NextCursor = matched[end-1].cursor.Encode()
+	} else {
+		end = len(matched)
+	}
+
+	pageConvs := make([]*models.Conversation, 0, end-start)
+	for _, e := range matched[start:end] {
+		pageConvs = append(pageConvs, e.conv)
+	}
+	page.Items = pageConvs
+	return page, nil
+}
+
+// readConversations 使用MGET批量读取会话，不存在的会话会被跳过
+func readConversations(ctx context.Context, c redis.Cmdable, convIDs []string) ([]*models.Conversation, error) {
+	convs := make([]*models.Conversation, 0, len(convIDs))
+	if len(convIDs) == 0 {
+		return convs, nil
+	}
+
+	keys := make([]string, len(convIDs))
+	for i, convID := range convIDs {
+		keys[i] = ConversationKeyPrefix + convID
+	}
+
+	values, err := c.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range values {
+		data, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var conv models.Conversation
+		if err := json.Unmarshal([]byte(data), &conv); err != nil {
+			return nil, err
+		}
+		convs = append(convs, &conv)
+	}
+	return convs, nil
+}
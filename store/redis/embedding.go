@@ -0,0 +1,204 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/hildam/eino-history/model"
+	"github.com/hildam/eino-history/store/common/logger"
+	"github.com/hildam/eino-history/store/interfaces"
+)
+
+// Redis key patterns
+const (
+	// EmbeddingKeyPrefix 向量数据，key 为 embedding:<来源类型>:<来源ID>
+	EmbeddingKeyPrefix = "embedding:"
+	// EmbeddingsKey 全部向量的有序集合，按创建时间排序
+	EmbeddingsKey = "embeddings"
+	// ConversationEmbeddingsPrefix 会话的向量集合
+	ConversationEmbeddingsPrefix = "conversation:embeddings:"
+)
+
+// embeddingScanCount 按前缀删除向量时每次 ZSCAN 的数量提示
+const embeddingScanCount = 500
+
+// globEscaper 转义 SCAN MATCH 模式中的通配符
+var globEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+// EmbeddingStore 实现EmbeddingStore接口的Redis实现
+type EmbeddingStore struct {
+	client *redis.Client
+	debug  bool
+	logger *logger.Logger
+}
+
+// NewEmbeddingStore 创建Redis向量存储库实例
+func NewEmbeddingStore(client *redis.Client, debug bool) interfaces.EmbeddingStore {
+	return &EmbeddingStore{
+		client: client,
+		debug:  debug,
+	}
+}
+
+// SetLogger 设置日志记录器
+func (r *EmbeddingStore) SetLogger(logger *logger.Logger) {
+	r.logger = logger
+}
+
+// embeddingMember 向量在集合中的成员名
+func embeddingMember(sourceType, sourceID string) string {
+	return sourceType + ":" + sourceID
+}
+
+// Upsert 创建或更新向量
+func (r *EmbeddingStore) Upsert(embedding *models.Embedding) error {
+	ctx := context.Background()
+
+	if embedding.CreatedAt == 0 {
+		embedding.CreatedAt = time.Now().Unix()
+	}
+	embedding.Dimension = len(embedding.Vector)
+
+	data, err := json.Marshal(embedding)
+	if err != nil {
+		r.logError("向量序列化失败: %v", err)
+		return err
+	}
+
+	member := embeddingMember(embedding.SourceType, embedding.SourceID)
+	pipe := r.client.TxPipeline()
+	pipe.Set(ctx, EmbeddingKeyPrefix+member, data, 0)
+	pipe.ZAdd(ctx, EmbeddingsKey, &redis.Z{
+		Score:  float64(embedding.CreatedAt),
+		Member: member,
+	})
+	pipe.SAdd(ctx, ConversationEmbeddingsPrefix+embedding.ConversationID, member)
+	if _, err := pipe.Exec(ctx); err != nil {
+		r.logError("保存向量失败: %v", err)
+		return err
+	}
+
+	if r.logger != nil {
+		r.logger.Debug("%s 的向量保存成功", member)
+	}
+	return nil
+}
+
+// Delete 删除指定来源的向量
+func (r *EmbeddingStore) Delete(sourceType, sourceID string) error {
+	ctx := context.Background()
+
+	member := embeddingMember(sourceType, sourceID)
+	key := EmbeddingKeyPrefix + member
+	data, err := r.client.Get(ctx, key).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil
+		}
+		return err
+	}
+
+	var embedding models.Embedding
+	if err := json.Unmarshal(data, &embedding); err != nil {
+		return err
+	}
+
+	pipe := r.client.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.ZRem(ctx, EmbeddingsKey, member)
+	pipe.SRem(ctx, ConversationEmbeddingsPrefix+embedding.ConversationID, member)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// DeleteByPrefix 删除来源ID以指定前缀开头的全部向量，通过 ZSCAN 在全部向量的有序集合中查找
+func (r *EmbeddingStore) DeleteByPrefix(sourceType, prefix string) error {
+	ctx := context.Background()
+
+	pattern := globEscaper.Replace(embeddingMember(sourceType, prefix)) + "*"
+	iter := r.client.ZScan(ctx, EmbeddingsKey, 0, pattern, embeddingScanCount).Iterator()
+	var sourceIDs []string
+	for member := true; iter.Next(ctx); member = !member {
+		// ZSCAN 依次返回成员和分数
+		if member {
+			sourceIDs = append(sourceIDs, strings.TrimPrefix(iter.Val(), sourceType+":"))
+		}
+	}
+	if err := iter.Err(); err != nil {
+		r.logError("扫描向量失败: %v", err)
+		return err
+	}
+	for _, sourceID := range sourceIDs {
+		if err := r.Delete(sourceType, sourceID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListByConversation 获取会话的全部向量
+func (r *EmbeddingStore) ListByConversation(conversationID string) ([]*models.Embedding, error) {
+	ctx := context.Background()
+
+	members, err := r.client.SMembers(ctx, ConversationEmbeddingsPrefix+conversationID).Result()
+	if err != nil {
+		r.logError("获取会话向量列表失败: %v", err)
+		return nil, err
+	}
+	return r.loadEmbeddings(ctx, members)
+}
+
+// List 分页获取全部向量
+func (r *EmbeddingStore) List(offset, limit int) ([]*models.Embedding, error) {
+	ctx := context.Background()
+
+	members, err := r.client.ZRange(ctx, EmbeddingsKey, int64(offset), int64(offset+limit-1)).Result()
+	if err != nil {
+		r.logError("获取向量列表失败: %v", err)
+		return nil, err
+	}
+	return r.loadEmbeddings(ctx, members)
+}
+
+// loadEmbeddings 使用MGET批量读取向量，已被删除的成员会被跳过
+func (r *EmbeddingStore) loadEmbeddings(ctx context.Context, members []string) ([]*models.Embedding, error) {
+	embeddings := []*models.Embedding{}
+	if len(members) == 0 {
+		return embeddings, nil
+	}
+
+	keys := make([]string, len(members))
+	for i, member := range members {
+		keys[i] = EmbeddingKeyPrefix + member
+	}
+
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		r.logError("批量读取向量失败: %v", err)
+		return nil, err
+	}
+
+	for _, v := range values {
+		data, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var embedding models.Embedding
+		if err := json.Unmarshal([]byte(data), &embedding); err != nil {
+			r.logError("向量反序列化失败: %v", err)
+			return nil, err
+		}
+		embeddings = append(embeddings, &embedding)
+	}
+	return embeddings, nil
+}
+
+// logError 记录错误日志
+func (r *EmbeddingStore) logError(format string, args ...interface{}) {
+	if r.logger != nil {
+		r.logger.Error(format, args...)
+	}
+}
@@ -0,0 +1,287 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/hildam/eino-history/model"
+	"github.com/hildam/eino-history/store/common/logger"
+	"github.com/hildam/eino-history/store/interfaces"
+)
+
+// Redis key patterns
+const (
+	// MessageFeedbackPrefix 消息的评价哈希，字段为用户ID，值为评价JSON
+	MessageFeedbackPrefix = "message_feedback:"
+	// ConversationFeedbackPrefix 会话中有评价的消息ID集合
+	ConversationFeedbackPrefix = "conversation:feedback:"
+	// ModelFeedbackPrefix 模型的有评价的消息ID集合
+	ModelFeedbackPrefix = "feedback:model:"
+	// FeedbackModelsKey 出现过评价的模型名称集合
+	FeedbackModelsKey = "feedback:models"
+)
+
+// FeedbackStore 实现FeedbackStore接口的Redis实现
+type FeedbackStore struct {
+	client *redis.Client
+	debug  bool
+	logger *logger.Logger
+}
+
+// NewFeedbackStore 创建Redis消息评价存储库实例
+func NewFeedbackStore(client *redis.Client, debug bool) interfaces.FeedbackStore {
+	return &FeedbackStore{
+		client: client,
+		debug:  debug,
+	}
+}
+
+// SetLogger 设置日志记录器
+func (r *FeedbackStore) SetLogger(logger *logger.Logger) {
+	r.logger = logger
+}
+
+// Upsert 创建或更新评价，在事务中同步会话和模型索引
+func (r *FeedbackStore) Upsert(feedback *models.MessageFeedback) error {
+	ctx := context.Background()
+	key := MessageFeedbackPrefix + feedback.MessageID
+
+	err := watchTx(ctx, r.client, func(tx *redis.Tx) error {
+		before, err := readFeedback(ctx, tx, feedback.MessageID)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().Unix()
+		feedback.CreatedAt = now
+		after := make([]*models.MessageFeedback, 0, len(before)+1)
+		for _, fb := range before {
+			if fb.UserID == feedback.UserID {
+				feedback.CreatedAt = fb.CreatedAt
+				continue
+			}
+			after = append(after, fb)
+		}
+		feedback.UpdatedAt = now
+		after = append(after, feedback)
+
+		data, err := json.Marshal(feedback)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, key, feedback.UserID, data)
+			syncFeedbackIndexes(ctx, pipe, feedback.MessageID, feedback.ConversationID, before, after)
+			return nil
+		})
+		return err
+	}, key)
+	if err != nil {
+		r.logError("保存评价失败: %v", err)
+		return err
+	}
+
+	if r.logger != nil {
+		r.logger.Debug("用户 %s 对消息 %s 的评价保存成功", feedback.UserID, feedback.MessageID)
+	}
+	return nil
+}
+
+// Delete 删除用户对消息的评价
+func (r *FeedbackStore) Delete(messageID, userID string) error {
+	ctx := context.Background()
+	key := MessageFeedbackPrefix + messageID
+
+	return watchTx(ctx, r.client, func(tx *redis.Tx) error {
+		before, err := readFeedback(ctx, tx, messageID)
+		if err != nil {
+			return err
+		}
+
+		var (
+			after  []*models.MessageFeedback
+			convID string
+		)
+		for _, fb := range before {
+			if fb.UserID == userID {
+				convID = fb.ConversationID
+				continue
+			}
+			after = append(after, fb)
+		}
+		if len(after) == len(before) {
+			return nil
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HDel(ctx, key, userID)
+			syncFeedbackIndexes(ctx, pipe, messageID, convID, before, after)
+			return nil
+		})
+		return err
+	}, key)
+}
+
+// ListByMessage 获取消息的全部评价
+func (r *FeedbackStore) ListByMessage(messageID string) ([]*models.MessageFeedback, error) {
+	return readFeedback(context.Background(), r.client, messageID)
+}
+
+// ListByConversation 获取会话中全部消息的评价
+func (r *FeedbackStore) ListByConversation(conversationID string) ([]*models.MessageFeedback, error) {
+	ctx := context.Background()
+
+	msgIDs, err := r.client.SMembers(ctx, ConversationFeedbackPrefix+conversationID).Result()
+	if err != nil {
+		r.logError("获取会话评价列表失败: %v", err)
+		return nil, err
+	}
+
+	feedback := []*models.MessageFeedback{}
+	for _, msgID := range msgIDs {
+		list, err := readFeedback(ctx, r.client, msgID)
+		if err != nil {
+			return nil, err
+		}
+		feedback = append(feedback, list...)
+	}
+	sortFeedback(feedback)
+	return feedback, nil
+}
+
+// StatsByConversation 汇总会话的评价
+func (r *FeedbackStore) StatsByConversation(conversationID string) (*models.FeedbackStats, error) {
+	feedback, err := r.ListByConversation(conversationID)
+	if err != nil {
+		return nil, err
+	}
+	stats := &models.FeedbackStats{Key: conversationID}
+	for _, fb := range feedback {
+		stats.Add(fb)
+	}
+	return stats, nil
+}
+
+// StatsByModel 按模型汇总评价，逐个读取模型索引中的消息评价并过滤
+func (r *FeedbackStore) StatsByModel(owner *models.Owner, since, until int64) ([]*models.FeedbackStats, error) {
+	ctx := context.Background()
+
+	names, err := r.client.SMembers(ctx, FeedbackModelsKey).Result()
+	if err != nil {
+		r.logError("获取评价模型列表失败: %v", err)
+		return nil, err
+	}
+	sort.Strings(names)
+
+	result := []*models.FeedbackStats{}
+	for _, name := range names {
+		msgIDs, err := r.client.SMembers(ctx, ModelFeedbackPrefix+name).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		stats := &models.FeedbackStats{Key: name}
+		for _, msgID := range msgIDs {
+			list, err := readFeedback(ctx, r.client, msgID)
+			if err != nil {
+				return nil, err
+			}
+			for _, fb := range list {
+				if fb.Model != name ||
+					(owner != nil && fb.TenantID != owner.TenantID) ||
+					(since > 0 && fb.UpdatedAt < since) ||
+					(until > 0 && fb.UpdatedAt > until) {
+					continue
+				}
+				stats.Add(fb)
+			}
+		}
+		if stats.Total > 0 {
+			result = append(result, stats)
+		}
+	}
+
+	if r.logger != nil {
+		r.logger.Debug("汇总了 %d 个模型的评价", len(result))
+	}
+	return result, nil
+}
+
+// readFeedback 读取消息的全部评价，按创建时间排序
+func readFeedback(ctx context.Context, c redis.Cmdable, msgID string) ([]*models.MessageFeedback, error) {
+	values, err := c.HGetAll(ctx, MessageFeedbackPrefix+msgID).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	feedback := make([]*models.MessageFeedback, 0, len(values))
+	for _, data := range values {
+		var fb models.MessageFeedback
+		if err := json.Unmarshal([]byte(data), &fb); err != nil {
+			return nil, err
+		}
+		feedback = append(feedback, &fb)
+	}
+	sortFeedback(feedback)
+	return feedback, nil
+}
+
+// sortFeedback 按创建时间和用户ID排序评价
+func sortFeedback(feedback []*models.MessageFeedback) {
+	sort.Slice(feedback, func(i, j int) bool {
+		if feedback[i].CreatedAt != feedback[j].CreatedAt {
+			return feedback[i].CreatedAt < feedback[j].CreatedAt
+		}
+		if feedback[i].MessageID != feedback[j].MessageID {
+			return feedback[i].MessageID < feedback[j].MessageID
+		}
+		return feedback[i].UserID < feedback[j].UserID
+	})
+}
+
+// syncFeedbackIndexes 在事务中根据消息评价的变化更新会话和模型索引
+func syncFeedbackIndexes(ctx context.Context, pipe redis.Pipeliner, msgID, convID string, before, after []*models.MessageFeedback) {
+	remaining := make(map[string]bool, len(after))
+	for _, fb := range after {
+		remaining[fb.Model] = true
+	}
+	for _, fb := range before {
+		if !remaining[fb.Model] {
+			pipe.SRem(ctx, ModelFeedbackPrefix+fb.Model, msgID)
+		}
+	}
+	for name := range remaining {
+		pipe.SAdd(ctx, ModelFeedbackPrefix+name, msgID)
+		pipe.SAdd(ctx, FeedbackModelsKey, name)
+	}
+
+	if len(after) == 0 {
+		pipe.SRem(ctx, ConversationFeedbackPrefix+convID, msgID)
+	} else {
+		pipe.SAdd(ctx, ConversationFeedbackPrefix+convID, msgID)
+	}
+}
+
+// purgeFeedback 删除消息的全部评价及其索引，供永久删除消息时调用
+func purgeFeedback(ctx context.Context, client *redis.Client, msgID string) error {
+	before, err := readFeedback(ctx, client, msgID)
+	if err != nil || len(before) == 0 {
+		return err
+	}
+
+	pipe := client.TxPipeline()
+	pipe.Del(ctx, MessageFeedbackPrefix+msgID)
+	syncFeedbackIndexes(ctx, pipe, msgID, before[0].ConversationID, before, nil)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// logError 记录错误日志
+func (r *FeedbackStore) logError(format string, args ...interface{}) {
+	if r.logger != nil {
+		r.logger.Error(format, args...)
+	}
+}
@@ -0,0 +1,441 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/hildam/eino-history/model"
+	"github.com/hildam/eino-history/store/common/logger"
+	"github.com/hildam/eino-history/store/interfaces"
+)
+
+// Redis key patterns
+const (
+	// FolderKeyPrefix 文件夹数据
+	FolderKeyPrefix = "folder:"
+	// OwnerFoldersPrefix 归属内的文件夹ID集合，key 为 folders:owner:<租户ID>:user:<用户ID>
+	OwnerFoldersPrefix = "folders:owner:"
+	// FolderConversationsPrefix 文件夹中的会话ID集合
+	FolderConversationsPrefix = "folder:conversations:"
+	// ConversationFolderPrefix 会话所在的文件夹ID
+	ConversationFolderPrefix = "conversation:folder:"
+)
+
+// FolderStore 实现FolderStore接口的Redis实现
+// 同一归属的文件夹结构变更监视归属集合和全部文件夹，保证名称唯一和不出现环
+type FolderStore struct {
+	client *redis.Client
+	debug  bool
+	logger *logger.Logger
+}
+
+// NewFolderStore 创建Redis文件夹存储库实例
+func NewFolderStore(client *redis.Client, debug bool) interfaces.FolderStore {
+	return &FolderStore{
+		client: client,
+		debug:  debug,
+	}
+}
+
+// SetLogger 设置日志记录器
+func (r *FolderStore) SetLogger(logger *logger.Logger) {
+	r.logger = logger
+}
+
+// Create 创建文件夹
+func (r *FolderStore) Create(folder *models.Folder) error {
+	ctx := context.Background()
+
+	if folder.FolderID == "" {
+		folder.FolderID = uuid.NewString()
+	}
+	now := time.Now().Unix()
+	if folder.CreatedAt == 0 {
+		folder.CreatedAt = now
+	}
+	folder.UpdatedAt = now
+
+	ownerFoldersKey := OwnerFoldersPrefix + ownerKey(folder.TenantID, folder.UserID)
+	err := watchTx(ctx, r.client, func(tx *redis.Tx) error {
+		folders, err := watchOwnerFolders(ctx, tx, ownerFoldersKey)
+		if err != nil {
+			return err
+		}
+		if folder.ParentID != "" && folders[folder.ParentID] == nil {
+			return fmt.Errorf("父文件夹 %s 不存在或不属于同一归属", folder.ParentID)
+		}
+		if siblingNameTaken(folders, folder, folder.ParentID, folder.Name) {
+			return models.ErrNameConflict
+		}
+
+		data, err := json.Marshal(folder)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, FolderKeyPrefix+folder.FolderID, data, 0)
+			pipe.SAdd(ctx, ownerFoldersKey, folder.FolderID)
+			return nil
+		})
+		return err
+	}, ownerFoldersKey)
+	if err != nil {
+		r.logError("创建文件夹失败: %v", err)
+		return err
+	}
+
+	if r.logger != nil {
+		r.logger.Info("文件夹 %s 创建成功", folder.FolderID)
+	}
+	return nil
+}
+
+// GetByID 根据ID获取文件夹
+func (r *FolderStore) GetByID(folderID string) (*models.Folder, error) {
+	folder, err := readFolder(context.Background(), r.client, folderID)
+	if err != nil {
+		return nil, err
+	}
+	if folder == nil {
+		return nil, fmt.Errorf("folder not found")
+	}
+	return folder, nil
+}
+
+// List 获取指定归属的全部文件夹
+func (r *FolderStore) List(tenantID, userID string) ([]*models.Folder, error) {
+	ctx := context.Background()
+
+	folderIDs, err := r.client.SMembers(ctx, OwnerFoldersPrefix+ownerKey(tenantID, userID)).Result()
+	if err != nil {
+		r.logError("获取文件夹列表失败: %v", err)
+		return nil, err
+	}
+	folders, err := readFolders(ctx, r.client, folderIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*models.Folder, 0, len(folders))
+	for _, folder := range folders {
+		list = append(list, folder)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Name != list[j].Name {
+			return list[i].Name < list[j].Name
+		}
+		return list[i].FolderID < list[j].FolderID
+	})
+	return list, nil
+}
+
+// Rename 重命名文件夹
+func (r *FolderStore) Rename(folderID, name string) error {
+	err := r.update(folderID, func(folders map[string]*models.Folder, folder *models.Folder) error {
+		if siblingNameTaken(folders, folder, folder.ParentID, name) {
+			return models.ErrNameConflict
+		}
+		folder.Name = name
+		return nil
+	})
+	if err == nil && r.logger != nil {
+		r.logger.Info("文件夹 %s 重命名为 %s", folderID, name)
+	}
+	return err
+}
+
+// Move 移动文件夹到新的父文件夹下，沿新父文件夹向上查找以防止出现环
+func (r *FolderStore) Move(folderID, parentID string) error {
+	err := r.update(folderID, func(folders map[string]*models.Folder, folder *models.Folder) error {
+		for ancestorID := parentID; ancestorID != ""; {
+			if ancestorID == folderID {
+				return models.ErrFolderCycle
+			}
+			ancestor := folders[ancestorID]
+			if ancestor == nil {
+				return fmt.Errorf("父文件夹 %s 不存在或不属于同一归属", ancestorID)
+			}
+			ancestorID = ancestor.ParentID
+		}
+		if siblingNameTaken(folders, folder, parentID, folder.Name) {
+			return models.ErrNameConflict
+		}
+		folder.ParentID = parentID
+		return nil
+	})
+	if err == nil && r.logger != nil {
+		r.logger.Info("文件夹 %s 移动到 %q 下", folderID, parentID)
+	}
+	return err
+}
+
+// update 在事务中读取归属内的全部文件夹，由 fn 修改目标文件夹后写回
+func (r *FolderStore) update(folderID string, fn func(folders map[string]*models.Folder, folder *models.Folder) error) error {
+	ctx := context.Background()
+
+	current, err := r.GetByID(folderID)
+	if err != nil {
+		return err
+	}
+	ownerFoldersKey := OwnerFoldersPrefix + ownerKey(current.TenantID, current.UserID)
+
+	return watchTx(ctx, r.client, func(tx *redis.Tx) error {
+		folders, err := watchOwnerFolders(ctx, tx, ownerFoldersKey)
+		if err != nil {
+			return err
+		}
+		folder := folders[folderID]
+		if folder == nil {
+			return fmt.Errorf("folder not found")
+		}
+		if err := fn(folders, folder); err != nil {
+			return err
+		}
+
+		folder.UpdatedAt = time.Now().Unix()
+		data, err := json.Marshal(folder)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, FolderKeyPrefix+folderID, data, 0)
+			return nil
+		})
+		return err
+	}, ownerFoldersKey)
+}
+
+// Delete 删除文件夹及其全部子文件夹，其中的会话移出文件夹
+func (r *FolderStore) Delete(folderID string) error {
+	ctx := context.Background()
+
+	current, err := readFolder(ctx, r.client, folderID)
+	if err != nil || current == nil {
+		return err
+	}
+	ownerFoldersKey := OwnerFoldersPrefix + ownerKey(current.TenantID, current.UserID)
+
+	err = watchTx(ctx, r.client, func(tx *redis.Tx) error {
+		folders, err := watchOwnerFolders(ctx, tx, ownerFoldersKey)
+		if err != nil {
+			return err
+		}
+		if folders[folderID] == nil {
+			return nil
+		}
+
+		children := make(map[string][]string)
+		for _, folder := range folders {
+			children[folder.ParentID] = append(children[folder.ParentID], folder.FolderID)
+		}
+		removed := []string{folderID}
+		for i := 0; i < len(removed); i++ {
+			removed = append(removed, children[removed[i]]...)
+		}
+
+		convKeys := make([]string, len(removed))
+		for i, id := range removed {
+			convKeys[i] = FolderConversationsPrefix + id
+		}
+		if err := tx.Watch(ctx, convKeys...).Err(); err != nil {
+			return err
+		}
+		var convIDs []string
+		for _, key := range convKeys {
+			ids, err := tx.SMembers(ctx, key).Result()
+			if err != nil {
+				return err
+			}
+			convIDs = append(convIDs, ids...)
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, id := range removed {
+				pipe.Del(ctx, FolderKeyPrefix+id, FolderConversationsPrefix+id)
+				pipe.SRem(ctx, ownerFoldersKey, id)
+			}
+			for _, convID := range convIDs {
+				pipe.Del(ctx, ConversationFolderPrefix+convID)
+			}
+			return nil
+		})
+		return err
+	}, ownerFoldersKey)
+	if err == nil && r.logger != nil {
+		r.logger.Info("文件夹 %s 及其子文件夹删除成功", folderID)
+	}
+	return err
+}
+
+// SetConversationFolder 将会话移动到文件夹，监视目标文件夹防止与删除文件夹并发
+func (r *FolderStore) SetConversationFolder(convID, folderID string) error {
+	ctx := context.Background()
+	convFolderKey := ConversationFolderPrefix + convID
+
+	keys := []string{convFolderKey}
+	if folderID != "" {
+		keys = append(keys, FolderKeyPrefix+folderID)
+	}
+	return watchTx(ctx, r.client, func(tx *redis.Tx) error {
+		if folderID != "" {
+			folder, err := readFolder(ctx, tx, folderID)
+			if err != nil {
+				return err
+			}
+			if folder == nil {
+				return fmt.Errorf("folder not found")
+			}
+		}
+		old, err := tx.Get(ctx, convFolderKey).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if old != "" {
+				pipe.SRem(ctx, FolderConversationsPrefix+old, convID)
+			}
+			if folderID == "" {
+				pipe.Del(ctx, convFolderKey)
+			} else {
+				pipe.Set(ctx, convFolderKey, folderID, 0)
+				pipe.SAdd(ctx, FolderConversationsPrefix+folderID, convID)
+			}
+			return nil
+		})
+		return err
+	}, keys...)
+}
+
+// GetConversationFolder 获取会话所在的文件夹ID
+func (r *FolderStore) GetConversationFolder(convID string) (string, error) {
+	folderID, err := r.client.Get(context.Background(), ConversationFolderPrefix+convID).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return folderID, err
+}
+
+// ListConversations 按更新时间降序获取文件夹中的会话
+func (r *FolderStore) ListConversations(folderID string, offset, limit int) ([]*models.Conversation, error) {
+	ctx := context.Background()
+
+	convIDs, err := r.client.SMembers(ctx, FolderConversationsPrefix+folderID).Result()
+	if err != nil {
+		r.logError("获取文件夹会话列表失败: %v", err)
+		return nil, err
+	}
+	return pageConversations(ctx, r.client, convIDs, offset, limit)
+}
+
+// watchOwnerFolders 在事务中读取归属内的全部文件夹，并监视它们的 key
+func watchOwnerFolders(ctx context.Context, tx *redis.Tx, ownerFoldersKey string) (map[string]*models.Folder, error) {
+	folderIDs, err := tx.SMembers(ctx, ownerFoldersKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(folderIDs) > 0 {
+		keys := make([]string, len(folderIDs))
+		for i, id := range folderIDs {
+			keys[i] = FolderKeyPrefix + id
+		}
+		if err := tx.Watch(ctx, keys...).Err(); err != nil {
+			return nil, err
+		}
+	}
+	return readFolders(ctx, tx, folderIDs)
+}
+
+// siblingNameTaken 判断同级是否已有同名文件夹
+func siblingNameTaken(folders map[string]*models.Folder, folder *models.Folder, parentID, name string) bool {
+	for _, f := range folders {
+		if f.FolderID != folder.FolderID && f.ParentID == parentID && f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// readFolder 读取文件夹，不存在时返回nil
+func readFolder(ctx context.Context, c redis.Cmdable, folderID string) (*models.Folder, error) {
+	data, err := c.Get(ctx, FolderKeyPrefix+folderID).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var folder models.Folder
+	if err := json.Unmarshal(data, &folder); err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
+// readFolders 使用MGET批量读取文件夹，不存在的文件夹会被跳过
+func readFolders(ctx context.Context, c redis.Cmdable, folderIDs []string) (map[string]*models.Folder, error) {
+	folders := make(map[string]*models.Folder, len(folderIDs))
+	if len(folderIDs) == 0 {
+		return folders, nil
+	}
+
+	keys := make([]string, len(folderIDs))
+	for i, id := range folderIDs {
+		keys[i] = FolderKeyPrefix + id
+	}
+	values, err := c.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range values {
+		data, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var folder models.Folder
+		if err := json.Unmarshal([]byte(data), &folder); err != nil {
+			return nil, err
+		}
+		folders[folder.FolderID] = &folder
+	}
+	return folders, nil
+}
+
+// unlinkConversation 删除会话的标签和文件夹关联，供永久删除会话时调用
+func unlinkConversation(ctx context.Context, client *redis.Client, convID string) error {
+	tagsKey := ConversationTagsPrefix + convID
+	folderKey := ConversationFolderPrefix + convID
+
+	tagIDs, err := client.SMembers(ctx, tagsKey).Result()
+	if err != nil {
+		return err
+	}
+	folderID, err := client.Get(ctx, folderKey).Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+
+	pipe := client.TxPipeline()
+	for _, tagID := range tagIDs {
+		pipe.SRem(ctx, TagConversationsPrefix+tagID, convID)
+	}
+	if folderID != "" {
+		pipe.SRem(ctx, FolderConversationsPrefix+folderID, convID)
+	}
+	pipe.Del(ctx, tagsKey, folderKey)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// logError 记录错误日志
+func (r *FolderStore) logError(format string, args ...interface{}) {
+	if r.logger != nil {
+		r.logger.Error(format, args...)
+	}
+}
@@ -18,6 +18,8 @@ import (
 const (
 	MessageKeyPrefix           = "message:"
 	ConversationMessagesPrefix = "conversation:messages:"
+	// ConversationOrderSeqPrefix 会话已分配的最大排序序号，只增不减，回收站中消息的序号不会被新消息复用
+	ConversationOrderSeqPrefix = "conversation:order_seq:"
 )
 
 // MessageStore 实现MessageStore接口的Redis实现
@@ -40,7 +42,8 @@ func (r *MessageStore) SetLogger(logger *logger.Logger) {
 	r.logger = logger
 }
 
-// Create 创建消息
+// Create 创建消息，并在同一事务中更新所属会话的活动字段
+// 未指定排序序号时按会话内已有消息顺延
 func (r *MessageStore) Create(msg *models.Message) error {
 	ctx := context.Background()
 
@@ -52,39 +55,72 @@ func (r *MessageStore) Create(msg *models.Message) error {
 		msg.CreatedAt = time.Now().Unix()
 	}
 
-	// 转换消息为JSON
-	data, err := json.Marshal(msg)
-	if err != nil {
-		if r.logger != nil {
-			r.logger.Error("消息序列化失败: %v", err)
-		} else if r.debug {
-			// 兼容旧的日志记录方式，将来可以移除
-			r.logError("消息序列化失败: %v", err)
+	autoSeq := msg.OrderSeq == 0
+	convKey := ConversationKeyPrefix + msg.ConversationID
+	messagesKey := ConversationMessagesPrefix + msg.ConversationID
+	seqKey := ConversationOrderSeqPrefix + msg.ConversationID
+	err := watchTx(ctx, r.client, func(tx *redis.Tx) error {
+		next, err := nextOrderSeq(ctx, tx, msg.ConversationID)
+		if err != nil {
+			return err
+		}
+		if autoSeq {
+			msg.OrderSeq = next
 		}
-		return err
-	}
 
-	// 存储消息
-	key := MessageKeyPrefix + msg.MsgID
-	if err := r.client.Set(ctx, key, data, 0).Err(); err != nil {
+		conv, err := readConversation(ctx, tx, msg.ConversationID)
+		if err != nil {
+			return err
+		}
+		if conv != nil && conv.DeletedAt != 0 {
+			return models.ErrDeleted
+		}
+		if conv != nil {
+			if err := refreshLastMessage(ctx, tx, conv, msg, ""); err != nil {
+				return err
+			}
+			conv.MessageCount++
+			conv.TotalTokens += int64(msg.TokenCount)
+			conv.UpdatedAt = time.Now().Unix()
+		}
+
+		// 转换消息为JSON
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+
+		// 存储消息、加入会话列表并更新会话
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, MessageKeyPrefix+msg.MsgID, data, 0)
+			pipe.ZAdd(ctx, messagesKey, &redis.Z{
+				Score:  float64(msg.OrderSeq),
+				Member: msg.MsgID,
+			})
+			pipe.Set(ctx, seqKey, max(next-1, msg.OrderSeq), 0)
+			if conv != nil {
+				return writeConversation(ctx, pipe, conv)
+			}
+			return nil
+		})
+		return err
+	}, convKey, messagesKey, seqKey)
+	if err != nil {
 		if r.logger != nil {
 			r.logger.Error("保存消息失败: %v", err)
 		} else if r.debug {
+			// 兼容旧的日志记录方式，将来可以移除
 			r.logError("保存消息失败: %v", err)
 		}
 		return err
 	}
 
-	// 将消息添加到会话列表
-	convKey := ConversationMessagesPrefix + msg.ConversationID
-	if err := r.client.ZAdd(ctx, convKey, &redis.Z{
-		Score:  float64(msg.OrderSeq),
-		Member: msg.MsgID,
-	}).Err(); err != nil {
+	// 建立全文检索索引
+	if err := indexMessage(ctx, r.client, msg); err != nil {
 		if r.logger != nil {
-			r.logger.Error("添加消息到会话列表失败: %v", err)
+			r.logger.Error("建立消息检索索引失败: %v", err)
 		} else if r.debug {
-			r.logError("添加消息到会话列表失败: %v", err)
+			r.logError("建立消息检索索引失败: %v", err)
 		}
 		return err
 	}
@@ -96,59 +132,294 @@ func (r *MessageStore) Create(msg *models.Message) error {
 	return nil
 }
 
+// CreateBatch 按会话分组批量创建消息
+// 每个会话在一个事务中通过管道写入消息并更新活动字段，某个会话失败时不影响其他会话的消息
+func (r *MessageStore) CreateBatch(msgs []*models.Message) error {
+	ctx := context.Background()
+
+	convIDs, groups, failed := groupByConversation(msgs)
+	for _, convID := range convIDs {
+		idx := groups[convID]
+		if err := r.createGroup(ctx, convID, msgs, idx); err != nil {
+			if r.logger != nil {
+				r.logger.Error("批量创建会话 %s 的 %d 条消息失败: %v", convID, len(idx), err)
+			}
+			for _, i := range idx {
+				failed = append(failed, &models.BatchItemError{Index: i, ID: msgs[i].MsgID, Err: err})
+			}
+			continue
+		}
+
+		// 建立全文检索索引，失败的消息已写入，只报告该项
+		for _, i := range idx {
+			if err := indexMessage(ctx, r.client, msgs[i]); err != nil {
+				if r.logger != nil {
+					r.logger.Error("建立消息 %s 检索索引失败: %v", msgs[i].MsgID, err)
+				}
+				failed = append(failed, &models.BatchItemError{Index: i, ID: msgs[i].MsgID, Err: err})
+			}
+		}
+	}
+	if r.logger != nil {
+		r.logger.Info("批量创建消息 %d 条，失败 %d 条", len(msgs), len(failed))
+	}
+	return models.NewBatchError(len(msgs), failed)
+}
+
+// createGroup 在一个事务中写入同一会话的消息，失败时还原自动分配的排序序号
+func (r *MessageStore) createGroup(ctx context.Context, convID string, msgs []*models.Message, idx []int) error {
+	now := time.Now().Unix()
+	batch := make([]*models.Message, len(idx))
+	autoSeq := make([]bool, len(idx))
+	for k, i := range idx {
+		batch[k] = msgs[i]
+		autoSeq[k] = msgs[i].OrderSeq == 0
+		if batch[k].CreatedAt == 0 {
+			batch[k].CreatedAt = now
+		}
+	}
+
+	convKey := ConversationKeyPrefix + convID
+	messagesKey := ConversationMessagesPrefix + convID
+	seqKey := ConversationOrderSeqPrefix + convID
+	err := watchTx(ctx, r.client, func(tx *redis.Tx) error {
+		next, err := nextOrderSeq(ctx, tx, convID)
+		if err != nil {
+			return err
+		}
+		var last *models.Message
+		tokens := 0
+		for k, msg := range batch {
+			if autoSeq[k] {
+				msg.OrderSeq = next
+			}
+			if msg.OrderSeq >= next {
+				next = msg.OrderSeq + 1
+			}
+			// 与有序集合的排序规则一致，分数相同时取字典序较大的成员
+			if last == nil || msg.OrderSeq > last.OrderSeq || (msg.OrderSeq == last.OrderSeq && msg.MsgID > last.MsgID) {
+				last = msg
+			}
+			tokens += msg.TokenCount
+		}
+
+		conv, err := readConversation(ctx, tx, convID)
+		if err != nil {
+			return err
+		}
+		if conv != nil && conv.DeletedAt != 0 {
+			return models.ErrDeleted
+		}
+		if conv != nil {
+			if err := refreshLastMessage(ctx, tx, conv, last, ""); err != nil {
+				return err
+			}
+			conv.MessageCount += int64(len(batch))
+			conv.TotalTokens += int64(tokens)
+			conv.UpdatedAt = now
+		}
+
+		values := make([][]byte, len(batch))
+		members := make([]*redis.Z, len(batch))
+		for k, msg := range batch {
+			if values[k], err = json.Marshal(msg); err != nil {
+				return err
+			}
+			members[k] = &redis.Z{Score: float64(msg.OrderSeq), Member: msg.MsgID}
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for k, msg := range batch {
+				pipe.Set(ctx, MessageKeyPrefix+msg.MsgID, values[k], 0)
+			}
+			pipe.ZAdd(ctx, messagesKey, members...)
+			pipe.Set(ctx, seqKey, next-1, 0)
+			if conv != nil {
+				return writeConversation(ctx, pipe, conv)
+			}
+			return nil
+		})
+		return err
+	}, convKey, messagesKey, seqKey)
+	if err != nil {
+		for k, msg := range batch {
+			if autoSeq[k] {
+				msg.OrderSeq = 0
+			}
+		}
+	}
+	return err
+}
+
+// groupByConversation 为消息补全ID并按会话分组，返回会话的出现顺序、各会话的消息下标和无效项
+func groupByConversation(msgs []*models.Message) ([]string, map[string][]int, []*models.BatchItemError) {
+	var convIDs []string
+	var failed []*models.BatchItemError
+	groups := make(map[string][]int)
+	for i, msg := range msgs {
+		if msg == nil {
+			failed = append(failed, &models.BatchItemError{Index: i, Err: fmt.Errorf("消息为空")})
+			continue
+		}
+		if len(msg.MsgID) == 0 {
+			msg.MsgID = uuid.NewString()
+		}
+		if _, ok := groups[msg.ConversationID]; !ok {
+			convIDs = append(convIDs, msg.ConversationID)
+		}
+		groups[msg.ConversationID] = append(groups[msg.ConversationID], i)
+	}
+	return convIDs, groups, failed
+}
+
 // 兼容旧版本的日志输出，将来可以移除
 func (r *MessageStore) logError(format string, args ...interface{}) {
 	log.Printf("Redis错误: "+format, args...)
 }
 
-// Update 更新消息
+// Update 更新消息，并在同一事务中更新所属会话的活动字段
 func (r *MessageStore) Update(msg *models.Message) error {
-	ctx := context.Background()
+	_, err := r.save(msg.MsgID, msg.ConversationID, func(old *models.Message) (*models.Message, error) {
+		return msg, nil
+	})
+	return err
+}
 
-	// 转换消息为JSON
-	data, err := json.Marshal(msg)
-	if err != nil {
-		if r.logger != nil {
-			r.logger.Error("消息序列化失败: %v", err)
-		} else if r.debug {
-			r.logError("消息序列化失败: %v", err)
+// CompareAndUpdate 在乐观事务中比较版本号，一致时更新消息
+func (r *MessageStore) CompareAndUpdate(msg *models.Message) error {
+	_, err := r.save(msg.MsgID, msg.ConversationID, func(old *models.Message) (*models.Message, error) {
+		if old == nil {
+			return nil, fmt.Errorf("message not found")
 		}
-		return err
+		if err := models.CheckVersion(&msg.Version, old.Version); err != nil {
+			return nil, err
+		}
+		return msg, nil
+	})
+	return err
+}
+
+// Patch 在乐观事务中读取消息，应用部分字段更新并写回
+func (r *MessageStore) Patch(msgID string, patch *models.MessagePatch) (*models.Message, error) {
+	cur, err := r.GetByID(msgID)
+	if err != nil {
+		return nil, err
 	}
+	return r.save(msgID, cur.ConversationID, func(old *models.Message) (*models.Message, error) {
+		if old == nil {
+			return nil, fmt.Errorf("message not found")
+		}
+		if err := models.CheckVersion(patch.Version, old.Version); err != nil {
+			return nil, err
+		}
+		msg := *old
+		patch.Apply(&msg)
+		return &msg, nil
+	})
+}
+
+// save 在乐观事务中写入 build 根据当前消息生成的新消息，递增版本号，保存修订并更新所属会话的活动字段
+// build 的参数在消息不存在时为nil，事务冲突重试时会再次调用
+func (r *MessageStore) save(msgID, convID string, build func(old *models.Message) (*models.Message, error)) (*models.Message, error) {
+	ctx := context.Background()
 
-	// 更新消息
-	key := MessageKeyPrefix + msg.MsgID
-	if err := r.client.Set(ctx, key, data, 0).Err(); err != nil {
+	key := MessageKeyPrefix + msgID
+	convKey := ConversationKeyPrefix + convID
+	messagesKey := ConversationMessagesPrefix + convID
+	var saved *models.Message
+	err := watchTx(ctx, r.client, func(tx *redis.Tx) error {
+		old, err := readMessage(ctx, tx, msgID)
+		if err != nil {
+			return err
+		}
+		if old != nil && old.DeletedAt != 0 {
+			return models.ErrDeleted
+		}
+		msg, err := build(old)
+		if err != nil {
+			return err
+		}
+		var revision []byte
+		var version int64
+		if old != nil {
+			if rev := models.NextRevision(old, msg, time.Now().Unix()); rev != nil {
+				if revision, err = json.Marshal(rev); err != nil {
+					return err
+				}
+			}
+			version = old.Version
+		}
+		msg.Version = version + 1
+		conv, err := readConversation(ctx, tx, convID)
+		if err != nil {
+			return err
+		}
+		if conv != nil {
+			if err := refreshLastMessage(ctx, tx, conv, msg, msgID); err != nil {
+				return err
+			}
+			if old != nil {
+				conv.TotalTokens += int64(msg.TokenCount - old.TokenCount)
+			} else {
+				conv.MessageCount++
+				conv.TotalTokens += int64(msg.TokenCount)
+			}
+			conv.UpdatedAt = time.Now().Unix()
+		}
+
+		// 转换消息为JSON
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+
+		// 更新消息、会话列表中的排序分数和会话，并追加旧版本的修订
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, 0)
+			if revision != nil {
+				pipe.RPush(ctx, MessageRevisionsPrefix+msgID, revision)
+			}
+			pipe.ZAdd(ctx, messagesKey, &redis.Z{
+				Score:  float64(msg.OrderSeq),
+				Member: msgID,
+			})
+			if conv != nil {
+				return writeConversation(ctx, pipe, conv)
+			}
+			return nil
+		})
+		if err == nil {
+			saved = msg
+		}
+		return err
+	}, key, convKey, messagesKey)
+	if err != nil {
 		if r.logger != nil {
 			r.logger.Error("更新消息失败: %v", err)
 		} else if r.debug {
 			r.logError("更新消息失败: %v", err)
 		}
-		return err
+		return nil, err
 	}
 
-	// 更新会话列表中的排序分数
-	convKey := ConversationMessagesPrefix + msg.ConversationID
-	if err := r.client.ZAdd(ctx, convKey, &redis.Z{
-		Score:  float64(msg.OrderSeq),
-		Member: msg.MsgID,
-	}).Err(); err != nil {
+	// 重建全文检索索引
+	if err := indexMessage(ctx, r.client, saved); err != nil {
 		if r.logger != nil {
-			r.logger.Error("更新消息排序分数失败: %v", err)
+			r.logger.Error("更新消息检索索引失败: %v", err)
 		} else if r.debug {
-			r.logError("更新消息排序分数失败: %v", err)
+			r.logError("更新消息检索索引失败: %v", err)
 		}
-		return err
+		return nil, err
 	}
 
 	if r.logger != nil {
-		r.logger.Info("消息 %s 更新成功", msg.MsgID)
+		r.logger.Info("消息 %s 更新成功", msgID)
 	}
 
-	return nil
+	return saved, nil
 }
 
-// Delete 删除消息
+// Delete 将消息移入回收站，并在同一事务中更新所属会话的活动字段
 func (r *MessageStore) Delete(msgID string) error {
 	ctx := context.Background()
 
@@ -163,9 +434,44 @@ func (r *MessageStore) Delete(msgID string) error {
 		return err
 	}
 
-	// 删除消息
 	key := MessageKeyPrefix + msgID
-	if err := r.client.Del(ctx, key).Err(); err != nil {
+	convKey := ConversationKeyPrefix + msg.ConversationID
+	messagesKey := ConversationMessagesPrefix + msg.ConversationID
+	err = watchTx(ctx, r.client, func(tx *redis.Tx) error {
+		// 事务内重新读取，消息可能已被并发删除或修改
+		current, err := readMessage(ctx, tx, msgID)
+		if err != nil || current == nil || current.DeletedAt != 0 {
+			return err
+		}
+		conv, err := readConversation(ctx, tx, msg.ConversationID)
+		if err != nil {
+			return err
+		}
+		if conv != nil {
+			if err := refreshLastMessage(ctx, tx, conv, nil, msgID); err != nil {
+				return err
+			}
+			if conv.MessageCount > 0 {
+				conv.MessageCount--
+			}
+			conv.TotalTokens -= int64(current.TokenCount)
+			conv.UpdatedAt = time.Now().Unix()
+		}
+
+		// 将消息从会话列表移入回收站并更新会话
+		current.DeletedAt = time.Now().Unix()
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if err := trashMessage(ctx, pipe, current); err != nil {
+				return err
+			}
+			if conv != nil {
+				return writeConversation(ctx, pipe, conv)
+			}
+			return nil
+		})
+		return err
+	}, key, convKey, messagesKey)
+	if err != nil {
 		if r.logger != nil {
 			r.logger.Error("删除消息失败: %v", err)
 		} else if r.debug {
@@ -174,21 +480,151 @@ func (r *MessageStore) Delete(msgID string) error {
 		return err
 	}
 
-	// 从会话列表中移除
-	convKey := ConversationMessagesPrefix + msg.ConversationID
-	if err := r.client.ZRem(ctx, convKey, msgID).Err(); err != nil {
+	// 移除全文检索索引
+	if err := unindexMessage(ctx, r.client, msgID); err != nil {
 		if r.logger != nil {
-			r.logger.Error("从会话中移除消息失败: %v", err)
+			r.logger.Error("移除消息检索索引失败: %v", err)
 		} else if r.debug {
-			r.logError("从会话中移除消息失败: %v", err)
+			r.logError("移除消息检索索引失败: %v", err)
 		}
 		return err
 	}
 
 	if r.logger != nil {
-		r.logger.Info("消息 %s 删除成功", msgID)
+		r.logger.Info("消息 %s 已移入回收站", msgID)
+	}
+
+	return nil
+}
+
+// Restore 从回收站恢复消息，并在同一事务中更新所属会话的活动字段
+func (r *MessageStore) Restore(msgID string) error {
+	ctx := context.Background()
+
+	msg, err := r.GetDeleted(msgID)
+	if err != nil {
+		return err
+	}
+
+	key := MessageKeyPrefix + msgID
+	convKey := ConversationKeyPrefix + msg.ConversationID
+	messagesKey := ConversationMessagesPrefix + msg.ConversationID
+	err = watchTx(ctx, r.client, func(tx *redis.Tx) error {
+		current, err := readMessage(ctx, tx, msgID)
+		if err != nil {
+			return err
+		}
+		if current == nil || current.DeletedAt == 0 {
+			return fmt.Errorf("message not found in trash")
+		}
+		conv, err := readConversation(ctx, tx, current.ConversationID)
+		if err != nil {
+			return err
+		}
+		if conv != nil && conv.DeletedAt != 0 {
+			return models.ErrDeleted
+		}
+		if conv != nil {
+			if err := refreshLastMessage(ctx, tx, conv, current, msgID); err != nil {
+				return err
+			}
+			conv.MessageCount++
+			conv.TotalTokens += int64(current.TokenCount)
+			conv.UpdatedAt = time.Now().Unix()
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if err := restoreMessage(ctx, pipe, current); err != nil {
+				return err
+			}
+			if conv != nil {
+				return writeConversation(ctx, pipe, conv)
+			}
+			return nil
+		})
+		msg = current
+		return err
+	}, key, convKey, messagesKey)
+	if err != nil {
+		if r.logger != nil {
+			r.logger.Error("恢复消息 %s 失败: %v", msgID, err)
+		}
+		return err
+	}
+
+	if err := indexMessage(ctx, r.client, msg); err != nil {
+		return err
 	}
 
+	if r.logger != nil {
+		r.logger.Info("消息 %s 已恢复", msgID)
+	}
+	return nil
+}
+
+// GetDeleted 获取回收站中的消息
+func (r *MessageStore) GetDeleted(msgID string) (*models.Message, error) {
+	msg, err := readMessage(context.Background(), r.client, msgID)
+	if err != nil {
+		return nil, err
+	}
+	if msg == nil || msg.DeletedAt == 0 {
+		return nil, fmt.Errorf("message not found in trash")
+	}
+	return msg, nil
+}
+
+// ListDeleted 按删除时间降序获取回收站中的消息
+func (r *MessageStore) ListDeleted(conversationID string, before int64, offset, limit int) ([]*models.Message, error) {
+	ctx := context.Background()
+
+	key := DeletedMessagesKey
+	if conversationID != "" {
+		key = ConversationDeletedMessagesPrefix + conversationID
+	}
+	by := deletedRange(before)
+	by.Offset, by.Count = int64(offset), int64(limit)
+	msgIDs, err := r.client.ZRevRangeByScore(ctx, key, by).Result()
+	if err != nil {
+		if r.logger != nil {
+			r.logger.Error("获取回收站消息列表失败: %v", err)
+		}
+		return nil, err
+	}
+	return readMessages(ctx, r.client, msgIDs)
+}
+
+// Purge 永久删除回收站中的消息及其附件关联、评价和历史修订
+func (r *MessageStore) Purge(msgID string) error {
+	ctx := context.Background()
+
+	msg, err := readMessage(ctx, r.client, msgID)
+	if err != nil || msg == nil || msg.DeletedAt == 0 {
+		return err
+	}
+	links, err := readMessageLinks(ctx, r.client, msgID)
+	if err != nil {
+		return err
+	}
+
+	pipe := r.client.TxPipeline()
+	purgeMessage(ctx, pipe, msg, links)
+	if _, err := pipe.Exec(ctx); err != nil {
+		if r.logger != nil {
+			r.logger.Error("永久删除消息 %s 失败: %v", msgID, err)
+		}
+		return err
+	}
+	if err := unindexMessage(ctx, r.client, msgID); err != nil {
+		return err
+	}
+	if err := purgeFeedback(ctx, r.client, msgID); err != nil {
+		return err
+	}
+
+	if r.logger != nil {
+		r.logger.Info("消息 %s 已永久删除", msgID)
+	}
 	return nil
 }
 
@@ -225,9 +661,55 @@ func (r *MessageStore) GetByID(msgID string) (*models.Message, error) {
 		return nil, err
 	}
 
+	// 回收站中的消息不参与常规读取
+	if msg.DeletedAt != 0 {
+		return nil, fmt.Errorf("message not found")
+	}
+
 	return &msg, nil
 }
 
+// messageBatchSize 批量读取时单次 MGET 的最大键数
+const messageBatchSize = 500
+
+// GetByIDs 批量获取消息，分批 MGET 后按输入顺序排列
+func (r *MessageStore) GetByIDs(msgIDs []string) ([]*models.Message, error) {
+	ctx := context.Background()
+
+	result := make([]*models.Message, 0, len(msgIDs))
+	var failed []*models.BatchItemError
+	for start := 0; start < len(msgIDs); start += messageBatchSize {
+		ids := msgIDs[start:min(start+messageBatchSize, len(msgIDs))]
+		keys := make([]string, len(ids))
+		for i, msgID := range ids {
+			keys[i] = MessageKeyPrefix + msgID
+		}
+		values, err := r.client.MGet(ctx, keys...).Result()
+		if err != nil {
+			if r.logger != nil {
+				r.logger.Error("批量获取消息失败: %v", err)
+			}
+			return nil, err
+		}
+
+		for i, v := range values {
+			var msg models.Message
+			if data, ok := v.(string); ok {
+				if err := json.Unmarshal([]byte(data), &msg); err != nil {
+					return nil, err
+				}
+			}
+			// 回收站中的消息不参与常规读取
+			if msg.MsgID == "" || msg.DeletedAt != 0 {
+				failed = append(failed, &models.BatchItemError{Index: start + i, ID: ids[i], Err: models.ErrNotFound})
+				continue
+			}
+			result = append(result, &msg)
+		}
+	}
+	return result, models.NewBatchError(len(msgIDs), failed)
+}
+
 // ListByConversation 获取对话的消息列表
 func (r *MessageStore) ListByConversation(conversationID string, offset, limit int) ([]*models.Message, error) {
 	ctx := context.Background()
@@ -255,19 +737,15 @@ func (r *MessageStore) ListByConversation(conversationID string, offset, limit i
 		return []*models.Message{}, nil
 	}
 
-	// 获取每条消息
-	var msgs []*models.Message
-	for _, msgID := range msgIDs {
-		msg, err := r.GetByID(msgID)
-		if err != nil {
-			if r.logger != nil {
-				r.logger.Error("获取消息 %s 详情失败: %v", msgID, err)
-			} else if r.debug {
-				r.logError("获取消息 %s 详情失败: %v", msgID, err)
-			}
-			return nil, err
+	// 一次 MGET 获取全部消息
+	msgs, err := r.GetByIDs(msgIDs)
+	if err != nil {
+		if r.logger != nil {
+			r.logger.Error("获取会话 %s 的消息详情失败: %v", conversationID, err)
+		} else if r.debug {
+			r.logError("获取会话 %s 的消息详情失败: %v", conversationID, err)
 		}
-		msgs = append(msgs, msg)
+		return nil, err
 	}
 
 	// 打印消息内容摘要，方便调试
@@ -294,44 +772,24 @@ func (r *MessageStore) ListByConversation(conversationID string, offset, limit i
 
 // UpdateStatus 更新消息状态
 func (r *MessageStore) UpdateStatus(msgID string, status string) error {
-	msg, err := r.GetByID(msgID)
-	if err != nil {
-		return err
-	}
-
-	msg.Status = status
-	return r.Update(msg)
+	_, err := r.Patch(msgID, &models.MessagePatch{Status: &status})
+	return err
 }
 
 // UpdateTokenCount 更新消息token数量
 func (r *MessageStore) UpdateTokenCount(msgID string, tokenCount int) error {
-	msg, err := r.GetByID(msgID)
-	if err != nil {
-		return err
-	}
-
-	msg.TokenCount = tokenCount
-	return r.Update(msg)
+	_, err := r.Patch(msgID, &models.MessagePatch{TokenCount: &tokenCount})
+	return err
 }
 
 // SetContextEdge 设置消息为上下文边界
 func (r *MessageStore) SetContextEdge(msgID string, isContextEdge bool) error {
-	msg, err := r.GetByID(msgID)
-	if err != nil {
-		return err
-	}
-
-	msg.IsContextEdge = isContextEdge
-	return r.Update(msg)
+	_, err := r.Patch(msgID, &models.MessagePatch{IsContextEdge: &isContextEdge})
+	return err
 }
 
 // SetVariant 设置消息为变体
 func (r *MessageStore) SetVariant(msgID string, isVariant bool) error {
-	msg, err := r.GetByID(msgID)
-	if err != nil {
-		return err
-	}
-
-	msg.IsVariant = isVariant
-	return r.Update(msg)
+	_, err := r.Patch(msgID, &models.MessagePatch{IsVariant: &isVariant})
+	return err
 }
@@ -14,6 +14,8 @@ import (
 const (
 	MessageAttachmentPrefix = "message_attachment:"
 	MessageAttachmentsKey   = "message_attachments"
+	// MessageAttachmentSeqKey 关联记录ID的自增序列
+	MessageAttachmentSeqKey = "message_attachment_seq"
 )
 
 // MessageAttachmentStore Redis implementation
@@ -34,6 +36,15 @@ func NewMessageAttachmentStore(client *redis.Client, debug bool) interfaces.Mess
 func (r *MessageAttachmentStore) Create(messageAttachment *models.MessageAttachment) error {
 	ctx := context.Background()
 
+	// 未指定ID时从自增序列分配，避免关联记录相互覆盖
+	if messageAttachment.ID == 0 {
+		id, err := r.client.Incr(ctx, MessageAttachmentSeqKey).Result()
+		if err != nil {
+			return err
+		}
+		messageAttachment.ID = uint64(id)
+	}
+
 	// 转换为JSON
 	data, err := json.Marshal(messageAttachment)
 	if err != nil {
@@ -143,6 +154,50 @@ func (r *MessageAttachmentStore) ListByMessage(messageID string) ([]*models.Mess
 	return messageAttachments, nil
 }
 
+// ListByMessages 通过管道读取多条消息的关联ID，再批量 MGET 关联记录
+func (r *MessageAttachmentStore) ListByMessages(messageIDs []string) ([]*models.MessageAttachment, error) {
+	ctx := context.Background()
+
+	messageAttachments := []*models.MessageAttachment{}
+	if len(messageIDs) == 0 {
+		return messageAttachments, nil
+	}
+
+	pipe := r.client.Pipeline()
+	cmds := make([]*redis.StringSliceCmd, len(messageIDs))
+	for i, messageID := range messageIDs {
+		cmds[i] = pipe.SMembers(ctx, fmt.Sprintf("%s%s", MessageAttachmentsKey, messageID))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, cmd := range cmds {
+		for _, idStr := range cmd.Val() {
+			keys = append(keys, fmt.Sprintf("%s%s", MessageAttachmentPrefix, idStr))
+		}
+	}
+
+	for start := 0; start < len(keys); start += messageBatchSize {
+		values, err := r.client.MGet(ctx, keys[start:min(start+messageBatchSize, len(keys))]...).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range values {
+			data, ok := v.(string)
+			if !ok {
+				continue
+			}
+			var messageAttachment models.MessageAttachment
+			if err := json.Unmarshal([]byte(data), &messageAttachment); err != nil {
+				return nil, err
+			}
+			messageAttachments = append(messageAttachments, &messageAttachment)
+		}
+	}
+	return messageAttachments, nil
+}
+
 // ListByAttachment gets message attachment associations by attachment ID
 func (r *MessageAttachmentStore) ListByAttachment(attachmentID string) ([]*models.MessageAttachment, error) {
 	ctx := context.Background()
@@ -179,3 +234,8 @@ func (r *MessageAttachmentStore) ListByAttachment(attachmentID string) ([]*model
 
 	return messageAttachments, nil
 }
+
+// CountByAttachment 统计附件的消息关联数
+func (r *MessageAttachmentStore) CountByAttachment(attachmentID string) (int64, error) {
+	return r.client.SCard(context.Background(), MessageAttachmentsKey+attachmentID).Result()
+}
@@ -16,7 +16,16 @@ type Provider struct {
 	conversationRepo      interfaces.ConversationStore
 	attachmentRepo        interfaces.AttachmentStore
 	messageAttachmentRepo interfaces.MessageAttachmentStore
+	searchRepo            interfaces.SearchStore
+	embeddingRepo         interfaces.EmbeddingStore
+	feedbackRepo          interfaces.FeedbackStore
+	tagRepo               interfaces.TagStore
+	folderRepo            interfaces.FolderStore
+	auditRepo             interfaces.AuditStore
+	blobRepo              interfaces.BlobStore
+	attachmentChunkRepo   interfaces.AttachmentChunkStore
 	logger                *logger.Logger
+	debug                 bool
 }
 
 // NewProvider 创建Redis提供者实例
@@ -55,6 +64,7 @@ func NewProvider(dsn string, loggingEnabled bool, logLevel string) (*Provider, e
 	provider := &Provider{
 		client: client,
 		logger: customLogger,
+		debug:  loggingEnabled,
 	}
 
 	// 为了兼容现有代码，我们需要先创建仓库，然后再设置logger
@@ -63,6 +73,14 @@ func NewProvider(dsn string, loggingEnabled bool, logLevel string) (*Provider, e
 	provider.conversationRepo = NewConversationStore(client, debug)
 	provider.attachmentRepo = NewAttachmentStore(client, debug)
 	provider.messageAttachmentRepo = NewMessageAttachmentStore(client, debug)
+	provider.searchRepo = NewSearchStore(client, debug)
+	provider.embeddingRepo = NewEmbeddingStore(client, debug)
+	provider.feedbackRepo = NewFeedbackStore(client, debug)
+	provider.tagRepo = NewTagStore(client, debug)
+	provider.folderRepo = NewFolderStore(client, debug)
+	provider.auditRepo = NewAuditStore(client, debug)
+	provider.blobRepo = NewBlobStore(client, debug)
+	provider.attachmentChunkRepo = NewAttachmentChunkStore(client, debug)
 
 	// 设置日志记录器
 	setLoggers(provider)
@@ -78,6 +96,30 @@ func setLoggers(p *Provider) {
 	if messageRepo, ok := p.messageRepo.(*MessageStore); ok && messageRepo != nil {
 		messageRepo.SetLogger(p.logger)
 	}
+	if searchRepo, ok := p.searchRepo.(*SearchStore); ok && searchRepo != nil {
+		searchRepo.SetLogger(p.logger)
+	}
+	if embeddingRepo, ok := p.embeddingRepo.(*EmbeddingStore); ok && embeddingRepo != nil {
+		embeddingRepo.SetLogger(p.logger)
+	}
+	if feedbackRepo, ok := p.feedbackRepo.(*FeedbackStore); ok && feedbackRepo != nil {
+		feedbackRepo.SetLogger(p.logger)
+	}
+	if tagRepo, ok := p.tagRepo.(*TagStore); ok && tagRepo != nil {
+		tagRepo.SetLogger(p.logger)
+	}
+	if folderRepo, ok := p.folderRepo.(*FolderStore); ok && folderRepo != nil {
+		folderRepo.SetLogger(p.logger)
+	}
+	if auditRepo, ok := p.auditRepo.(*AuditStore); ok && auditRepo != nil {
+		auditRepo.SetLogger(p.logger)
+	}
+	if blobRepo, ok := p.blobRepo.(*BlobStore); ok && blobRepo != nil {
+		blobRepo.SetLogger(p.logger)
+	}
+	if attachmentChunkRepo, ok := p.attachmentChunkRepo.(*AttachmentChunkStore); ok && attachmentChunkRepo != nil {
+		attachmentChunkRepo.SetLogger(p.logger)
+	}
 }
 
 // GetMessageStore 获取消息存储库
@@ -108,6 +150,62 @@ func (p *Provider) GetMessageAttachmentStore() interfaces.MessageAttachmentStore
 	return p.messageAttachmentRepo
 }
 
+// GetSearchStore 获取全文检索存储库
+// 返回:
+//   - interfaces.SearchStore: 全文检索存储库实例
+func (p *Provider) GetSearchStore() interfaces.SearchStore {
+	return p.searchRepo
+}
+
+// GetEmbeddingStore 获取向量存储库
+// 返回:
+//   - interfaces.EmbeddingStore: 向量存储库实例
+func (p *Provider) GetEmbeddingStore() interfaces.EmbeddingStore {
+	return p.embeddingRepo
+}
+
+// GetFeedbackStore 获取消息评价存储库
+// 返回:
+//   - interfaces.FeedbackStore: 消息评价存储库实例
+func (p *Provider) GetFeedbackStore() interfaces.FeedbackStore {
+	return p.feedbackRepo
+}
+
+// GetTagStore 获取标签存储库
+// 返回:
+//   - interfaces.TagStore: 标签存储库实例
+func (p *Provider) GetTagStore() interfaces.TagStore {
+	return p.tagRepo
+}
+
+// GetFolderStore 获取文件夹存储库
+// 返回:
+//   - interfaces.FolderStore: 文件夹存储库实例
+func (p *Provider) GetFolderStore() interfaces.FolderStore {
+	return p.folderRepo
+}
+
+// GetAuditStore 获取审计日志存储库
+// 返回:
+//   - interfaces.AuditStore: 审计日志存储库实例
+func (p *Provider) GetAuditStore() interfaces.AuditStore {
+	return p.auditRepo
+}
+
+// GetBlobStore 获取附件内容存储库
+// 返回:
+//   - interfaces.BlobStore: 附件内容存储库实例
+func (p *Provider) GetBlobStore() interfaces.BlobStore {
+	return p.blobRepo
+}
+
+// GetAttachmentChunkStore 获取附件文本分块存储库
+// 返回:
+//   - interfaces.AttachmentChunkStore: 附件文本分块存储库实例
+func (p *Provider) GetAttachmentChunkStore() interfaces.AttachmentChunkStore {
+	return p.attachmentChunkRepo
+}
+
 // Close 关闭数据库连接
 // 返回:
 //   - error: 如果关闭过程中发生错误
@@ -0,0 +1,53 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hildam/eino-history/model"
+)
+
+// MessageRevisionsPrefix 消息的历史修订列表，按修订号升序追加
+const MessageRevisionsPrefix = "message:revisions:"
+
+// ListRevisions 按修订号升序获取消息的历史修订
+func (r *MessageStore) ListRevisions(msgID string) ([]*models.MessageRevision, error) {
+	ctx := context.Background()
+
+	values, err := r.client.LRange(ctx, MessageRevisionsPrefix+msgID, 0, -1).Result()
+	if err != nil {
+		r.logError("获取消息修订列表失败: %v", err)
+		return nil, err
+	}
+
+	revisions := make([]*models.MessageRevision, 0, len(values))
+	for _, data := range values {
+		var rev models.MessageRevision
+		if err := json.Unmarshal([]byte(data), &rev); err != nil {
+			r.logError("消息修订反序列化失败: %v", err)
+			return nil, err
+		}
+		revisions = append(revisions, &rev)
+	}
+	return revisions, nil
+}
+
+// GetRevision 获取消息的指定历史修订
+func (r *MessageStore) GetRevision(msgID string, revision int) (*models.MessageRevision, error) {
+	revisions, err := r.ListRevisions(msgID)
+	if err != nil {
+		return nil, err
+	}
+	for _, rev := range revisions {
+		if rev.Revision == revision {
+			return rev, nil
+		}
+	}
+	return nil, fmt.Errorf("revision not found")
+}
+
+// DeleteRevisions 删除消息的全部历史修订
+func (r *MessageStore) DeleteRevisions(msgID string) error {
+	return r.client.Del(context.Background(), MessageRevisionsPrefix+msgID).Err()
+}
@@ -0,0 +1,314 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"sort"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/hildam/eino-history/model"
+	"github.com/hildam/eino-history/store/common/fulltext"
+	"github.com/hildam/eino-history/store/common/logger"
+	"github.com/hildam/eino-history/store/interfaces"
+)
+
+// 倒排索引的 key 前缀
+const (
+	// SearchTermPrefix 检索词的倒排列表，ZSET，成员为消息ID，分数为词频
+	SearchTermPrefix = "search:term:"
+	// SearchMessageTermsPrefix 消息包含的检索词集合，用于更新和删除时清理倒排列表
+	SearchMessageTermsPrefix = "search:message_terms:"
+	// SearchMessagesKey 已建立索引的消息集合，用于计算逆文档频率
+	SearchMessagesKey = "search:messages"
+)
+
+// BM25 词频饱和参数
+const bm25K1 = 1.2
+
+// SearchStore 实现SearchStore接口的Redis实现，基于自维护的倒排索引
+type SearchStore struct {
+	client *redis.Client
+	debug  bool
+	logger *logger.Logger
+}
+
+// NewSearchStore 创建Redis全文检索实例
+func NewSearchStore(client *redis.Client, debug bool) interfaces.SearchStore {
+	return &SearchStore{
+		client: client,
+		debug:  debug,
+	}
+}
+
+// SetLogger 设置日志记录器
+func (r *SearchStore) SetLogger(logger *logger.Logger) {
+	r.logger = logger
+}
+
+// indexMessage 为消息内容建立倒排索引，已有索引会先被清理
+func indexMessage(ctx context.Context, client *redis.Client, msg *models.Message) error {
+	if err := unindexMessage(ctx, client, msg.MsgID); err != nil {
+		return err
+	}
+
+	freqs := fulltext.TermFrequencies(msg.Content)
+	if len(freqs) == 0 {
+		return nil
+	}
+
+	pipe := client.TxPipeline()
+	terms := make([]interface{}, 0, len(freqs))
+	for term, tf := range freqs {
+		pipe.ZAdd(ctx, SearchTermPrefix+term, &redis.Z{
+			Score:  float64(tf),
+			Member: msg.MsgID,
+		})
+		terms = append(terms, term)
+	}
+	pipe.SAdd(ctx, SearchMessageTermsPrefix+msg.MsgID, terms...)
+	pipe.SAdd(ctx, SearchMessagesKey, msg.MsgID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// unindexMessage 从倒排索引中移除消息
+func unindexMessage(ctx context.Context, client *redis.Client, msgID string) error {
+	termsKey := SearchMessageTermsPrefix + msgID
+	terms, err := client.SMembers(ctx, termsKey).Result()
+	if err != nil {
+		return err
+	}
+
+	pipe := client.TxPipeline()
+	for _, term := range terms {
+		pipe.ZRem(ctx, SearchTermPrefix+term, msgID)
+	}
+	pipe.Del(ctx, termsKey)
+	pipe.SRem(ctx, SearchMessagesKey, msgID)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// Search 按关键词检索消息
+// 对每个检索词读取倒排列表并按BM25公式累加得分，再按得分顺序分批读取候选消息并校验过滤条件，
+// 取满 Offset+Limit 条命中后停止读取
+func (r *SearchStore) Search(query string, filter *models.SearchFilter) (*models.SearchResult, error) {
+	ctx := context.Background()
+
+	if filter == nil {
+		filter = &models.SearchFilter{}
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = models.DefaultSearchLimit
+	}
+
+	terms := uniqueTerms(fulltext.Tokenize(query))
+	result := &models.SearchResult{}
+	if len(terms) == 0 {
+		return result, nil
+	}
+
+	total, err := r.client.SCard(ctx, SearchMessagesKey).Result()
+	if err != nil {
+		r.logError("读取索引文档数失败: %v", err)
+		return nil, err
+	}
+
+	// 累加每条消息的相关度得分
+	scores := make(map[string]float64)
+	for _, term := range terms {
+		postings, err := r.client.ZRangeWithScores(ctx, SearchTermPrefix+term, 0, -1).Result()
+		if err != nil {
+			r.logError("读取检索词 %s 的倒排列表失败: %v", term, err)
+			return nil, err
+		}
+		df := float64(len(postings))
+		if df == 0 {
+			continue
+		}
+		idf := math.Log(1 + (float64(total)-df+0.5)/(df+0.5))
+		for _, p := range postings {
+			tf := p.Score
+			scores[p.Member.(string)] += idf * tf * (bm25K1 + 1) / (tf + bm25K1)
+		}
+	}
+
+	candidates := make([]string, 0, len(scores))
+	for msgID := range scores {
+		candidates = append(candidates, msgID)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if scores[candidates[i]] != scores[candidates[j]] {
+			return scores[candidates[i]] > scores[candidates[j]]
+		}
+		return candidates[i] < candidates[j]
+	})
+
+	// 按得分顺序分批读取候选消息，取满当前页后停止读取
+	need := int64(filter.Offset + limit)
+	convs := make(map[string]*models.Conversation)
+	checked := 0
+	for checked < len(candidates) && result.Total < need {
+		batch := candidates[checked:min(checked+messageBatchSize, len(candidates))]
+		msgs, err := r.loadMessages(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+		for _, msgID := range batch {
+			if result.Total >= need {
+				break
+			}
+			checked++
+			msg := msgs[msgID]
+			if msg == nil || msg.DeletedAt != 0 {
+				continue
+			}
+			ok, err := r.matchFilter(ctx, msg, filter, convs)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+
+			result.Total++
+			if result.Total <= int64(filter.Offset) {
+				continue
+			}
+			result.Hits = append(result.Hits, &models.SearchHit{
+				MsgID:          msg.MsgID,
+				ConversationID: msg.ConversationID,
+				Role:           msg.Role,
+				Snippet:        fulltext.Snippet(msg.Content, terms, 0),
+				Score:          scores[msgID],
+				CreatedAt:      msg.CreatedAt,
+			})
+		}
+	}
+	// 未读取的候选不再校验过滤条件，计入总数，此时总数为上界
+	result.Total += int64(len(candidates) - checked)
+
+	if r.logger != nil {
+		r.logger.Info("检索 %q 命中 %d 条消息", query, result.Total)
+	}
+	return result, nil
+}
+
+// loadMessages 使用MGET批量读取消息，调用方按 messageBatchSize 分批
+func (r *SearchStore) loadMessages(ctx context.Context, msgIDs []string) (map[string]*models.Message, error) {
+	msgs := make(map[string]*models.Message, len(msgIDs))
+	if len(msgIDs) == 0 {
+		return msgs, nil
+	}
+
+	keys := make([]string, len(msgIDs))
+	for i, msgID := range msgIDs {
+		keys[i] = MessageKeyPrefix + msgID
+	}
+
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		r.logError("批量读取消息失败: %v", err)
+		return nil, err
+	}
+
+	for i, v := range values {
+		data, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var msg models.Message
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			r.logError("消息 %s 反序列化失败: %v", msgIDs[i], err)
+			return nil, err
+		}
+		msgs[msgIDs[i]] = &msg
+	}
+	return msgs, nil
+}
+
+// matchFilter 判断消息是否满足过滤条件，会话信息按需读取并缓存
+func (r *SearchStore) matchFilter(ctx context.Context, msg *models.Message, filter *models.SearchFilter,
+	convs map[string]*models.Conversation) (bool, error) {
+	if filter.ConversationID != "" && msg.ConversationID != filter.ConversationID {
+		return false, nil
+	}
+	if len(filter.Roles) > 0 && !containsString(filter.Roles, msg.Role) {
+		return false, nil
+	}
+	if filter.Since > 0 && msg.CreatedAt < filter.Since {
+		return false, nil
+	}
+	if filter.Until > 0 && msg.CreatedAt > filter.Until {
+		return false, nil
+	}
+	if filter.Archived == nil && filter.Pinned == nil && filter.Owner == nil {
+		return true, nil
+	}
+
+	conv, ok := convs[msg.ConversationID]
+	if !ok {
+		data, err := r.client.Get(ctx, ConversationKeyPrefix+msg.ConversationID).Bytes()
+		switch {
+		case err == redis.Nil:
+			// 会话不存在时按未归档、未置顶处理，且不属于任何归属范围
+			conv = nil
+		case err != nil:
+			r.logError("读取会话 %s 失败: %v", msg.ConversationID, err)
+			return false, err
+		default:
+			conv = &models.Conversation{}
+			if err := json.Unmarshal(data, conv); err != nil {
+				return false, err
+			}
+		}
+		convs[msg.ConversationID] = conv
+	}
+
+	if conv == nil {
+		return filter.Owner == nil && (filter.Archived == nil || !*filter.Archived) &&
+			(filter.Pinned == nil || !*filter.Pinned), nil
+	}
+	if filter.Owner != nil && !filter.Owner.Owns(conv) {
+		return false, nil
+	}
+	if filter.Archived != nil && conv.IsArchived != *filter.Archived {
+		return false, nil
+	}
+	if filter.Pinned != nil && conv.IsPinned != *filter.Pinned {
+		return false, nil
+	}
+	return true, nil
+}
+
+// logError 记录错误日志
+func (r *SearchStore) logError(format string, args ...interface{}) {
+	if r.logger != nil {
+		r.logger.Error(format, args...)
+	}
+}
+
+// uniqueTerms 去除重复的检索词并保持原有顺序
+func uniqueTerms(terms []string) []string {
+	seen := make(map[string]bool, len(terms))
+	var result []string
+	for _, t := range terms {
+		if !seen[t] {
+			seen[t] = true
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+// containsString 判断字符串是否在列表中
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,338 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/hildam/eino-history/model"
+	"github.com/hildam/eino-history/store/common/logger"
+	"github.com/hildam/eino-history/store/interfaces"
+)
+
+// Redis key patterns
+const (
+	// TagKeyPrefix 标签数据
+	TagKeyPrefix = "tag:"
+	// TagNamesPrefix 归属内标签名称到标签ID的哈希，key 为 tag_names:<租户ID>:user:<用户ID>
+	TagNamesPrefix = "tag_names:"
+	// TagConversationsPrefix 带有标签的会话ID集合
+	TagConversationsPrefix = "tag:conversations:"
+	// ConversationTagsPrefix 会话的标签ID集合
+	ConversationTagsPrefix = "conversation:tags:"
+)
+
+// ownerKey 标签和文件夹归属索引的 key 后缀
+func ownerKey(tenantID, userID string) string {
+	return tenantID + ":user:" + userID
+}
+
+// TagStore 实现TagStore接口的Redis实现
+type TagStore struct {
+	client *redis.Client
+	debug  bool
+	logger *logger.Logger
+}
+
+// NewTagStore 创建Redis标签存储库实例
+func NewTagStore(client *redis.Client, debug bool) interfaces.TagStore {
+	return &TagStore{
+		client: client,
+		debug:  debug,
+	}
+}
+
+// SetLogger 设置日志记录器
+func (r *TagStore) SetLogger(logger *logger.Logger) {
+	r.logger = logger
+}
+
+// Create 创建标签，监视名称哈希保证同一归属内名称唯一
+func (r *TagStore) Create(tag *models.Tag) error {
+	ctx := context.Background()
+
+	if tag.TagID == "" {
+		tag.TagID = uuid.NewString()
+	}
+	if tag.CreatedAt == 0 {
+		tag.CreatedAt = time.Now().Unix()
+	}
+	data, err := json.Marshal(tag)
+	if err != nil {
+		return err
+	}
+
+	namesKey := TagNamesPrefix + ownerKey(tag.TenantID, tag.UserID)
+	err = watchTx(ctx, r.client, func(tx *redis.Tx) error {
+		exists, err := tx.HExists(ctx, namesKey, tag.Name).Result()
+		if err != nil {
+			return err
+		}
+		if exists {
+			return models.ErrNameConflict
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, TagKeyPrefix+tag.TagID, data, 0)
+			pipe.HSet(ctx, namesKey, tag.Name, tag.TagID)
+			return nil
+		})
+		return err
+	}, namesKey)
+	if err != nil {
+		r.logError("创建标签失败: %v", err)
+		return err
+	}
+
+	if r.logger != nil {
+		r.logger.Info("标签 %s 创建成功", tag.TagID)
+	}
+	return nil
+}
+
+// GetByID 根据ID获取标签
+func (r *TagStore) GetByID(tagID string) (*models.Tag, error) {
+	tag, err := readTag(context.Background(), r.client, tagID)
+	if err != nil {
+		return nil, err
+	}
+	if tag == nil {
+		return nil, fmt.Errorf("tag not found")
+	}
+	return tag, nil
+}
+
+// List 获取指定归属的全部标签
+func (r *TagStore) List(tenantID, userID string) ([]*models.Tag, error) {
+	ctx := context.Background()
+
+	tagIDs, err := r.client.HVals(ctx, TagNamesPrefix+ownerKey(tenantID, userID)).Result()
+	if err != nil {
+		r.logError("获取标签列表失败: %v", err)
+		return nil, err
+	}
+	return readTags(ctx, r.client, tagIDs)
+}
+
+// Rename 重命名标签
+func (r *TagStore) Rename(tagID, name string) error {
+	ctx := context.Background()
+
+	tag, err := r.GetByID(tagID)
+	if err != nil {
+		return err
+	}
+	namesKey := TagNamesPrefix + ownerKey(tag.TenantID, tag.UserID)
+	key := TagKeyPrefix + tagID
+
+	err = watchTx(ctx, r.client, func(tx *redis.Tx) error {
+		tag, err := readTag(ctx, tx, tagID)
+		if err != nil {
+			return err
+		}
+		if tag == nil {
+			return fmt.Errorf("tag not found")
+		}
+		owner, err := tx.HGet(ctx, namesKey, name).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if err == nil && owner != tagID {
+			return models.ErrNameConflict
+		}
+
+		oldName := tag.Name
+		tag.Name = name
+		data, err := json.Marshal(tag)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HDel(ctx, namesKey, oldName)
+			pipe.HSet(ctx, namesKey, name, tagID)
+			pipe.Set(ctx, key, data, 0)
+			return nil
+		})
+		return err
+	}, key, namesKey)
+	if err == nil && r.logger != nil {
+		r.logger.Info("标签 %s 重命名为 %s", tagID, name)
+	}
+	return err
+}
+
+// Delete 删除标签及其全部会话关联
+func (r *TagStore) Delete(tagID string) error {
+	ctx := context.Background()
+	key := TagKeyPrefix + tagID
+	convsKey := TagConversationsPrefix + tagID
+
+	err := watchTx(ctx, r.client, func(tx *redis.Tx) error {
+		tag, err := readTag(ctx, tx, tagID)
+		if err != nil || tag == nil {
+			return err
+		}
+		convIDs, err := tx.SMembers(ctx, convsKey).Result()
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, convID := range convIDs {
+				pipe.SRem(ctx, ConversationTagsPrefix+convID, tagID)
+			}
+			pipe.Del(ctx, key, convsKey)
+			pipe.HDel(ctx, TagNamesPrefix+ownerKey(tag.TenantID, tag.UserID), tag.Name)
+			return nil
+		})
+		return err
+	}, key, convsKey)
+	if err == nil && r.logger != nil {
+		r.logger.Info("标签 %s 删除成功", tagID)
+	}
+	return err
+}
+
+// AddToConversation 为会话添加标签
+func (r *TagStore) AddToConversation(convID, tagID string) error {
+	ctx := context.Background()
+	key := TagKeyPrefix + tagID
+
+	return watchTx(ctx, r.client, func(tx *redis.Tx) error {
+		tag, err := readTag(ctx, tx, tagID)
+		if err != nil {
+			return err
+		}
+		if tag == nil {
+			return fmt.Errorf("tag not found")
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.SAdd(ctx, TagConversationsPrefix+tagID, convID)
+			pipe.SAdd(ctx, ConversationTagsPrefix+convID, tagID)
+			return nil
+		})
+		return err
+	}, key)
+}
+
+// RemoveFromConversation 移除会话的标签
+func (r *TagStore) RemoveFromConversation(convID, tagID string) error {
+	ctx := context.Background()
+
+	pipe := r.client.TxPipeline()
+	pipe.SRem(ctx, TagConversationsPrefix+tagID, convID)
+	pipe.SRem(ctx, ConversationTagsPrefix+convID, tagID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// ListByConversation 获取会话的全部标签
+func (r *TagStore) ListByConversation(convID string) ([]*models.Tag, error) {
+	ctx := context.Background()
+
+	tagIDs, err := r.client.SMembers(ctx, ConversationTagsPrefix+convID).Result()
+	if err != nil {
+		r.logError("获取会话标签失败: %v", err)
+		return nil, err
+	}
+	return readTags(ctx, r.client, tagIDs)
+}
+
+// ListConversations 按更新时间降序获取带有标签的会话
+func (r *TagStore) ListConversations(tagID string, offset, limit int) ([]*models.Conversation, error) {
+	ctx := context.Background()
+
+	convIDs, err := r.client.SMembers(ctx, TagConversationsPrefix+tagID).Result()
+	if err != nil {
+		r.logError("获取标签会话列表失败: %v", err)
+		return nil, err
+	}
+	return pageConversations(ctx, r.client, convIDs, offset, limit)
+}
+
+// readTag 读取标签，不存在时返回nil
+func readTag(ctx context.Context, c redis.Cmdable, tagID string) (*models.Tag, error) {
+	data, err := c.Get(ctx, TagKeyPrefix+tagID).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var tag models.Tag
+	if err := json.Unmarshal(data, &tag); err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+// readTags 使用MGET批量读取标签并按名称排序，不存在的标签会被跳过
+func readTags(ctx context.Context, c redis.Cmdable, tagIDs []string) ([]*models.Tag, error) {
+	tags := make([]*models.Tag, 0, len(tagIDs))
+	if len(tagIDs) == 0 {
+		return tags, nil
+	}
+
+	keys := make([]string, len(tagIDs))
+	for i, tagID := range tagIDs {
+		keys[i] = TagKeyPrefix + tagID
+	}
+	values, err := c.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range values {
+		data, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var tag models.Tag
+		if err := json.Unmarshal([]byte(data), &tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, &tag)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return tags, nil
+}
+
+// pageConversations 读取会话，跳过回收站中的会话，按更新时间降序分页
+func pageConversations(ctx context.Context, c redis.Cmdable, convIDs []string, offset, limit int) ([]*models.Conversation, error) {
+	convs, err := readConversations(ctx, c, convIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	active := convs[:0]
+	for _, conv := range convs {
+		if conv.DeletedAt == 0 {
+			active = append(active, conv)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool {
+		if active[i].UpdatedAt != active[j].UpdatedAt {
+			return active[i].UpdatedAt > active[j].UpdatedAt
+		}
+		return active[i].ConvID > active[j].ConvID
+	})
+
+	if offset >= len(active) {
+		return []*models.Conversation{}, nil
+	}
+	end := len(active)
+	if limit > 0 && offset+limit < end {
+		end = offset + limit
+	}
+	return active[offset:end], nil
+}
+
+// logError 记录错误日志
+func (r *TagStore) logError(format string, args ...interface{}) {
+	if r.logger != nil {
+		r.logger.Error(format, args...)
+	}
+}
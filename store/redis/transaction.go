@@ -0,0 +1,405 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/hildam/eino-history/store/common/logger"
+	"github.com/hildam/eino-history/store/interfaces"
+)
+
+// UndoKeyPrefix 事务内被修改的字符串和列表键在首次写入前的副本，事务结束后删除
+// 副本带有过期时间，进程在事务中途退出时由 Redis 自动清理
+const UndoKeyPrefix = "tx:undo:"
+
+// undoKeyTTL 副本的过期时间
+const undoKeyTTL = time.Hour
+
+// undoKind 回滚记录的类型
+type undoKind int
+
+const (
+	undoWholeKey   undoKind = iota // 整个键的副本，用于字符串和列表等按实体划分的键
+	undoSetMember                  // 集合中的一个成员
+	undoZSetMember                 // 有序集合中的一个成员及其分数
+	undoHashField                  // 哈希中的一个字段及其值
+)
+
+// journaledCommands 事务内需要记录回滚信息的写命令及记录方式
+// 集合、有序集合和哈希按成员记录，全局的会话列表和检索索引只回滚本事务写入的成员，不覆盖并发写入
+// INCR 只用于生成关联ID，回滚时不恢复，避免与并发事务分配到相同的ID
+var journaledCommands = map[string]undoKind{
+	"del": undoWholeKey, "set": undoWholeKey, "rpush": undoWholeKey,
+	"sadd": undoSetMember, "srem": undoSetMember,
+	"zadd": undoZSetMember, "zrem": undoZSetMember,
+	"hset": undoHashField, "hdel": undoHashField,
+}
+
+// zaddOptions ZADD 命令中位于分数和成员之前的选项
+var zaddOptions = map[string]bool{"nx": true, "xx": true, "gt": true, "lt": true, "ch": true, "incr": true}
+
+// undoEntry 一条回滚记录，保存键或成员在事务首次写入前的状态
+type undoEntry struct {
+	kind    undoKind
+	key     string
+	member  string // 集合成员、有序集合成员或哈希字段，整个键的记录为空
+	existed bool
+	score   float64
+	value   string
+}
+
+// id 返回记录的去重标识
+func (e *undoEntry) id() string {
+	return fmt.Sprintf("%d\x00%s\x00%s", e.kind, e.key, e.member)
+}
+
+// txJournal 作为钩子挂在事务作用域的客户端上，写命令执行前记录涉及的键或成员的原状态，回滚时按相反顺序恢复
+// Redis 不提供跨命令的隔离，事务提交前其他客户端可以看到事务内的写入
+type txJournal struct {
+	client  *redis.Client // 未挂载钩子的客户端，用于读取原状态和恢复
+	id      string
+	mu      sync.Mutex
+	entries []*undoEntry          // 按记录顺序排列的回滚记录
+	seen    map[string]*undoEntry // 已记录的键和成员
+}
+
+// journalEntriesCtx 上下文中记录本次管道新增的回滚记录
+type journalEntriesCtx struct{}
+
+// newTxJournal 创建事务日志
+func newTxJournal(client *redis.Client) *txJournal {
+	return &txJournal{
+		client: client,
+		id:     uuid.NewString(),
+		seen:   make(map[string]*undoEntry),
+	}
+}
+
+// undoKey 返回键的副本键名
+func (j *txJournal) undoKey(key string) string {
+	return UndoKeyPrefix + j.id + ":" + key
+}
+
+// argString 将命令参数转换为字符串
+func argString(arg interface{}) string {
+	if b, ok := arg.([]byte); ok {
+		return string(b)
+	}
+	return fmt.Sprint(arg)
+}
+
+// journalTargets 返回写命令涉及的回滚记录，未读取原状态
+func journalTargets(cmd redis.Cmder) []*undoEntry {
+	name := strings.ToLower(cmd.Name())
+	kind, ok := journaledCommands[name]
+	args := cmd.Args()
+	if !ok || len(args) < 2 {
+		return nil
+	}
+	key := argString(args[1])
+
+	var members []interface{}
+	switch {
+	case name == "del":
+		targets := make([]*undoEntry, 0, len(args)-1)
+		for _, arg := range args[1:] {
+			targets = append(targets, &undoEntry{kind: undoWholeKey, key: argString(arg)})
+		}
+		return targets
+	case kind == undoWholeKey:
+		return []*undoEntry{{kind: undoWholeKey, key: key}}
+	case name == "zadd":
+		rest := args[2:]
+		for len(rest) > 0 {
+			if opt, ok := rest[0].(string); !ok || !zaddOptions[strings.ToLower(opt)] {
+				break
+			}
+			rest = rest[1:]
+		}
+		for i := 1; i < len(rest); i += 2 {
+			members = append(members, rest[i])
+		}
+	case name == "hset":
+		for i := 2; i < len(args); i += 2 {
+			members = append(members, args[i])
+		}
+	default:
+		members = args[2:]
+	}
+
+	targets := make([]*undoEntry, 0, len(members))
+	for _, member := range members {
+		targets = append(targets, &undoEntry{kind: kind, key: key, member: argString(member)})
+	}
+	return targets
+}
+
+// capture 为命令涉及的、尚未记录的键和成员读取原状态，整个键的记录用 COPY 保存副本，返回新增的记录
+func (j *txJournal) capture(ctx context.Context, cmds ...redis.Cmder) ([]*undoEntry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var fresh []*undoEntry
+	batch := make(map[string]bool)
+	for _, cmd := range cmds {
+		for _, entry := range journalTargets(cmd) {
+			id := entry.id()
+			if _, saved := j.seen[id]; saved || batch[id] {
+				continue
+			}
+			batch[id] = true
+			fresh = append(fresh, entry)
+		}
+	}
+	if len(fresh) == 0 {
+		return nil, nil
+	}
+
+	db := j.client.Options().DB
+	pipe := j.client.Pipeline()
+	reads := make([]redis.Cmder, len(fresh))
+	for i, entry := range fresh {
+		switch entry.kind {
+		case undoWholeKey:
+			reads[i] = pipe.Copy(ctx, entry.key, j.undoKey(entry.key), db, true)
+			pipe.Expire(ctx, j.undoKey(entry.key), undoKeyTTL)
+		case undoSetMember:
+			reads[i] = pipe.SIsMember(ctx, entry.key, entry.member)
+		case undoZSetMember:
+			reads[i] = pipe.ZScore(ctx, entry.key, entry.member)
+		case undoHashField:
+			reads[i] = pipe.HGet(ctx, entry.key, entry.member)
+		}
+	}
+	// 成员不存在时 ZSCORE 和 HGET 返回 redis.Nil，逐条检查
+	pipe.Exec(ctx)
+	for i, entry := range fresh {
+		if err := reads[i].Err(); err != nil && err != redis.Nil {
+			j.dropUndoKeys(ctx, fresh)
+			return nil, fmt.Errorf("保存事务回滚信息失败: %w", err)
+		}
+		switch cmd := reads[i].(type) {
+		case *redis.IntCmd:
+			entry.existed = cmd.Val() == 1
+		case *redis.BoolCmd:
+			entry.existed = cmd.Val()
+		case *redis.FloatCmd:
+			entry.existed = cmd.Err() == nil
+			entry.score = cmd.Val()
+		case *redis.StringCmd:
+			entry.existed = cmd.Err() == nil
+			entry.value = cmd.Val()
+		}
+	}
+	for _, entry := range fresh {
+		j.entries = append(j.entries, entry)
+		j.seen[entry.id()] = entry
+	}
+	return fresh, nil
+}
+
+// dropUndoKeys 删除记录对应的副本
+func (j *txJournal) dropUndoKeys(ctx context.Context, entries []*undoEntry) error {
+	var undoKeys []string
+	for _, entry := range entries {
+		if entry.kind == undoWholeKey {
+			undoKeys = append(undoKeys, j.undoKey(entry.key))
+		}
+	}
+	if len(undoKeys) == 0 {
+		return nil
+	}
+	return j.client.Del(ctx, undoKeys...).Err()
+}
+
+// forget 丢弃回滚记录，用于 WATCH 冲突后未执行的写入，重试时重新读取最新的状态
+func (j *txJournal) forget(ctx context.Context, entries []*undoEntry) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	drop := make(map[*undoEntry]bool, len(entries))
+	for _, entry := range entries {
+		drop[entry] = true
+		delete(j.seen, entry.id())
+	}
+	kept := j.entries[:0]
+	for _, entry := range j.entries {
+		if !drop[entry] {
+			kept = append(kept, entry)
+		}
+	}
+	j.entries = kept
+	j.dropUndoKeys(ctx, entries)
+}
+
+// rollback 在一个 MULTI 中按记录的相反顺序恢复原状态并删除副本
+// 集合、有序集合和哈希只恢复本事务写入过的成员，其他成员保持当前内容
+func (j *txJournal) rollback(ctx context.Context) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if len(j.entries) == 0 {
+		return nil
+	}
+
+	db := j.client.Options().DB
+	pipe := j.client.TxPipeline()
+	for i := len(j.entries) - 1; i >= 0; i-- {
+		entry := j.entries[i]
+		switch entry.kind {
+		case undoWholeKey:
+			if entry.existed {
+				pipe.Copy(ctx, j.undoKey(entry.key), entry.key, db, true)
+				// 副本的过期时间随复制带回，存储库的键都不过期
+				pipe.Persist(ctx, entry.key)
+			} else {
+				pipe.Del(ctx, entry.key)
+			}
+			pipe.Del(ctx, j.undoKey(entry.key))
+		case undoSetMember:
+			if entry.existed {
+				pipe.SAdd(ctx, entry.key, entry.member)
+			} else {
+				pipe.SRem(ctx, entry.key, entry.member)
+			}
+		case undoZSetMember:
+			if entry.existed {
+				pipe.ZAdd(ctx, entry.key, &redis.Z{Score: entry.score, Member: entry.member})
+			} else {
+				pipe.ZRem(ctx, entry.key, entry.member)
+			}
+		case undoHashField:
+			if entry.existed {
+				pipe.HSet(ctx, entry.key, entry.member, entry.value)
+			} else {
+				pipe.HDel(ctx, entry.key, entry.member)
+			}
+		}
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// discard 事务成功后删除全部副本
+func (j *txJournal) discard(ctx context.Context) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.dropUndoKeys(ctx, j.entries)
+}
+
+// BeforeProcess 实现 redis.Hook 接口，写命令执行前记录原状态
+func (j *txJournal) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	_, err := j.capture(ctx, cmd)
+	return ctx, err
+}
+
+// AfterProcess 实现 redis.Hook 接口
+func (j *txJournal) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	return nil
+}
+
+// BeforeProcessPipeline 实现 redis.Hook 接口，管道执行前为其中的写命令记录原状态
+func (j *txJournal) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	fresh, err := j.capture(ctx, cmds...)
+	if err != nil {
+		return ctx, err
+	}
+	return context.WithValue(ctx, journalEntriesCtx{}, fresh), nil
+}
+
+// AfterProcessPipeline 实现 redis.Hook 接口，WATCH 冲突导致管道未执行时丢弃本次新增的回滚记录
+func (j *txJournal) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	fresh, _ := ctx.Value(journalEntriesCtx{}).([]*undoEntry)
+	if len(fresh) == 0 {
+		return nil
+	}
+	for _, cmd := range cmds {
+		if cmd.Err() == redis.TxFailedErr {
+			j.forget(ctx, fresh)
+			break
+		}
+	}
+	return nil
+}
+
+// txStores 共用同一个事务日志的存储库
+type txStores struct {
+	messageRepo           *MessageStore
+	conversationRepo      *ConversationStore
+	attachmentRepo        *AttachmentStore
+	messageAttachmentRepo *MessageAttachmentStore
+}
+
+// newTxStores 创建使用事务作用域客户端的存储库
+func newTxStores(client *redis.Client, debug bool, logger *logger.Logger) *txStores {
+	s := &txStores{
+		messageRepo:           &MessageStore{client: client, debug: debug},
+		conversationRepo:      &ConversationStore{client: client, debug: debug},
+		attachmentRepo:        &AttachmentStore{client: client, debug: debug},
+		messageAttachmentRepo: &MessageAttachmentStore{client: client, debug: debug},
+	}
+	s.messageRepo.SetLogger(logger)
+	return s
+}
+
+// GetMessageStore 获取事务内的消息存储库
+func (s *txStores) GetMessageStore() interfaces.MessageStore {
+	return s.messageRepo
+}
+
+// GetConversationStore 获取事务内的对话存储库
+func (s *txStores) GetConversationStore() interfaces.ConversationStore {
+	return s.conversationRepo
+}
+
+// GetAttachmentStore 获取事务内的附件存储库
+func (s *txStores) GetAttachmentStore() interfaces.AttachmentStore {
+	return s.attachmentRepo
+}
+
+// GetMessageAttachmentStore 获取事务内的消息附件关联存储库
+func (s *txStores) GetMessageAttachmentStore() interfaces.MessageAttachmentStore {
+	return s.messageAttachmentRepo
+}
+
+// Transaction 以补偿方式执行事务：写命令执行前记录涉及的键或成员的原状态，fn 返回错误或发生 panic 时恢复
+// 字符串和列表用 COPY 保存整个键的副本；集合、有序集合和哈希只记录本事务写入的成员，回滚时不影响并发写入的其他成员
+// 每个存储库方法仍在自己的 WATCH/MULTI 事务中执行，事务结束前其他客户端可以看到中间状态；需要 Redis 6.2 及以上版本
+// 参数:
+//   - fn: 使用事务内存储库执行写入的函数
+//
+// 返回:
+//   - error: fn 返回的错误，或保存、恢复副本过程中发生的错误
+func (p *Provider) Transaction(fn func(tx interfaces.TxStores) error) (err error) {
+	ctx := context.Background()
+
+	journal := newTxJournal(p.client)
+	client := p.client.WithContext(ctx)
+	client.AddHook(journal)
+
+	defer func() {
+		if r := recover(); r != nil {
+			if rbErr := journal.rollback(ctx); rbErr != nil {
+				p.logger.Error("事务回滚失败: %v", rbErr)
+			}
+			panic(r)
+		}
+	}()
+
+	if err = fn(newTxStores(client, p.debug, p.logger)); err != nil {
+		if rbErr := journal.rollback(ctx); rbErr != nil {
+			p.logger.Error("事务回滚失败: %v", rbErr)
+			return fmt.Errorf("%w (回滚失败: %v)", err, rbErr)
+		}
+		p.logger.Error("事务已回滚: %v", err)
+		return err
+	}
+	if err := journal.discard(ctx); err != nil {
+		p.logger.Error("清理事务回滚副本失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/hildam/eino-history/model"
+)
+
+// 回收站的 key
+const (
+	// DeletedConversationsKey 回收站中会话的有序集合，分数为删除时间
+	DeletedConversationsKey = "conversations:deleted"
+	// DeletedMessagesKey 回收站中全部消息的有序集合，分数为删除时间，供清理任务扫描
+	DeletedMessagesKey = "messages:deleted"
+	// ConversationDeletedMessagesPrefix 会话在回收站中的消息有序集合，分数为删除时间
+	ConversationDeletedMessagesPrefix = "conversation:deleted_messages:"
+)
+
+// readMessages 使用MGET批量读取消息，不存在的消息会被跳过
+func readMessages(ctx context.Context, c redis.Cmdable, msgIDs []string) ([]*models.Message, error) {
+	msgs := make([]*models.Message, 0, len(msgIDs))
+	if len(msgIDs) == 0 {
+		return msgs, nil
+	}
+
+	keys := make([]string, len(msgIDs))
+	for i, msgID := range msgIDs {
+		keys[i] = MessageKeyPrefix + msgID
+	}
+	values, err := c.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range values {
+		data, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var msg models.Message
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, &msg)
+	}
+	return msgs, nil
+}
+
+// trashMessage 在事务中将已设置删除时间的消息从会话消息列表移入回收站
+func trashMessage(ctx context.Context, pipe redis.Pipeliner, msg *models.Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	z := &redis.Z{Score: float64(msg.DeletedAt), Member: msg.MsgID}
+	pipe.Set(ctx, MessageKeyPrefix+msg.MsgID, data, 0)
+	pipe.ZRem(ctx, ConversationMessagesPrefix+msg.ConversationID, msg.MsgID)
+	pipe.ZAdd(ctx, ConversationDeletedMessagesPrefix+msg.ConversationID, z)
+	pipe.ZAdd(ctx, DeletedMessagesKey, z)
+	return nil
+}
+
+// restoreMessage 在事务中将消息从回收站放回会话消息列表
+func restoreMessage(ctx context.Context, pipe redis.Pipeliner, msg *models.Message) error {
+	msg.DeletedAt = 0
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	pipe.Set(ctx, MessageKeyPrefix+msg.MsgID, data, 0)
+	pipe.ZAdd(ctx, ConversationMessagesPrefix+msg.ConversationID, &redis.Z{
+		Score:  float64(msg.OrderSeq),
+		Member: msg.MsgID,
+	})
+	pipe.ZRem(ctx, ConversationDeletedMessagesPrefix+msg.ConversationID, msg.MsgID)
+	pipe.ZRem(ctx, DeletedMessagesKey, msg.MsgID)
+	return nil
+}
+
+// trashConversation 在事务中将已设置删除时间的会话从列表索引移入回收站
+func trashConversation(ctx context.Context, pipe redis.Pipeliner, conv *models.Conversation) error {
+	data, err := json.Marshal(conv)
+	if err != nil {
+		return err
+	}
+	pipe.Set(ctx, ConversationKeyPrefix+conv.ConvID, data, 0)
+	pipe.ZRem(ctx, ConversationsKey, conv.ConvID)
+	for _, key := range ownerIndexKeys(conv.TenantID, conv.UserID) {
+		pipe.ZRem(ctx, key, conv.ConvID)
+	}
+	pipe.ZAdd(ctx, DeletedConversationsKey, &redis.Z{Score: float64(conv.DeletedAt), Member: conv.ConvID})
+	return nil
+}
+
+// purgeMessage 在事务中永久删除消息及其附件关联和历史修订，关联记录需事先读取
+func purgeMessage(ctx context.Context, pipe redis.Pipeliner, msg *models.Message, links []*models.MessageAttachment) {
+	for _, link := range links {
+		id := strconv.FormatUint(link.ID, 10)
+		pipe.Del(ctx, MessageAttachmentPrefix+id)
+		pipe.SRem(ctx, MessageAttachmentsKey+link.AttachmentID, id)
+	}
+	pipe.Del(ctx, MessageAttachmentsKey+msg.MsgID)
+	pipe.Del(ctx, MessageRevisionsPrefix+msg.MsgID)
+	pipe.Del(ctx, MessageKeyPrefix+msg.MsgID)
+	pipe.ZRem(ctx, ConversationMessagesPrefix+msg.ConversationID, msg.MsgID)
+	pipe.ZRem(ctx, ConversationDeletedMessagesPrefix+msg.ConversationID, msg.MsgID)
+	pipe.ZRem(ctx, DeletedMessagesKey, msg.MsgID)
+}
+
+// readMessageLinks 读取消息的全部附件关联
+func readMessageLinks(ctx context.Context, c redis.Cmdable, msgID string) ([]*models.MessageAttachment, error) {
+	ids, err := c.SMembers(ctx, MessageAttachmentsKey+msgID).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var links []*models.MessageAttachment
+	for _, id := range ids {
+		data, err := c.Get(ctx, MessageAttachmentPrefix+id).Bytes()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var link models.MessageAttachment
+		if err := json.Unmarshal(data, &link); err != nil {
+			return nil, err
+		}
+		links = append(links, &link)
+	}
+	return links, nil
+}
+
+// deletedRange 返回删除时间早于 before 的分数范围，before 为0时不限制
+func deletedRange(before int64) *redis.ZRangeBy {
+	by := &redis.ZRangeBy{Min: "-inf", Max: "+inf"}
+	if before > 0 {
+		by.Max = fmt.Sprintf("(%d", before)
+	}
+	return by
+}